@@ -0,0 +1,66 @@
+// Command event-sink is a local stand-in for the services that consume outbox events.
+// It accepts the events posted by the HTTP sink, logs them, and acknowledges duplicates without logging them
+// again. Set EVENT_SINK_FAIL_RATE to a value between 0 and 1 to reject that share of requests and watch the
+// dispatcher retry them.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+func main() {
+	logger.SetupLoggerAuto("", "")
+
+	addr := flag.String("addr", ":8090", "address to listen on")
+	flag.Parse()
+
+	failRate, _ := strconv.ParseFloat(os.Getenv("EVENT_SINK_FAIL_RATE"), 64)
+
+	var mux sync.Mutex
+	seen := make(map[uuid.UUID]bool)
+
+	http.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var event model.OutboxEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if rand.Float64() < failRate {
+			logger.Warn("rejecting event %s", event.ID)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		mux.Lock()
+		duplicate := seen[event.ID]
+		seen[event.ID] = true
+		mux.Unlock()
+
+		if duplicate {
+			logger.Debug("duplicate event %s", event.ID)
+		} else {
+			logger.Info("#%d %s on %s %s: %s", event.Sequence, event.EventType, event.AggregateType, event.AggregateID, event.Payload)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	logger.Info("Event sink listening on %s", *addr)
+	logger.Fatal("%s", http.ListenAndServe(*addr, nil))
+}
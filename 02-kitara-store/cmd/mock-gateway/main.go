@@ -0,0 +1,51 @@
+// Command mock-gateway is a local stand-in for the payment gateway the store charges orders through.
+// MOCK_GATEWAY_BEHAVIOUR selects whether charges are approved, declined or time out: "approve" (the default),
+// "decline" or "timeout". A timed out charge is answered only after MOCK_GATEWAY_DELAY and approved then. The
+// outcome of every charge is posted to MOCK_GATEWAY_CALLBACK_URL, repeated MOCK_GATEWAY_DUPLICATES more times to
+// exercise webhook idempotency. Succeeded charges can be refunded.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+func main() {
+	logger.SetupLoggerAuto("", "")
+
+	addr := flag.String("addr", ":8091", "address to listen on")
+	flag.Parse()
+
+	behaviour := os.Getenv("MOCK_GATEWAY_BEHAVIOUR")
+	switch behaviour {
+	case "":
+		behaviour = service.MockGatewayApprove
+	case service.MockGatewayApprove, service.MockGatewayDecline, service.MockGatewayTimeout:
+	default:
+		logger.Fatal("Unknown mock gateway behaviour: %s", behaviour)
+	}
+
+	delay, err := time.ParseDuration(os.Getenv("MOCK_GATEWAY_DELAY"))
+	if err != nil {
+		delay = 10 * time.Second
+	}
+
+	callbackURL := os.Getenv("MOCK_GATEWAY_CALLBACK_URL")
+	if callbackURL == "" {
+		callbackURL = "http://localhost:8080/payments/webhook"
+	}
+
+	duplicates, _ := strconv.Atoi(os.Getenv("MOCK_GATEWAY_DUPLICATES"))
+
+	gateway := service.NewMockPaymentGateway(behaviour, delay, duplicates)
+	gateway.SetCallbackURL(callbackURL)
+
+	logger.Info("Mock payment gateway listening on %s, set to %s", *addr, behaviour)
+	logger.Fatal("%s", http.ListenAndServe(*addr, gateway))
+}
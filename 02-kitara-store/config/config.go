@@ -9,6 +9,41 @@ import (
 	"github.com/kerti/evm/02-kitara-store/util/logger"
 )
 
+const (
+	// DBBackendMySQL keeps the data of the store in MySQL
+	DBBackendMySQL = "mysql"
+	// DBBackendMemory keeps the data of the store in memory, for local development and tests. Nothing survives a
+	// restart and replicas do not share anything.
+	DBBackendMemory = "memory"
+)
+
+const (
+	// ProcessStrategyMutex serializes order processing with a mutex local to the running instance
+	ProcessStrategyMutex = "mutex"
+	// ProcessStrategyRowLock locks the affected order and inventory rows in the database
+	ProcessStrategyRowLock = "rowlock"
+	// ProcessStrategyOptimistic relies on versioned conditional updates and retries on conflict
+	ProcessStrategyOptimistic = "optimistic"
+)
+
+const (
+	// AllocationStrategySingle fills a whole order from the highest priority warehouse that can fill all of it
+	AllocationStrategySingle = "single"
+	// AllocationStrategyPriority fills each order item from the highest priority warehouse that can fill the item
+	AllocationStrategyPriority = "priority"
+	// AllocationStrategySplit fills each order item from as many warehouses as needed, in priority order
+	AllocationStrategySplit = "split"
+)
+
+const (
+	// OutboxSinkLog publishes outbox events to the application log
+	OutboxSinkLog = "log"
+	// OutboxSinkHTTP publishes outbox events by posting them to an HTTP endpoint
+	OutboxSinkHTTP = "http"
+	// OutboxSinkMemory keeps published outbox events in memory, for tests
+	OutboxSinkMemory = "memory"
+)
+
 var (
 	appName = "EVM Machine Gun"
 	conf    Config
@@ -17,7 +52,14 @@ var (
 
 // Config is the configuration struct
 type Config struct {
+	Cart struct {
+		HoldTTL            time.Duration `envconfig:"CART_HOLD_TTL" default:"15m"`
+		HoldSweepEnabled   bool          `envconfig:"CART_HOLD_SWEEP_ENABLED" default:"true"`
+		HoldSweepInterval  time.Duration `envconfig:"CART_HOLD_SWEEP_INTERVAL" default:"30s"`
+		HoldSweepBatchSize int           `envconfig:"CART_HOLD_SWEEP_BATCH_SIZE" default:"100"`
+	}
 	DB struct {
+		Backend   string `envconfig:"DB_BACKEND" default:"mysql"`
 		Host      string `envconfig:"DB_HOST"`
 		Port      int    `envconfig:"DB_PORT"`
 		User      string `envconfig:"DB_USER"`
@@ -25,6 +67,62 @@ type Config struct {
 		Name      string `envconfig:"DB_NAME"`
 		ConnLimit int    `envconfig:"DB_CONN_LIMIT"`
 	}
+	FlashSale struct {
+		ProductIDs     []string      `envconfig:"FLASH_SALE_PRODUCT_IDS"`
+		ResyncInterval time.Duration `envconfig:"FLASH_SALE_RESYNC_INTERVAL" default:"5s"`
+	}
+	Idempotency struct {
+		TTL             time.Duration `envconfig:"IDEMPOTENCY_TTL" default:"24h"`
+		WaitTimeout     time.Duration `envconfig:"IDEMPOTENCY_WAIT_TIMEOUT" default:"5s"`
+		LockTimeout     time.Duration `envconfig:"IDEMPOTENCY_LOCK_TIMEOUT" default:"1m"`
+		CleanupInterval time.Duration `envconfig:"IDEMPOTENCY_CLEANUP_INTERVAL" default:"10m"`
+	}
+	Job struct {
+		Workers      int           `envconfig:"JOB_WORKERS" default:"4"`
+		PollInterval time.Duration `envconfig:"JOB_POLL_INTERVAL" default:"200ms"`
+		BatchSize    int           `envconfig:"JOB_BATCH_SIZE" default:"50"`
+		LeaseTimeout time.Duration `envconfig:"JOB_LEASE_TIMEOUT" default:"1m"`
+		MaxAttempts  int           `envconfig:"JOB_MAX_ATTEMPTS" default:"5"`
+	}
+	Inventory struct {
+		VelocityWindow  time.Duration `envconfig:"INVENTORY_VELOCITY_WINDOW" default:"168h"`
+		ReorderCoverage time.Duration `envconfig:"INVENTORY_REORDER_COVERAGE" default:"336h"`
+	}
+	Order struct {
+		AllocationStrategy     string        `envconfig:"ORDER_ALLOCATION_STRATEGY" default:"priority"`
+		BatchConcurrency       int           `envconfig:"ORDER_BATCH_CONCURRENCY" default:"4"`
+		BatchMaxSize           int           `envconfig:"ORDER_BATCH_MAX_SIZE" default:"100"`
+		CodePrefix             string        `envconfig:"ORDER_CODE_PREFIX" default:"EVM"`
+		CodeSequenceWidth      int           `envconfig:"ORDER_CODE_SEQUENCE_WIDTH" default:"5"`
+		CodeUnambiguous        bool          `envconfig:"ORDER_CODE_UNAMBIGUOUS" default:"false"`
+		ProcessAsync           bool          `envconfig:"ORDER_PROCESS_ASYNC" default:"false"`
+		ProcessStrategy        string        `envconfig:"ORDER_PROCESS_STRATEGY" default:"rowlock"`
+		ProcessMaxRetries      int           `envconfig:"ORDER_PROCESS_MAX_RETRIES" default:"5"`
+		ProcessRetryBackoff    time.Duration `envconfig:"ORDER_PROCESS_RETRY_BACKOFF" default:"10ms"`
+		ProcessRetryMaxBackoff time.Duration `envconfig:"ORDER_PROCESS_RETRY_MAX_BACKOFF" default:"100ms"`
+	}
+	Outbox struct {
+		DispatchEnabled  bool          `envconfig:"OUTBOX_DISPATCH_ENABLED" default:"true"`
+		DispatchInterval time.Duration `envconfig:"OUTBOX_DISPATCH_INTERVAL" default:"1s"`
+		BatchSize        int           `envconfig:"OUTBOX_BATCH_SIZE" default:"100"`
+		Sink             string        `envconfig:"OUTBOX_SINK" default:"log"`
+		HTTPURL          string        `envconfig:"OUTBOX_HTTP_URL" default:"http://localhost:8090/events"`
+		HTTPTimeout      time.Duration `envconfig:"OUTBOX_HTTP_TIMEOUT" default:"5s"`
+	}
+	Payment struct {
+		GatewayURL     string        `envconfig:"PAYMENT_GATEWAY_URL" default:"http://localhost:8091"`
+		GatewayTimeout time.Duration `envconfig:"PAYMENT_GATEWAY_TIMEOUT" default:"5s"`
+		PendingTimeout time.Duration `envconfig:"PAYMENT_PENDING_TIMEOUT" default:"15m"`
+		SweepEnabled   bool          `envconfig:"PAYMENT_SWEEP_ENABLED" default:"true"`
+		SweepInterval  time.Duration `envconfig:"PAYMENT_SWEEP_INTERVAL" default:"1m"`
+		SweepBatchSize int           `envconfig:"PAYMENT_SWEEP_BATCH_SIZE" default:"100"`
+	}
+	Reservation struct {
+		TTL            time.Duration `envconfig:"RESERVATION_TTL" default:"30m"`
+		SweepEnabled   bool          `envconfig:"RESERVATION_SWEEP_ENABLED" default:"true"`
+		SweepInterval  time.Duration `envconfig:"RESERVATION_SWEEP_INTERVAL" default:"1m"`
+		SweepBatchSize int           `envconfig:"RESERVATION_SWEEP_BATCH_SIZE" default:"100"`
+	}
 	Server struct {
 		Port           int           `envconfig:"SERVER_PORT" default:"8080"`
 		ShutdownPeriod time.Duration `envconfig:"SERVER_SHUTDOWN_PERIOD" default:"5s"`
@@ -38,6 +136,35 @@ func Get() *Config {
 		if err != nil {
 			logger.Fatal("Failed to load config: ", err)
 		}
+		switch conf.DB.Backend {
+		case DBBackendMySQL, DBBackendMemory:
+		default:
+			logger.Fatal("Unknown database backend: %s", conf.DB.Backend)
+		}
+		switch conf.Order.ProcessStrategy {
+		case ProcessStrategyMutex, ProcessStrategyRowLock, ProcessStrategyOptimistic:
+		default:
+			logger.Fatal("Unknown order process strategy: %s", conf.Order.ProcessStrategy)
+		}
+		switch conf.Order.AllocationStrategy {
+		case AllocationStrategySingle, AllocationStrategyPriority, AllocationStrategySplit:
+		default:
+			logger.Fatal("Unknown order allocation strategy: %s", conf.Order.AllocationStrategy)
+		}
+		if conf.Order.BatchConcurrency < 1 {
+			logger.Fatal("Order batch concurrency must be at least 1: %d", conf.Order.BatchConcurrency)
+		}
+		if conf.Job.Workers < 1 {
+			logger.Fatal("Job workers must be at least 1: %d", conf.Job.Workers)
+		}
+		if conf.Job.MaxAttempts < 1 {
+			logger.Fatal("Job max attempts must be at least 1: %d", conf.Job.MaxAttempts)
+		}
+		switch conf.Outbox.Sink {
+		case OutboxSinkLog, OutboxSinkHTTP, OutboxSinkMemory:
+		default:
+			logger.Fatal("Unknown outbox sink: %s", conf.Outbox.Sink)
+		}
 		byteConfig, err := json.MarshalIndent(conf, "", "\t")
 		if err != nil {
 			logger.Fatal("Failed to marshal config: ", err)
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Memory is the database for in-memory repositories. It holds no data itself and only runs transaction blocks,
+// leaving it to the repositories to undo their changes on rollback.
+type Memory struct{}
+
+// Startup perform startup functions
+func (m *Memory) Startup() {
+	logger.Trace("In-memory database starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (m *Memory) Shutdown() {
+	logger.Trace("In-memory database shutting down...")
+}
+
+// WithTransaction performs changes with transaction
+func (m *Memory) WithTransaction(block Block) (err error) {
+	e := make(chan error)
+	tx := &Tx{}
+	go block(tx, e)
+	err = <-e
+	tx.end(err == nil)
+	return
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
 
 	// required MySQL import
@@ -10,9 +11,6 @@ import (
 	"github.com/kerti/evm/02-kitara-store/util/logger"
 )
 
-// Block contains a transaction block
-type Block func(db *sqlx.Tx, c chan error)
-
 // MySQL is the MySQL database class
 type MySQL struct {
 	Config *config.Config
@@ -46,21 +44,24 @@ func (m *MySQL) Shutdown() {
 }
 
 // WithTransaction performs queries with transaction
-func (m *MySQL) WithTransaction(db *MySQL, block Block) (err error) {
+func (m *MySQL) WithTransaction(block Block) (err error) {
 	e := make(chan error)
-	tx, err := m.DB.Beginx()
+	sqlTx, err := m.DB.Beginx()
 	if err != nil {
 		return
 	}
+	tx := &Tx{Tx: sqlTx}
 	go block(tx, e)
 	err = <-e
 	if err != nil {
 		if errTx := tx.Rollback(); errTx != nil {
 			err = fmt.Errorf("Rolling %s FAIL: %v", err.Error(), errTx)
 		}
+		tx.end(false)
 		return
 	}
 	err = tx.Commit()
+	tx.end(err == nil)
 	return
 }
 
@@ -74,6 +75,11 @@ func (m *MySQL) Select(dest interface{}, query string, args ...interface{}) (err
 	return m.DB.Select(dest, query, args...)
 }
 
+// Exec executes a query without returning any rows
+func (m *MySQL) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return m.DB.Exec(query, args...)
+}
+
 // In performs queries with IN clause
 func (m *MySQL) In(query string, params ...interface{}) (string, []interface{}, error) {
 	return sqlx.In(query, params...)
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// Block contains a transaction block
+type Block func(tx *Tx, c chan error)
+
+// Transactor is the interface of databases that can run a transaction block
+type Transactor interface {
+	WithTransaction(block Block) error
+}
+
+// Tx is a transaction that repositories take part in. Repositories backed by MySQL run their queries on the
+// embedded SQL transaction. In-memory repositories change their data right away and register how to undo the
+// changes in case the transaction is rolled back, along with the row locks to release when it ends.
+type Tx struct {
+	*sqlx.Tx
+	undos []func()
+	ends  []func()
+}
+
+// OnRollback registers a function that undoes a change if the transaction is rolled back.
+// Undo functions run in the reverse order of their registration.
+func (t *Tx) OnRollback(undo func()) {
+	t.undos = append(t.undos, undo)
+}
+
+// OnEnd registers a function that runs once the transaction has been committed or rolled back.
+// End functions run in the reverse order of their registration.
+func (t *Tx) OnEnd(f func()) {
+	t.ends = append(t.ends, f)
+}
+
+func (t *Tx) end(committed bool) {
+	if !committed {
+		for idx := len(t.undos) - 1; idx >= 0; idx-- {
+			t.undos[idx]()
+		}
+	}
+	for idx := len(t.ends) - 1; idx >= 0; idx-- {
+		t.ends[idx]()
+	}
+}
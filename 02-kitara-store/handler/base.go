@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kerti/evm/02-kitara-store/handler/response"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+// maxPageSize is the largest page any listing serves at once
+const maxPageSize = 100
+
+func getIDFromRequest(w http.ResponseWriter, r *http.Request) (id uuid.UUID, err error) {
+	vars := mux.Vars(r)
+
+	id, err = uuid.FromString(vars["id"])
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+	}
+
+	return
+}
+
+func getPageFromRequest(w http.ResponseWriter, r *http.Request) (pageNum int, pageSize int, err error) {
+	pageNumStr, withPageNum := r.URL.Query()["page"]
+	pageSizeStr, withPageSize := r.URL.Query()["pageSize"]
+
+	pageNum = 1
+	if withPageNum && len(pageNumStr[0]) > 0 {
+		pageNum, err = strconv.Atoi(pageNumStr[0])
+		if err != nil {
+			response.RespondWithError(w, failure.BadRequest(err))
+			return
+		}
+	}
+
+	if pageNum <= 0 {
+		err = failure.BadRequestFromString("page must be positive integer")
+		response.RespondWithError(w, err)
+		return
+	}
+
+	pageSize = 10
+	if withPageSize && len(pageSizeStr[0]) > 0 {
+		pageSize, err = strconv.Atoi(pageSizeStr[0])
+		if err != nil {
+			response.RespondWithError(w, failure.BadRequest(err))
+			return
+		}
+	}
+
+	if pageSize <= 0 {
+		err = failure.BadRequestFromString("page size must be positive integer")
+		response.RespondWithError(w, err)
+		return
+	}
+
+	if pageSize > maxPageSize {
+		err = failure.BadRequestFromString(fmt.Sprintf("page size must not be larger than %d", maxPageSize))
+		response.RespondWithError(w, err)
+		return
+	}
+
+	return
+}
+
+func getTimeFromQuery(w http.ResponseWriter, r *http.Request, key string) (t *time.Time, err error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequestFromString(fmt.Sprintf("%s must be an RFC 3339 timestamp", key)))
+		return
+	}
+
+	return &parsed, nil
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kerti/evm/02-kitara-store/handler/response"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Cart is the handler interface for Carts
+type Cart interface {
+	Startup()
+	Shutdown()
+	HandleCreate(w http.ResponseWriter, r *http.Request)
+	HandleResolveByID(w http.ResponseWriter, r *http.Request)
+	HandleAddLine(w http.ResponseWriter, r *http.Request)
+	HandleRemoveLine(w http.ResponseWriter, r *http.Request)
+	HandleCheckout(w http.ResponseWriter, r *http.Request)
+}
+
+// CartImpl is the handler implementation for Carts
+type CartImpl struct {
+	Service service.Cart `inject:"cartService"`
+}
+
+// Startup performs startup functions
+func (h *CartImpl) Startup() {
+	logger.Trace("Cart Handler starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (h *CartImpl) Shutdown() {
+	logger.Trace("Cart Handler shutting down...")
+}
+
+// HandleCreate handles the request. The body may be left out, creating a Cart without a customer reference.
+func (h *CartImpl) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var input model.CartInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil && err != io.EOF {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	cart, err := h.Service.Create(input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusCreated, cart)
+}
+
+// HandleResolveByID handles the request
+func (h *CartImpl) HandleResolveByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	cart, err := h.Service.ResolveByID(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, cart)
+}
+
+// HandleAddLine handles the request
+func (h *CartImpl) HandleAddLine(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	var input model.CartLineInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	cart, err := h.Service.AddLine(id, input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, cart)
+}
+
+// HandleRemoveLine handles the request
+func (h *CartImpl) HandleRemoveLine(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	lineID, err := uuid.FromString(mux.Vars(r)["lineId"])
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	cart, err := h.Service.RemoveLine(id, lineID)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, cart)
+}
+
+// HandleCheckout handles the request. The body may be left out when no vouchers are used.
+func (h *CartImpl) HandleCheckout(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	var input model.CartCheckoutInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil && err != io.EOF {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	order, err := h.Service.Checkout(id, input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusCreated, order)
+}
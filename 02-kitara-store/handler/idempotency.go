@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/kerti/evm/02-kitara-store/handler/response"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying a client-supplied Idempotency Key
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is the response header set when a stored response is replayed
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency is the handler interface for Idempotency Keys
+type Idempotency interface {
+	Startup()
+	Shutdown()
+	Wrap(next http.HandlerFunc) http.HandlerFunc
+}
+
+// IdempotencyImpl is the handler implementation for Idempotency Keys
+type IdempotencyImpl struct {
+	Service service.Idempotency `inject:"idempotencyService"`
+}
+
+// Startup performs startup functions
+func (h *IdempotencyImpl) Startup() {
+	logger.Trace("Idempotency Handler starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (h *IdempotencyImpl) Shutdown() {
+	logger.Trace("Idempotency Handler shutting down...")
+}
+
+// Wrap makes a handler idempotent for requests carrying an Idempotency-Key header. The first response for a key
+// is stored and replayed byte-for-byte, with its original Content-Type, for later requests with the same key and
+// body. Server errors are not stored, so the request can be retried with the same key.
+func (h *IdempotencyImpl) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			response.RespondWithError(w, failure.BadRequestFromString("Idempotency-Key must not be longer than 255 characters"))
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			response.RespondWithError(w, failure.BadRequest(err))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		idempotencyKey, err := h.Service.Begin(key, hashRequest(r, body))
+		if err != nil {
+			response.RespondWithError(w, err)
+			return
+		}
+
+		if idempotencyKey.Status == model.IdempotencyStatusCompleted {
+			if idempotencyKey.ResponseContentType != "" {
+				w.Header().Set("Content-Type", idempotencyKey.ResponseContentType)
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(idempotencyKey.ResponseCode)
+			w.Write(idempotencyKey.ResponseBody)
+			return
+		}
+
+		recorder := &recordingResponseWriter{ResponseWriter: w, code: http.StatusOK}
+		next(recorder, r)
+
+		if recorder.code >= http.StatusInternalServerError {
+			err = h.Service.Abandon(*idempotencyKey)
+		} else {
+			err = h.Service.Complete(*idempotencyKey, recorder.code, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		}
+		if err != nil {
+			logger.ErrNoStack("failed storing outcome of idempotency key %s: %v", key, err)
+		}
+	}
+}
+
+// hashRequest hashes the parts of a request that must match for a stored response to be replayed
+func hashRequest(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingResponseWriter passes a response through while keeping a copy of its status code and body
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	rw.code = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
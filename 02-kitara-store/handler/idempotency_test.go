@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/model"
+)
+
+type stubIdempotencyService struct {
+	keys map[string]model.IdempotencyKey
+}
+
+func (s *stubIdempotencyService) Startup()  {}
+func (s *stubIdempotencyService) Shutdown() {}
+
+func (s *stubIdempotencyService) Begin(key string, requestHash string) (*model.IdempotencyKey, error) {
+	if existing, ok := s.keys[key]; ok {
+		return &existing, nil
+	}
+	claimed := model.NewIdempotencyKey(key, requestHash, time.Hour)
+	s.keys[key] = claimed
+	return &claimed, nil
+}
+
+func (s *stubIdempotencyService) Complete(key model.IdempotencyKey, responseCode int, contentType string, responseBody []byte) error {
+	key.Status = model.IdempotencyStatusCompleted
+	key.ResponseCode = responseCode
+	key.ResponseContentType = contentType
+	key.ResponseBody = responseBody
+	s.keys[key.Key] = key
+	return nil
+}
+
+func (s *stubIdempotencyService) Abandon(key model.IdempotencyKey) error {
+	delete(s.keys, key.Key)
+	return nil
+}
+
+func (s *stubIdempotencyService) Cleanup() int64 {
+	return 0
+}
+
+func TestIdempotencyWrap(t *testing.T) {
+
+	newRequest := func(key string) *http.Request {
+		req, err := http.NewRequest("POST", "/orders/process", strings.NewReader(`{"orderId":"5b27773a-efce-4e21-8474-2694ebdaa084"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		return req
+	}
+
+	t.Run("replaysStoredResponse", func(t *testing.T) {
+		calls := 0
+		wrapped := (&IdempotencyImpl{Service: &stubIdempotencyService{keys: map[string]model.IdempotencyKey{}}}).Wrap(
+			func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/vnd.kitara+json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"data":{"status":"processing"}}`))
+			})
+
+		first := httptest.NewRecorder()
+		wrapped.ServeHTTP(first, newRequest("retry-1"))
+		second := httptest.NewRecorder()
+		wrapped.ServeHTTP(second, newRequest("retry-1"))
+
+		if calls != 1 {
+			t.Errorf("handler was called %v times, want 1", calls)
+		}
+
+		if second.Code != first.Code || second.Body.String() != first.Body.String() {
+			t.Errorf("replayed response differs: got %v %v want %v %v", second.Code, second.Body.String(), first.Code, first.Body.String())
+		}
+
+		if contentType := second.Header().Get("Content-Type"); contentType != first.Header().Get("Content-Type") {
+			t.Errorf("replayed response has Content-Type %v want %v", contentType, first.Header().Get("Content-Type"))
+		}
+
+		if second.Header().Get(IdempotentReplayedHeader) != "true" {
+			t.Errorf("replayed response is missing the %v header", IdempotentReplayedHeader)
+		}
+	})
+
+	t.Run("doesNotStoreServerErrors", func(t *testing.T) {
+		calls := 0
+		wrapped := (&IdempotencyImpl{Service: &stubIdempotencyService{keys: map[string]model.IdempotencyKey{}}}).Wrap(
+			func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(http.StatusInternalServerError)
+			})
+
+		wrapped.ServeHTTP(httptest.NewRecorder(), newRequest("retry-2"))
+		wrapped.ServeHTTP(httptest.NewRecorder(), newRequest("retry-2"))
+
+		if calls != 2 {
+			t.Errorf("handler was called %v times, want 2", calls)
+		}
+	})
+
+	t.Run("withoutKey", func(t *testing.T) {
+		calls := 0
+		wrapped := (&IdempotencyImpl{Service: &stubIdempotencyService{keys: map[string]model.IdempotencyKey{}}}).Wrap(
+			func(w http.ResponseWriter, r *http.Request) {
+				calls++
+			})
+
+		wrapped.ServeHTTP(httptest.NewRecorder(), newRequest(""))
+		wrapped.ServeHTTP(httptest.NewRecorder(), newRequest(""))
+
+		if calls != 2 {
+			t.Errorf("handler was called %v times, want 2", calls)
+		}
+	})
+
+}
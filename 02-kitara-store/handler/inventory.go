@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/handler/response"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Inventory is the handler interface for Inventories
+type Inventory interface {
+	Startup()
+	Shutdown()
+	HandleResolveMovementPage(w http.ResponseWriter, r *http.Request)
+	HandleResolveStock(w http.ResponseWriter, r *http.Request)
+	HandleResolveLowStock(w http.ResponseWriter, r *http.Request)
+	HandleRestock(w http.ResponseWriter, r *http.Request)
+	HandleAdjust(w http.ResponseWriter, r *http.Request)
+}
+
+// InventoryImpl is the handler implementation for Inventories
+type InventoryImpl struct {
+	Service service.Inventory `inject:"inventoryService"`
+}
+
+// Startup performs startup functions
+func (h *InventoryImpl) Startup() {
+	logger.Trace("Inventory Handler starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (h *InventoryImpl) Shutdown() {
+	logger.Trace("Inventory Handler shutting down...")
+}
+
+// HandleResolveMovementPage handles the request
+func (h *InventoryImpl) HandleResolveMovementPage(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	pageNum, pageSize, err := getPageFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := model.InventoryMovementFilter{
+		ProductID: id,
+		Page:      pageNum,
+		PageSize:  pageSize,
+	}
+
+	if warehouseID := query.Get("warehouseId"); warehouseID != "" {
+		filter.WarehouseID, err = uuid.FromString(warehouseID)
+		if err != nil {
+			response.RespondWithError(w, failure.BadRequest(err))
+			return
+		}
+	}
+
+	if filter.From, err = getTimeFromQuery(w, r, "from"); err != nil {
+		return
+	}
+
+	if filter.To, err = getTimeFromQuery(w, r, "to"); err != nil {
+		return
+	}
+
+	page, err := h.Service.ResolveMovementPage(filter)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, page)
+}
+
+// HandleResolveStock handles the request
+func (h *InventoryImpl) HandleResolveStock(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	asOf, err := getTimeFromQuery(w, r, "asOf")
+	if err != nil {
+		return
+	}
+
+	if asOf == nil {
+		now := time.Now()
+		asOf = &now
+	}
+
+	snapshot, err := h.Service.ResolveStockAsOf(id, *asOf)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, snapshot)
+}
+
+// HandleResolveLowStock handles the request
+func (h *InventoryImpl) HandleResolveLowStock(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Service.ResolveLowStock()
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, items)
+}
+
+// HandleRestock handles the request
+func (h *InventoryImpl) HandleRestock(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	var input model.InventoryRestockInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	inventory, err := h.Service.Restock(id, input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, inventory)
+}
+
+// HandleAdjust handles the request
+func (h *InventoryImpl) HandleAdjust(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	var input model.InventoryAdjustInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	inventory, err := h.Service.Adjust(id, input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, inventory)
+}
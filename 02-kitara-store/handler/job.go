@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kerti/evm/02-kitara-store/handler/response"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Job is the handler interface for Jobs
+type Job interface {
+	Startup()
+	Shutdown()
+	HandleResolveByID(w http.ResponseWriter, r *http.Request)
+}
+
+// JobImpl is the handler implementation for Jobs
+type JobImpl struct {
+	Service service.Job `inject:"jobService"`
+}
+
+// Startup performs startup functions
+func (h *JobImpl) Startup() {
+	logger.Trace("Job Handler starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (h *JobImpl) Shutdown() {
+	logger.Trace("Job Handler shutting down...")
+}
+
+// HandleResolveByID handles the request
+func (h *JobImpl) HandleResolveByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	job, err := h.Service.ResolveByID(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, job)
+}
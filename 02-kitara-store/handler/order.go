@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
 	"github.com/kerti/evm/02-kitara-store/handler/response"
 	"github.com/kerti/evm/02-kitara-store/model"
 
@@ -16,12 +18,20 @@ import (
 type Order interface {
 	Startup()
 	Shutdown()
+	HandleResolveByID(w http.ResponseWriter, r *http.Request)
+	HandleResolveByCode(w http.ResponseWriter, r *http.Request)
+	HandleResolvePage(w http.ResponseWriter, r *http.Request)
+	HandleCreateOrder(w http.ResponseWriter, r *http.Request)
 	HandleProcessOrder(w http.ResponseWriter, r *http.Request)
+	HandleProcessOrderBatch(w http.ResponseWriter, r *http.Request)
+	HandleCompleteOrder(w http.ResponseWriter, r *http.Request)
+	HandleCancelOrder(w http.ResponseWriter, r *http.Request)
 }
 
 // OrderImpl is the handler implementation for Orders
 type OrderImpl struct {
-	Service service.Order `inject:"orderService"`
+	Service    service.Order `inject:"orderService"`
+	JobService service.Job   `inject:"jobService"`
 }
 
 // Startup performs startup functions
@@ -34,7 +44,87 @@ func (h *OrderImpl) Shutdown() {
 	logger.Trace("Order Handler shutting down...")
 }
 
-// HandleProcessOrder handles the request
+// HandleResolveByID handles the request
+func (h *OrderImpl) HandleResolveByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	order, err := h.Service.ResolveByID(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, order)
+}
+
+// HandleResolveByCode handles the request
+func (h *OrderImpl) HandleResolveByCode(w http.ResponseWriter, r *http.Request) {
+	order, err := h.Service.ResolveByCode(mux.Vars(r)["code"])
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, order)
+}
+
+// HandleResolvePage handles the request
+func (h *OrderImpl) HandleResolvePage(w http.ResponseWriter, r *http.Request) {
+	pageNum, pageSize, err := getPageFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := model.OrderFilter{
+		Status:    query.Get("status"),
+		Code:      query.Get("code"),
+		SortBy:    query.Get("sortBy"),
+		SortOrder: query.Get("sortOrder"),
+		Page:      pageNum,
+		PageSize:  pageSize,
+	}
+
+	if productID := query.Get("productId"); productID != "" {
+		filter.ProductID, err = uuid.FromString(productID)
+		if err != nil {
+			response.RespondWithError(w, failure.BadRequest(err))
+			return
+		}
+	}
+
+	page, err := h.Service.ResolvePage(filter)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, page)
+}
+
+// HandleCreateOrder handles the request
+func (h *OrderImpl) HandleCreateOrder(w http.ResponseWriter, r *http.Request) {
+	var input model.OrderInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	order, err := h.Service.Create(input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusCreated, order)
+}
+
+// HandleProcessOrder handles the request. When orders are processed asynchronously, the order is queued to be
+// processed by a Job, which is returned right away.
 func (h *OrderImpl) HandleProcessOrder(w http.ResponseWriter, r *http.Request) {
 	var input model.OrderProcessInput
 	err := json.NewDecoder(r.Body).Decode(&input)
@@ -43,6 +133,17 @@ func (h *OrderImpl) HandleProcessOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.JobService.Enabled() {
+		job, err := h.JobService.EnqueueProcess(input)
+		if err != nil {
+			response.RespondWithError(w, err)
+			return
+		}
+
+		response.RespondWithJSON(w, http.StatusAccepted, job)
+		return
+	}
+
 	order, err := h.Service.Process(input)
 	if err != nil {
 		response.RespondWithError(w, err)
@@ -51,3 +152,53 @@ func (h *OrderImpl) HandleProcessOrder(w http.ResponseWriter, r *http.Request) {
 
 	response.RespondWithJSON(w, http.StatusOK, order)
 }
+
+// HandleProcessOrderBatch handles the request
+func (h *OrderImpl) HandleProcessOrderBatch(w http.ResponseWriter, r *http.Request) {
+	var input model.OrderBatchProcessInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	batch, err := h.Service.ProcessBatch(input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, batch)
+}
+
+// HandleCompleteOrder handles the request
+func (h *OrderImpl) HandleCompleteOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	order, err := h.Service.Complete(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, order)
+}
+
+// HandleCancelOrder handles the request
+func (h *OrderImpl) HandleCancelOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	order, err := h.Service.Cancel(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, order)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kerti/evm/02-kitara-store/handler/response"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Payment is the handler interface for Payments
+type Payment interface {
+	Startup()
+	Shutdown()
+	HandlePay(w http.ResponseWriter, r *http.Request)
+	HandleResolveByID(w http.ResponseWriter, r *http.Request)
+	HandleWebhook(w http.ResponseWriter, r *http.Request)
+}
+
+// PaymentImpl is the handler implementation for Payments
+type PaymentImpl struct {
+	Service service.Payment `inject:"paymentService"`
+}
+
+// Startup performs startup functions
+func (h *PaymentImpl) Startup() {
+	logger.Trace("Payment Handler starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (h *PaymentImpl) Shutdown() {
+	logger.Trace("Payment Handler shutting down...")
+}
+
+// HandlePay handles the request. A payment settled by the gateway right away is returned with 201 Created, whether
+// it succeeded or failed, and one left pending for the gateway's webhook with 202 Accepted.
+func (h *PaymentImpl) HandlePay(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	payment, err := h.Service.Pay(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	if !payment.IsSettled() {
+		response.RespondWithJSON(w, http.StatusAccepted, payment)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusCreated, payment)
+}
+
+// HandleResolveByID handles the request
+func (h *PaymentImpl) HandleResolveByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	payment, err := h.Service.ResolveByID(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, payment)
+}
+
+// HandleWebhook handles the callback the payment gateway sends with the outcome of a charge
+func (h *PaymentImpl) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	var charge model.PaymentCharge
+	err := json.NewDecoder(r.Body).Decode(&charge)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	payment, err := h.Service.HandleCharge(charge)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, payment)
+}
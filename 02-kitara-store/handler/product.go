@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kerti/evm/02-kitara-store/handler/response"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Product is the handler interface for Products
+type Product interface {
+	Startup()
+	Shutdown()
+	HandleResolveByID(w http.ResponseWriter, r *http.Request)
+	HandleResolvePage(w http.ResponseWriter, r *http.Request)
+	HandleCreate(w http.ResponseWriter, r *http.Request)
+	HandleUpdate(w http.ResponseWriter, r *http.Request)
+	HandleDelete(w http.ResponseWriter, r *http.Request)
+}
+
+// ProductImpl is the handler implementation for Products
+type ProductImpl struct {
+	Service service.Product `inject:"productService"`
+}
+
+// Startup performs startup functions
+func (h *ProductImpl) Startup() {
+	logger.Trace("Product Handler starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (h *ProductImpl) Shutdown() {
+	logger.Trace("Product Handler shutting down...")
+}
+
+// HandleResolveByID handles the request
+func (h *ProductImpl) HandleResolveByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	product, err := h.Service.ResolveByID(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, product)
+}
+
+// HandleResolvePage handles the request
+func (h *ProductImpl) HandleResolvePage(w http.ResponseWriter, r *http.Request) {
+	pageNum, pageSize, err := getPageFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	page, err := h.Service.ResolvePage(pageNum, pageSize)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, page)
+}
+
+// HandleCreate handles the request
+func (h *ProductImpl) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var input model.ProductInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	product, err := h.Service.Create(input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusCreated, product)
+}
+
+// HandleUpdate handles the request
+func (h *ProductImpl) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	var input model.ProductInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	product, err := h.Service.Update(id, input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, product)
+}
+
+// HandleDelete handles the request
+func (h *ProductImpl) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	err = h.Service.Delete(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithNoContent(w)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kerti/evm/02-kitara-store/handler/response"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Promotion is the handler interface for Promotions
+type Promotion interface {
+	Startup()
+	Shutdown()
+	HandleResolveByID(w http.ResponseWriter, r *http.Request)
+	HandleResolvePage(w http.ResponseWriter, r *http.Request)
+	HandleCreate(w http.ResponseWriter, r *http.Request)
+	HandleUpdate(w http.ResponseWriter, r *http.Request)
+}
+
+// PromotionImpl is the handler implementation for Promotions
+type PromotionImpl struct {
+	Service service.Promotion `inject:"promotionService"`
+}
+
+// Startup performs startup functions
+func (h *PromotionImpl) Startup() {
+	logger.Trace("Promotion Handler starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (h *PromotionImpl) Shutdown() {
+	logger.Trace("Promotion Handler shutting down...")
+}
+
+// HandleResolveByID handles the request
+func (h *PromotionImpl) HandleResolveByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	promotion, err := h.Service.ResolveByID(id)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, promotion)
+}
+
+// HandleResolvePage handles the request
+func (h *PromotionImpl) HandleResolvePage(w http.ResponseWriter, r *http.Request) {
+	pageNum, pageSize, err := getPageFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	page, err := h.Service.ResolvePage(pageNum, pageSize)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, page)
+}
+
+// HandleCreate handles the request
+func (h *PromotionImpl) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var input model.PromotionInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	promotion, err := h.Service.Create(input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusCreated, promotion)
+}
+
+// HandleUpdate handles the request
+func (h *PromotionImpl) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	var input model.PromotionInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		response.RespondWithError(w, failure.BadRequest(err))
+		return
+	}
+
+	promotion, err := h.Service.Update(id, input)
+	if err != nil {
+		response.RespondWithError(w, err)
+		return
+	}
+
+	response.RespondWithJSON(w, http.StatusOK, promotion)
+}
@@ -13,6 +13,12 @@ var failureStatusMap = map[failure.Code]int{
 	failure.CodeInternalError:         http.StatusInternalServerError,
 	failure.CodeUnimplemented:         http.StatusNotImplemented,
 	failure.CodeEntityNotFound:        http.StatusNotFound,
+	failure.CodeDuplicateEntity:       http.StatusConflict,
+	failure.CodeVersionConflict:       http.StatusConflict,
+	failure.CodeInsufficientStock:     http.StatusConflict,
+	failure.CodeSoldOut:               http.StatusConflict,
+	failure.CodePromotionExhausted:    http.StatusConflict,
+	failure.CodePurchaseLimitExceeded: http.StatusConflict,
 	failure.CodeOperationNotPermitted: http.StatusConflict,
 }
 
@@ -21,6 +27,7 @@ type BaseResponse struct {
 	Data    *interface{} `json:"data,omitempty"`
 	Error   *string      `json:"error,omitempty"`
 	Message *string      `json:"message,omitempty"`
+	Details *interface{} `json:"details,omitempty"`
 }
 
 // RespondWithNoContent sends a response without any content
@@ -46,7 +53,11 @@ func RespondWithError(w http.ResponseWriter, err error) {
 		status = http.StatusInternalServerError
 	}
 	errMsg := err.Error()
-	respond(w, status, BaseResponse{Error: &errMsg})
+	resp := BaseResponse{Error: &errMsg}
+	if details := failure.GetDetails(err); details != nil {
+		resp.Details = &details
+	}
+	respond(w, status, resp)
 }
 
 // RespondWithPreparingShutdown sends a default response for when the server is preparing to shut down
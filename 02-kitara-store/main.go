@@ -6,14 +6,9 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/kerti/evm/02-kitara-store/repository"
-	"github.com/kerti/evm/02-kitara-store/service"
-
 	"github.com/kerti/evm/02-kitara-store/config"
-	"github.com/kerti/evm/02-kitara-store/database"
-	"github.com/kerti/evm/02-kitara-store/handler"
 	"github.com/kerti/evm/02-kitara-store/inject"
-	"github.com/kerti/evm/02-kitara-store/server"
+	"github.com/kerti/evm/02-kitara-store/registry"
 	"github.com/kerti/evm/02-kitara-store/util/logger"
 )
 
@@ -27,24 +22,16 @@ func main() {
 	// Prepare containers
 	container := inject.NewContainer()
 
-	// Prepare containers - database
-	var db database.MySQL
-	container.RegisterService("mysql", &db)
-
-	// Prepare containers - repositories
-	container.RegisterService("inventoryRepository", new(repository.InventoryMySQLRepo))
-	container.RegisterService("orderRepository", new(repository.OrderMySQLRepo))
-
-	// Prepare containers - services
-	container.RegisterService("orderService", new(service.OrderImpl))
-
-	// Prepare containers - handlers
-	container.RegisterService("healthHandler", new(handler.HealthImpl))
-	container.RegisterService("orderHandler", new(handler.OrderImpl))
+	// Prepare containers - database and repositories
+	if config.Get().DB.Backend == config.DBBackendMemory {
+		logger.Info("Running on in-memory repositories. Nothing is kept across restarts.")
+		registry.NewMemoryRepositories().Register(container)
+	} else {
+		registry.RegisterMySQLRepositories(container)
+	}
 
-	// Prepare containers - HTTP server
-	var s server.Server
-	container.RegisterService("server", &s)
+	// Prepare containers - services, handlers and HTTP server
+	s := registry.RegisterApplication(container)
 
 	// call this after all dependencies are registered
 	if err := container.Ready(); err != nil {
@@ -63,7 +50,7 @@ func main() {
 // handle graceful shutdown
 func handleShutdown(container inject.ServiceContainer) {
 	config := config.Get()
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 	go func(ch chan os.Signal) {
 		<-ch
@@ -0,0 +1,2 @@
+ALTER TABLE `products`
+    ADD UNIQUE INDEX `products_sku_unique` (`sku`);
@@ -0,0 +1,5 @@
+ALTER TABLE `inventory`
+    ADD INDEX `inventory_product_entity_id` (`product_entity_id`);
+
+ALTER TABLE `order_items`
+    ADD INDEX `order_items_order_entity_id` (`order_entity_id`);
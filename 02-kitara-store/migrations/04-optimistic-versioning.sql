@@ -0,0 +1,5 @@
+ALTER TABLE `inventory`
+    ADD COLUMN `version` INT NOT NULL DEFAULT 0;
+
+ALTER TABLE `orders`
+    ADD COLUMN `version` INT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE `orders`
+    MODIFY COLUMN `status` ENUM('new', 'processing', 'completed', 'cancelled') NOT NULL DEFAULT 'new';
@@ -0,0 +1,4 @@
+ALTER TABLE `orders`
+    MODIFY COLUMN `status` ENUM('new', 'processing', 'completed', 'cancelled', 'expired') NOT NULL DEFAULT 'new',
+    ADD COLUMN `processed_at` DATETIME NULL,
+    ADD INDEX `orders_status_processed_at` (`status`, `processed_at`);
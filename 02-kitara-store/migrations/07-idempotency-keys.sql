@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `idempotency_keys` (
+    `idempotency_key` VARCHAR(255) NOT NULL,
+    `request_hash` CHAR(64) NOT NULL,
+    `status` ENUM('in_progress', 'completed') NOT NULL,
+    `response_code` INT NOT NULL DEFAULT 0,
+    `response_body` MEDIUMBLOB NULL,
+    `created_at` DATETIME NOT NULL,
+    `expires_at` DATETIME NOT NULL,
+    PRIMARY KEY (`idempotency_key`),
+    INDEX `idempotency_keys_expires_at` (`expires_at`)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE `orders`
+    ADD INDEX `orders_order_code` (`order_code`);
+
+ALTER TABLE `order_items`
+    ADD INDEX `order_items_product_entity_id` (`product_entity_id`);
@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS `warehouses` (
+    `entity_id` CHAR(36) NOT NULL,
+    `code` VARCHAR(20) NOT NULL,
+    `name` VARCHAR(255) NOT NULL,
+    `priority` INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (`entity_id`),
+    UNIQUE INDEX `warehouses_code` (`code`)
+);
+
+INSERT INTO `warehouses` (`entity_id`, `code`, `name`, `priority`)
+VALUES ('3eb2e602-1f5b-42b7-943a-eb03d46484b6', 'DEFAULT', 'Default Warehouse', 0);
+
+ALTER TABLE `inventory`
+    ADD COLUMN `warehouse_entity_id` CHAR(36) NOT NULL DEFAULT '3eb2e602-1f5b-42b7-943a-eb03d46484b6' AFTER `product_entity_id`;
+
+ALTER TABLE `inventory`
+    ALTER COLUMN `warehouse_entity_id` DROP DEFAULT,
+    ADD UNIQUE INDEX `inventory_product_entity_id_warehouse_entity_id` (`product_entity_id`, `warehouse_entity_id`);
+
+CREATE TABLE IF NOT EXISTS `order_item_allocations` (
+    `entity_id` CHAR(36) NOT NULL,
+    `order_entity_id` CHAR(36) NOT NULL,
+    `order_item_entity_id` CHAR(36) NOT NULL,
+    `product_entity_id` CHAR(36) NOT NULL,
+    `warehouse_entity_id` CHAR(36) NOT NULL,
+    `inventory_entity_id` CHAR(36) NOT NULL,
+    `qty` INT NOT NULL,
+    PRIMARY KEY (`entity_id`),
+    INDEX `order_item_allocations_order_entity_id` (`order_entity_id`)
+);
+
+-- Orders that are already processing hold their reservation in the default warehouse
+INSERT INTO `order_item_allocations` (
+    `entity_id`,
+    `order_entity_id`,
+    `order_item_entity_id`,
+    `product_entity_id`,
+    `warehouse_entity_id`,
+    `inventory_entity_id`,
+    `qty`)
+SELECT
+    UUID(),
+    `order_items`.`order_entity_id`,
+    `order_items`.`entity_id`,
+    `order_items`.`product_entity_id`,
+    `inventory`.`warehouse_entity_id`,
+    `inventory`.`entity_id`,
+    CAST(`order_items`.`qty` AS UNSIGNED)
+FROM `order_items`
+JOIN `orders` ON `orders`.`entity_id` = `order_items`.`order_entity_id`
+JOIN `inventory` ON `inventory`.`product_entity_id` = `order_items`.`product_entity_id`
+WHERE `orders`.`status` = 'processing';
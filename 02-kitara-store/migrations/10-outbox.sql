@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS `outbox` (
+    `sequence` BIGINT NOT NULL AUTO_INCREMENT,
+    `entity_id` CHAR(36) NOT NULL,
+    `aggregate_type` VARCHAR(50) NOT NULL,
+    `aggregate_id` CHAR(36) NOT NULL,
+    `event_type` VARCHAR(100) NOT NULL,
+    `payload` MEDIUMBLOB NOT NULL,
+    `created_at` DATETIME NOT NULL,
+    `published_at` DATETIME NULL,
+    `attempts` INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (`sequence`),
+    UNIQUE INDEX `outbox_entity_id` (`entity_id`),
+    INDEX `outbox_published_at_sequence` (`published_at`, `sequence`)
+);
+
+-- A single row that dispatchers lock so only one of them publishes at a time, keeping events in order
+CREATE TABLE IF NOT EXISTS `outbox_dispatch_lock` (
+    `name` VARCHAR(50) NOT NULL,
+    PRIMARY KEY (`name`)
+);
+
+INSERT INTO `outbox_dispatch_lock` (`name`) VALUES ('dispatcher');
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS `inventory_movements` (
+    `sequence` BIGINT NOT NULL AUTO_INCREMENT,
+    `entity_id` CHAR(36) NOT NULL,
+    `inventory_entity_id` CHAR(36) NOT NULL,
+    `product_entity_id` CHAR(36) NOT NULL,
+    `warehouse_entity_id` CHAR(36) NOT NULL,
+    `reason` ENUM('opening', 'reserve', 'release', 'ship', 'restock') NOT NULL,
+    `reference_id` CHAR(36) NULL,
+    `qty_in_store_delta` INT NOT NULL,
+    `qty_reserved_delta` INT NOT NULL,
+    `created_at` DATETIME(6) NOT NULL,
+    PRIMARY KEY (`sequence`),
+    UNIQUE INDEX `inventory_movements_entity_id` (`entity_id`),
+    INDEX `inventory_movements_product_entity_id_created_at` (`product_entity_id`, `created_at`)
+);
+
+-- Existing stock levels become the opening balance of every inventory
+INSERT INTO `inventory_movements` (
+    `entity_id`,
+    `inventory_entity_id`,
+    `product_entity_id`,
+    `warehouse_entity_id`,
+    `reason`,
+    `reference_id`,
+    `qty_in_store_delta`,
+    `qty_reserved_delta`,
+    `created_at`)
+SELECT
+    UUID(),
+    `inventory`.`entity_id`,
+    `inventory`.`product_entity_id`,
+    `inventory`.`warehouse_entity_id`,
+    'opening',
+    NULL,
+    `inventory`.`qty_in_store`,
+    `inventory`.`qty_reserved`,
+    UTC_TIMESTAMP(6)
+FROM `inventory`;
@@ -0,0 +1,7 @@
+ALTER TABLE `products`
+    ADD COLUMN `reorder_point` INT NOT NULL DEFAULT 0;
+
+ALTER TABLE `inventory_movements`
+    MODIFY COLUMN `reason` ENUM('opening', 'reserve', 'release', 'ship', 'restock', 'adjust') NOT NULL,
+    ADD COLUMN `note` VARCHAR(255) NOT NULL DEFAULT '' AFTER `reference_id`,
+    ADD INDEX `inventory_movements_reason_created_at` (`reason`, `created_at`);
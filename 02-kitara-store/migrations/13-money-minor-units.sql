@@ -0,0 +1,27 @@
+-- Prices become integer amounts in the minor unit of their currency. Existing prices are rupiah with two decimals.
+ALTER TABLE `products`
+    MODIFY COLUMN `price` DECIMAL(20,2) NOT NULL,
+    ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'IDR' AFTER `price`;
+
+UPDATE `products` SET `price` = `price` * 100;
+
+ALTER TABLE `products`
+    MODIFY COLUMN `price` BIGINT NOT NULL;
+
+ALTER TABLE `orders`
+    MODIFY COLUMN `total_price` DECIMAL(20,2) NOT NULL,
+    ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'IDR' AFTER `total_price`;
+
+UPDATE `orders` SET `total_price` = `total_price` * 100;
+
+ALTER TABLE `orders`
+    MODIFY COLUMN `total_price` BIGINT NOT NULL;
+
+ALTER TABLE `order_items`
+    MODIFY COLUMN `price` DECIMAL(20,2) NOT NULL,
+    ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'IDR' AFTER `price`;
+
+UPDATE `order_items` SET `price` = `price` * 100;
+
+ALTER TABLE `order_items`
+    MODIFY COLUMN `price` BIGINT NOT NULL;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS `promotions` (
+    `entity_id` CHAR(36) NOT NULL,
+    `code` VARCHAR(50) NULL,
+    `name` VARCHAR(255) NOT NULL,
+    `type` ENUM('percentage', 'fixed', 'buyXGetY') NOT NULL,
+    `percent_off` INT NOT NULL DEFAULT 0,
+    `amount_off` BIGINT NOT NULL DEFAULT 0,
+    `amount_off_currency` CHAR(3) NOT NULL DEFAULT '',
+    `buy_qty` INT NOT NULL DEFAULT 0,
+    `get_qty` INT NOT NULL DEFAULT 0,
+    `min_spend` BIGINT NOT NULL DEFAULT 0,
+    `min_spend_currency` CHAR(3) NOT NULL DEFAULT '',
+    `target_product_entity_id` CHAR(36) NULL,
+    `target_sku` VARCHAR(20) NOT NULL DEFAULT '',
+    `valid_from` DATETIME(6) NULL,
+    `valid_until` DATETIME(6) NULL,
+    `usage_cap` INT NULL,
+    `usage_count` INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (`entity_id`),
+    UNIQUE INDEX `promotions_code` (`code`)
+);
+
+CREATE TABLE IF NOT EXISTS `order_discounts` (
+    `entity_id` CHAR(36) NOT NULL,
+    `order_entity_id` CHAR(36) NOT NULL,
+    `promotion_entity_id` CHAR(36) NOT NULL,
+    `code` VARCHAR(50) NOT NULL DEFAULT '',
+    `name` VARCHAR(255) NOT NULL,
+    `amount` BIGINT NOT NULL,
+    `currency` CHAR(3) NOT NULL,
+    PRIMARY KEY (`entity_id`),
+    INDEX `order_discounts_order_entity_id` (`order_entity_id`)
+);
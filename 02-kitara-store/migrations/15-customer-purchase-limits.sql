@@ -0,0 +1,12 @@
+ALTER TABLE `orders`
+    ADD COLUMN `customer_ref` VARCHAR(64) NOT NULL DEFAULT '' AFTER `order_code`;
+
+ALTER TABLE `products`
+    ADD COLUMN `purchase_limit` INT NULL;
+
+CREATE TABLE IF NOT EXISTS `customer_purchases` (
+    `customer_ref` VARCHAR(64) NOT NULL,
+    `product_entity_id` CHAR(36) NOT NULL,
+    `qty` INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (`customer_ref`, `product_entity_id`)
+);
@@ -0,0 +1,18 @@
+UPDATE `orders`
+    JOIN (
+        SELECT DISTINCT duplicate.entity_id
+        FROM `orders` AS duplicate
+        JOIN `orders` AS original
+            ON original.order_code = duplicate.order_code AND original.entity_id < duplicate.entity_id
+    ) AS duplicates ON duplicates.entity_id = `orders`.entity_id
+SET `orders`.order_code = CONCAT(`orders`.order_code, '-', LEFT(`orders`.entity_id, 8));
+
+ALTER TABLE `orders`
+    DROP INDEX `orders_order_code`,
+    ADD UNIQUE INDEX `orders_order_code` (`order_code`);
+
+CREATE TABLE IF NOT EXISTS `order_code_sequences` (
+    `name` VARCHAR(32) NOT NULL,
+    `value` BIGINT NOT NULL,
+    PRIMARY KEY (`name`)
+);
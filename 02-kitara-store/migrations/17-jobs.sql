@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `jobs` (
+    `entity_id` CHAR(36) NOT NULL,
+    `type` VARCHAR(50) NOT NULL,
+    `order_entity_id` CHAR(36) NOT NULL,
+    `shard_key` CHAR(36) NOT NULL,
+    `status` ENUM('queued', 'running', 'succeeded', 'failed') NOT NULL,
+    `attempts` INT NOT NULL DEFAULT 0,
+    `result` MEDIUMTEXT NULL,
+    `failure` TEXT NULL,
+    `created_at` DATETIME NOT NULL,
+    `started_at` DATETIME NULL,
+    `lease_expires_at` DATETIME NULL,
+    `finished_at` DATETIME NULL,
+    PRIMARY KEY (`entity_id`),
+    INDEX `jobs_status_created_at` (`status`, `created_at`)
+);
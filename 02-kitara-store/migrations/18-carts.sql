@@ -0,0 +1,36 @@
+ALTER TABLE `inventory`
+    ADD COLUMN `qty_held` INT NOT NULL DEFAULT 0 AFTER `qty_reserved`;
+
+CREATE TABLE IF NOT EXISTS `carts` (
+    `entity_id` CHAR(36) NOT NULL,
+    `customer_ref` VARCHAR(64) NOT NULL DEFAULT '',
+    `status` ENUM('open', 'checkedOut') NOT NULL,
+    `order_entity_id` CHAR(36) NULL,
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+    `version` INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (`entity_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `cart_lines` (
+    `entity_id` CHAR(36) NOT NULL,
+    `cart_entity_id` CHAR(36) NOT NULL,
+    `product_entity_id` CHAR(36) NOT NULL,
+    `qty` INT NOT NULL,
+    `position` INT NOT NULL,
+    PRIMARY KEY (`entity_id`),
+    INDEX `cart_lines_cart` (`cart_entity_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `cart_holds` (
+    `entity_id` CHAR(36) NOT NULL,
+    `cart_entity_id` CHAR(36) NOT NULL,
+    `product_entity_id` CHAR(36) NOT NULL,
+    `warehouse_entity_id` CHAR(36) NOT NULL,
+    `inventory_entity_id` CHAR(36) NOT NULL,
+    `qty` INT NOT NULL,
+    `expires_at` DATETIME NOT NULL,
+    PRIMARY KEY (`entity_id`),
+    INDEX `cart_holds_cart` (`cart_entity_id`),
+    INDEX `cart_holds_expires_at` (`expires_at`)
+);
@@ -0,0 +1,17 @@
+ALTER TABLE `orders`
+    MODIFY COLUMN `status` ENUM('new', 'processing', 'paid', 'payment_failed', 'completed', 'cancelled', 'expired') NOT NULL DEFAULT 'new';
+
+CREATE TABLE IF NOT EXISTS `payments` (
+    `entity_id` CHAR(36) NOT NULL,
+    `order_entity_id` CHAR(36) NOT NULL,
+    `amount` BIGINT NOT NULL,
+    `currency` CHAR(3) NOT NULL,
+    `status` ENUM('pending', 'succeeded', 'failed') NOT NULL,
+    `charge_id` VARCHAR(64) NOT NULL DEFAULT '',
+    `failure_reason` VARCHAR(255) NOT NULL DEFAULT '',
+    `created_at` DATETIME NOT NULL,
+    `settled_at` DATETIME NULL,
+    `version` INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (`entity_id`),
+    INDEX `payments_order` (`order_entity_id`, `created_at`)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `bundle_components` (
+    `bundle_entity_id` CHAR(36) NOT NULL,
+    `product_entity_id` CHAR(36) NOT NULL,
+    `qty` INT NOT NULL,
+    PRIMARY KEY (`bundle_entity_id`, `product_entity_id`),
+    INDEX `bundle_components_product` (`product_entity_id`)
+);
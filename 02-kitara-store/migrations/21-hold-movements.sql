@@ -0,0 +1,29 @@
+ALTER TABLE `inventory_movements`
+    MODIFY COLUMN `reason` ENUM('opening', 'reserve', 'release', 'ship', 'restock', 'adjust', 'hold', 'release_hold') NOT NULL,
+    ADD COLUMN `qty_held_delta` INT NOT NULL DEFAULT 0 AFTER `qty_reserved_delta`;
+
+-- Stock held by carts before holds were recorded becomes part of the ledger
+INSERT INTO `inventory_movements` (
+    `entity_id`,
+    `inventory_entity_id`,
+    `product_entity_id`,
+    `warehouse_entity_id`,
+    `reason`,
+    `reference_id`,
+    `qty_in_store_delta`,
+    `qty_reserved_delta`,
+    `qty_held_delta`,
+    `created_at`)
+SELECT
+    UUID(),
+    `inventory`.`entity_id`,
+    `inventory`.`product_entity_id`,
+    `inventory`.`warehouse_entity_id`,
+    'hold',
+    NULL,
+    0,
+    0,
+    `inventory`.`qty_held`,
+    UTC_TIMESTAMP(6)
+FROM `inventory`
+WHERE `inventory`.`qty_held` > 0;
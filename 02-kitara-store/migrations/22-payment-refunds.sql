@@ -0,0 +1,4 @@
+ALTER TABLE `payments`
+    MODIFY COLUMN `status` ENUM('pending', 'succeeded', 'failed', 'refund_pending', 'refunded') NOT NULL,
+    ADD COLUMN `refund_id` VARCHAR(64) NOT NULL DEFAULT '' AFTER `settled_at`,
+    ADD COLUMN `refunded_at` DATETIME NULL AFTER `refund_id`;
@@ -0,0 +1,2 @@
+ALTER TABLE `payments`
+    ADD INDEX `payments_unsettled` (`status`, `created_at`);
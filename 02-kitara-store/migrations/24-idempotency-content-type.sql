@@ -0,0 +1,5 @@
+ALTER TABLE `idempotency_keys`
+    ADD COLUMN `response_content_type` VARCHAR(255) NOT NULL DEFAULT '' AFTER `response_code`;
+
+-- Every response stored before the Content-Type was kept was JSON
+UPDATE `idempotency_keys` SET `response_content_type` = 'application/json' WHERE `status` = 'completed';
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+// Allocation records how much of an Order Item is picked from the Inventory of a Warehouse
+type Allocation struct {
+	ID          uuid.UUID `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	OrderID     uuid.UUID `json:"orderId" db:"order_entity_id" validate:"min=36,max=36"`
+	OrderItemID uuid.UUID `json:"orderItemId" db:"order_item_entity_id" validate:"min=36,max=36"`
+	ProductID   uuid.UUID `json:"productId" db:"product_entity_id" validate:"min=36,max=36"`
+	WarehouseID uuid.UUID `json:"warehouseId" db:"warehouse_entity_id" validate:"min=36,max=36"`
+	InventoryID uuid.UUID `json:"inventoryId" db:"inventory_entity_id" validate:"min=36,max=36"`
+	Qty         int       `json:"qty" db:"qty" validate:"min=1"`
+}
+
+// AllocationStrategy decides which Inventories fill the items of an Order.
+// The Inventories are those of the Order's Products and the Warehouses are sorted by priority.
+type AllocationStrategy func(order Order, inventories []Inventory, warehouses []Warehouse) ([]Allocation, error)
+
+// AllocateFromSingleWarehouse fills the whole Order from the highest priority Warehouse that can fill all of it
+func AllocateFromSingleWarehouse(order Order, inventories []Inventory, warehouses []Warehouse) ([]Allocation, error) {
+	stock := newStockLevels(inventories)
+	qtyMap := order.QtyByProduct()
+	for _, warehouse := range warehouses {
+		if !stock.canFill(warehouse.ID, qtyMap) {
+			continue
+		}
+
+		allocations := make([]Allocation, 0)
+		for _, item := range order.Items {
+			allocations = append(allocations, stock.take(item, warehouse.ID, item.Qty))
+		}
+		return allocations, nil
+	}
+
+	return nil, failure.InsufficientStock("no single warehouse can fill the whole order", nil)
+}
+
+// AllocateByPriority fills each item of the Order from the highest priority Warehouse that can fill the whole item
+func AllocateByPriority(order Order, inventories []Inventory, warehouses []Warehouse) ([]Allocation, error) {
+	stock := newStockLevels(inventories)
+	allocations := make([]Allocation, 0)
+	for _, item := range order.Items {
+		allocated := false
+		for _, warehouse := range warehouses {
+			if stock.available(warehouse.ID, item.ProductID) >= item.Qty {
+				allocations = append(allocations, stock.take(item, warehouse.ID, item.Qty))
+				allocated = true
+				break
+			}
+		}
+
+		if !allocated {
+			return nil, failure.InsufficientStock(
+				fmt.Sprintf("no single warehouse can fill order item %s", item.ID),
+				nil)
+		}
+	}
+
+	return allocations, nil
+}
+
+// AllocateSplit fills each item of the Order from as many Warehouses as needed, taking from higher priority ones first
+func AllocateSplit(order Order, inventories []Inventory, warehouses []Warehouse) ([]Allocation, error) {
+	stock := newStockLevels(inventories)
+	allocations := make([]Allocation, 0)
+	for _, item := range order.Items {
+		remaining := item.Qty
+		for _, warehouse := range warehouses {
+			if remaining == 0 {
+				break
+			}
+
+			qty := stock.available(warehouse.ID, item.ProductID)
+			if qty > remaining {
+				qty = remaining
+			}
+			if qty > 0 {
+				allocations = append(allocations, stock.take(item, warehouse.ID, qty))
+				remaining -= qty
+			}
+		}
+
+		if remaining > 0 {
+			return nil, failure.InsufficientStock(
+				fmt.Sprintf("not enough stock across all warehouses to fill order item %s", item.ID),
+				nil)
+		}
+	}
+
+	return allocations, nil
+}
+
+// stockKey identifies the Inventory of a Product in a Warehouse
+type stockKey struct {
+	warehouseID uuid.UUID
+	productID   uuid.UUID
+}
+
+// stockLevels tracks the quantities still available to an allocation in progress
+type stockLevels struct {
+	inventoryIDs map[stockKey]uuid.UUID
+	qtyAvailable map[stockKey]int
+}
+
+func newStockLevels(inventories []Inventory) stockLevels {
+	stock := stockLevels{
+		inventoryIDs: make(map[stockKey]uuid.UUID),
+		qtyAvailable: make(map[stockKey]int),
+	}
+	for _, inventory := range inventories {
+		key := stockKey{warehouseID: inventory.WarehouseID, productID: inventory.ProductID}
+		stock.inventoryIDs[key] = inventory.ID
+		stock.qtyAvailable[key] = inventory.QtyAvailable
+	}
+	return stock
+}
+
+func (s stockLevels) available(warehouseID uuid.UUID, productID uuid.UUID) int {
+	return s.qtyAvailable[stockKey{warehouseID: warehouseID, productID: productID}]
+}
+
+func (s stockLevels) canFill(warehouseID uuid.UUID, qtyMap map[uuid.UUID]int) bool {
+	for productID, qty := range qtyMap {
+		if s.available(warehouseID, productID) < qty {
+			return false
+		}
+	}
+	return true
+}
+
+func (s stockLevels) take(item OrderItem, warehouseID uuid.UUID, qty int) Allocation {
+	key := stockKey{warehouseID: warehouseID, productID: item.ProductID}
+	s.qtyAvailable[key] -= qty
+
+	id, _ := uuid.NewV4()
+	return Allocation{
+		ID:          id,
+		OrderID:     item.OrderID,
+		OrderItemID: item.ID,
+		ProductID:   item.ProductID,
+		WarehouseID: warehouseID,
+		InventoryID: s.inventoryIDs[key],
+		Qty:         qty,
+	}
+}
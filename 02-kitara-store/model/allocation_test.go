@@ -0,0 +1,87 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestAllocationStrategies(t *testing.T) {
+
+	productA, _ := uuid.NewV4()
+	productB, _ := uuid.NewV4()
+	primary := Warehouse{ID: uuid.Must(uuid.NewV4()), Code: "PRIMARY", Priority: 0}
+	secondary := Warehouse{ID: uuid.Must(uuid.NewV4()), Code: "SECONDARY", Priority: 1}
+	warehouses := []Warehouse{primary, secondary}
+
+	order := Order{
+		Items: []OrderItem{
+			{ID: uuid.Must(uuid.NewV4()), ProductID: productA, Qty: 4},
+			{ID: uuid.Must(uuid.NewV4()), ProductID: productB, Qty: 2},
+		},
+	}
+
+	// PRIMARY can fill product A but only part of product B, SECONDARY can fill the whole order
+	inventories := []Inventory{
+		{ID: uuid.Must(uuid.NewV4()), ProductID: productA, WarehouseID: primary.ID, QtyAvailable: 5},
+		{ID: uuid.Must(uuid.NewV4()), ProductID: productB, WarehouseID: primary.ID, QtyAvailable: 1},
+		{ID: uuid.Must(uuid.NewV4()), ProductID: productA, WarehouseID: secondary.ID, QtyAvailable: 4},
+		{ID: uuid.Must(uuid.NewV4()), ProductID: productB, WarehouseID: secondary.ID, QtyAvailable: 2},
+	}
+
+	allocatedFrom := func(allocations []Allocation) map[uuid.UUID]map[uuid.UUID]int {
+		result := make(map[uuid.UUID]map[uuid.UUID]int)
+		for _, allocation := range allocations {
+			if result[allocation.ProductID] == nil {
+				result[allocation.ProductID] = make(map[uuid.UUID]int)
+			}
+			result[allocation.ProductID][allocation.WarehouseID] += allocation.Qty
+		}
+		return result
+	}
+
+	t.Run("single", func(t *testing.T) {
+		allocations, err := AllocateFromSingleWarehouse(order, inventories, warehouses)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := allocatedFrom(allocations)
+		if got[productA][secondary.ID] != 4 || got[productB][secondary.ID] != 2 || len(got[productA]) != 1 || len(got[productB]) != 1 {
+			t.Errorf("order was not allocated from SECONDARY alone: %+v", allocations)
+		}
+	})
+
+	t.Run("priority", func(t *testing.T) {
+		allocations, err := AllocateByPriority(order, inventories, warehouses)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := allocatedFrom(allocations)
+		if got[productA][primary.ID] != 4 || got[productB][secondary.ID] != 2 || len(got[productA]) != 1 || len(got[productB]) != 1 {
+			t.Errorf("items were not allocated from their highest priority warehouse: %+v", allocations)
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		allocations, err := AllocateSplit(order, inventories, warehouses)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := allocatedFrom(allocations)
+		if got[productA][primary.ID] != 4 || got[productB][primary.ID] != 1 || got[productB][secondary.ID] != 1 {
+			t.Errorf("items were not split in priority order: %+v", allocations)
+		}
+	})
+
+	t.Run("singleWithoutWarehouse", func(t *testing.T) {
+		_, err := AllocateFromSingleWarehouse(order, inventories[:3], warehouses)
+		if failure.GetCode(err) != failure.CodeInsufficientStock {
+			t.Errorf("wrong error: got %v want %v", err, failure.CodeInsufficientStock)
+		}
+	})
+
+}
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+// BundleComponent records how many units of a component Product go into one unit of a bundle Product
+type BundleComponent struct {
+	BundleID  uuid.UUID `json:"-" db:"bundle_entity_id"`
+	ProductID uuid.UUID `json:"productId" db:"product_entity_id" validate:"min=36,max=36"`
+	Qty       int       `json:"qty" db:"qty" validate:"min=1"`
+}
+
+// BundleComponentInput represents the input object for a single component of a bundle Product
+type BundleComponentInput struct {
+	ProductID uuid.UUID `json:"productId"`
+	Qty       int       `json:"qty"`
+}
+
+// newBundleComponents creates the components of a bundle Product from their input objects, ordered by Product ID
+func newBundleComponents(bundleID uuid.UUID, inputs []BundleComponentInput) []BundleComponent {
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	components := make([]BundleComponent, 0)
+	for _, input := range inputs {
+		components = append(components, BundleComponent{BundleID: bundleID, ProductID: input.ProductID, Qty: input.Qty})
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].ProductID.String() < components[j].ProductID.String()
+	})
+	return components
+}
+
+// IsBundle checks whether a Product is a bundle of other Products. A bundle has no inventory of its own and is
+// reserved by reserving its components.
+func (p *Product) IsBundle() bool {
+	return len(p.Components) > 0
+}
+
+// AttachComponents attaches BundleComponents to a Product
+func (p *Product) AttachComponents(components []BundleComponent) Product {
+	p.Components = nil
+	for _, component := range components {
+		if component.BundleID == p.ID {
+			p.Components = append(p.Components, component)
+		}
+	}
+	return *p
+}
+
+// ComponentIDs returns the IDs of the component Products of a bundle
+func (p *Product) ComponentIDs() []uuid.UUID {
+	productIDs := make([]uuid.UUID, 0)
+	for _, component := range p.Components {
+		productIDs = append(productIDs, component.ProductID)
+	}
+	return productIDs
+}
+
+// BundleQtyAvailable returns how many units of a bundle could be made from the available inventory of its
+// components, which is the smallest available quantity of a component divided by its quantity per bundle
+func (p *Product) BundleQtyAvailable(inventories []Inventory) int {
+	availableMap := make(map[uuid.UUID]int)
+	for _, inventory := range inventories {
+		availableMap[inventory.ProductID] += inventory.QtyAvailable
+	}
+
+	qtyAvailable := 0
+	for idx, component := range p.Components {
+		bundles := availableMap[component.ProductID] / component.Qty
+		if idx == 0 || bundles < qtyAvailable {
+			qtyAvailable = bundles
+		}
+	}
+	return qtyAvailable
+}
+
+// ShowAvailability fills in how many units of a bundle are available, derived from its components. It does nothing
+// for a Product that is not a bundle.
+func (p *Product) ShowAvailability(inventories []Inventory) {
+	if !p.IsBundle() {
+		return
+	}
+
+	qtyAvailable := p.BundleQtyAvailable(inventories)
+	p.QtyAvailable = &qtyAvailable
+}
+
+// validateComponents validates the components of a bundle Product
+func (p *Product) validateComponents() error {
+	seen := make(map[uuid.UUID]bool)
+	for _, component := range p.Components {
+		if component.ProductID == uuid.Nil {
+			return failure.BadRequestFromString("bundle component must specify a product")
+		}
+
+		if component.ProductID == p.ID {
+			return failure.BadRequestFromString("bundle must not be a component of itself")
+		}
+
+		if component.Qty <= 0 {
+			return failure.BadRequestFromString("bundle component quantity must be positive integer")
+		}
+
+		if seen[component.ProductID] {
+			return failure.BadRequestFromString(fmt.Sprintf("bundle component %s is specified more than once", component.ProductID))
+		}
+		seen[component.ProductID] = true
+	}
+
+	return nil
+}
+
+// AttachBundles attaches the components of the bundles among the supplied Products to the items of an Order that
+// are for them. Items of other Products are left without components.
+func (o *Order) AttachBundles(products []Product) Order {
+	productMap := make(map[uuid.UUID]Product)
+	for _, product := range products {
+		productMap[product.ID] = product
+	}
+
+	for idx := range o.Items {
+		o.Items[idx].Components = productMap[o.Items[idx].ProductID].Components
+	}
+	return *o
+}
+
+// StockOrder returns a copy of the Order whose items are as they draw on inventory: an item of a bundle is replaced
+// by one item per component, for the quantity of the component in all the bundles ordered. The component items keep
+// the ID of their bundle item, so that allocations and shortages point back to what was ordered.
+func (o *Order) StockOrder() Order {
+	stock := *o
+	stock.Items = make([]OrderItem, 0)
+	for _, item := range o.Items {
+		if len(item.Components) == 0 {
+			stock.Items = append(stock.Items, item)
+			continue
+		}
+
+		for _, component := range item.Components {
+			stock.Items = append(stock.Items, OrderItem{
+				ID:        item.ID,
+				OrderID:   item.OrderID,
+				ProductID: component.ProductID,
+				Qty:       item.Qty * component.Qty,
+			})
+		}
+	}
+	return stock
+}
+
+// StockProductIDs returns the distinct IDs of the Products whose inventory the Order draws on: those of its stock
+// items, along with those it has been allocated from
+func (o *Order) StockProductIDs() []uuid.UUID {
+	stock := o.StockOrder()
+	productIDs := stock.ProductIDs()
+	seen := make(map[uuid.UUID]bool)
+	for _, productID := range productIDs {
+		seen[productID] = true
+	}
+
+	for _, allocation := range o.Allocations {
+		if !seen[allocation.ProductID] {
+			seen[allocation.ProductID] = true
+			productIDs = append(productIDs, allocation.ProductID)
+		}
+	}
+	return productIDs
+}
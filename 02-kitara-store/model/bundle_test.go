@@ -0,0 +1,162 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestBundleQtyAvailable(t *testing.T) {
+
+	bundleID, _ := uuid.NewV4()
+	productA, _ := uuid.NewV4()
+	productB, _ := uuid.NewV4()
+	bundle := Product{
+		ID: bundleID,
+		Components: newBundleComponents(bundleID, []BundleComponentInput{
+			{ProductID: productA, Qty: 2},
+			{ProductID: productB, Qty: 3},
+		}),
+	}
+
+	primary, _ := uuid.NewV4()
+	secondary, _ := uuid.NewV4()
+	inventories := []Inventory{
+		{ProductID: productA, WarehouseID: primary, QtyAvailable: 5},
+		{ProductID: productA, WarehouseID: secondary, QtyAvailable: 4},
+		{ProductID: productB, WarehouseID: primary, QtyAvailable: 11},
+	}
+
+	// Product A makes 9 / 2 = 4 bundles across both warehouses, product B makes 11 / 3 = 3
+	if qty := bundle.BundleQtyAvailable(inventories); qty != 3 {
+		t.Errorf("wrong bundle availability: got %v want 3", qty)
+	}
+
+	if qty := bundle.BundleQtyAvailable(inventories[:2]); qty != 0 {
+		t.Errorf("bundle with a component lacking inventory is available: %v", qty)
+	}
+
+	bundle.ShowAvailability(inventories)
+	if bundle.QtyAvailable == nil || *bundle.QtyAvailable != 3 {
+		t.Errorf("bundle availability was not shown: %v", bundle.QtyAvailable)
+	}
+
+	product := Product{ID: productA}
+	product.ShowAvailability(inventories)
+	if product.QtyAvailable != nil {
+		t.Errorf("availability was shown for a product that is not a bundle: %v", *product.QtyAvailable)
+	}
+
+}
+
+func TestOrderStockOrder(t *testing.T) {
+
+	bundleID, _ := uuid.NewV4()
+	productA, _ := uuid.NewV4()
+	productB, _ := uuid.NewV4()
+	bundle := Product{
+		ID: bundleID,
+		Components: newBundleComponents(bundleID, []BundleComponentInput{
+			{ProductID: productA, Qty: 2},
+			{ProductID: productB, Qty: 1},
+		}),
+	}
+
+	bundleItem := OrderItem{ID: uuid.Must(uuid.NewV4()), ProductID: bundleID, Qty: 3}
+	directItem := OrderItem{ID: uuid.Must(uuid.NewV4()), ProductID: productA, Qty: 1}
+	order := Order{Items: []OrderItem{bundleItem, directItem}}
+	order.AttachBundles([]Product{bundle, {ID: productA}})
+
+	stock := order.StockOrder()
+	if len(stock.Items) != 3 || len(order.Items) != 2 {
+		t.Fatalf("wrong stock items: %+v", stock.Items)
+	}
+
+	qtyMap := stock.QtyByProduct()
+	if qtyMap[productA] != 7 || qtyMap[productB] != 3 || qtyMap[bundleID] != 0 {
+		t.Errorf("wrong stock quantities: %+v", qtyMap)
+	}
+
+	for _, item := range stock.Items {
+		if item.ProductID != directItem.ProductID && item.ID != bundleItem.ID {
+			t.Errorf("component item does not point back to its bundle item: %+v", item)
+		}
+	}
+
+	productIDs := order.StockProductIDs()
+	if len(productIDs) != 2 {
+		t.Errorf("wrong stock product IDs: %v", productIDs)
+	}
+
+	warehouse := Warehouse{ID: uuid.Must(uuid.NewV4())}
+	inventories := []Inventory{
+		{ID: uuid.Must(uuid.NewV4()), ProductID: productA, WarehouseID: warehouse.ID, QtyAvailable: 7},
+		{ID: uuid.Must(uuid.NewV4()), ProductID: productB, WarehouseID: warehouse.ID, QtyAvailable: 2},
+	}
+
+	t.Run("componentShort", func(t *testing.T) {
+		shortages := FindStockShortages(stock, inventories)
+		if len(shortages) != 1 || shortages[0].OrderItemID != bundleItem.ID || shortages[0].ProductID != productB || shortages[0].QtyShort != 1 {
+			t.Errorf("unexpected shortages: %+v", shortages)
+		}
+
+		if _, err := AllocateSplit(stock, inventories, []Warehouse{warehouse}); failure.GetCode(err) != failure.CodeInsufficientStock {
+			t.Errorf("bundle was allocated despite a short component: %v", err)
+		}
+	})
+
+	t.Run("allocated", func(t *testing.T) {
+		inventories[1].QtyAvailable = 3
+		allocations, err := AllocateSplit(stock, inventories, []Warehouse{warehouse})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		order.Allocations = allocations
+		qtyMap := order.QtyByInventory()
+		if len(allocations) != 3 || qtyMap[inventories[0].ID] != 7 || qtyMap[inventories[1].ID] != 3 {
+			t.Errorf("unexpected allocations: %+v", allocations)
+		}
+	})
+
+}
+
+func TestProductValidateComponents(t *testing.T) {
+
+	productA, _ := uuid.NewV4()
+	productB, _ := uuid.NewV4()
+	input := ProductInput{SKU: "KIT-1", Name: "Kit", Price: NewMoney(1000, "IDR")}
+
+	cases := []struct {
+		name       string
+		components []BundleComponentInput
+		valid      bool
+	}{
+		{"notBundle", nil, true},
+		{"bundle", []BundleComponentInput{{ProductID: productA, Qty: 1}, {ProductID: productB, Qty: 2}}, true},
+		{"noProduct", []BundleComponentInput{{Qty: 1}}, false},
+		{"zeroQty", []BundleComponentInput{{ProductID: productA, Qty: 0}}, false},
+		{"duplicate", []BundleComponentInput{{ProductID: productA, Qty: 1}, {ProductID: productA, Qty: 1}}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			input.Components = c.components
+			product := NewProductFromInput(input)
+			if err := product.Validate(); (err == nil) != c.valid {
+				t.Errorf("unexpected validation result: %v", err)
+			}
+		})
+	}
+
+	t.Run("itself", func(t *testing.T) {
+		input.Components = nil
+		product := NewProductFromInput(input)
+		product.Update(ProductInput{SKU: input.SKU, Name: input.Name, Price: input.Price, Components: []BundleComponentInput{{ProductID: product.ID, Qty: 1}}})
+		if err := product.Validate(); err == nil {
+			t.Errorf("bundle of itself was valid")
+		}
+	})
+
+}
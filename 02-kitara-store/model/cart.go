@@ -0,0 +1,339 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const (
+	// CartStatusOpen is the status of a Cart whose lines may still be changed
+	CartStatusOpen = "open"
+	// CartStatusCheckedOut is the status of a Cart that has been turned into an Order
+	CartStatusCheckedOut = "checkedOut"
+)
+
+// Cart represents a shopping Cart. Its lines are turned into the items of an Order at checkout. Lines may hold
+// inventory for a while, keeping it from other Orders until the holds expire or the Cart is checked out.
+type Cart struct {
+	ID          uuid.UUID     `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	CustomerRef string        `json:"customerRef,omitempty" db:"customer_ref"`
+	Status      string        `json:"status" db:"status"`
+	OrderID     uuid.NullUUID `json:"orderId" db:"order_entity_id"`
+	CreatedAt   time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time     `json:"updatedAt" db:"updated_at"`
+	Version     int           `json:"version" db:"version"`
+	Lines       []CartLine    `json:"lines" db:"-"`
+	Holds       []CartHold    `json:"-" db:"-"`
+}
+
+// CartLine represents a quantity of a Product in a Cart. The price, held and available quantities are worked out
+// live whenever the Cart is resolved, and are not stored.
+type CartLine struct {
+	ID            uuid.UUID  `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	CartID        uuid.UUID  `json:"cartId" db:"cart_entity_id" validate:"min=36,max=36"`
+	ProductID     uuid.UUID  `json:"productId" db:"product_entity_id" validate:"min=36,max=36"`
+	Qty           int        `json:"qty" db:"qty" validate:"min=1"`
+	Position      int        `json:"-" db:"position"`
+	UnitPrice     *Money     `json:"unitPrice,omitempty" db:"-"`
+	QtyHeld       int        `json:"qtyHeld" db:"-"`
+	HoldExpiresAt *time.Time `json:"holdExpiresAt,omitempty" db:"-"`
+	QtyAvailable  int        `json:"qtyAvailable" db:"-"`
+}
+
+// CartHold records how much of the Inventory of a Warehouse is held for a Product in a Cart, and until when
+type CartHold struct {
+	ID          uuid.UUID `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	CartID      uuid.UUID `json:"cartId" db:"cart_entity_id" validate:"min=36,max=36"`
+	ProductID   uuid.UUID `json:"productId" db:"product_entity_id" validate:"min=36,max=36"`
+	WarehouseID uuid.UUID `json:"warehouseId" db:"warehouse_entity_id" validate:"min=36,max=36"`
+	InventoryID uuid.UUID `json:"inventoryId" db:"inventory_entity_id" validate:"min=36,max=36"`
+	Qty         int       `json:"qty" db:"qty" validate:"min=1"`
+	ExpiresAt   time.Time `json:"expiresAt" db:"expires_at"`
+}
+
+// NewCartFromInput creates a new, empty Cart from its input object
+func NewCartFromInput(input CartInput, at time.Time) Cart {
+	id, _ := uuid.NewV4()
+	return Cart{
+		ID:          id,
+		CustomerRef: strings.TrimSpace(input.CustomerRef),
+		Status:      CartStatusOpen,
+		CreatedAt:   at,
+		UpdatedAt:   at,
+		Lines:       make([]CartLine, 0),
+		Holds:       make([]CartHold, 0),
+	}
+}
+
+// AttachLines attaches lines to the Cart, in the order they were added
+func (c *Cart) AttachLines(lines []CartLine) Cart {
+	c.Lines = make([]CartLine, 0)
+	for _, line := range lines {
+		if line.CartID == c.ID {
+			c.Lines = append(c.Lines, line)
+		}
+	}
+	sort.SliceStable(c.Lines, func(i, j int) bool {
+		return c.Lines[i].Position < c.Lines[j].Position
+	})
+	return *c
+}
+
+// AttachHolds attaches holds to the Cart
+func (c *Cart) AttachHolds(holds []CartHold) Cart {
+	c.Holds = make([]CartHold, 0)
+	for _, hold := range holds {
+		if hold.CartID == c.ID {
+			c.Holds = append(c.Holds, hold)
+		}
+	}
+	return *c
+}
+
+// EnsureOpen checks that the Cart may still be changed by the specified operation
+func (c *Cart) EnsureOpen(operation string) error {
+	if c.Status != CartStatusOpen {
+		return failure.OperationNotPermitted(operation, "Cart", "the cart has been checked out")
+	}
+	return nil
+}
+
+// AddLine adds a quantity of a Product to the Cart and returns the line holding it. A Product already in the Cart
+// has its quantity increased instead of getting a second line.
+func (c *Cart) AddLine(productID uuid.UUID, qty int, at time.Time) CartLine {
+	c.UpdatedAt = at
+	position := 0
+	for idx, line := range c.Lines {
+		if line.ProductID == productID {
+			c.Lines[idx].Qty += qty
+			return c.Lines[idx]
+		}
+		if line.Position >= position {
+			position = line.Position + 1
+		}
+	}
+
+	id, _ := uuid.NewV4()
+	line := CartLine{ID: id, CartID: c.ID, ProductID: productID, Qty: qty, Position: position}
+	c.Lines = append(c.Lines, line)
+	return line
+}
+
+// RemoveLine removes a line from the Cart and returns it
+func (c *Cart) RemoveLine(lineID uuid.UUID, at time.Time) (CartLine, error) {
+	for idx, line := range c.Lines {
+		if line.ID == lineID {
+			c.Lines = append(c.Lines[:idx:idx], c.Lines[idx+1:]...)
+			c.UpdatedAt = at
+			return line, nil
+		}
+	}
+
+	return CartLine{}, failure.EntityNotFound("Cart line")
+}
+
+// HeldProductIDs returns the distinct IDs of the Products the Cart holds inventory for, in ascending order
+func (c *Cart) HeldProductIDs() []uuid.UUID {
+	seen := make(map[uuid.UUID]bool)
+	productIDs := make([]uuid.UUID, 0)
+	for _, hold := range c.Holds {
+		if !seen[hold.ProductID] {
+			seen[hold.ProductID] = true
+			productIDs = append(productIDs, hold.ProductID)
+		}
+	}
+	sort.Slice(productIDs, func(i, j int) bool {
+		return productIDs[i].String() < productIDs[j].String()
+	})
+	return productIDs
+}
+
+// HoldsExpiredAt returns the holds of the Cart that have expired at the specified time
+func (c *Cart) HoldsExpiredAt(at time.Time) []CartHold {
+	holds := make([]CartHold, 0)
+	for _, hold := range c.Holds {
+		if !hold.ExpiresAt.After(at) {
+			holds = append(holds, hold)
+		}
+	}
+	return holds
+}
+
+// HoldStock holds the whole quantity of a line in the supplied Inventories until the specified time, taking from
+// higher priority Warehouses first. If the Product lacks available inventory, nothing is held and the failure
+// details describe the shortage. The Inventories are changed in place and the changed ones are returned.
+func (c *Cart) HoldStock(line CartLine, inventories []Inventory, warehouses []Warehouse, expiresAt time.Time) ([]Inventory, error) {
+	order := Order{ID: c.ID, Items: []OrderItem{{ID: line.ID, OrderID: c.ID, ProductID: line.ProductID, Qty: line.Qty}}}
+	if shortages := FindStockShortages(order, inventories); len(shortages) > 0 {
+		return nil, failure.InsufficientStock("insufficient stock to hold the cart line", shortages)
+	}
+
+	allocations, err := AllocateSplit(order, inventories, warehouses)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]Inventory, 0)
+	for _, allocation := range allocations {
+		for idx := range inventories {
+			if inventories[idx].ID != allocation.InventoryID {
+				continue
+			}
+
+			if err := inventories[idx].Hold(allocation.Qty); err != nil {
+				return nil, err
+			}
+			changed = append(changed, inventories[idx])
+		}
+
+		id, _ := uuid.NewV4()
+		c.Holds = append(c.Holds, CartHold{
+			ID:          id,
+			CartID:      c.ID,
+			ProductID:   allocation.ProductID,
+			WarehouseID: allocation.WarehouseID,
+			InventoryID: allocation.InventoryID,
+			Qty:         allocation.Qty,
+			ExpiresAt:   expiresAt,
+		})
+	}
+
+	return changed, nil
+}
+
+// ReleaseHolds releases the holds of the Cart that match back to the supplied Inventories and drops them from the
+// Cart. The Inventories are changed in place and the changed ones are returned.
+func (c *Cart) ReleaseHolds(match func(hold CartHold) bool, inventories []Inventory) ([]Inventory, error) {
+	kept := make([]CartHold, 0)
+	changedIDs := make(map[uuid.UUID]bool)
+	for _, hold := range c.Holds {
+		if !match(hold) {
+			kept = append(kept, hold)
+			continue
+		}
+
+		found := false
+		for idx := range inventories {
+			if inventories[idx].ID == hold.InventoryID {
+				if err := inventories[idx].ReleaseHold(hold.Qty); err != nil {
+					return nil, err
+				}
+				changedIDs[hold.InventoryID] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, failure.EntityNotFound("Inventory")
+		}
+	}
+	c.Holds = kept
+
+	changed := make([]Inventory, 0)
+	for _, inventory := range inventories {
+		if changedIDs[inventory.ID] {
+			changed = append(changed, inventory)
+		}
+	}
+	return changed, nil
+}
+
+// CheckOut records that the Cart has been turned into an Order. Its holds are gone, as they were either released or
+// turned into reservations of the Order.
+func (c *Cart) CheckOut(orderID uuid.UUID, at time.Time) {
+	c.Status = CartStatusCheckedOut
+	c.OrderID = uuid.NullUUID{UUID: orderID, Valid: true}
+	c.Holds = make([]CartHold, 0)
+	c.UpdatedAt = at
+}
+
+// OrderInput returns the input for creating an Order from the lines of the Cart
+func (c *Cart) OrderInput(voucherCodes []string) OrderInput {
+	input := OrderInput{CustomerRef: c.CustomerRef, VoucherCodes: voucherCodes}
+	for _, line := range c.Lines {
+		input.Items = append(input.Items, OrderItemInput{ProductID: line.ProductID, Qty: line.Qty})
+	}
+	return input
+}
+
+// ShowAvailability fills in the live fields of the Cart's lines: the current price of each Product, how much of
+// it the Cart holds and until when, and how much of it the Cart could still get, counting what it holds. The
+// availability of a bundle is derived from its components, so the inventories of those must be supplied too.
+func (c *Cart) ShowAvailability(products []Product, inventories []Inventory) {
+	productMap := make(map[uuid.UUID]Product)
+	for _, product := range products {
+		productMap[product.ID] = product
+	}
+
+	availableMap := make(map[uuid.UUID]int)
+	for _, inventory := range inventories {
+		availableMap[inventory.ProductID] += inventory.QtyAvailable
+	}
+
+	for idx := range c.Lines {
+		line := &c.Lines[idx]
+		if product, ok := productMap[line.ProductID]; ok {
+			price := product.Price
+			line.UnitPrice = &price
+		}
+
+		line.QtyHeld = 0
+		line.HoldExpiresAt = nil
+		for _, hold := range c.Holds {
+			if hold.ProductID != line.ProductID {
+				continue
+			}
+			line.QtyHeld += hold.Qty
+			if line.HoldExpiresAt == nil || hold.ExpiresAt.Before(*line.HoldExpiresAt) {
+				expiresAt := hold.ExpiresAt
+				line.HoldExpiresAt = &expiresAt
+			}
+		}
+		line.QtyAvailable = availableMap[line.ProductID] + line.QtyHeld
+		if product, ok := productMap[line.ProductID]; ok && product.IsBundle() {
+			line.QtyAvailable = product.BundleQtyAvailable(inventories)
+		}
+	}
+}
+
+// CartInput represents the input object for creating new Carts
+type CartInput struct {
+	CustomerRef string `json:"customerRef,omitempty"`
+}
+
+// Validate validates the CartInput object
+func (i *CartInput) Validate() error {
+	if len(strings.TrimSpace(i.CustomerRef)) > 64 {
+		return failure.BadRequestFromString("customer reference must not be longer than 64 characters")
+	}
+	return nil
+}
+
+// CartLineInput represents the input object for adding a Product to a Cart. When Hold is set, the whole quantity
+// of the line is held for a while.
+type CartLineInput struct {
+	ProductID uuid.UUID `json:"productId"`
+	Qty       int       `json:"qty"`
+	Hold      bool      `json:"hold"`
+}
+
+// Validate validates the CartLineInput object
+func (i *CartLineInput) Validate() error {
+	if i.ProductID == uuid.Nil {
+		return failure.BadRequestFromString("cart line must specify a product")
+	}
+
+	if i.Qty <= 0 {
+		return failure.BadRequestFromString("cart line quantity must be positive integer")
+	}
+
+	return nil
+}
+
+// CartCheckoutInput represents the input object for checking a Cart out
+type CartCheckoutInput struct {
+	VoucherCodes []string `json:"voucherCodes,omitempty"`
+}
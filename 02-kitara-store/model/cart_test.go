@@ -0,0 +1,121 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestCart(t *testing.T) {
+
+	productA, _ := uuid.NewV4()
+	productB, _ := uuid.NewV4()
+	primary := Warehouse{ID: uuid.Must(uuid.NewV4()), Code: "PRIMARY", Priority: 0}
+	secondary := Warehouse{ID: uuid.Must(uuid.NewV4()), Code: "SECONDARY", Priority: 1}
+	warehouses := []Warehouse{primary, secondary}
+	now := time.Now()
+
+	// PRIMARY has 3 of product A available and SECONDARY has 4
+	stock := func() []Inventory {
+		return []Inventory{
+			{ID: uuid.Must(uuid.NewV4()), ProductID: productA, WarehouseID: primary.ID, QtyInStore: 3, QtyAvailable: 3},
+			{ID: uuid.Must(uuid.NewV4()), ProductID: productA, WarehouseID: secondary.ID, QtyInStore: 5, QtyReserved: 1, QtyAvailable: 4},
+		}
+	}
+
+	t.Run("lines", func(t *testing.T) {
+		cart := NewCartFromInput(CartInput{CustomerRef: " CUST-1 "}, now)
+		if cart.Status != CartStatusOpen || cart.CustomerRef != "CUST-1" || cart.EnsureOpen("add to") != nil {
+			t.Errorf("wrong new cart: %+v", cart)
+		}
+
+		lineA := cart.AddLine(productA, 2, now)
+		cart.AddLine(productB, 1, now)
+		if merged := cart.AddLine(productA, 3, now); merged.ID != lineA.ID || merged.Qty != 5 || len(cart.Lines) != 2 {
+			t.Errorf("product already in the cart got a new line: %+v", cart.Lines)
+		}
+
+		input := cart.OrderInput([]string{"PROMO"})
+		if input.CustomerRef != "CUST-1" || len(input.Items) != 2 || input.Items[0].ProductID != productA ||
+			input.Items[0].Qty != 5 || input.VoucherCodes[0] != "PROMO" {
+			t.Errorf("wrong order input: %+v", input)
+		}
+
+		if _, err := cart.RemoveLine(lineA.ID, now); err != nil {
+			t.Fatalf("failed to remove line: %v", err)
+		}
+		if _, err := cart.RemoveLine(lineA.ID, now); failure.GetCode(err) != failure.CodeEntityNotFound {
+			t.Errorf("removing a missing line returned %v", err)
+		}
+		if len(cart.Lines) != 1 || cart.Lines[0].ProductID != productB {
+			t.Errorf("wrong lines after removal: %+v", cart.Lines)
+		}
+
+		cart.CheckOut(uuid.Must(uuid.NewV4()), now)
+		if err := cart.EnsureOpen("add to"); failure.GetCode(err) != failure.CodeOperationNotPermitted {
+			t.Errorf("checked out cart is still open: %v", err)
+		}
+	})
+
+	t.Run("holdStock", func(t *testing.T) {
+		cart := NewCartFromInput(CartInput{}, now)
+		inventories := stock()
+		line := cart.AddLine(productA, 5, now)
+
+		changed, err := cart.HoldStock(line, inventories, warehouses, now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("failed to hold stock: %v", err)
+		}
+		if len(changed) != 2 || inventories[0].QtyHeld != 3 || inventories[0].QtyAvailable != 0 ||
+			inventories[1].QtyHeld != 2 || inventories[1].QtyAvailable != 2 {
+			t.Errorf("stock was not held by warehouse priority: %+v", inventories)
+		}
+		if len(cart.Holds) != 2 || cart.HeldProductIDs()[0] != productA {
+			t.Errorf("wrong holds: %+v", cart.Holds)
+		}
+
+		cart.ShowAvailability(nil, inventories)
+		if cart.Lines[0].QtyHeld != 5 || cart.Lines[0].QtyAvailable != 7 || cart.Lines[0].HoldExpiresAt == nil {
+			t.Errorf("wrong availability: %+v", cart.Lines[0])
+		}
+
+		other := NewCartFromInput(CartInput{}, now)
+		_, err = other.HoldStock(other.AddLine(productA, 3, now), inventories, warehouses, now.Add(time.Minute))
+		if failure.GetCode(err) != failure.CodeInsufficientStock || len(other.Holds) != 0 {
+			t.Errorf("holding more than available returned %v", err)
+		}
+	})
+
+	t.Run("releaseHolds", func(t *testing.T) {
+		cart := NewCartFromInput(CartInput{}, now)
+		inventories := append(stock(), Inventory{ID: uuid.Must(uuid.NewV4()), ProductID: productB, WarehouseID: secondary.ID, QtyInStore: 2, QtyAvailable: 2})
+		if _, err := cart.HoldStock(cart.AddLine(productA, 4, now), inventories, warehouses, now.Add(time.Minute)); err != nil {
+			t.Fatalf("failed to hold stock: %v", err)
+		}
+		if _, err := cart.HoldStock(cart.AddLine(productB, 2, now), inventories, warehouses, now.Add(time.Hour)); err != nil {
+			t.Fatalf("failed to hold stock: %v", err)
+		}
+
+		expired := cart.HoldsExpiredAt(now.Add(2 * time.Minute))
+		if len(expired) != 2 || expired[0].ProductID != productA || expired[1].ProductID != productA {
+			t.Fatalf("wrong expired holds: %+v", expired)
+		}
+
+		isExpired := func(hold CartHold) bool { return !hold.ExpiresAt.After(now.Add(2 * time.Minute)) }
+		changed, err := cart.ReleaseHolds(isExpired, inventories)
+		if err != nil {
+			t.Fatalf("failed to release holds: %v", err)
+		}
+		if len(changed) != 2 || len(cart.Holds) != 1 || inventories[0].QtyHeld != 0 || inventories[0].QtyAvailable != 3 ||
+			inventories[1].QtyHeld != 0 || inventories[2].QtyHeld != 2 {
+			t.Errorf("wrong inventories after release: %+v", inventories)
+		}
+
+		if _, err := cart.ReleaseHolds(func(CartHold) bool { return true }, inventories[:2]); failure.GetCode(err) != failure.CodeEntityNotFound {
+			t.Errorf("releasing a hold without its inventory returned %v", err)
+		}
+	})
+
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// AggregateTypeOrder is the aggregate type of events about an Order
+	AggregateTypeOrder = "Order"
+	// AggregateTypeInventory is the aggregate type of events about an Inventory
+	AggregateTypeInventory = "Inventory"
+)
+
+const (
+	// EventTypeOrderProcessed is published when an Order has been processed and its inventory reserved
+	EventTypeOrderProcessed = "OrderProcessed"
+	// EventTypeInventoryReserved is published when part of an Inventory has been reserved for an Order
+	EventTypeInventoryReserved = "InventoryReserved"
+)
+
+// OutboxEvent represents a domain event recorded in the same transaction as the change it describes,
+// waiting to be published. Events of the same aggregate are published in Sequence order.
+type OutboxEvent struct {
+	Sequence      int64           `json:"sequence" db:"sequence"`
+	ID            uuid.UUID       `json:"id" db:"entity_id"`
+	AggregateType string          `json:"aggregateType" db:"aggregate_type"`
+	AggregateID   uuid.UUID       `json:"aggregateId" db:"aggregate_id"`
+	EventType     string          `json:"eventType" db:"event_type"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	CreatedAt     time.Time       `json:"createdAt" db:"created_at"`
+	PublishedAt   *time.Time      `json:"-" db:"published_at"`
+	Attempts      int             `json:"-" db:"attempts"`
+}
+
+// NewOutboxEvent creates a new unpublished event about an aggregate
+func NewOutboxEvent(aggregateType string, aggregateID uuid.UUID, eventType string, payload interface{}) (OutboxEvent, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+
+	id, _ := uuid.NewV4()
+	return OutboxEvent{
+		ID:            id,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       body,
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// InventoryReservedPayload is the payload of an InventoryReserved event
+type InventoryReservedPayload struct {
+	InventoryID  uuid.UUID `json:"inventoryId"`
+	ProductID    uuid.UUID `json:"productId"`
+	WarehouseID  uuid.UUID `json:"warehouseId"`
+	OrderID      uuid.UUID `json:"orderId"`
+	Qty          int       `json:"qty"`
+	QtyInStore   int       `json:"qtyInStore"`
+	QtyReserved  int       `json:"qtyReserved"`
+	QtyAvailable int       `json:"qtyAvailable"`
+}
+
+// NewOrderProcessedEvents creates the events describing a processed Order: one OrderProcessed event carrying
+// the Order with its items and allocations, followed by one InventoryReserved event for every reserved Inventory
+func NewOrderProcessedEvents(order Order, reserved []Inventory) ([]OutboxEvent, error) {
+	orderEvent, err := NewOutboxEvent(AggregateTypeOrder, order.ID, EventTypeOrderProcessed, order)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []OutboxEvent{orderEvent}
+	qtyMap := order.QtyByInventory()
+	for _, inventory := range reserved {
+		inventoryEvent, err := NewOutboxEvent(
+			AggregateTypeInventory,
+			inventory.ID,
+			EventTypeInventoryReserved,
+			InventoryReservedPayload{
+				InventoryID:  inventory.ID,
+				ProductID:    inventory.ProductID,
+				WarehouseID:  inventory.WarehouseID,
+				OrderID:      order.ID,
+				Qty:          qtyMap[inventory.ID],
+				QtyInStore:   inventory.QtyInStore,
+				QtyReserved:  inventory.QtyReserved,
+				QtyAvailable: inventory.QtyAvailable,
+			})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, inventoryEvent)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	// IdempotencyStatusInProgress is the status of an Idempotency Key whose original request is still being handled
+	IdempotencyStatusInProgress = "in_progress"
+	// IdempotencyStatusCompleted is the status of an Idempotency Key whose response has been stored
+	IdempotencyStatusCompleted = "completed"
+)
+
+// IdempotencyKey represents a client-supplied key together with the request it was first used for
+// and, once available, the response that request produced
+type IdempotencyKey struct {
+	Key                 string    `json:"key" db:"idempotency_key"`
+	RequestHash         string    `json:"requestHash" db:"request_hash"`
+	Status              string    `json:"status" db:"status"`
+	ResponseCode        int       `json:"responseCode" db:"response_code"`
+	ResponseContentType string    `json:"responseContentType" db:"response_content_type"`
+	ResponseBody        []byte    `json:"-" db:"response_body"`
+	CreatedAt           time.Time `json:"createdAt" db:"created_at"`
+	ExpiresAt           time.Time `json:"expiresAt" db:"expires_at"`
+}
+
+// NewIdempotencyKey creates a new in-progress Idempotency Key that expires after the specified TTL
+func NewIdempotencyKey(key string, requestHash string, ttl time.Duration) IdempotencyKey {
+	now := time.Now().UTC().Truncate(time.Second)
+	return IdempotencyKey{
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      IdempotencyStatusInProgress,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+}
+
+// IsExpired checks whether the Idempotency Key has outlived its TTL
+func (k *IdempotencyKey) IsExpired() bool {
+	return time.Now().After(k.ExpiresAt)
+}
+
+// IsStale checks whether the Idempotency Key has been in progress for longer than the specified timeout,
+// which means the instance handling the original request most likely died before storing a response
+func (k *IdempotencyKey) IsStale(timeout time.Duration) bool {
+	return k.Status == IdempotencyStatusInProgress && time.Now().After(k.CreatedAt.Add(timeout))
+}
@@ -1,24 +1,146 @@
 package model
 
 import (
-	"errors"
+	"math"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
 )
 
-// Inventory represents an Inventory object
+// Inventory represents an Inventory object. QtyReserved is held for processing Orders, while QtyHeld is held for a
+// short while for the Carts it was added to. Neither is available to other Orders.
 type Inventory struct {
 	ID           uuid.UUID `json:"id" db:"entity_id" validate:"min=36,max=36"`
 	ProductID    uuid.UUID `json:"productId" db:"product_entity_id" validate:"min=36,max=36"`
+	WarehouseID  uuid.UUID `json:"warehouseId" db:"warehouse_entity_id" validate:"min=36,max=36"`
 	QtyInStore   int       `json:"qtyInStore" db:"qty_in_store" validate:"min=0"`
 	QtyReserved  int       `json:"qtyReserved" db:"qty_reserved" validate:"min=0"`
+	QtyHeld      int       `json:"qtyHeld" db:"qty_held" validate:"min=0"`
 	QtyAvailable int       `json:"qtyAvailable" db:"qty_available" validate:"min=0"`
+	Version      int       `json:"version" db:"version"`
+}
+
+// NewInventory creates a new, empty Inventory of a Product in a Warehouse
+func NewInventory(productID uuid.UUID, warehouseID uuid.UUID) Inventory {
+	id, _ := uuid.NewV4()
+	return Inventory{
+		ID:          id,
+		ProductID:   productID,
+		WarehouseID: warehouseID,
+	}
+}
+
+const (
+	// ShortageReasonNoInventory indicates that a Product has no inventory at all
+	ShortageReasonNoInventory = "noInventory"
+	// ShortageReasonInsufficient indicates that a Product's available inventory is less than what is requested
+	ShortageReasonInsufficient = "insufficient"
+)
+
+// StockShortage describes an Order Item that cannot be fulfilled from the available inventory.
+// Quantities of several items for the same Product are added up, so QtyRequested and QtyShort
+// apply to the Product as a whole while Qty is the quantity of the item itself.
+type StockShortage struct {
+	OrderItemID  uuid.UUID `json:"orderItemId"`
+	ProductID    uuid.UUID `json:"productId"`
+	Qty          int       `json:"qty"`
+	QtyRequested int       `json:"qtyRequested"`
+	QtyAvailable int       `json:"qtyAvailable"`
+	QtyShort     int       `json:"qtyShort"`
+	Reason       string    `json:"reason"`
+}
+
+// FindStockShortages reports every item of an Order whose Product lacks enough available inventory.
+// The available quantities of a Product across all warehouses are added up.
+func FindStockShortages(order Order, inventories []Inventory) []StockShortage {
+	availableMap := make(map[uuid.UUID]int)
+	for _, inventory := range inventories {
+		availableMap[inventory.ProductID] += inventory.QtyAvailable
+	}
+
+	qtyMap := order.QtyByProduct()
+	shortages := make([]StockShortage, 0)
+	for _, item := range order.Items {
+		shortage := StockShortage{
+			OrderItemID:  item.ID,
+			ProductID:    item.ProductID,
+			Qty:          item.Qty,
+			QtyRequested: qtyMap[item.ProductID],
+		}
+
+		available, ok := availableMap[item.ProductID]
+		if !ok {
+			shortage.QtyShort = shortage.QtyRequested
+			shortage.Reason = ShortageReasonNoInventory
+			shortages = append(shortages, shortage)
+			continue
+		}
+
+		if available < shortage.QtyRequested {
+			shortage.QtyAvailable = available
+			shortage.QtyShort = shortage.QtyRequested - available
+			shortage.Reason = ShortageReasonInsufficient
+			shortages = append(shortages, shortage)
+		}
+	}
+
+	return shortages
 }
 
 // Reserve reserves the specified amount of inventory
 func (i *Inventory) Reserve(qty int) error {
 	i.QtyReserved += qty
-	i.QtyAvailable = i.QtyInStore - i.QtyReserved
+	i.QtyAvailable = i.QtyInStore - i.QtyReserved - i.QtyHeld
+
+	return i.Validate()
+}
+
+// Release returns the specified amount of reserved inventory to the available pool
+func (i *Inventory) Release(qty int) error {
+	i.QtyReserved -= qty
+	i.QtyAvailable = i.QtyInStore - i.QtyReserved - i.QtyHeld
+
+	return i.Validate()
+}
+
+// Ship removes the specified amount of reserved inventory from the store
+func (i *Inventory) Ship(qty int) error {
+	i.QtyInStore -= qty
+	i.QtyReserved -= qty
+	i.QtyAvailable = i.QtyInStore - i.QtyReserved - i.QtyHeld
+
+	return i.Validate()
+}
+
+// Restock adds the specified amount of inventory to the store
+func (i *Inventory) Restock(qty int) error {
+	i.QtyInStore += qty
+	i.QtyAvailable = i.QtyInStore - i.QtyReserved - i.QtyHeld
+
+	return i.Validate()
+}
+
+// Adjust corrects the in-store amount of inventory by the specified signed amount
+func (i *Inventory) Adjust(delta int) error {
+	i.QtyInStore += delta
+	i.QtyAvailable = i.QtyInStore - i.QtyReserved - i.QtyHeld
+
+	return i.Validate()
+}
+
+// Hold holds the specified amount of available inventory for a Cart
+func (i *Inventory) Hold(qty int) error {
+	i.QtyHeld += qty
+	i.QtyAvailable = i.QtyInStore - i.QtyReserved - i.QtyHeld
+
+	return i.Validate()
+}
+
+// ReleaseHold returns the specified amount of held inventory to the available pool
+func (i *Inventory) ReleaseHold(qty int) error {
+	i.QtyHeld -= qty
+	i.QtyAvailable = i.QtyInStore - i.QtyReserved - i.QtyHeld
 
 	return i.Validate()
 }
@@ -26,16 +148,120 @@ func (i *Inventory) Reserve(qty int) error {
 // Validate validates the Inventory object
 func (i *Inventory) Validate() error {
 	if i.QtyInStore < 0 {
-		return errors.New("cannot have negative in-store quantity")
+		return failure.BadRequestFromString("cannot have negative in-store quantity")
+	}
+
+	if i.QtyReserved < 0 {
+		return failure.BadRequestFromString("cannot have negative reserved quantity")
+	}
+
+	if i.QtyHeld < 0 {
+		return failure.BadRequestFromString("cannot have negative held quantity")
 	}
 
 	if i.QtyReserved > i.QtyInStore {
-		return errors.New("cannot reserve more than in-store quantity")
+		return failure.BadRequestFromString("cannot reserve more than in-store quantity")
 	}
 
 	if i.QtyAvailable < 0 {
-		return errors.New("cannot have negative available quantity")
+		return failure.BadRequestFromString("cannot have negative available quantity")
+	}
+
+	return nil
+}
+
+// InventoryRestockInput represents the input object for adding stock of a Product to a Warehouse.
+// When no Warehouse is specified, the highest priority one is used.
+type InventoryRestockInput struct {
+	WarehouseID uuid.UUID     `json:"warehouseId,omitempty"`
+	Qty         int           `json:"qty"`
+	ReferenceID uuid.NullUUID `json:"referenceId"`
+	Note        string        `json:"note"`
+}
+
+// Validate validates the InventoryRestockInput object
+func (i *InventoryRestockInput) Validate() error {
+	if i.Qty <= 0 {
+		return failure.BadRequestFromString("restock quantity must be positive integer")
+	}
+
+	if len(i.Note) > 255 {
+		return failure.BadRequestFromString("note must not be longer than 255 characters")
+	}
+
+	return nil
+}
+
+// InventoryAdjustInput represents the input object for correcting the stock of a Product in a Warehouse.
+// Either QtyDelta corrects the in-store quantity by a signed amount, for example to write off shrinkage,
+// or QtyInStore sets it to the quantity counted at a stock-take. When no Warehouse is specified,
+// the highest priority one is used.
+type InventoryAdjustInput struct {
+	WarehouseID uuid.UUID `json:"warehouseId,omitempty"`
+	QtyDelta    *int      `json:"qtyDelta,omitempty"`
+	QtyInStore  *int      `json:"qtyInStore,omitempty"`
+	Note        string    `json:"note"`
+}
+
+// Validate validates the InventoryAdjustInput object
+func (i *InventoryAdjustInput) Validate() error {
+	if (i.QtyDelta == nil) == (i.QtyInStore == nil) {
+		return failure.BadRequestFromString("adjustment must specify either qtyDelta or qtyInStore")
+	}
+
+	if i.QtyDelta != nil && *i.QtyDelta == 0 {
+		return failure.BadRequestFromString("adjustment quantity must not be zero")
+	}
+
+	if i.QtyInStore != nil && *i.QtyInStore < 0 {
+		return failure.BadRequestFromString("counted quantity must not be negative")
+	}
+
+	if i.Note == "" {
+		return failure.BadRequestFromString("adjustment must have a note explaining it")
+	}
+
+	if len(i.Note) > 255 {
+		return failure.BadRequestFromString("note must not be longer than 255 characters")
 	}
 
 	return nil
 }
+
+// DeltaFor returns the signed change the adjustment makes to the in-store quantity of an Inventory
+func (i *InventoryAdjustInput) DeltaFor(inventory Inventory) int {
+	if i.QtyDelta != nil {
+		return *i.QtyDelta
+	}
+	return *i.QtyInStore - inventory.QtyInStore
+}
+
+// LowStockItem represents a Product whose available quantity across all Warehouses is at or below its reorder point
+type LowStockItem struct {
+	ProductID     uuid.UUID `json:"productId" db:"product_entity_id"`
+	SKU           string    `json:"sku" db:"sku"`
+	Name          string    `json:"name" db:"name"`
+	ReorderPoint  int       `json:"reorderPoint" db:"reorder_point"`
+	QtyInStore    int       `json:"qtyInStore" db:"qty_in_store"`
+	QtyReserved   int       `json:"qtyReserved" db:"qty_reserved"`
+	QtyHeld       int       `json:"qtyHeld" db:"qty_held"`
+	QtyAvailable  int       `json:"qtyAvailable" db:"qty_available"`
+	DailyVelocity float64   `json:"dailyVelocity" db:"-"`
+	SuggestedQty  int       `json:"suggestedQty" db:"-"`
+}
+
+// SuggestReorder works out the daily reservation velocity from the quantity reserved during the velocity window,
+// then suggests reordering enough to cover the demand expected over the coverage period on top of the reorder point
+func (l *LowStockItem) SuggestReorder(reservedQty int, window time.Duration, coverage time.Duration) {
+	velocity := 0.0
+	if window > 0 {
+		velocity = float64(reservedQty) * 24 / window.Hours()
+	}
+	l.DailyVelocity = math.Round(velocity*100) / 100
+
+	target := l.ReorderPoint + int(math.Ceil(velocity*coverage.Hours()/24))
+	l.SuggestedQty = target - l.QtyAvailable
+	if l.SuggestedQty < 0 {
+		l.SuggestedQty = 0
+	}
+}
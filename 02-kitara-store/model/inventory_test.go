@@ -0,0 +1,112 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestFindStockShortages(t *testing.T) {
+
+	productA, _ := uuid.NewV4()
+	productB, _ := uuid.NewV4()
+	itemA1, _ := uuid.NewV4()
+	itemA2, _ := uuid.NewV4()
+	itemB, _ := uuid.NewV4()
+
+	order := Order{
+		Items: []OrderItem{
+			{ID: itemA1, ProductID: productA, Qty: 4},
+			{ID: itemA2, ProductID: productA, Qty: 3},
+			{ID: itemB, ProductID: productB, Qty: 1},
+		},
+	}
+
+	t.Run("sufficient", func(t *testing.T) {
+		inventories := []Inventory{
+			{ProductID: productA, QtyInStore: 7, QtyAvailable: 7},
+			{ProductID: productB, QtyInStore: 1, QtyAvailable: 1},
+		}
+
+		if shortages := FindStockShortages(order, inventories); len(shortages) != 0 {
+			t.Errorf("unexpected shortages: %+v", shortages)
+		}
+	})
+
+	t.Run("multipleItemsForSameProduct", func(t *testing.T) {
+		inventories := []Inventory{
+			{ProductID: productA, QtyInStore: 5, QtyAvailable: 5},
+			{ProductID: productB, QtyInStore: 1, QtyAvailable: 1},
+		}
+
+		shortages := FindStockShortages(order, inventories)
+		if len(shortages) != 2 {
+			t.Fatalf("wrong number of shortages: got %v want 2", len(shortages))
+		}
+
+		for _, shortage := range shortages {
+			if shortage.ProductID != productA || shortage.QtyRequested != 7 || shortage.QtyShort != 2 {
+				t.Errorf("unexpected shortage: %+v", shortage)
+			}
+		}
+	})
+
+	t.Run("missingInventory", func(t *testing.T) {
+		inventories := []Inventory{
+			{ProductID: productA, QtyInStore: 7, QtyAvailable: 7},
+		}
+
+		shortages := FindStockShortages(order, inventories)
+		if len(shortages) != 1 {
+			t.Fatalf("wrong number of shortages: got %v want 1", len(shortages))
+		}
+
+		if shortages[0].OrderItemID != itemB || shortages[0].Reason != ShortageReasonNoInventory || shortages[0].QtyShort != 1 {
+			t.Errorf("unexpected shortage: %+v", shortages[0])
+		}
+	})
+
+}
+
+func TestInventoryAdjust(t *testing.T) {
+
+	inventory := Inventory{QtyInStore: 10, QtyReserved: 4, QtyAvailable: 6}
+
+	if err := inventory.Adjust(-5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if inventory.QtyInStore != 5 || inventory.QtyAvailable != 1 {
+		t.Errorf("wrong quantities after adjustment: %+v", inventory)
+	}
+
+	if err := inventory.Adjust(-2); failure.GetCode(err) != failure.CodeBadRequest {
+		t.Errorf("adjusting below the reserved quantity returned wrong error: got %v want %v", err, failure.CodeBadRequest)
+	}
+
+	counted := 8
+	input := InventoryAdjustInput{QtyInStore: &counted, Note: "stock-take"}
+	if delta := input.DeltaFor(Inventory{QtyInStore: 11}); delta != -3 {
+		t.Errorf("wrong stock-take delta: got %v want -3", delta)
+	}
+
+}
+
+func TestLowStockItemSuggestReorder(t *testing.T) {
+
+	item := LowStockItem{ReorderPoint: 10, QtyAvailable: 4}
+
+	// 70 reserved over the past week is 10 a day, so two weeks of cover on top of the reorder point is 150
+	item.SuggestReorder(70, 7*24*time.Hour, 14*24*time.Hour)
+	if item.DailyVelocity != 10 || item.SuggestedQty != 146 {
+		t.Errorf("wrong suggestion: got velocity %v qty %v want 10 and 146", item.DailyVelocity, item.SuggestedQty)
+	}
+
+	item.SuggestReorder(0, 7*24*time.Hour, 14*24*time.Hour)
+	if item.SuggestedQty != 6 {
+		t.Errorf("wrong suggestion without demand: got %v want 6", item.SuggestedQty)
+	}
+
+}
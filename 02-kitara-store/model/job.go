@@ -0,0 +1,121 @@
+package model
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const (
+	// JobTypeProcessOrder is the type of a Job that processes an Order
+	JobTypeProcessOrder = "processOrder"
+)
+
+const (
+	// JobStatusQueued is the status of a Job waiting for a worker
+	JobStatusQueued = "queued"
+	// JobStatusRunning is the status of a Job claimed by a worker until its lease expires
+	JobStatusRunning = "running"
+	// JobStatusSucceeded is the status of a Job that was carried out
+	JobStatusSucceeded = "succeeded"
+	// JobStatusFailed is the status of a Job that could not be carried out
+	JobStatusFailed = "failed"
+)
+
+// Job represents a request queued to be carried out in the background. A worker claims a Job for a lease, during
+// which no other worker picks it up, and acknowledges it by recording its outcome. A Job whose lease expires before
+// it is acknowledged, for example because its worker stopped, is claimed again. Attempts counts the claims and tells
+// the latest claim apart from earlier ones. Jobs with the same ShardKey are carried out one at a time by one worker.
+type Job struct {
+	ID             uuid.UUID       `json:"id" db:"entity_id"`
+	Type           string          `json:"type" db:"type"`
+	OrderID        uuid.UUID       `json:"orderId" db:"order_entity_id"`
+	ShardKey       uuid.UUID       `json:"-" db:"shard_key"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	Result         json.RawMessage `json:"result,omitempty" db:"result"`
+	Failure        json.RawMessage `json:"failure,omitempty" db:"failure"`
+	CreatedAt      time.Time       `json:"createdAt" db:"created_at"`
+	StartedAt      *time.Time      `json:"startedAt,omitempty" db:"started_at"`
+	LeaseExpiresAt *time.Time      `json:"-" db:"lease_expires_at"`
+	FinishedAt     *time.Time      `json:"finishedAt,omitempty" db:"finished_at"`
+}
+
+// NewProcessOrderJob creates a queued Job that processes an Order. Its ShardKey is the lowest ID among the Products
+// of the Order, so that Orders for the same single Product are processed one after the other.
+func NewProcessOrderJob(order Order) Job {
+	productIDs := order.ProductIDs()
+	sort.Slice(productIDs, func(i, j int) bool {
+		return productIDs[i].String() < productIDs[j].String()
+	})
+
+	id, _ := uuid.NewV4()
+	job := Job{
+		ID:        id,
+		Type:      JobTypeProcessOrder,
+		OrderID:   order.ID,
+		Status:    JobStatusQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+	if len(productIDs) > 0 {
+		job.ShardKey = productIDs[0]
+	}
+
+	return job
+}
+
+// IsClaimable checks whether a Job may be claimed at the specified time: it is queued, or its lease has expired
+func (j *Job) IsClaimable(at time.Time) bool {
+	return j.Status == JobStatusQueued ||
+		(j.Status == JobStatusRunning && j.LeaseExpiresAt != nil && j.LeaseExpiresAt.Before(at))
+}
+
+// Claim claims the Job for a worker until the lease expires
+func (j *Job) Claim(at time.Time, leaseExpiresAt time.Time) {
+	j.Status = JobStatusRunning
+	j.Attempts++
+	j.StartedAt = &at
+	j.LeaseExpiresAt = &leaseExpiresAt
+}
+
+// Succeed records that the Job was carried out, with its result
+func (j *Job) Succeed(result interface{}, at time.Time) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	j.Status = JobStatusSucceeded
+	j.Result = body
+	j.LeaseExpiresAt = nil
+	j.FinishedAt = &at
+	return nil
+}
+
+// Fail records that the Job could not be carried out, with the failure that stopped it
+func (j *Job) Fail(err error, at time.Time) error {
+	f, ok := err.(*failure.Failure)
+	if !ok {
+		f = &failure.Failure{Code: failure.CodeInternalError, Message: err.Error()}
+	}
+
+	body, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	j.Status = JobStatusFailed
+	j.Failure = body
+	j.LeaseExpiresAt = nil
+	j.FinishedAt = &at
+	return nil
+}
+
+// Release gives the Job back to the queue to be claimed again
+func (j *Job) Release() {
+	j.Status = JobStatusQueued
+	j.LeaseExpiresAt = nil
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestJob(t *testing.T) {
+
+	productA := uuid.FromStringOrNil("a0000000-0000-0000-0000-000000000000")
+	productB := uuid.FromStringOrNil("b0000000-0000-0000-0000-000000000000")
+	order := Order{
+		ID: uuid.Must(uuid.NewV4()),
+		Items: []OrderItem{
+			{ProductID: productB, Qty: 1},
+			{ProductID: productA, Qty: 1},
+		},
+	}
+	now := time.Now()
+
+	t.Run("newProcessOrderJob", func(t *testing.T) {
+		job := NewProcessOrderJob(order)
+		if job.OrderID != order.ID || job.Status != JobStatusQueued || job.Attempts != 0 {
+			t.Errorf("wrong new job: %+v", job)
+		}
+		if job.ShardKey != productA {
+			t.Errorf("wrong shard key: got %s want %s", job.ShardKey, productA)
+		}
+		if !job.IsClaimable(now) {
+			t.Errorf("queued job is not claimable")
+		}
+	})
+
+	t.Run("lease", func(t *testing.T) {
+		job := NewProcessOrderJob(order)
+		job.Claim(now, now.Add(time.Minute))
+		if job.Status != JobStatusRunning || job.Attempts != 1 {
+			t.Errorf("wrong claimed job: %+v", job)
+		}
+		if job.IsClaimable(now.Add(30 * time.Second)) {
+			t.Errorf("leased job is claimable")
+		}
+		if !job.IsClaimable(now.Add(2 * time.Minute)) {
+			t.Errorf("job with an expired lease is not claimable")
+		}
+
+		job.Release()
+		if job.Status != JobStatusQueued || job.Attempts != 1 || !job.IsClaimable(now) {
+			t.Errorf("wrong released job: %+v", job)
+		}
+	})
+
+	t.Run("outcomes", func(t *testing.T) {
+		job := NewProcessOrderJob(order)
+		job.Claim(now, now.Add(time.Minute))
+		if err := job.Succeed(order, now); err != nil {
+			t.Fatalf("failed to succeed job: %v", err)
+		}
+		var result Order
+		if err := json.Unmarshal(job.Result, &result); err != nil || result.ID != order.ID {
+			t.Errorf("wrong result: %s", job.Result)
+		}
+		if job.Status != JobStatusSucceeded || job.FinishedAt == nil || job.IsClaimable(now.Add(time.Hour)) {
+			t.Errorf("wrong succeeded job: %+v", job)
+		}
+
+		for _, cause := range []error{failure.InsufficientStock("insufficient stock", nil), errors.New("connection lost")} {
+			job := NewProcessOrderJob(order)
+			job.Claim(now, now.Add(time.Minute))
+			if err := job.Fail(cause, now); err != nil {
+				t.Fatalf("failed to fail job: %v", err)
+			}
+			var f failure.Failure
+			if err := json.Unmarshal(job.Failure, &f); err != nil || f.Code != failure.GetCode(cause) {
+				t.Errorf("wrong failure for %v: %s", cause, job.Failure)
+			}
+			if job.Status != JobStatusFailed || job.IsClaimable(now.Add(time.Hour)) {
+				t.Errorf("wrong failed job: %+v", job)
+			}
+		}
+	})
+
+}
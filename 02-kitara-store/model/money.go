@@ -0,0 +1,131 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+// currencyExponents lists the supported ISO 4217 currencies with the number of digits of their minor unit
+var currencyExponents = map[string]int{
+	"IDR": 2,
+	"SGD": 2,
+	"MYR": 2,
+	"USD": 2,
+	"EUR": 2,
+	"JPY": 0,
+}
+
+// IsCurrency checks whether a string is a supported ISO 4217 currency code
+func IsCurrency(currency string) bool {
+	_, ok := currencyExponents[currency]
+	return ok
+}
+
+// Money is an exact amount of money, kept as an integer number of the minor units of its currency,
+// e.g. 1050 with currency IDR is IDR 10.50. Amounts in different currencies are never combined.
+type Money struct {
+	Amount   int64  `json:"amount" db:"amount"`
+	Currency string `json:"currency" db:"currency"`
+}
+
+// NewMoney creates Money from an amount in minor units and a currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Validate validates the Money object
+func (m Money) Validate() error {
+	if !IsCurrency(m.Currency) {
+		return failure.BadRequestFromString(fmt.Sprintf("unsupported currency %q", m.Currency))
+	}
+
+	return nil
+}
+
+// IsNegative checks whether the amount is below zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Add adds another amount in the same currency. It fails if the currencies differ or the sum overflows.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, failure.BadRequestFromString(
+			fmt.Sprintf("cannot add %s to %s: currencies differ", other, m))
+	}
+
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, failure.BadRequestFromString(fmt.Sprintf("adding %s to %s overflows", other, m))
+	}
+
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Subtract subtracts another amount in the same currency. It fails if the currencies differ or the difference
+// overflows.
+func (m Money) Subtract(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, failure.BadRequestFromString(fmt.Sprintf("subtracting %s from %s overflows", other, m))
+	}
+
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Multiply multiplies the amount by a quantity. It fails if the product overflows.
+func (m Money) Multiply(qty int) (Money, error) {
+	return m.Scale(int64(qty), 1)
+}
+
+// Scale multiplies the amount by the fraction numerator/denominator, e.g. 15/100 for 15 percent. The exact result
+// is rounded to the nearest minor unit, with halves rounded to the even neighbour so that rounding errors do not
+// pile up in one direction over many operations. It fails if the denominator is not positive or the result
+// overflows.
+func (m Money) Scale(numerator int64, denominator int64) (Money, error) {
+	if denominator <= 0 {
+		return Money{}, failure.BadRequestFromString("money can only be scaled by a positive denominator")
+	}
+
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(numerator))
+	quotient, remainder := new(big.Int).QuoRem(product, big.NewInt(denominator), new(big.Int))
+
+	// compare twice the remainder with the denominator to decide whether to round away from zero
+	twiceRemainder := new(big.Int).Abs(remainder)
+	twiceRemainder.Lsh(twiceRemainder, 1)
+	cmp := twiceRemainder.Cmp(big.NewInt(denominator))
+	if cmp > 0 || (cmp == 0 && quotient.Bit(0) == 1) {
+		if product.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	if !quotient.IsInt64() {
+		return Money{}, failure.BadRequestFromString(
+			fmt.Sprintf("scaling %s by %d/%d overflows", m, numerator, denominator))
+	}
+
+	return Money{Amount: quotient.Int64(), Currency: m.Currency}, nil
+}
+
+// String formats the amount with its currency and minor unit digits, e.g. IDR 10.50
+func (m Money) String() string {
+	exponent := currencyExponents[m.Currency]
+	if exponent == 0 {
+		return fmt.Sprintf("%s %d", m.Currency, m.Amount)
+	}
+
+	sign := ""
+	amount := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		amount = uint64(-(m.Amount + 1)) + 1
+	}
+
+	unit := uint64(math.Pow10(exponent))
+	return fmt.Sprintf("%s %s%d.%0*d", m.Currency, sign, amount/unit, exponent, amount%unit)
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+
+	t.Run("add", func(t *testing.T) {
+		sum, err := NewMoney(1050, "IDR").Add(NewMoney(25, "IDR"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sum != NewMoney(1075, "IDR") {
+			t.Errorf("wrong sum: got %v want %v", sum, NewMoney(1075, "IDR"))
+		}
+	})
+
+	t.Run("addDifferentCurrencies", func(t *testing.T) {
+		_, err := NewMoney(1050, "IDR").Add(NewMoney(25, "USD"))
+		if failure.GetCode(err) != failure.CodeBadRequest {
+			t.Errorf("wrong error: got %v want %v", err, failure.CodeBadRequest)
+		}
+	})
+
+	t.Run("addOverflow", func(t *testing.T) {
+		_, err := NewMoney(math.MaxInt64, "IDR").Add(NewMoney(1, "IDR"))
+		if failure.GetCode(err) != failure.CodeBadRequest {
+			t.Errorf("wrong error: got %v want %v", err, failure.CodeBadRequest)
+		}
+	})
+
+	t.Run("multiplyOverflow", func(t *testing.T) {
+		_, err := NewMoney(math.MaxInt64/2+1, "IDR").Multiply(2)
+		if failure.GetCode(err) != failure.CodeBadRequest {
+			t.Errorf("wrong error: got %v want %v", err, failure.CodeBadRequest)
+		}
+	})
+
+}
+
+func TestMoneyScale(t *testing.T) {
+
+	scales := []struct {
+		name        string
+		amount      int64
+		numerator   int64
+		denominator int64
+		expected    int64
+	}{
+		{"exact", 1000, 15, 100, 150},
+		{"roundDown", 1004, 1, 10, 100},
+		{"roundUp", 1006, 1, 10, 101},
+		{"halfToEvenDown", 1025, 1, 10, 102},
+		{"halfToEvenUp", 1035, 1, 10, 104},
+		{"negativeHalfToEven", -1035, 1, 10, -104},
+		{"negativeRoundUp", -1006, 1, 10, -101},
+		{"largeIntermediate", math.MaxInt64 / 10, 30, 100, math.MaxInt64 / 10 * 3 / 10},
+	}
+
+	for _, tc := range scales {
+		t.Run(tc.name, func(t *testing.T) {
+			scaled, err := NewMoney(tc.amount, "IDR").Scale(tc.numerator, tc.denominator)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if scaled.Amount != tc.expected {
+				t.Errorf("wrong amount: got %v want %v", scaled.Amount, tc.expected)
+			}
+		})
+	}
+
+}
+
+func TestMoneyString(t *testing.T) {
+
+	formats := []struct {
+		money    Money
+		expected string
+	}{
+		{NewMoney(1050, "IDR"), "IDR 10.50"},
+		{NewMoney(5, "USD"), "USD 0.05"},
+		{NewMoney(-1050, "IDR"), "IDR -10.50"},
+		{NewMoney(math.MinInt64, "IDR"), "IDR -92233720368547758.08"},
+		{NewMoney(1500, "JPY"), "JPY 1500"},
+	}
+
+	for _, tc := range formats {
+		if formatted := tc.money.String(); formatted != tc.expected {
+			t.Errorf("wrong format: got %v want %v", formatted, tc.expected)
+		}
+	}
+
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const (
+	// MovementReasonOpening is the reason of the movement that brought an Inventory's stock level into the ledger
+	MovementReasonOpening = "opening"
+	// MovementReasonReserve is the reason of a movement that reserved stock for an Order
+	MovementReasonReserve = "reserve"
+	// MovementReasonRelease is the reason of a movement that returned reserved stock to the available pool
+	MovementReasonRelease = "release"
+	// MovementReasonShip is the reason of a movement that took reserved stock out of the store
+	MovementReasonShip = "ship"
+	// MovementReasonRestock is the reason of a movement that added stock to the store
+	MovementReasonRestock = "restock"
+	// MovementReasonAdjust is the reason of a movement that corrected the in-store stock, such as after a stock-take
+	MovementReasonAdjust = "adjust"
+	// MovementReasonHold is the reason of a movement that held available stock for a Cart
+	MovementReasonHold = "hold"
+	// MovementReasonReleaseHold is the reason of a movement that returned stock held for a Cart to the available pool
+	MovementReasonReleaseHold = "release_hold"
+)
+
+// InventoryMovement represents a single signed change to an Inventory's quantities.
+// Movements are never updated or deleted, so adding up the movements of an Inventory up to any point in time
+// gives its stock level at that time.
+type InventoryMovement struct {
+	Sequence         int64         `json:"sequence" db:"sequence"`
+	ID               uuid.UUID     `json:"id" db:"entity_id"`
+	InventoryID      uuid.UUID     `json:"inventoryId" db:"inventory_entity_id"`
+	ProductID        uuid.UUID     `json:"productId" db:"product_entity_id"`
+	WarehouseID      uuid.UUID     `json:"warehouseId" db:"warehouse_entity_id"`
+	Reason           string        `json:"reason" db:"reason"`
+	ReferenceID      uuid.NullUUID `json:"referenceId" db:"reference_id"`
+	Note             string        `json:"note,omitempty" db:"note"`
+	QtyInStoreDelta  int           `json:"qtyInStoreDelta" db:"qty_in_store_delta"`
+	QtyReservedDelta int           `json:"qtyReservedDelta" db:"qty_reserved_delta"`
+	QtyHeldDelta     int           `json:"qtyHeldDelta" db:"qty_held_delta"`
+	CreatedAt        time.Time     `json:"createdAt" db:"created_at"`
+}
+
+// NewInventoryMovement creates the movement that takes an Inventory from one state to another
+func NewInventoryMovement(before Inventory, after Inventory, reason string, referenceID uuid.UUID) InventoryMovement {
+	id, _ := uuid.NewV4()
+	return InventoryMovement{
+		ID:               id,
+		InventoryID:      after.ID,
+		ProductID:        after.ProductID,
+		WarehouseID:      after.WarehouseID,
+		Reason:           reason,
+		ReferenceID:      uuid.NullUUID{UUID: referenceID, Valid: referenceID != uuid.Nil},
+		QtyInStoreDelta:  after.QtyInStore - before.QtyInStore,
+		QtyReservedDelta: after.QtyReserved - before.QtyReserved,
+		QtyHeldDelta:     after.QtyHeld - before.QtyHeld,
+		CreatedAt:        time.Now().UTC(),
+	}
+}
+
+// NewHoldMovements creates the movements that take the changed Inventories from their state before, holding more
+// or releasing what a Cart held. Changed Inventories that are not among those before are left out.
+func NewHoldMovements(before []Inventory, changed []Inventory, cartID uuid.UUID) []InventoryMovement {
+	movements := make([]InventoryMovement, 0)
+	for _, after := range changed {
+		for _, inventory := range before {
+			if inventory.ID != after.ID {
+				continue
+			}
+
+			reason := MovementReasonHold
+			if after.QtyHeld < inventory.QtyHeld {
+				reason = MovementReasonReleaseHold
+			}
+			movements = append(movements, NewInventoryMovement(inventory, after, reason, cartID))
+		}
+	}
+	return movements
+}
+
+// InventoryMovementFilter represents the criteria for resolving a Page of Inventory Movements
+type InventoryMovementFilter struct {
+	ProductID   uuid.UUID
+	WarehouseID uuid.UUID
+	From        *time.Time
+	To          *time.Time
+	Page        int
+	PageSize    int
+}
+
+// Validate validates the InventoryMovementFilter object
+func (f *InventoryMovementFilter) Validate() error {
+	if f.From != nil && f.To != nil && f.To.Before(*f.From) {
+		return failure.BadRequestFromString("to must not be earlier than from")
+	}
+
+	return nil
+}
+
+// StockLevel represents the quantities of an Inventory at a point in time
+type StockLevel struct {
+	InventoryID  uuid.UUID `json:"inventoryId" db:"inventory_entity_id"`
+	WarehouseID  uuid.UUID `json:"warehouseId" db:"warehouse_entity_id"`
+	QtyInStore   int       `json:"qtyInStore" db:"qty_in_store"`
+	QtyReserved  int       `json:"qtyReserved" db:"qty_reserved"`
+	QtyHeld      int       `json:"qtyHeld" db:"qty_held"`
+	QtyAvailable int       `json:"qtyAvailable" db:"-"`
+}
+
+// StockSnapshot represents the stock of a Product across all Warehouses at a point in time,
+// rebuilt from the Inventory Movements recorded up to then
+type StockSnapshot struct {
+	ProductID    uuid.UUID    `json:"productId"`
+	AsOf         time.Time    `json:"asOf"`
+	QtyInStore   int          `json:"qtyInStore"`
+	QtyReserved  int          `json:"qtyReserved"`
+	QtyHeld      int          `json:"qtyHeld"`
+	QtyAvailable int          `json:"qtyAvailable"`
+	Warehouses   []StockLevel `json:"warehouses"`
+}
+
+// NewStockSnapshot creates a Stock Snapshot of a Product from the stock levels of its Inventories
+func NewStockSnapshot(productID uuid.UUID, asOf time.Time, levels []StockLevel) StockSnapshot {
+	snapshot := StockSnapshot{
+		ProductID:  productID,
+		AsOf:       asOf,
+		Warehouses: make([]StockLevel, 0),
+	}
+
+	for _, level := range levels {
+		level.QtyAvailable = level.QtyInStore - level.QtyReserved - level.QtyHeld
+		snapshot.QtyInStore += level.QtyInStore
+		snapshot.QtyReserved += level.QtyReserved
+		snapshot.QtyHeld += level.QtyHeld
+		snapshot.QtyAvailable += level.QtyAvailable
+		snapshot.Warehouses = append(snapshot.Warehouses, level)
+	}
+
+	return snapshot
+}
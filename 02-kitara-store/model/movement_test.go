@@ -0,0 +1,81 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestInventoryMovementsRebuildStock(t *testing.T) {
+
+	orderID, _ := uuid.NewV4()
+	inventory := Inventory{ID: uuid.Must(uuid.NewV4()), ProductID: uuid.Must(uuid.NewV4()), QtyInStore: 10, QtyAvailable: 10}
+
+	movements := []InventoryMovement{NewInventoryMovement(Inventory{}, inventory, MovementReasonOpening, uuid.Nil)}
+	steps := []struct {
+		reason string
+		change func(*Inventory, int) error
+		qty    int
+	}{
+		{MovementReasonReserve, (*Inventory).Reserve, 4},
+		{MovementReasonRelease, (*Inventory).Release, 1},
+		{MovementReasonShip, (*Inventory).Ship, 3},
+		{MovementReasonHold, (*Inventory).Hold, 2},
+		{MovementReasonReleaseHold, (*Inventory).ReleaseHold, 1},
+	}
+
+	for _, step := range steps {
+		before := inventory
+		if err := step.change(&inventory, step.qty); err != nil {
+			t.Fatalf("unexpected error applying %s: %v", step.reason, err)
+		}
+		movements = append(movements, NewInventoryMovement(before, inventory, step.reason, orderID))
+	}
+
+	level := StockLevel{InventoryID: inventory.ID}
+	for _, movement := range movements {
+		level.QtyInStore += movement.QtyInStoreDelta
+		level.QtyReserved += movement.QtyReservedDelta
+		level.QtyHeld += movement.QtyHeldDelta
+	}
+
+	snapshot := NewStockSnapshot(inventory.ProductID, time.Now(), []StockLevel{level})
+	if snapshot.QtyInStore != inventory.QtyInStore || snapshot.QtyReserved != inventory.QtyReserved ||
+		snapshot.QtyHeld != inventory.QtyHeld || snapshot.QtyAvailable != inventory.QtyAvailable {
+		t.Errorf("rebuilt stock differs: got %+v want %+v", snapshot, inventory)
+	}
+
+	if movements[0].ReferenceID.Valid || !movements[1].ReferenceID.Valid {
+		t.Errorf("wrong movement references: %+v", movements)
+	}
+
+}
+
+func TestNewHoldMovements(t *testing.T) {
+
+	cartID, _ := uuid.NewV4()
+	held := Inventory{ID: uuid.Must(uuid.NewV4()), QtyInStore: 10, QtyAvailable: 10}
+	released := Inventory{ID: uuid.Must(uuid.NewV4()), QtyInStore: 10, QtyHeld: 4, QtyAvailable: 6}
+	before := []Inventory{held, released}
+
+	if err := held.Hold(3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := released.ReleaseHold(4); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	movements := NewHoldMovements(before, []Inventory{held, released}, cartID)
+	if len(movements) != 2 {
+		t.Fatalf("wrong number of movements: got %v want 2", len(movements))
+	}
+
+	if movements[0].Reason != MovementReasonHold || movements[0].QtyHeldDelta != 3 || movements[0].ReferenceID.UUID != cartID {
+		t.Errorf("unexpected hold movement: %+v", movements[0])
+	}
+	if movements[1].Reason != MovementReasonReleaseHold || movements[1].QtyHeldDelta != -4 || movements[1].QtyReservedDelta != 0 {
+		t.Errorf("unexpected release movement: %+v", movements[1])
+	}
+
+}
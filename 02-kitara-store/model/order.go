@@ -1,18 +1,166 @@
 package model
 
 import (
-	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
 )
 
-// Order represents an Order entity
+const (
+	// OrderStatusNew is the status of an Order that has been created but not processed
+	OrderStatusNew = "new"
+	// OrderStatusProcessing is the status of an Order whose inventory has been reserved
+	OrderStatusProcessing = "processing"
+	// OrderStatusPaid is the status of a processing Order whose payment has succeeded
+	OrderStatusPaid = "paid"
+	// OrderStatusPaymentFailed is the status of an Order whose payment failed, releasing its reservation
+	OrderStatusPaymentFailed = "payment_failed"
+	// OrderStatusCompleted is the status of an Order whose reserved inventory has left the store
+	OrderStatusCompleted = "completed"
+	// OrderStatusCancelled is the status of an Order that will not be fulfilled
+	OrderStatusCancelled = "cancelled"
+	// OrderStatusExpired is the status of an Order whose reservation lapsed before it was completed
+	OrderStatusExpired = "expired"
+)
+
+// orderTransitions lists the statuses an Order may move to from each status
+var orderTransitions = map[string][]string{
+	OrderStatusNew:        {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusPaid, OrderStatusPaymentFailed, OrderStatusCompleted, OrderStatusCancelled, OrderStatusExpired},
+	OrderStatusPaid:       {OrderStatusCompleted},
+}
+
+// IsOrderStatus checks whether a string is a known Order status
+func IsOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusNew, OrderStatusProcessing, OrderStatusPaid, OrderStatusPaymentFailed, OrderStatusCompleted,
+		OrderStatusCancelled, OrderStatusExpired:
+		return true
+	}
+	return false
+}
+
+// Order represents an Order entity. CustomerRef identifies the customer placing the Order, if any, and is what
+// purchase limits are counted against.
 type Order struct {
-	ID         uuid.UUID   `json:"id" db:"entity_id" validate:"min=36,max=36"`
-	Code       string      `json:"code" db:"order_code"`
-	TotalPrice float64     `json:"totalPrice" db:"total_price" validate:"min=0"`
-	Status     string      `json:"status" db:"status"`
-	Items      []OrderItem `json:"items" db:"-"`
+	ID          uuid.UUID       `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	Code        string          `json:"code" db:"order_code"`
+	CustomerRef string          `json:"customerRef,omitempty" db:"customer_ref"`
+	TotalPrice  Money           `json:"totalPrice" db:"total_price"`
+	Status      string          `json:"status" db:"status"`
+	ProcessedAt *time.Time      `json:"processedAt,omitempty" db:"processed_at"`
+	Version     int             `json:"version" db:"version"`
+	Items       []OrderItem     `json:"items" db:"-"`
+	Discounts   []OrderDiscount `json:"discounts,omitempty" db:"-"`
+	Allocations []Allocation    `json:"allocations,omitempty" db:"-"`
+}
+
+// NewOrderFromInput creates a new Order from its input object, pricing each item from the supplied Products.
+// The Order is left without a code for the caller to generate one.
+func NewOrderFromInput(input OrderInput, products []Product) (Order, error) {
+	id := input.ID
+	if input.ID == uuid.Nil {
+		id, _ = uuid.NewV4()
+	}
+
+	productMap := make(map[uuid.UUID]Product)
+	for _, product := range products {
+		productMap[product.ID] = product
+	}
+
+	order := Order{
+		ID:          id,
+		CustomerRef: strings.TrimSpace(input.CustomerRef),
+		Status:      OrderStatusNew,
+		Items:       make([]OrderItem, 0),
+	}
+
+	for _, itemInput := range input.Items {
+		if itemInput.Qty <= 0 {
+			return order, failure.BadRequestFromString("order item quantity must be positive integer")
+		}
+
+		product, ok := productMap[itemInput.ProductID]
+		if !ok {
+			return order, failure.BadRequestFromString(fmt.Sprintf("specified Product %s does not exist", itemInput.ProductID))
+		}
+
+		price, err := product.Price.Multiply(itemInput.Qty)
+		if err != nil {
+			return order, err
+		}
+
+		itemID, _ := uuid.NewV4()
+		order.Items = append(order.Items, OrderItem{
+			ID:        itemID,
+			OrderID:   order.ID,
+			ProductID: product.ID,
+			Qty:       itemInput.Qty,
+			Price:     price,
+		})
+	}
+
+	total, err := order.ComputeTotal()
+	if err != nil {
+		return order, err
+	}
+	order.TotalPrice = total
+
+	return order, nil
+}
+
+// ComputeSubtotal adds up the prices of the Order's items. It fails if the items are priced in different currencies.
+func (o *Order) ComputeSubtotal() (Money, error) {
+	if len(o.Items) == 0 {
+		return Money{}, failure.BadRequestFromString("cannot compute the total of an order without items")
+	}
+
+	subtotal := NewMoney(0, o.Items[0].Price.Currency)
+	for _, item := range o.Items {
+		var err error
+		subtotal, err = subtotal.Add(item.Price)
+		if err != nil {
+			return Money{}, err
+		}
+	}
+	return subtotal, nil
+}
+
+// ComputeTotal computes the total of the Order from the prices of its items less its discounts
+func (o *Order) ComputeTotal() (Money, error) {
+	total, err := o.ComputeSubtotal()
+	if err != nil {
+		return Money{}, err
+	}
+
+	for _, discount := range o.Discounts {
+		total, err = total.Subtract(discount.Amount)
+		if err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// VerifyTotal checks that the stored total of the Order still matches the total of its items less its discounts
+func (o *Order) VerifyTotal() error {
+	total, err := o.ComputeTotal()
+	if err != nil {
+		return err
+	}
+
+	if total != o.TotalPrice {
+		return failure.OperationNotPermitted(
+			"process",
+			"Order",
+			fmt.Sprintf("stored total %s does not match the items' total %s", o.TotalPrice, total))
+	}
+
+	return nil
 }
 
 // AttachItems attaches Order Items to an Order
@@ -25,27 +173,408 @@ func (o *Order) AttachItems(items []OrderItem) Order {
 	return *o
 }
 
-// Process updates an Order's status to processing
+// AttachDiscounts attaches Order Discounts to an Order
+func (o *Order) AttachDiscounts(discounts []OrderDiscount) Order {
+	for _, discount := range discounts {
+		if discount.OrderID == o.ID {
+			o.Discounts = append(o.Discounts, discount)
+		}
+	}
+	return *o
+}
+
+// AttachAllocations attaches Allocations to an Order
+func (o *Order) AttachAllocations(allocations []Allocation) Order {
+	for _, allocation := range allocations {
+		if allocation.OrderID == o.ID {
+			o.Allocations = append(o.Allocations, allocation)
+		}
+	}
+	return *o
+}
+
+// ProductIDs returns the distinct Product IDs referenced by the Order's items
+func (o *Order) ProductIDs() []uuid.UUID {
+	seen := make(map[uuid.UUID]bool)
+	productIDs := make([]uuid.UUID, 0)
+	for _, item := range o.Items {
+		if !seen[item.ProductID] {
+			seen[item.ProductID] = true
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+	return productIDs
+}
+
+// PromotionIDs returns the distinct IDs of the Promotions applied to the Order, in ascending order
+func (o *Order) PromotionIDs() []uuid.UUID {
+	seen := make(map[uuid.UUID]bool)
+	promotionIDs := make([]uuid.UUID, 0)
+	for _, discount := range o.Discounts {
+		if !seen[discount.PromotionID] {
+			seen[discount.PromotionID] = true
+			promotionIDs = append(promotionIDs, discount.PromotionID)
+		}
+	}
+	sort.Slice(promotionIDs, func(i, j int) bool {
+		return promotionIDs[i].String() < promotionIDs[j].String()
+	})
+	return promotionIDs
+}
+
+// QtyByProduct returns the total quantity ordered for each Product across all of the Order's items
+func (o *Order) QtyByProduct() map[uuid.UUID]int {
+	qtyMap := make(map[uuid.UUID]int)
+	for _, item := range o.Items {
+		qtyMap[item.ProductID] += item.Qty
+	}
+	return qtyMap
+}
+
+// QtyByInventory returns the total quantity allocated from each Inventory across all of the Order's allocations
+func (o *Order) QtyByInventory() map[uuid.UUID]int {
+	qtyMap := make(map[uuid.UUID]int)
+	for _, allocation := range o.Allocations {
+		qtyMap[allocation.InventoryID] += allocation.Qty
+	}
+	return qtyMap
+}
+
+// CanTransitionTo checks whether an Order may move from its current status to the specified one
+func (o *Order) CanTransitionTo(status string) bool {
+	for _, allowed := range orderTransitions[o.Status] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Process updates an Order's status to processing and records when it happened
 func (o *Order) Process() error {
-	if o.Status != "new" {
-		return errors.New("cannot process an order that is not new")
+	if err := o.transitionTo("process", OrderStatusProcessing); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	o.ProcessedAt = &now
+
+	return nil
+}
+
+// MarkPaid updates an Order's status to paid
+func (o *Order) MarkPaid() error {
+	return o.transitionTo("pay", OrderStatusPaid)
+}
+
+// FailPayment updates an Order's status to payment_failed
+func (o *Order) FailPayment() error {
+	return o.transitionTo("fail the payment of", OrderStatusPaymentFailed)
+}
+
+// Complete updates an Order's status to completed
+func (o *Order) Complete() error {
+	return o.transitionTo("complete", OrderStatusCompleted)
+}
+
+// Cancel updates an Order's status to cancelled
+func (o *Order) Cancel() error {
+	return o.transitionTo("cancel", OrderStatusCancelled)
+}
+
+// Expire updates an Order's status to expired
+func (o *Order) Expire() error {
+	return o.transitionTo("expire", OrderStatusExpired)
+}
+
+func (o *Order) transitionTo(operation string, status string) error {
+	if !o.CanTransitionTo(status) {
+		return failure.OperationNotPermitted(
+			operation,
+			"Order",
+			fmt.Sprintf("cannot %s an order that is %s", operation, o.Status))
 	}
 
-	o.Status = "processing"
+	o.Status = status
 
 	return nil
 }
 
-// OrderItem represents an Order Item entity
+// OrderItem represents an Order Item entity. The Components of an item for a bundle are attached while the Order
+// is processed or changes status, and are not stored.
 type OrderItem struct {
-	ID        uuid.UUID `json:"id" db:"entity_id" validate:"min=36,max=36"`
-	OrderID   uuid.UUID `json:"orderId" db:"order_entity_id" validate:"min=36,max=36"`
-	ProductID uuid.UUID `json:"productId" db:"product_entity_id" validate:"min=36,max=36"`
-	Qty       int       `json:"qty" db:"qty" validate:"min=1"`
-	Price     float64   `json:"price" db:"price"`
+	ID         uuid.UUID         `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	OrderID    uuid.UUID         `json:"orderId" db:"order_entity_id" validate:"min=36,max=36"`
+	ProductID  uuid.UUID         `json:"productId" db:"product_entity_id" validate:"min=36,max=36"`
+	Qty        int               `json:"qty" db:"qty" validate:"min=1"`
+	Price      Money             `json:"price" db:"price"`
+	Components []BundleComponent `json:"-" db:"-"`
+}
+
+// OrderInput represents the input object for creating new Orders
+type OrderInput struct {
+	ID           uuid.UUID        `json:"id,omitempty"`
+	CustomerRef  string           `json:"customerRef,omitempty"`
+	Items        []OrderItemInput `json:"items"`
+	VoucherCodes []string         `json:"voucherCodes,omitempty"`
+}
+
+// Validate validates the OrderInput object
+func (i *OrderInput) Validate() error {
+	if len(strings.TrimSpace(i.CustomerRef)) > 64 {
+		return failure.BadRequestFromString("customer reference must not be longer than 64 characters")
+	}
+
+	if len(i.Items) == 0 {
+		return failure.BadRequestFromString("order must have at least one item")
+	}
+
+	for _, item := range i.Items {
+		if item.ProductID == uuid.Nil {
+			return failure.BadRequestFromString("order item must specify a product")
+		}
+
+		if item.Qty <= 0 {
+			return failure.BadRequestFromString("order item quantity must be positive integer")
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range i.VoucherCodes {
+		code = NormalizeVoucherCode(code)
+		if code == "" {
+			return failure.BadRequestFromString("voucher code must not be empty")
+		}
+
+		if seen[code] {
+			return failure.BadRequestFromString(fmt.Sprintf("voucher %s is specified more than once", code))
+		}
+		seen[code] = true
+	}
+
+	return nil
+}
+
+// ProductIDs returns the distinct Product IDs referenced by the input's items
+func (i *OrderInput) ProductIDs() []uuid.UUID {
+	seen := make(map[uuid.UUID]bool)
+	productIDs := make([]uuid.UUID, 0)
+	for _, item := range i.Items {
+		if !seen[item.ProductID] {
+			seen[item.ProductID] = true
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+	return productIDs
+}
+
+// OrderItemInput represents the input object for a single item of a new Order
+type OrderItemInput struct {
+	ProductID uuid.UUID `json:"productId"`
+	Qty       int       `json:"qty"`
+}
+
+// OrderFilter represents the criteria for resolving a Page of Orders
+type OrderFilter struct {
+	Status    string
+	Code      string
+	ProductID uuid.UUID
+	SortBy    string
+	SortOrder string
+	Page      int
+	PageSize  int
+}
+
+// orderSortFields maps the sortable fields of an Order to their columns
+var orderSortFields = map[string]string{
+	"code":        "`orders`.order_code",
+	"totalPrice":  "`orders`.total_price",
+	"status":      "`orders`.status",
+	"processedAt": "`orders`.processed_at",
+}
+
+// Validate validates the OrderFilter object and fills in default sorting
+func (f *OrderFilter) Validate() error {
+	if f.Status != "" && !IsOrderStatus(f.Status) {
+		return failure.BadRequestFromString(fmt.Sprintf("unknown order status %s", f.Status))
+	}
+
+	if f.SortBy == "" {
+		f.SortBy = "code"
+	}
+
+	if _, ok := orderSortFields[f.SortBy]; !ok {
+		return failure.BadRequestFromString(fmt.Sprintf("cannot sort orders by %s", f.SortBy))
+	}
+
+	if f.SortOrder == "" {
+		f.SortOrder = "asc"
+	}
+
+	if f.SortOrder != "asc" && f.SortOrder != "desc" {
+		return failure.BadRequestFromString("sort order must be either asc or desc")
+	}
+
+	return nil
+}
+
+// SortClause returns the ORDER BY clause for the OrderFilter's sorting
+func (f *OrderFilter) SortClause() string {
+	return fmt.Sprintf("%s %s, `orders`.entity_id %s", orderSortFields[f.SortBy], f.SortOrder, f.SortOrder)
 }
 
 // OrderProcessInput represents an input where the user wants to process an Order
 type OrderProcessInput struct {
 	OrderID uuid.UUID `json:"orderId"`
 }
+
+const (
+	// OrderBatchModeBestEffort processes every Order of a batch on its own, so some may succeed while others fail
+	OrderBatchModeBestEffort = "bestEffort"
+	// OrderBatchModeAllOrNothing processes all Orders of a batch in one transaction that is rolled back if any fails
+	OrderBatchModeAllOrNothing = "allOrNothing"
+)
+
+const (
+	// OrderBatchStatusProcessed is the result of an Order that was processed
+	OrderBatchStatusProcessed = "processed"
+	// OrderBatchStatusInsufficientStock is the result of an Order that lacked stock
+	OrderBatchStatusInsufficientStock = "insufficientStock"
+	// OrderBatchStatusSoldOut is the result of an Order turned away by the flash-sale stock gate
+	OrderBatchStatusSoldOut = "soldOut"
+	// OrderBatchStatusPurchaseLimitExceeded is the result of an Order that went past a customer purchase limit
+	OrderBatchStatusPurchaseLimitExceeded = "purchaseLimitExceeded"
+	// OrderBatchStatusPromotionExhausted is the result of an Order whose Promotion reached its usage cap
+	OrderBatchStatusPromotionExhausted = "promotionExhausted"
+	// OrderBatchStatusNotNew is the result of an Order that was not new anymore
+	OrderBatchStatusNotNew = "notNew"
+	// OrderBatchStatusNotFound is the result of an Order that does not exist
+	OrderBatchStatusNotFound = "notFound"
+	// OrderBatchStatusRolledBack is the result of an Order that could be processed but was rolled back because
+	// another Order of an all-or-nothing batch failed
+	OrderBatchStatusRolledBack = "rolledBack"
+	// OrderBatchStatusFailed is the result of an Order that failed for any other reason
+	OrderBatchStatusFailed = "failed"
+)
+
+// OrderBatchProcessInput represents an input where the user wants to process several Orders at once
+type OrderBatchProcessInput struct {
+	OrderIDs []uuid.UUID `json:"orderIds"`
+	Mode     string      `json:"mode"`
+}
+
+// Validate validates the OrderBatchProcessInput object against the maximum batch size and fills in the default mode
+func (i *OrderBatchProcessInput) Validate(maxSize int) error {
+	if len(i.OrderIDs) == 0 {
+		return failure.BadRequestFromString("batch must have at least one order")
+	}
+
+	if len(i.OrderIDs) > maxSize {
+		return failure.BadRequestFromString(fmt.Sprintf("batch must not have more than %d orders", maxSize))
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for _, orderID := range i.OrderIDs {
+		if orderID == uuid.Nil {
+			return failure.BadRequestFromString("batch must not have empty order IDs")
+		}
+
+		if seen[orderID] {
+			return failure.BadRequestFromString(fmt.Sprintf("order %s appears more than once in the batch", orderID))
+		}
+		seen[orderID] = true
+	}
+
+	if i.Mode == "" {
+		i.Mode = OrderBatchModeBestEffort
+	}
+
+	if i.Mode != OrderBatchModeBestEffort && i.Mode != OrderBatchModeAllOrNothing {
+		return failure.BadRequestFromString(fmt.Sprintf("batch mode must be either %s or %s", OrderBatchModeBestEffort, OrderBatchModeAllOrNothing))
+	}
+
+	return nil
+}
+
+// OrderBatchResult represents the outcome of processing a single Order of a batch
+type OrderBatchResult struct {
+	OrderID uuid.UUID   `json:"orderId"`
+	Status  string      `json:"status"`
+	Order   *Order      `json:"order,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// NewOrderBatchResult creates the result of processing an Order from the processed Order or the failure that
+// stopped it. Whether the Order exists and is new is decided from the Order itself, see NewSkippedOrderBatchResult,
+// so any other failure is reported as failed.
+func NewOrderBatchResult(orderID uuid.UUID, order *Order, err error) OrderBatchResult {
+	result := OrderBatchResult{
+		OrderID: orderID,
+		Status:  OrderBatchStatusProcessed,
+		Order:   order,
+	}
+	if err == nil {
+		return result
+	}
+
+	result.Order = nil
+	result.Error = err.Error()
+	result.Details = failure.GetDetails(err)
+	switch failure.GetCode(err) {
+	case failure.CodeInsufficientStock:
+		result.Status = OrderBatchStatusInsufficientStock
+	case failure.CodeSoldOut:
+		result.Status = OrderBatchStatusSoldOut
+	case failure.CodePurchaseLimitExceeded:
+		result.Status = OrderBatchStatusPurchaseLimitExceeded
+	case failure.CodePromotionExhausted:
+		result.Status = OrderBatchStatusPromotionExhausted
+	default:
+		result.Status = OrderBatchStatusFailed
+	}
+
+	return result
+}
+
+// NewSkippedOrderBatchResult creates the result of an Order that is not processed at all, because it does not exist
+// (nil) or is not new anymore. It returns nil for a new Order, which can be processed.
+func NewSkippedOrderBatchResult(orderID uuid.UUID, order *Order) *OrderBatchResult {
+	var err error
+	var status string
+	switch {
+	case order == nil:
+		err, status = failure.EntityNotFound("Order"), OrderBatchStatusNotFound
+	case order.Status != OrderStatusNew:
+		err, status = failure.OperationNotPermitted("process", "Order", fmt.Sprintf("cannot process an order that is %s", order.Status)), OrderBatchStatusNotNew
+	default:
+		return nil
+	}
+
+	return &OrderBatchResult{OrderID: orderID, Status: status, Error: err.Error()}
+}
+
+// OrderBatchResponse represents the outcome of processing a batch of Orders, with one result per Order in the
+// order they were requested
+type OrderBatchResponse struct {
+	Mode      string             `json:"mode"`
+	Processed int                `json:"processed"`
+	Failed    int                `json:"failed"`
+	Results   []OrderBatchResult `json:"results"`
+}
+
+// NewOrderBatchResponse creates the outcome of a batch from the results of its Orders
+func NewOrderBatchResponse(mode string, results []OrderBatchResult) OrderBatchResponse {
+	response := OrderBatchResponse{
+		Mode:    mode,
+		Results: results,
+	}
+	for _, result := range results {
+		if result.Status == OrderBatchStatusProcessed {
+			response.Processed++
+		} else {
+			response.Failed++
+		}
+	}
+	return response
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const (
+	// orderCodeAlphabet holds every digit and upper-case letter
+	orderCodeAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// unambiguousOrderCodeAlphabet is Crockford's Base32 alphabet, which leaves out I, L and O so they cannot be
+	// mistaken for 1 and 0, and U so that codes do not spell out words by accident
+	unambiguousOrderCodeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	// orderCodeDateLayout is the layout of the date segment of an Order code
+	orderCodeDateLayout = "060102"
+)
+
+// orderCodeLookAlikes reads the letters left out of the unambiguous alphabet as the digits they look like
+var orderCodeLookAlikes = strings.NewReplacer("I", "1", "L", "1", "O", "0")
+
+// OrderCodeFormat generates Order codes made of a prefix, the date the Order was created, a sequence number that
+// starts over every day, and a check character, e.g. EVM-261017-0004KF. The sequence number is written in the base of
+// the alphabet, padded to a minimum width. The check character is worked out with the Luhn mod N algorithm over
+// everything before it, so that a single mistyped character and most swaps of two neighbours are caught.
+type OrderCodeFormat struct {
+	prefix        string
+	sequenceWidth int
+	unambiguous   bool
+	alphabet      string
+}
+
+// NewOrderCodeFormat creates an OrderCodeFormat. When unambiguous is set, generated codes leave out characters that
+// are easily mistaken for others, and the prefix must not contain them either.
+func NewOrderCodeFormat(prefix string, sequenceWidth int, unambiguous bool) (OrderCodeFormat, error) {
+	format := OrderCodeFormat{
+		prefix:        prefix,
+		sequenceWidth: sequenceWidth,
+		unambiguous:   unambiguous,
+		alphabet:      orderCodeAlphabet,
+	}
+	if unambiguous {
+		format.alphabet = unambiguousOrderCodeAlphabet
+	}
+
+	if prefix == "" || len(prefix) > 10 {
+		return format, failure.BadRequestFromString("order code prefix must have between 1 and 10 characters")
+	}
+
+	for _, char := range prefix {
+		if !strings.ContainsRune(format.alphabet, char) {
+			return format, failure.BadRequestFromString(
+				fmt.Sprintf("order code prefix must only contain characters from %s", format.alphabet))
+		}
+	}
+
+	if sequenceWidth < 1 || sequenceWidth > 12 {
+		return format, failure.BadRequestFromString("order code sequence width must be between 1 and 12")
+	}
+
+	return format, nil
+}
+
+// SequenceName returns the name of the sequence that numbers the Orders created at the specified time
+func (f OrderCodeFormat) SequenceName(at time.Time) string {
+	return f.prefix + "-" + at.Format(orderCodeDateLayout)
+}
+
+// Format formats the code of an Order created at the specified time with a number from its sequence
+func (f OrderCodeFormat) Format(at time.Time, sequence int64) string {
+	base := int64(len(f.alphabet))
+	digits := make([]byte, 0)
+	for ; sequence > 0; sequence /= base {
+		digits = append([]byte{f.alphabet[sequence%base]}, digits...)
+	}
+	for len(digits) < f.sequenceWidth {
+		digits = append([]byte{f.alphabet[0]}, digits...)
+	}
+
+	date := at.Format(orderCodeDateLayout)
+	check := f.checkCharacter(f.prefix + date + string(digits))
+	return fmt.Sprintf("%s-%s-%s%c", f.prefix, date, digits, check)
+}
+
+// Normalize cleans up an Order code as read back by a customer: it is trimmed and upper-cased and, for unambiguous
+// codes, letters that look like digits are read as those digits after the prefix
+func (f OrderCodeFormat) Normalize(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !f.unambiguous || !strings.HasPrefix(code, f.prefix+"-") {
+		return code
+	}
+
+	return f.prefix + orderCodeLookAlikes.Replace(code[len(f.prefix):])
+}
+
+// Verify checks an Order code that has the shape of a generated one against its check character. Codes of any
+// other shape are left alone, since they were not generated with this format.
+func (f OrderCodeFormat) Verify(code string) error {
+	segments := strings.Split(code, "-")
+	if len(segments) != 3 || segments[0] != f.prefix || len(segments[1]) != len(orderCodeDateLayout) ||
+		len(segments[2]) < f.sequenceWidth+1 {
+		return nil
+	}
+
+	body := strings.Join(segments, "")
+	for _, char := range body {
+		if !strings.ContainsRune(f.alphabet, char) {
+			return nil
+		}
+	}
+
+	if f.checkCharacter(body[:len(body)-1]) != body[len(body)-1] {
+		return failure.BadRequestFromString(fmt.Sprintf("order code %s has a wrong check character", code))
+	}
+
+	return nil
+}
+
+// checkCharacter works out the Luhn mod N check character of a string made of characters from the alphabet
+func (f OrderCodeFormat) checkCharacter(body string) byte {
+	base := len(f.alphabet)
+	factor := 2
+	sum := 0
+	for idx := len(body) - 1; idx >= 0; idx-- {
+		addend := factor * strings.IndexByte(f.alphabet, body[idx])
+		sum += addend/base + addend%base
+		factor = 3 - factor
+	}
+
+	return f.alphabet[(base-sum%base)%base]
+}
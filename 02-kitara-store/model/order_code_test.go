@@ -0,0 +1,113 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestOrderCodeFormat(t *testing.T) {
+
+	at := time.Date(2026, time.October, 17, 12, 0, 0, 0, time.UTC)
+
+	t.Run("format", func(t *testing.T) {
+		format, err := NewOrderCodeFormat("EVM", 5, false)
+		if err != nil {
+			t.Fatalf("failed to create format: %v", err)
+		}
+
+		if name := format.SequenceName(at); name != "EVM-261017" {
+			t.Errorf("wrong sequence name: got %s want EVM-261017", name)
+		}
+
+		cases := map[int64]string{1: "EVM-261017-00001", 36: "EVM-261017-00010", 60466176: "EVM-261017-100000"}
+		for sequence, expected := range cases {
+			code := format.Format(at, sequence)
+			if code[:len(code)-1] != expected {
+				t.Errorf("wrong code for sequence %d: got %s want %s and a check character", sequence, code, expected)
+			}
+			if err := format.Verify(code); err != nil {
+				t.Errorf("generated code %s does not verify: %v", code, err)
+			}
+		}
+	})
+
+	t.Run("checkCharacterCatchesMistakes", func(t *testing.T) {
+		format, _ := NewOrderCodeFormat("EVM", 5, false)
+		code := format.Format(at, 12345)
+
+		for idx := len("EVM-"); idx < len(code)-1; idx++ {
+			if code[idx] == '-' {
+				continue
+			}
+
+			for _, char := range orderCodeAlphabet {
+				if byte(char) == code[idx] {
+					continue
+				}
+				mistyped := code[:idx] + string(char) + code[idx+1:]
+				if failure.GetCode(format.Verify(mistyped)) != failure.CodeBadRequest {
+					t.Errorf("mistyped code %s of %s verifies", mistyped, code)
+				}
+			}
+
+			if next := idx + 1; next < len(code)-1 && code[next] != '-' && code[next] != code[idx] {
+				swapped := code[:idx] + string(code[next]) + string(code[idx]) + code[next+1:]
+				if failure.GetCode(format.Verify(swapped)) != failure.CodeBadRequest {
+					t.Errorf("swapped code %s of %s verifies", swapped, code)
+				}
+			}
+		}
+	})
+
+	t.Run("otherCodesAreLeftAlone", func(t *testing.T) {
+		format, _ := NewOrderCodeFormat("EVM", 5, false)
+		for _, code := range []string{"EVM-TEST-ORDER-1", "ORDER-1", "EVM-261017-01"} {
+			if err := format.Verify(code); err != nil {
+				t.Errorf("code %s was rejected: %v", code, err)
+			}
+		}
+	})
+
+	t.Run("unambiguous", func(t *testing.T) {
+		format, err := NewOrderCodeFormat("EVM", 5, true)
+		if err != nil {
+			t.Fatalf("failed to create format: %v", err)
+		}
+
+		for sequence := int64(1); sequence < 2000; sequence++ {
+			code := format.Format(at, sequence)
+			if strings.ContainsAny(code, "ILOU") {
+				t.Fatalf("unambiguous code %s contains an ambiguous character", code)
+			}
+		}
+
+		code := format.Format(at, 32)
+		misread := strings.ToLower(strings.Replace(strings.Replace(code, "0", "O", -1), "1", "l", -1))
+		if normalized := format.Normalize(" " + misread + " "); normalized != code {
+			t.Errorf("wrong normalized code: got %s want %s", normalized, code)
+		}
+
+		if _, err := NewOrderCodeFormat("KTR", 5, true); err != nil {
+			t.Errorf("unambiguous prefix was rejected: %v", err)
+		}
+		if _, err := NewOrderCodeFormat("LOOT", 5, true); err == nil {
+			t.Errorf("ambiguous prefix was accepted")
+		}
+	})
+
+	t.Run("invalidFormats", func(t *testing.T) {
+		for _, prefix := range []string{"", "EVM-", "evm", "TOOLONGPREFIX"} {
+			if _, err := NewOrderCodeFormat(prefix, 5, false); err == nil {
+				t.Errorf("prefix %q was accepted", prefix)
+			}
+		}
+
+		if _, err := NewOrderCodeFormat("EVM", 0, false); err == nil {
+			t.Errorf("sequence width 0 was accepted")
+		}
+	})
+
+}
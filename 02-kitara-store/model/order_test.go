@@ -0,0 +1,269 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestOrderTransitions(t *testing.T) {
+
+	transitions := []struct {
+		name     string
+		from     string
+		apply    func(o *Order) error
+		expected string
+		allowed  bool
+	}{
+		{"processNew", OrderStatusNew, (*Order).Process, OrderStatusProcessing, true},
+		{"cancelNew", OrderStatusNew, (*Order).Cancel, OrderStatusCancelled, true},
+		{"completeNew", OrderStatusNew, (*Order).Complete, OrderStatusNew, false},
+		{"processProcessing", OrderStatusProcessing, (*Order).Process, OrderStatusProcessing, false},
+		{"completeProcessing", OrderStatusProcessing, (*Order).Complete, OrderStatusCompleted, true},
+		{"cancelProcessing", OrderStatusProcessing, (*Order).Cancel, OrderStatusCancelled, true},
+		{"payProcessing", OrderStatusProcessing, (*Order).MarkPaid, OrderStatusPaid, true},
+		{"payNew", OrderStatusNew, (*Order).MarkPaid, OrderStatusNew, false},
+		{"failPaymentProcessing", OrderStatusProcessing, (*Order).FailPayment, OrderStatusPaymentFailed, true},
+		{"failPaymentPaid", OrderStatusPaid, (*Order).FailPayment, OrderStatusPaid, false},
+		{"completePaid", OrderStatusPaid, (*Order).Complete, OrderStatusCompleted, true},
+		{"cancelPaid", OrderStatusPaid, (*Order).Cancel, OrderStatusPaid, false},
+		{"processPaymentFailed", OrderStatusPaymentFailed, (*Order).Process, OrderStatusPaymentFailed, false},
+		{"cancelCompleted", OrderStatusCompleted, (*Order).Cancel, OrderStatusCompleted, false},
+		{"processCancelled", OrderStatusCancelled, (*Order).Process, OrderStatusCancelled, false},
+	}
+
+	for _, tc := range transitions {
+		t.Run(tc.name, func(t *testing.T) {
+			order := Order{Status: tc.from}
+			err := tc.apply(&order)
+
+			if tc.allowed && err != nil {
+				t.Errorf("transition returned unexpected error: %v", err)
+			}
+
+			if !tc.allowed && failure.GetCode(err) != failure.CodeOperationNotPermitted {
+				t.Errorf("transition returned wrong error: got %v want %v", err, failure.CodeOperationNotPermitted)
+			}
+
+			if order.Status != tc.expected {
+				t.Errorf("transition left wrong status: got %v want %v", order.Status, tc.expected)
+			}
+		})
+	}
+
+}
+
+func TestOrderBatchProcessInput(t *testing.T) {
+
+	orderA, _ := uuid.NewV4()
+	orderB, _ := uuid.NewV4()
+
+	inputs := []struct {
+		name  string
+		input OrderBatchProcessInput
+		valid bool
+	}{
+		{"defaultMode", OrderBatchProcessInput{OrderIDs: []uuid.UUID{orderA, orderB}}, true},
+		{"allOrNothing", OrderBatchProcessInput{OrderIDs: []uuid.UUID{orderA}, Mode: OrderBatchModeAllOrNothing}, true},
+		{"empty", OrderBatchProcessInput{}, false},
+		{"tooMany", OrderBatchProcessInput{OrderIDs: []uuid.UUID{orderA, orderB, uuid.Must(uuid.NewV4())}}, false},
+		{"duplicate", OrderBatchProcessInput{OrderIDs: []uuid.UUID{orderA, orderA}}, false},
+		{"unknownMode", OrderBatchProcessInput{OrderIDs: []uuid.UUID{orderA}, Mode: "sometimes"}, false},
+	}
+
+	for _, tc := range inputs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.input.Validate(2)
+			if tc.valid && err != nil {
+				t.Errorf("validation returned unexpected error: %v", err)
+			}
+			if !tc.valid && failure.GetCode(err) != failure.CodeBadRequest {
+				t.Errorf("validation returned wrong error: got %v want %v", err, failure.CodeBadRequest)
+			}
+			if tc.valid && tc.input.Mode == "" {
+				t.Errorf("validation did not fill in the default mode")
+			}
+		})
+	}
+
+}
+
+func TestNewOrderBatchResponse(t *testing.T) {
+
+	orderID, _ := uuid.NewV4()
+	order := &Order{ID: orderID, Status: OrderStatusProcessing}
+
+	results := []OrderBatchResult{
+		NewOrderBatchResult(orderID, order, nil),
+		NewOrderBatchResult(orderID, nil, failure.InsufficientStock("insufficient stock", []StockShortage{})),
+		NewOrderBatchResult(orderID, nil, failure.OperationNotPermitted("process", "Order", "stored total IDR 10 does not match the items' total IDR 20")),
+		NewOrderBatchResult(orderID, nil, failure.EntityNotFound("Inventory")),
+		NewOrderBatchResult(orderID, nil, failure.SoldOut("sold out")),
+		NewOrderBatchResult(orderID, nil, failure.PromotionExhausted("promotion has been fully redeemed")),
+	}
+
+	expected := []string{
+		OrderBatchStatusProcessed,
+		OrderBatchStatusInsufficientStock,
+		OrderBatchStatusFailed,
+		OrderBatchStatusFailed,
+		OrderBatchStatusSoldOut,
+		OrderBatchStatusPromotionExhausted,
+	}
+	for idx, result := range results {
+		if result.Status != expected[idx] {
+			t.Errorf("wrong status for result %d: got %v want %v", idx, result.Status, expected[idx])
+		}
+	}
+
+	if results[1].Details == nil || results[1].Order != nil {
+		t.Errorf("failed result does not carry the failure details: %+v", results[1])
+	}
+
+	response := NewOrderBatchResponse(OrderBatchModeBestEffort, results)
+	if response.Processed != 1 || response.Failed != 5 {
+		t.Errorf("wrong counts: got %d processed and %d failed want 1 and 5", response.Processed, response.Failed)
+	}
+
+}
+
+func TestNewSkippedOrderBatchResult(t *testing.T) {
+
+	orderID, _ := uuid.NewV4()
+	cases := []struct {
+		name     string
+		order    *Order
+		expected string
+	}{
+		{"missing", nil, OrderBatchStatusNotFound},
+		{"notNew", &Order{ID: orderID, Status: OrderStatusCompleted}, OrderBatchStatusNotNew},
+		{"new", &Order{ID: orderID, Status: OrderStatusNew}, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := NewSkippedOrderBatchResult(orderID, c.order)
+			if c.expected == "" {
+				if result != nil {
+					t.Errorf("new order was skipped: %+v", result)
+				}
+				return
+			}
+
+			if result == nil || result.Status != c.expected || result.Error == "" || result.OrderID != orderID {
+				t.Errorf("unexpected result: %+v", result)
+			}
+		})
+	}
+
+}
+
+func TestNewOrderFromInput(t *testing.T) {
+
+	productA := Product{ID: uuid.Must(uuid.NewV4()), Price: NewMoney(1999, "IDR")}
+	productB := Product{ID: uuid.Must(uuid.NewV4()), Price: NewMoney(250, "IDR")}
+	unknown := uuid.Must(uuid.NewV4())
+	products := []Product{productA, productB}
+
+	inputs := []struct {
+		name   string
+		items  []OrderItemInput
+		prices []Money
+		total  Money
+		code   failure.Code
+	}{
+		{"singleItem", []OrderItemInput{{ProductID: productA.ID, Qty: 1}}, []Money{NewMoney(1999, "IDR")}, NewMoney(1999, "IDR"), ""},
+		{"multipliedByQty", []OrderItemInput{{ProductID: productB.ID, Qty: 4}}, []Money{NewMoney(1000, "IDR")}, NewMoney(1000, "IDR"), ""},
+		{"severalItems", []OrderItemInput{{ProductID: productA.ID, Qty: 2}, {ProductID: productB.ID, Qty: 3}}, []Money{NewMoney(3998, "IDR"), NewMoney(750, "IDR")}, NewMoney(4748, "IDR"), ""},
+		{"unknownProduct", []OrderItemInput{{ProductID: productA.ID, Qty: 1}, {ProductID: unknown, Qty: 1}}, nil, Money{}, failure.CodeBadRequest},
+		{"zeroQty", []OrderItemInput{{ProductID: productA.ID, Qty: 0}}, nil, Money{}, failure.CodeBadRequest},
+		{"negativeQty", []OrderItemInput{{ProductID: productA.ID, Qty: -2}}, nil, Money{}, failure.CodeBadRequest},
+	}
+
+	for _, tc := range inputs {
+		t.Run(tc.name, func(t *testing.T) {
+			input := OrderInput{Items: tc.items}
+			order, err := NewOrderFromInput(input, products)
+			if tc.code != "" {
+				if err == nil || failure.GetCode(err) != tc.code {
+					t.Errorf("wrong error: got %v want %v", err, tc.code)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := input.Validate(); err != nil {
+				t.Errorf("validation returned unexpected error: %v", err)
+			}
+			if order.Status != OrderStatusNew || len(order.Items) != len(tc.prices) {
+				t.Fatalf("unexpected order: %+v", order)
+			}
+			for idx, item := range order.Items {
+				if item.Price != tc.prices[idx] || item.OrderID != order.ID {
+					t.Errorf("wrong item %d: got %+v want price %v", idx, item, tc.prices[idx])
+				}
+			}
+			if order.TotalPrice != tc.total {
+				t.Errorf("wrong total: got %v want %v", order.TotalPrice, tc.total)
+			}
+		})
+	}
+
+	t.Run("nonPositiveQtyInput", func(t *testing.T) {
+		for _, qty := range []int{0, -1} {
+			input := OrderInput{Items: []OrderItemInput{{ProductID: productA.ID, Qty: qty}}}
+			if err := input.Validate(); err == nil || failure.GetCode(err) != failure.CodeBadRequest {
+				t.Errorf("validating quantity %d returned %v", qty, err)
+			}
+		}
+	})
+
+}
+
+func TestNewOrderFromInputTotal(t *testing.T) {
+
+	productA := Product{ID: uuid.Must(uuid.NewV4()), Price: NewMoney(1999, "IDR")}
+	productB := Product{ID: uuid.Must(uuid.NewV4()), Price: NewMoney(1, "IDR")}
+	productUSD := Product{ID: uuid.Must(uuid.NewV4()), Price: NewMoney(100, "USD")}
+	products := []Product{productA, productB, productUSD}
+
+	t.Run("exactTotal", func(t *testing.T) {
+		order, err := NewOrderFromInput(OrderInput{Items: []OrderItemInput{
+			{ProductID: productA.ID, Qty: 3},
+			{ProductID: productB.ID, Qty: 7},
+		}}, products)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if order.TotalPrice != NewMoney(6004, "IDR") {
+			t.Errorf("wrong total: got %v want %v", order.TotalPrice, NewMoney(6004, "IDR"))
+		}
+		if err := order.VerifyTotal(); err != nil {
+			t.Errorf("verification returned unexpected error: %v", err)
+		}
+	})
+
+	t.Run("mixedCurrencies", func(t *testing.T) {
+		_, err := NewOrderFromInput(OrderInput{Items: []OrderItemInput{
+			{ProductID: productA.ID, Qty: 1},
+			{ProductID: productUSD.ID, Qty: 1},
+		}}, products)
+		if failure.GetCode(err) != failure.CodeBadRequest {
+			t.Errorf("wrong error: got %v want %v", err, failure.CodeBadRequest)
+		}
+	})
+
+	t.Run("tamperedTotal", func(t *testing.T) {
+		order, _ := NewOrderFromInput(OrderInput{Items: []OrderItemInput{
+			{ProductID: productA.ID, Qty: 1},
+		}}, products)
+		order.TotalPrice = NewMoney(1000, "IDR")
+		if err := order.VerifyTotal(); failure.GetCode(err) != failure.CodeOperationNotPermitted {
+			t.Errorf("wrong error: got %v want %v", err, failure.CodeOperationNotPermitted)
+		}
+	})
+
+}
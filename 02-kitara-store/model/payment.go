@@ -0,0 +1,259 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const (
+	// PaymentStatusPending is the status of a Payment whose charge has not been settled by the gateway yet
+	PaymentStatusPending = "pending"
+	// PaymentStatusSucceeded is the status of a Payment whose charge went through
+	PaymentStatusSucceeded = "succeeded"
+	// PaymentStatusFailed is the status of a Payment whose charge was declined
+	PaymentStatusFailed = "failed"
+	// PaymentStatusRefundPending is the status of a Payment whose charge went through for an Order that can no
+	// longer be paid, until the gateway refunds it
+	PaymentStatusRefundPending = "refund_pending"
+	// PaymentStatusRefunded is the status of a Payment whose charge was refunded by the gateway
+	PaymentStatusRefunded = "refunded"
+)
+
+const (
+	// ChargeStatusSucceeded is the status the payment gateway reports for a charge that went through
+	ChargeStatusSucceeded = "succeeded"
+	// ChargeStatusDeclined is the status the payment gateway reports for a charge that was declined
+	ChargeStatusDeclined = "declined"
+)
+
+// Payment represents an attempt to charge the total price of an Order through the payment gateway. A Payment stays
+// pending until the gateway settles its charge, either in its response to the charge request or later through a
+// webhook. A charge that went through after its Order was cancelled, expired or failed is refunded.
+type Payment struct {
+	ID            uuid.UUID  `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	OrderID       uuid.UUID  `json:"orderId" db:"order_entity_id" validate:"min=36,max=36"`
+	Amount        Money      `json:"amount" db:"amount"`
+	Status        string     `json:"status" db:"status"`
+	ChargeID      string     `json:"chargeId,omitempty" db:"charge_id"`
+	FailureReason string     `json:"failureReason,omitempty" db:"failure_reason"`
+	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
+	SettledAt     *time.Time `json:"settledAt,omitempty" db:"settled_at"`
+	RefundID      string     `json:"refundId,omitempty" db:"refund_id"`
+	RefundedAt    *time.Time `json:"refundedAt,omitempty" db:"refunded_at"`
+	Version       int        `json:"version" db:"version"`
+}
+
+// NewPayment creates a new, pending Payment of the total price of an Order
+func NewPayment(order Order, at time.Time) Payment {
+	id, _ := uuid.NewV4()
+	return Payment{
+		ID:        id,
+		OrderID:   order.ID,
+		Amount:    order.TotalPrice,
+		Status:    PaymentStatusPending,
+		CreatedAt: at,
+	}
+}
+
+// IsSettled checks whether the charge of a Payment has been settled
+func (p *Payment) IsSettled() bool {
+	return p.Status != PaymentStatusPending
+}
+
+// Settle records the outcome of the charge of a pending Payment
+func (p *Payment) Settle(charge PaymentCharge, at time.Time) error {
+	if charge.Reference != p.ID {
+		return failure.BadRequestFromString(fmt.Sprintf("charge %s is not for payment %s", charge.ID, p.ID))
+	}
+
+	if charge.Amount != p.Amount {
+		return failure.BadRequestFromString(fmt.Sprintf("charge %s is of %s instead of %s", charge.ID, charge.Amount, p.Amount))
+	}
+
+	if p.IsSettled() {
+		return failure.OperationNotPermitted("settle", "Payment", fmt.Sprintf("the payment has already %s", p.Status))
+	}
+
+	p.Status = charge.PaymentStatus()
+	p.ChargeID = charge.ID
+	if p.Status == PaymentStatusFailed {
+		p.FailureReason = charge.Reason
+	}
+	p.SettledAt = &at
+
+	return nil
+}
+
+// Fail fails a pending Payment whose charge never reached the gateway
+func (p *Payment) Fail(reason string, at time.Time) error {
+	if p.IsSettled() {
+		return failure.OperationNotPermitted("fail", "Payment", fmt.Sprintf("the payment has already %s", p.Status))
+	}
+
+	p.Status = PaymentStatusFailed
+	p.FailureReason = reason
+	p.SettledAt = &at
+
+	return nil
+}
+
+// Records checks whether a settled Payment already records the outcome of a charge, so that settling it with the
+// same charge again changes nothing. A Payment being or having been refunded records the charge that went through.
+func (p *Payment) Records(charge PaymentCharge) bool {
+	return p.IsSettled() && p.ChargeID == charge.ID && p.chargeStatus() == charge.PaymentStatus()
+}
+
+// RequiresRefund checks whether a Payment whose charge went through must be refunded, because its Order was
+// cancelled, expired or had its payment fail before the charge was settled
+func (p *Payment) RequiresRefund(order Order) bool {
+	if p.Status != PaymentStatusSucceeded {
+		return false
+	}
+
+	switch order.Status {
+	case OrderStatusCancelled, OrderStatusExpired, OrderStatusPaymentFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// MarkForRefund marks a Payment whose charge went through as awaiting its refund
+func (p *Payment) MarkForRefund() error {
+	if p.Status != PaymentStatusSucceeded {
+		return failure.OperationNotPermitted("refund", "Payment", fmt.Sprintf("the payment is %s", p.Status))
+	}
+
+	p.Status = PaymentStatusRefundPending
+	return nil
+}
+
+// Refund records the refund of a Payment awaiting it
+func (p *Payment) Refund(refund PaymentRefund, at time.Time) error {
+	if refund.Reference != p.ID || refund.ChargeID != p.ChargeID {
+		return failure.BadRequestFromString(fmt.Sprintf("refund %s is not for payment %s", refund.ID, p.ID))
+	}
+
+	if p.Status != PaymentStatusRefundPending {
+		return failure.OperationNotPermitted("refund", "Payment", fmt.Sprintf("the payment is %s", p.Status))
+	}
+
+	p.Status = PaymentStatusRefunded
+	p.RefundID = refund.ID
+	p.RefundedAt = &at
+
+	return nil
+}
+
+// chargeStatus returns the status of a settled Payment as its charge settled it, before any refund
+func (p *Payment) chargeStatus() string {
+	if p.Status == PaymentStatusRefundPending || p.Status == PaymentStatusRefunded {
+		return PaymentStatusSucceeded
+	}
+	return p.Status
+}
+
+// PaymentChargeInput represents the request asking the payment gateway to charge a Payment. The Payment's ID is
+// the reference of the charge.
+type PaymentChargeInput struct {
+	Reference uuid.UUID `json:"reference"`
+	Amount    Money     `json:"amount"`
+}
+
+// Validate validates the PaymentChargeInput object
+func (i *PaymentChargeInput) Validate() error {
+	if i.Reference == uuid.Nil {
+		return failure.BadRequestFromString("charge must specify a reference")
+	}
+
+	if err := i.Amount.Validate(); err != nil {
+		return err
+	}
+
+	if i.Amount.IsNegative() {
+		return failure.BadRequestFromString("charge amount must not be negative")
+	}
+
+	return nil
+}
+
+// PaymentCharge is what the payment gateway reports about a charge, both in its response to the charge request and
+// in the webhooks it sends afterwards
+type PaymentCharge struct {
+	ID        string    `json:"id"`
+	Reference uuid.UUID `json:"reference"`
+	Amount    Money     `json:"amount"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Validate validates the PaymentCharge object
+func (c *PaymentCharge) Validate() error {
+	if strings.TrimSpace(c.ID) == "" {
+		return failure.BadRequestFromString("charge must have an ID")
+	}
+
+	if c.Reference == uuid.Nil {
+		return failure.BadRequestFromString("charge must specify a reference")
+	}
+
+	if c.Status != ChargeStatusSucceeded && c.Status != ChargeStatusDeclined {
+		return failure.BadRequestFromString(fmt.Sprintf("unknown charge status %s", c.Status))
+	}
+
+	return nil
+}
+
+// PaymentStatus returns the status of a Payment settled by the charge
+func (c *PaymentCharge) PaymentStatus() string {
+	if c.Status == ChargeStatusSucceeded {
+		return PaymentStatusSucceeded
+	}
+	return PaymentStatusFailed
+}
+
+// PaymentRefundInput represents the request asking the payment gateway to refund the charge of a Payment. The
+// Payment's ID is the reference of the refund.
+type PaymentRefundInput struct {
+	Reference uuid.UUID `json:"reference"`
+	ChargeID  string    `json:"chargeId"`
+	Amount    Money     `json:"amount"`
+}
+
+// Validate validates the PaymentRefundInput object
+func (i *PaymentRefundInput) Validate() error {
+	if i.Reference == uuid.Nil {
+		return failure.BadRequestFromString("refund must specify a reference")
+	}
+
+	if strings.TrimSpace(i.ChargeID) == "" {
+		return failure.BadRequestFromString("refund must specify a charge")
+	}
+
+	return i.Amount.Validate()
+}
+
+// PaymentRefund is what the payment gateway reports about the refund of a charge
+type PaymentRefund struct {
+	ID        string    `json:"id"`
+	Reference uuid.UUID `json:"reference"`
+	ChargeID  string    `json:"chargeId"`
+	Amount    Money     `json:"amount"`
+}
+
+// Validate validates the PaymentRefund object
+func (r *PaymentRefund) Validate() error {
+	if strings.TrimSpace(r.ID) == "" {
+		return failure.BadRequestFromString("refund must have an ID")
+	}
+
+	if r.Reference == uuid.Nil {
+		return failure.BadRequestFromString("refund must specify a reference")
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestPayment(t *testing.T) {
+
+	order := Order{ID: uuid.Must(uuid.NewV4()), TotalPrice: NewMoney(2500, "IDR"), Status: OrderStatusProcessing}
+	now := time.Now()
+
+	t.Run("newPayment", func(t *testing.T) {
+		payment := NewPayment(order, now)
+		if payment.OrderID != order.ID || payment.Amount != order.TotalPrice || payment.Status != PaymentStatusPending {
+			t.Errorf("wrong new payment: %+v", payment)
+		}
+		if payment.IsSettled() || payment.SettledAt != nil {
+			t.Errorf("new payment is settled")
+		}
+	})
+
+	t.Run("settleSucceeded", func(t *testing.T) {
+		payment := NewPayment(order, now)
+		charge := PaymentCharge{ID: "ch_1", Reference: payment.ID, Amount: payment.Amount, Status: ChargeStatusSucceeded}
+		if err := payment.Settle(charge, now); err != nil {
+			t.Fatalf("settling returned unexpected error: %v", err)
+		}
+		if payment.Status != PaymentStatusSucceeded || payment.ChargeID != "ch_1" || payment.SettledAt == nil {
+			t.Errorf("wrong settled payment: %+v", payment)
+		}
+		if !payment.Records(charge) {
+			t.Errorf("settled payment does not record its charge")
+		}
+		if err := payment.Settle(charge, now); failure.GetCode(err) != failure.CodeOperationNotPermitted {
+			t.Errorf("settling twice returned wrong error: got %v want %v", err, failure.CodeOperationNotPermitted)
+		}
+	})
+
+	t.Run("settleDeclined", func(t *testing.T) {
+		payment := NewPayment(order, now)
+		charge := PaymentCharge{ID: "ch_2", Reference: payment.ID, Amount: payment.Amount, Status: ChargeStatusDeclined, Reason: "insufficient funds"}
+		if err := payment.Settle(charge, now); err != nil {
+			t.Fatalf("settling returned unexpected error: %v", err)
+		}
+		if payment.Status != PaymentStatusFailed || payment.FailureReason != "insufficient funds" {
+			t.Errorf("wrong settled payment: %+v", payment)
+		}
+
+		approved := charge
+		approved.Status = ChargeStatusSucceeded
+		if payment.Records(approved) {
+			t.Errorf("declined payment records an approved charge")
+		}
+	})
+
+	t.Run("refund", func(t *testing.T) {
+		payment := NewPayment(order, now)
+		charge := PaymentCharge{ID: "ch_5", Reference: payment.ID, Amount: payment.Amount, Status: ChargeStatusSucceeded}
+		if err := payment.Settle(charge, now); err != nil {
+			t.Fatalf("settling returned unexpected error: %v", err)
+		}
+
+		for _, status := range []string{OrderStatusProcessing, OrderStatusPaid, OrderStatusCompleted} {
+			if payment.RequiresRefund(Order{Status: status}) {
+				t.Errorf("payment for a %s order requires a refund", status)
+			}
+		}
+		for _, status := range []string{OrderStatusCancelled, OrderStatusExpired, OrderStatusPaymentFailed} {
+			if !payment.RequiresRefund(Order{Status: status}) {
+				t.Errorf("payment for a %s order does not require a refund", status)
+			}
+		}
+
+		refund := PaymentRefund{ID: "re_1", Reference: payment.ID, ChargeID: charge.ID, Amount: payment.Amount}
+		if err := payment.Refund(refund, now); failure.GetCode(err) != failure.CodeOperationNotPermitted {
+			t.Errorf("refunding a payment not marked for refund returned wrong error: got %v want %v", err, failure.CodeOperationNotPermitted)
+		}
+
+		if err := payment.MarkForRefund(); err != nil {
+			t.Fatalf("marking for refund returned unexpected error: %v", err)
+		}
+		if !payment.Records(charge) {
+			t.Errorf("payment awaiting its refund does not record its charge")
+		}
+
+		if err := payment.Refund(PaymentRefund{ID: "re_2", Reference: payment.ID, ChargeID: "ch_6"}, now); failure.GetCode(err) != failure.CodeBadRequest {
+			t.Errorf("refunding another charge returned wrong error: got %v want %v", err, failure.CodeBadRequest)
+		}
+		if err := payment.Refund(refund, now); err != nil {
+			t.Fatalf("refunding returned unexpected error: %v", err)
+		}
+		if payment.Status != PaymentStatusRefunded || payment.RefundID != "re_1" || payment.RefundedAt == nil || !payment.Records(charge) {
+			t.Errorf("wrong refunded payment: %+v", payment)
+		}
+		if err := payment.MarkForRefund(); failure.GetCode(err) != failure.CodeOperationNotPermitted {
+			t.Errorf("marking a refunded payment for refund returned wrong error: got %v want %v", err, failure.CodeOperationNotPermitted)
+		}
+	})
+
+	t.Run("settleMismatched", func(t *testing.T) {
+		payment := NewPayment(order, now)
+		charges := []PaymentCharge{
+			{ID: "ch_3", Reference: uuid.Must(uuid.NewV4()), Amount: payment.Amount, Status: ChargeStatusSucceeded},
+			{ID: "ch_4", Reference: payment.ID, Amount: NewMoney(100, "IDR"), Status: ChargeStatusSucceeded},
+		}
+		for _, charge := range charges {
+			if err := payment.Settle(charge, now); failure.GetCode(err) != failure.CodeBadRequest {
+				t.Errorf("settling with charge %+v returned wrong error: got %v want %v", charge, err, failure.CodeBadRequest)
+			}
+		}
+		if payment.IsSettled() {
+			t.Errorf("mismatched charge settled the payment")
+		}
+	})
+
+}
+
+func TestPaymentChargeValidate(t *testing.T) {
+
+	reference := uuid.Must(uuid.NewV4())
+	charges := []struct {
+		name   string
+		charge PaymentCharge
+		valid  bool
+	}{
+		{"succeeded", PaymentCharge{ID: "ch_1", Reference: reference, Status: ChargeStatusSucceeded}, true},
+		{"declined", PaymentCharge{ID: "ch_1", Reference: reference, Status: ChargeStatusDeclined}, true},
+		{"noID", PaymentCharge{Reference: reference, Status: ChargeStatusSucceeded}, false},
+		{"noReference", PaymentCharge{ID: "ch_1", Status: ChargeStatusSucceeded}, false},
+		{"unknownStatus", PaymentCharge{ID: "ch_1", Reference: reference, Status: "refunded"}, false},
+	}
+
+	for _, tc := range charges {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.charge.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("valid charge returned error: %v", err)
+			}
+			if !tc.valid && failure.GetCode(err) != failure.CodeBadRequest {
+				t.Errorf("invalid charge returned wrong error: got %v want %v", err, failure.CodeBadRequest)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+// Product represents a Product entity. A Product whose available quantity is at or below its ReorderPoint
+// is reported as low on stock. A Product with a PurchaseLimit may only be bought up to that quantity by each
+// customer, counted across their processing and completed Orders. A Product with Components is a bundle, see
+// IsBundle. The available quantity of a bundle is derived from its components and only filled in when it is resolved
+// on its own.
+type Product struct {
+	ID            uuid.UUID         `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	SKU           string            `json:"sku" db:"sku"`
+	Name          string            `json:"name" db:"name"`
+	Price         Money             `json:"price" db:"price"`
+	ReorderPoint  int               `json:"reorderPoint" db:"reorder_point" validate:"min=0"`
+	PurchaseLimit *int              `json:"purchaseLimit,omitempty" db:"purchase_limit"`
+	Components    []BundleComponent `json:"components,omitempty" db:"-"`
+	QtyAvailable  *int              `json:"qtyAvailable,omitempty" db:"-"`
+}
+
+// NewProductFromInput creates a new Product from its input object
+func NewProductFromInput(input ProductInput) Product {
+	id := input.ID
+	if input.ID == uuid.Nil {
+		id, _ = uuid.NewV4()
+	}
+	return Product{
+		ID:            id,
+		SKU:           strings.TrimSpace(input.SKU),
+		Name:          strings.TrimSpace(input.Name),
+		Price:         input.Price,
+		ReorderPoint:  input.ReorderPoint,
+		PurchaseLimit: input.PurchaseLimit,
+		Components:    newBundleComponents(id, input.Components),
+	}
+}
+
+// Update updates a Product's fields from its input object
+func (p *Product) Update(input ProductInput) Product {
+	p.SKU = strings.TrimSpace(input.SKU)
+	p.Name = strings.TrimSpace(input.Name)
+	p.Price = input.Price
+	p.ReorderPoint = input.ReorderPoint
+	p.PurchaseLimit = input.PurchaseLimit
+	p.Components = newBundleComponents(p.ID, input.Components)
+	return *p
+}
+
+// Validate validates the Product object
+func (p *Product) Validate() error {
+	if p.SKU == "" {
+		return failure.BadRequestFromString("product SKU must not be empty")
+	}
+
+	if len(p.SKU) > 20 {
+		return failure.BadRequestFromString("product SKU must not be longer than 20 characters")
+	}
+
+	if p.Name == "" {
+		return failure.BadRequestFromString("product name must not be empty")
+	}
+
+	if len(p.Name) > 255 {
+		return failure.BadRequestFromString("product name must not be longer than 255 characters")
+	}
+
+	if err := p.Price.Validate(); err != nil {
+		return err
+	}
+
+	if p.Price.IsNegative() {
+		return failure.BadRequestFromString("product price must not be negative")
+	}
+
+	if p.ReorderPoint < 0 {
+		return failure.BadRequestFromString("product reorder point must not be negative")
+	}
+
+	if p.PurchaseLimit != nil && *p.PurchaseLimit <= 0 {
+		return failure.BadRequestFromString("product purchase limit must be positive integer")
+	}
+
+	return p.validateComponents()
+}
+
+// ProductInput represents the input object for creating and updating Products. Components make the Product a
+// bundle of other Products.
+type ProductInput struct {
+	ID            uuid.UUID              `json:"id,omitempty"`
+	SKU           string                 `json:"sku"`
+	Name          string                 `json:"name"`
+	Price         Money                  `json:"price"`
+	ReorderPoint  int                    `json:"reorderPoint"`
+	PurchaseLimit *int                   `json:"purchaseLimit,omitempty"`
+	Components    []BundleComponentInput `json:"components,omitempty"`
+}
@@ -0,0 +1,360 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const (
+	// PromotionTypePercentage takes a percentage off the targeted items
+	PromotionTypePercentage = "percentage"
+	// PromotionTypeFixed takes a fixed amount off the targeted items
+	PromotionTypeFixed = "fixed"
+	// PromotionTypeBuyXGetY gives GetQty units of a targeted Product away for every BuyQty units bought
+	PromotionTypeBuyXGetY = "buyXGetY"
+)
+
+// IsPromotionType checks whether a string is a known Promotion type
+func IsPromotionType(promotionType string) bool {
+	switch promotionType {
+	case PromotionTypePercentage, PromotionTypeFixed, PromotionTypeBuyXGetY:
+		return true
+	}
+	return false
+}
+
+// Promotion represents a Promotion entity. A Promotion with a Code is a voucher that only applies to Orders created
+// with that code, while a Promotion without one applies to every eligible Order on its own. A Promotion targets the
+// items of TargetProductID and of the Products whose SKU matches TargetSKU, where a trailing * matches any SKU
+// starting with what comes before it. Without targets it applies to all items. UsageCount counts the Orders that
+// have reserved their inventory with the Promotion applied and never goes over UsageCap, if one is set.
+type Promotion struct {
+	ID              uuid.UUID  `json:"id" db:"entity_id"`
+	Code            string     `json:"code,omitempty" db:"code"`
+	Name            string     `json:"name" db:"name"`
+	Type            string     `json:"type" db:"type"`
+	PercentOff      int        `json:"percentOff,omitempty" db:"percent_off"`
+	AmountOff       Money      `json:"amountOff" db:"amount_off"`
+	BuyQty          int        `json:"buyQty,omitempty" db:"buy_qty"`
+	GetQty          int        `json:"getQty,omitempty" db:"get_qty"`
+	MinSpend        Money      `json:"minSpend" db:"min_spend"`
+	TargetProductID uuid.UUID  `json:"targetProductId,omitempty" db:"target_product_entity_id"`
+	TargetSKU       string     `json:"targetSku,omitempty" db:"target_sku"`
+	ValidFrom       *time.Time `json:"validFrom,omitempty" db:"valid_from"`
+	ValidUntil      *time.Time `json:"validUntil,omitempty" db:"valid_until"`
+	UsageCap        *int       `json:"usageCap,omitempty" db:"usage_cap"`
+	UsageCount      int        `json:"usageCount" db:"usage_count"`
+}
+
+// NewPromotionFromInput creates a new Promotion from its input object
+func NewPromotionFromInput(input PromotionInput) Promotion {
+	id := input.ID
+	if input.ID == uuid.Nil {
+		id, _ = uuid.NewV4()
+	}
+
+	promotion := Promotion{ID: id}
+	promotion.Update(input)
+	return promotion
+}
+
+// Update updates a Promotion's fields from its input object, leaving its usage count as it is
+func (p *Promotion) Update(input PromotionInput) Promotion {
+	p.Code = NormalizeVoucherCode(input.Code)
+	p.Name = strings.TrimSpace(input.Name)
+	p.Type = input.Type
+	p.PercentOff = input.PercentOff
+	p.AmountOff = input.AmountOff
+	p.BuyQty = input.BuyQty
+	p.GetQty = input.GetQty
+	p.MinSpend = input.MinSpend
+	p.TargetProductID = input.TargetProductID
+	p.TargetSKU = strings.TrimSpace(input.TargetSKU)
+	p.ValidFrom = input.ValidFrom
+	p.ValidUntil = input.ValidUntil
+	p.UsageCap = input.UsageCap
+	return *p
+}
+
+// Validate validates the Promotion object
+func (p *Promotion) Validate() error {
+	if p.Name == "" {
+		return failure.BadRequestFromString("promotion name must not be empty")
+	}
+
+	if len(p.Name) > 255 {
+		return failure.BadRequestFromString("promotion name must not be longer than 255 characters")
+	}
+
+	if len(p.Code) > 50 {
+		return failure.BadRequestFromString("promotion code must not be longer than 50 characters")
+	}
+
+	switch p.Type {
+	case PromotionTypePercentage:
+		if p.PercentOff < 1 || p.PercentOff > 100 {
+			return failure.BadRequestFromString("percentage promotion must take between 1 and 100 percent off")
+		}
+	case PromotionTypeFixed:
+		if err := p.AmountOff.Validate(); err != nil {
+			return err
+		}
+		if p.AmountOff.Amount <= 0 {
+			return failure.BadRequestFromString("fixed promotion must take a positive amount off")
+		}
+	case PromotionTypeBuyXGetY:
+		if p.BuyQty < 1 || p.GetQty < 1 {
+			return failure.BadRequestFromString("buy X get Y promotion must have positive buy and get quantities")
+		}
+	default:
+		return failure.BadRequestFromString(fmt.Sprintf("unknown promotion type %s", p.Type))
+	}
+
+	if p.MinSpend.Amount != 0 {
+		if err := p.MinSpend.Validate(); err != nil {
+			return err
+		}
+		if p.MinSpend.IsNegative() {
+			return failure.BadRequestFromString("promotion minimum spend must not be negative")
+		}
+	}
+
+	if len(p.TargetSKU) > 20 {
+		return failure.BadRequestFromString("promotion target SKU must not be longer than 20 characters")
+	}
+
+	if p.ValidFrom != nil && p.ValidUntil != nil && !p.ValidUntil.After(*p.ValidFrom) {
+		return failure.BadRequestFromString("promotion must be valid until a time after it becomes valid")
+	}
+
+	if p.UsageCap != nil && *p.UsageCap < 1 {
+		return failure.BadRequestFromString("promotion usage cap must be positive integer")
+	}
+
+	return nil
+}
+
+// IsVoucher checks whether the Promotion only applies to Orders created with its code
+func (p *Promotion) IsVoucher() bool {
+	return p.Code != ""
+}
+
+// IsActiveAt checks whether the Promotion is valid at the specified time
+func (p *Promotion) IsActiveAt(at time.Time) bool {
+	if p.ValidFrom != nil && at.Before(*p.ValidFrom) {
+		return false
+	}
+	return p.ValidUntil == nil || at.Before(*p.ValidUntil)
+}
+
+// IsExhausted checks whether the Promotion has been used as often as its usage cap allows
+func (p *Promotion) IsExhausted() bool {
+	return p.UsageCap != nil && p.UsageCount >= *p.UsageCap
+}
+
+// Targets checks whether the Promotion applies to items of a Product
+func (p *Promotion) Targets(product Product) bool {
+	if p.TargetProductID != uuid.Nil && p.TargetProductID != product.ID {
+		return false
+	}
+
+	if strings.HasSuffix(p.TargetSKU, "*") {
+		return strings.HasPrefix(product.SKU, strings.TrimSuffix(p.TargetSKU, "*"))
+	}
+	return p.TargetSKU == "" || p.TargetSKU == product.SKU
+}
+
+// ComputeDiscount computes how much the Promotion takes off an Order whose items are priced from the supplied
+// Products. It fails with the reason if the Promotion does not apply to the Order.
+func (p *Promotion) ComputeDiscount(order Order, productMap map[uuid.UUID]Product) (Money, error) {
+	subtotal, err := order.ComputeSubtotal()
+	if err != nil {
+		return Money{}, err
+	}
+
+	if p.MinSpend.Amount > 0 {
+		if p.MinSpend.Currency != subtotal.Currency {
+			return Money{}, p.notApplicable(fmt.Sprintf("its minimum spend is in %s", p.MinSpend.Currency))
+		}
+		if subtotal.Amount < p.MinSpend.Amount {
+			return Money{}, p.notApplicable(fmt.Sprintf("the order does not reach the minimum spend of %s", p.MinSpend))
+		}
+	}
+
+	eligible := NewMoney(0, subtotal.Currency)
+	eligibleQty := make(map[uuid.UUID]int)
+	for _, item := range order.Items {
+		if !p.Targets(productMap[item.ProductID]) {
+			continue
+		}
+		if eligible, err = eligible.Add(item.Price); err != nil {
+			return Money{}, err
+		}
+		eligibleQty[item.ProductID] += item.Qty
+	}
+
+	if len(eligibleQty) == 0 {
+		return Money{}, p.notApplicable("it does not target any item of the order")
+	}
+
+	switch p.Type {
+	case PromotionTypePercentage:
+		return eligible.Scale(int64(p.PercentOff), 100)
+	case PromotionTypeFixed:
+		if p.AmountOff.Currency != eligible.Currency {
+			return Money{}, p.notApplicable(fmt.Sprintf("it takes an amount in %s off", p.AmountOff.Currency))
+		}
+		if p.AmountOff.Amount > eligible.Amount {
+			return eligible, nil
+		}
+		return p.AmountOff, nil
+	default:
+		discount := NewMoney(0, eligible.Currency)
+		for productID, qty := range eligibleQty {
+			free, err := productMap[productID].Price.Multiply(qty / (p.BuyQty + p.GetQty) * p.GetQty)
+			if err != nil {
+				return Money{}, err
+			}
+			if discount, err = discount.Add(free); err != nil {
+				return Money{}, err
+			}
+		}
+		if discount.Amount == 0 {
+			return Money{}, p.notApplicable(fmt.Sprintf("the order does not buy %d of a targeted product", p.BuyQty+p.GetQty))
+		}
+		return discount, nil
+	}
+}
+
+func (p *Promotion) notApplicable(reason string) error {
+	return failure.OperationNotPermitted("apply", "Promotion", fmt.Sprintf("%s does not apply because %s", p.Name, reason))
+}
+
+// PromotionInput represents the input object for creating and updating Promotions
+type PromotionInput struct {
+	ID              uuid.UUID  `json:"id,omitempty"`
+	Code            string     `json:"code"`
+	Name            string     `json:"name"`
+	Type            string     `json:"type"`
+	PercentOff      int        `json:"percentOff"`
+	AmountOff       Money      `json:"amountOff"`
+	BuyQty          int        `json:"buyQty"`
+	GetQty          int        `json:"getQty"`
+	MinSpend        Money      `json:"minSpend"`
+	TargetProductID uuid.UUID  `json:"targetProductId"`
+	TargetSKU       string     `json:"targetSku"`
+	ValidFrom       *time.Time `json:"validFrom"`
+	ValidUntil      *time.Time `json:"validUntil"`
+	UsageCap        *int       `json:"usageCap"`
+}
+
+// NormalizeVoucherCode normalizes a voucher code so that codes are matched regardless of case and surrounding spaces
+func NormalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// OrderDiscount represents an Order Discount entity, the amount a Promotion took off an Order
+type OrderDiscount struct {
+	ID          uuid.UUID `json:"id" db:"entity_id"`
+	OrderID     uuid.UUID `json:"orderId" db:"order_entity_id"`
+	PromotionID uuid.UUID `json:"promotionId" db:"promotion_entity_id"`
+	Code        string    `json:"code,omitempty" db:"code"`
+	Name        string    `json:"name" db:"name"`
+	Amount      Money     `json:"amount" db:"amount"`
+}
+
+// ApplyPromotions applies Promotions to a new Order priced from the supplied Products and lowers its total by the
+// discounts. Every automatic Promotion that is active and applies is applied, along with the vouchers whose codes
+// were supplied. A supplied voucher that does not exist, is not active, has been used up or does not apply fails
+// the Order. Each discount is computed from the prices of the items, but the discounts together never take the
+// total below zero.
+func (o *Order) ApplyPromotions(promotions []Promotion, voucherCodes []string, products []Product, at time.Time) error {
+	productMap := make(map[uuid.UUID]Product)
+	for _, product := range products {
+		productMap[product.ID] = product
+	}
+
+	requested := make(map[string]bool)
+	for _, code := range voucherCodes {
+		requested[NormalizeVoucherCode(code)] = true
+	}
+
+	sorted := make([]Promotion, len(promotions))
+	copy(sorted, promotions)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Code != sorted[j].Code {
+			return sorted[i].Code < sorted[j].Code
+		}
+		return sorted[i].ID.String() < sorted[j].ID.String()
+	})
+
+	remaining, err := o.ComputeSubtotal()
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[string]bool)
+	for _, promotion := range sorted {
+		if promotion.IsVoucher() && !requested[promotion.Code] {
+			continue
+		}
+
+		amount, err := promotion.discountFor(*o, productMap, at)
+		if err != nil {
+			if promotion.IsVoucher() {
+				return err
+			}
+			continue
+		}
+		applied[promotion.Code] = true
+
+		if amount.Amount > remaining.Amount {
+			amount = remaining
+		}
+		if amount.Amount == 0 {
+			continue
+		}
+
+		if remaining, err = remaining.Subtract(amount); err != nil {
+			return err
+		}
+
+		discountID, _ := uuid.NewV4()
+		o.Discounts = append(o.Discounts, OrderDiscount{
+			ID:          discountID,
+			OrderID:     o.ID,
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			Name:        promotion.Name,
+			Amount:      amount,
+		})
+	}
+
+	for code := range requested {
+		if !applied[code] {
+			return failure.BadRequestFromString(fmt.Sprintf("voucher %s does not exist", code))
+		}
+	}
+
+	o.TotalPrice = remaining
+	return nil
+}
+
+// discountFor computes how much the Promotion takes off an Order at the specified time, checking that it is active
+// and has not been used up first
+func (p *Promotion) discountFor(order Order, productMap map[uuid.UUID]Product, at time.Time) (Money, error) {
+	if !p.IsActiveAt(at) {
+		return Money{}, p.notApplicable("it is not valid at this time")
+	}
+
+	if p.IsExhausted() {
+		return Money{}, p.notApplicable("it has been fully redeemed")
+	}
+
+	return p.ComputeDiscount(order, productMap)
+}
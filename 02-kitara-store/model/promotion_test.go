@@ -0,0 +1,156 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestApplyPromotions(t *testing.T) {
+
+	shirt := Product{ID: uuid.Must(uuid.NewV4()), SKU: "SHIRT-RED", Price: NewMoney(10000, "IDR")}
+	shirtBlue := Product{ID: uuid.Must(uuid.NewV4()), SKU: "SHIRT-BLUE", Price: NewMoney(12000, "IDR")}
+	socks := Product{ID: uuid.Must(uuid.NewV4()), SKU: "SOCKS", Price: NewMoney(2500, "IDR")}
+	pin := Product{ID: uuid.Must(uuid.NewV4()), SKU: "PIN", Price: NewMoney(250, "IDR")}
+	products := []Product{shirt, shirtBlue, socks, pin}
+
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	usedUp := 3
+
+	newOrder := func(t *testing.T, items ...OrderItemInput) Order {
+		order, err := NewOrderFromInput(OrderInput{Items: items}, products)
+		if err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+		return order
+	}
+
+	cases := []struct {
+		name       string
+		items      []OrderItemInput
+		promotions []Promotion
+		vouchers   []string
+		total      int64
+		errCode    failure.Code
+	}{
+		{
+			name:       "percentageOnTargetedSKUs",
+			items:      []OrderItemInput{{ProductID: shirt.ID, Qty: 1}, {ProductID: shirtBlue.ID, Qty: 1}, {ProductID: socks.ID, Qty: 1}},
+			promotions: []Promotion{{Name: "Shirts", Type: PromotionTypePercentage, PercentOff: 15, TargetSKU: "SHIRT-*"}},
+			total:      24500 - 3300,
+		},
+		{
+			name:       "percentageRoundsHalfToEven",
+			items:      []OrderItemInput{{ProductID: pin.ID, Qty: 1}},
+			promotions: []Promotion{{Name: "Odd", Type: PromotionTypePercentage, PercentOff: 1}},
+			total:      250 - 2,
+		},
+		{
+			name:       "fixedCappedAtTargetedItems",
+			items:      []OrderItemInput{{ProductID: shirt.ID, Qty: 1}, {ProductID: socks.ID, Qty: 2}},
+			promotions: []Promotion{{Name: "Socks", Type: PromotionTypeFixed, AmountOff: NewMoney(9000, "IDR"), TargetProductID: socks.ID}},
+			total:      10000,
+		},
+		{
+			name:       "buyTwoGetOne",
+			items:      []OrderItemInput{{ProductID: socks.ID, Qty: 4}, {ProductID: socks.ID, Qty: 3}},
+			promotions: []Promotion{{Name: "Socks 3 for 2", Type: PromotionTypeBuyXGetY, BuyQty: 2, GetQty: 1, TargetProductID: socks.ID}},
+			total:      7*2500 - 2*2500,
+		},
+		{
+			name:  "minimumSpendNotReached",
+			items: []OrderItemInput{{ProductID: socks.ID, Qty: 1}},
+			promotions: []Promotion{
+				{Name: "Big Spender", Type: PromotionTypeFixed, AmountOff: NewMoney(1000, "IDR"), MinSpend: NewMoney(5000, "IDR")},
+			},
+			total: 2500,
+		},
+		{
+			name:  "discountsNeverGoBelowZero",
+			items: []OrderItemInput{{ProductID: socks.ID, Qty: 1}},
+			promotions: []Promotion{
+				{Name: "Half", Type: PromotionTypePercentage, PercentOff: 50},
+				{Name: "Fixed", Type: PromotionTypeFixed, AmountOff: NewMoney(2000, "IDR")},
+			},
+			total: 0,
+		},
+		{
+			name:       "voucherNotRequested",
+			items:      []OrderItemInput{{ProductID: shirt.ID, Qty: 1}},
+			promotions: []Promotion{{Code: "TENOFF", Name: "Voucher", Type: PromotionTypePercentage, PercentOff: 10}},
+			total:      10000,
+		},
+		{
+			name:       "voucherApplied",
+			items:      []OrderItemInput{{ProductID: shirt.ID, Qty: 1}},
+			promotions: []Promotion{{Code: "TENOFF", Name: "Voucher", Type: PromotionTypePercentage, PercentOff: 10}},
+			vouchers:   []string{" tenoff "},
+			total:      9000,
+		},
+		{
+			name:     "unknownVoucher",
+			items:    []OrderItemInput{{ProductID: shirt.ID, Qty: 1}},
+			vouchers: []string{"NOPE"},
+			errCode:  failure.CodeBadRequest,
+		},
+		{
+			name:       "expiredVoucher",
+			items:      []OrderItemInput{{ProductID: shirt.ID, Qty: 1}},
+			promotions: []Promotion{{Code: "OLD", Name: "Voucher", Type: PromotionTypePercentage, PercentOff: 10, ValidUntil: &past}},
+			vouchers:   []string{"OLD"},
+			errCode:    failure.CodeOperationNotPermitted,
+		},
+		{
+			name:  "usedUpVoucher",
+			items: []OrderItemInput{{ProductID: shirt.ID, Qty: 1}},
+			promotions: []Promotion{
+				{Code: "USED", Name: "Voucher", Type: PromotionTypePercentage, PercentOff: 10, UsageCap: &usedUp, UsageCount: 3},
+			},
+			vouchers: []string{"USED"},
+			errCode:  failure.CodeOperationNotPermitted,
+		},
+		{
+			name:       "voucherNotTargetingOrder",
+			items:      []OrderItemInput{{ProductID: shirt.ID, Qty: 1}},
+			promotions: []Promotion{{Code: "SOCKS", Name: "Voucher", Type: PromotionTypePercentage, PercentOff: 10, TargetProductID: socks.ID}},
+			vouchers:   []string{"SOCKS"},
+			errCode:    failure.CodeOperationNotPermitted,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for idx := range tc.promotions {
+				tc.promotions[idx].ID = uuid.Must(uuid.NewV4())
+			}
+
+			order := newOrder(t, tc.items...)
+			vouchers := make([]string, 0)
+			for _, code := range tc.vouchers {
+				vouchers = append(vouchers, NormalizeVoucherCode(code))
+			}
+
+			err := order.ApplyPromotions(tc.promotions, vouchers, products, now)
+			if tc.errCode != "" {
+				if failure.GetCode(err) != tc.errCode {
+					t.Errorf("wrong error: got %v want %v", err, tc.errCode)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if order.TotalPrice != NewMoney(tc.total, "IDR") {
+				t.Errorf("wrong total: got %v want %v", order.TotalPrice, NewMoney(tc.total, "IDR"))
+			}
+			if err := order.VerifyTotal(); err != nil {
+				t.Errorf("verification returned unexpected error: %v", err)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// PurchaseLimitReasonNoCustomer is the reason for a violation by an Order without a customer, whose purchases
+	// cannot be counted
+	PurchaseLimitReasonNoCustomer = "noCustomer"
+	// PurchaseLimitReasonExceeded is the reason for a violation by an Order that would take the customer's purchases
+	// of a Product past its limit
+	PurchaseLimitReasonExceeded = "exceeded"
+)
+
+// PurchaseLimitViolation describes an Order Item whose Product the customer may not buy that much of.
+// Quantities of several items for the same Product are added up, so QtyRequested applies to the Product as a whole
+// while Qty is the quantity of the item itself. QtyPurchased is what the customer's other processing and completed
+// Orders already count towards the limit.
+type PurchaseLimitViolation struct {
+	OrderItemID  uuid.UUID `json:"orderItemId"`
+	ProductID    uuid.UUID `json:"productId"`
+	Qty          int       `json:"qty"`
+	QtyRequested int       `json:"qtyRequested"`
+	QtyPurchased int       `json:"qtyPurchased"`
+	Limit        int       `json:"limit"`
+	Reason       string    `json:"reason"`
+}
+
+// FindPurchaseLimitViolations reports every item of an Order whose Product has a purchase limit the Order would go
+// past, given the quantity of each Product the customer purchased before. An Order without a customer violates the
+// limit of every limited Product it contains.
+func FindPurchaseLimitViolations(order Order, products []Product, purchased map[uuid.UUID]int) []PurchaseLimitViolation {
+	limitMap := make(map[uuid.UUID]int)
+	for _, product := range products {
+		if product.PurchaseLimit != nil {
+			limitMap[product.ID] = *product.PurchaseLimit
+		}
+	}
+
+	qtyMap := order.QtyByProduct()
+	violations := make([]PurchaseLimitViolation, 0)
+	for _, item := range order.Items {
+		limit, ok := limitMap[item.ProductID]
+		if !ok {
+			continue
+		}
+
+		violation := PurchaseLimitViolation{
+			OrderItemID:  item.ID,
+			ProductID:    item.ProductID,
+			Qty:          item.Qty,
+			QtyRequested: qtyMap[item.ProductID],
+			QtyPurchased: purchased[item.ProductID],
+			Limit:        limit,
+		}
+
+		if order.CustomerRef == "" {
+			violation.Reason = PurchaseLimitReasonNoCustomer
+			violations = append(violations, violation)
+			continue
+		}
+
+		if violation.QtyPurchased+violation.QtyRequested > limit {
+			violation.Reason = PurchaseLimitReasonExceeded
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations
+}
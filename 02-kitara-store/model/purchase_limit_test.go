@@ -0,0 +1,65 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestFindPurchaseLimitViolations(t *testing.T) {
+
+	limit := 2
+	limited := Product{ID: uuid.Must(uuid.NewV4()), PurchaseLimit: &limit}
+	unlimited := Product{ID: uuid.Must(uuid.NewV4())}
+	products := []Product{limited, unlimited}
+	itemA1, _ := uuid.NewV4()
+	itemA2, _ := uuid.NewV4()
+	itemB, _ := uuid.NewV4()
+
+	order := Order{
+		CustomerRef: "CUSTOMER-1",
+		Items: []OrderItem{
+			{ID: itemA1, ProductID: limited.ID, Qty: 1},
+			{ID: itemA2, ProductID: limited.ID, Qty: 1},
+			{ID: itemB, ProductID: unlimited.ID, Qty: 10},
+		},
+	}
+
+	t.Run("withinLimit", func(t *testing.T) {
+		purchased := map[uuid.UUID]int{unlimited.ID: 100}
+		if violations := FindPurchaseLimitViolations(order, products, purchased); len(violations) != 0 {
+			t.Errorf("unexpected violations: %+v", violations)
+		}
+	})
+
+	t.Run("exceededByEarlierPurchases", func(t *testing.T) {
+		purchased := map[uuid.UUID]int{limited.ID: 1}
+		violations := FindPurchaseLimitViolations(order, products, purchased)
+		if len(violations) != 2 {
+			t.Fatalf("wrong number of violations: got %v want 2", len(violations))
+		}
+
+		for idx, violation := range violations {
+			if violation.OrderItemID != order.Items[idx].ID || violation.Qty != 1 || violation.QtyRequested != 2 ||
+				violation.QtyPurchased != 1 || violation.Limit != 2 || violation.Reason != PurchaseLimitReasonExceeded {
+				t.Errorf("unexpected violation: %+v", violation)
+			}
+		}
+	})
+
+	t.Run("noCustomer", func(t *testing.T) {
+		anonymous := order
+		anonymous.CustomerRef = ""
+		violations := FindPurchaseLimitViolations(anonymous, products, map[uuid.UUID]int{})
+		if len(violations) != 2 {
+			t.Fatalf("wrong number of violations: got %v want 2", len(violations))
+		}
+
+		for _, violation := range violations {
+			if violation.ProductID != limited.ID || violation.Reason != PurchaseLimitReasonNoCustomer {
+				t.Errorf("unexpected violation: %+v", violation)
+			}
+		}
+	})
+
+}
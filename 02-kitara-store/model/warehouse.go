@@ -0,0 +1,12 @@
+package model
+
+import "github.com/gofrs/uuid"
+
+// Warehouse represents a location inventory is stored in and shipped from.
+// Warehouses with a lower Priority are allocated from first.
+type Warehouse struct {
+	ID       uuid.UUID `json:"id" db:"entity_id" validate:"min=36,max=36"`
+	Code     string    `json:"code" db:"code"`
+	Name     string    `json:"name" db:"name"`
+	Priority int       `json:"priority" db:"priority"`
+}
@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/handler"
+	"github.com/kerti/evm/02-kitara-store/inject"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/server"
+	"github.com/kerti/evm/02-kitara-store/service"
+)
+
+// MemoryRepositories holds the repositories kept in memory, so that whoever registers them can still reach them,
+// such as tests seeding and inspecting the store
+type MemoryRepositories struct {
+	Carts              *repository.CartMemoryRepo
+	IdempotencyKeys    *repository.IdempotencyKeyMemoryRepo
+	Inventory          *repository.InventoryMemoryRepo
+	Jobs               *repository.JobMemoryRepo
+	Movements          *repository.InventoryMovementMemoryRepo
+	OrderCodeSequences *repository.OrderCodeSequenceMemoryRepo
+	Orders             *repository.OrderMemoryRepo
+	Outbox             *repository.OutboxMemoryRepo
+	Payments           *repository.PaymentMemoryRepo
+	Products           *repository.ProductMemoryRepo
+	Promotions         *repository.PromotionMemoryRepo
+	Purchases          *repository.CustomerPurchaseMemoryRepo
+	Warehouses         *repository.WarehouseMemoryRepo
+}
+
+// NewMemoryRepositories creates every repository kept in memory
+func NewMemoryRepositories() *MemoryRepositories {
+	return &MemoryRepositories{
+		Carts:              new(repository.CartMemoryRepo),
+		IdempotencyKeys:    new(repository.IdempotencyKeyMemoryRepo),
+		Inventory:          new(repository.InventoryMemoryRepo),
+		Jobs:               new(repository.JobMemoryRepo),
+		Movements:          new(repository.InventoryMovementMemoryRepo),
+		OrderCodeSequences: new(repository.OrderCodeSequenceMemoryRepo),
+		Orders:             new(repository.OrderMemoryRepo),
+		Outbox:             new(repository.OutboxMemoryRepo),
+		Payments:           new(repository.PaymentMemoryRepo),
+		Products:           new(repository.ProductMemoryRepo),
+		Promotions:         new(repository.PromotionMemoryRepo),
+		Purchases:          new(repository.CustomerPurchaseMemoryRepo),
+		Warehouses:         new(repository.WarehouseMemoryRepo),
+	}
+}
+
+// Register registers the in-memory database and the repositories kept in memory, which start out empty apart from
+// the default warehouse
+func (r *MemoryRepositories) Register(container inject.ServiceContainer) {
+	container.RegisterService("db", new(database.Memory))
+
+	container.RegisterService("cartRepository", r.Carts)
+	container.RegisterService("customerPurchaseRepository", r.Purchases)
+	container.RegisterService("idempotencyKeyRepository", r.IdempotencyKeys)
+	container.RegisterService("inventoryRepository", r.Inventory)
+	container.RegisterService("inventoryMovementRepository", r.Movements)
+	container.RegisterService("jobRepository", r.Jobs)
+	container.RegisterService("orderRepository", r.Orders)
+	container.RegisterService("orderCodeSequenceRepository", r.OrderCodeSequences)
+	container.RegisterService("outboxRepository", r.Outbox)
+	container.RegisterService("paymentRepository", r.Payments)
+	container.RegisterService("productRepository", r.Products)
+	container.RegisterService("promotionRepository", r.Promotions)
+	container.RegisterService("warehouseRepository", r.Warehouses)
+}
+
+// RegisterMySQLRepositories registers the MySQL database and the repositories backed by it
+func RegisterMySQLRepositories(container inject.ServiceContainer) {
+	container.RegisterService("db", new(database.MySQL))
+
+	container.RegisterService("cartRepository", new(repository.CartMySQLRepo))
+	container.RegisterService("customerPurchaseRepository", new(repository.CustomerPurchaseMySQLRepo))
+	container.RegisterService("idempotencyKeyRepository", new(repository.IdempotencyKeyMySQLRepo))
+	container.RegisterService("inventoryRepository", new(repository.InventoryMySQLRepo))
+	container.RegisterService("inventoryMovementRepository", new(repository.InventoryMovementMySQLRepo))
+	container.RegisterService("jobRepository", new(repository.JobMySQLRepo))
+	container.RegisterService("orderRepository", new(repository.OrderMySQLRepo))
+	container.RegisterService("orderCodeSequenceRepository", new(repository.OrderCodeSequenceMySQLRepo))
+	container.RegisterService("outboxRepository", new(repository.OutboxMySQLRepo))
+	container.RegisterService("paymentRepository", new(repository.PaymentMySQLRepo))
+	container.RegisterService("productRepository", new(repository.ProductMySQLRepo))
+	container.RegisterService("promotionRepository", new(repository.PromotionMySQLRepo))
+	container.RegisterService("warehouseRepository", new(repository.WarehouseMySQLRepo))
+}
+
+// RegisterApplication registers the services, the handlers and the HTTP server on top of whichever repositories
+// are registered, and returns the server
+func RegisterApplication(container inject.ServiceContainer) *server.Server {
+	container.RegisterService("cartService", new(service.CartImpl))
+	container.RegisterService("holdSweeper", new(service.HoldSweeperImpl))
+	container.RegisterService("idempotencyService", new(service.IdempotencyImpl))
+	container.RegisterService("inventoryService", new(service.InventoryImpl))
+	container.RegisterService("jobService", new(service.JobImpl))
+	container.RegisterService("orderService", new(service.OrderImpl))
+	container.RegisterService("outboxDispatcher", new(service.OutboxDispatcherImpl))
+	container.RegisterService("paymentService", new(service.PaymentImpl))
+	container.RegisterService("paymentSweeper", new(service.PaymentSweeperImpl))
+	container.RegisterService("productService", new(service.ProductImpl))
+	container.RegisterService("promotionService", new(service.PromotionImpl))
+	container.RegisterService("reservationSweeper", new(service.ReservationSweeperImpl))
+	container.RegisterService("stockGate", new(service.StockGateImpl))
+
+	container.RegisterService("cartHandler", new(handler.CartImpl))
+	container.RegisterService("healthHandler", new(handler.HealthImpl))
+	container.RegisterService("idempotencyHandler", new(handler.IdempotencyImpl))
+	container.RegisterService("inventoryHandler", new(handler.InventoryImpl))
+	container.RegisterService("jobHandler", new(handler.JobImpl))
+	container.RegisterService("orderHandler", new(handler.OrderImpl))
+	container.RegisterService("paymentHandler", new(handler.PaymentImpl))
+	container.RegisterService("productHandler", new(handler.ProductImpl))
+	container.RegisterService("promotionHandler", new(handler.PromotionImpl))
+
+	var s server.Server
+	container.RegisterService("server", &s)
+	return &s
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	mySQLErrDuplicateEntry = 1062
+	mySQLErrDeadlock       = 1213
+)
+
+// isDuplicateEntryError checks whether an error is caused by a violated unique index
+func isDuplicateEntryError(err error) bool {
+	if mySQLErr, ok := err.(*mysql.MySQLError); ok {
+		return mySQLErr.Number == mySQLErrDuplicateEntry
+	}
+	return false
+}
+
+// isDeadlockError checks whether an error is caused by the transaction having been rolled back to break a deadlock
+func isDeadlockError(err error) bool {
+	if mySQLErr, ok := err.(*mysql.MySQLError); ok {
+		return mySQLErr.Number == mySQLErrDeadlock
+	}
+	return false
+}
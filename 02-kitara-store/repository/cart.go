@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryInsertCart = `
+		INSERT INTO carts (
+			entity_id,
+			customer_ref,
+			status,
+			order_entity_id,
+			created_at,
+			updated_at,
+			version
+		) VALUES (
+			:entity_id,
+			:customer_ref,
+			:status,
+			:order_entity_id,
+			:created_at,
+			:updated_at,
+			:version)`
+
+	queryInsertCartLine = `
+		INSERT INTO cart_lines (
+			entity_id,
+			cart_entity_id,
+			product_entity_id,
+			qty,
+			position
+		) VALUES (
+			:entity_id,
+			:cart_entity_id,
+			:product_entity_id,
+			:qty,
+			:position)`
+
+	queryInsertCartHold = `
+		INSERT INTO cart_holds (
+			entity_id,
+			cart_entity_id,
+			product_entity_id,
+			warehouse_entity_id,
+			inventory_entity_id,
+			qty,
+			expires_at
+		) VALUES (
+			:entity_id,
+			:cart_entity_id,
+			:product_entity_id,
+			:warehouse_entity_id,
+			:inventory_entity_id,
+			:qty,
+			:expires_at)`
+
+	querySelectCart = `
+		SELECT
+			carts.entity_id,
+			carts.customer_ref,
+			carts.status,
+			carts.order_entity_id,
+			carts.created_at,
+			carts.updated_at,
+			carts.version
+		FROM carts`
+
+	querySelectCartLine = `
+		SELECT
+			cart_lines.entity_id,
+			cart_lines.cart_entity_id,
+			cart_lines.product_entity_id,
+			cart_lines.qty,
+			cart_lines.position
+		FROM cart_lines`
+
+	querySelectCartHold = `
+		SELECT
+			cart_holds.entity_id,
+			cart_holds.cart_entity_id,
+			cart_holds.product_entity_id,
+			cart_holds.warehouse_entity_id,
+			cart_holds.inventory_entity_id,
+			cart_holds.qty,
+			cart_holds.expires_at
+		FROM cart_holds`
+
+	queryUpdateCart = `
+		UPDATE carts
+		SET
+			status = :status,
+			order_entity_id = :order_entity_id,
+			updated_at = :updated_at,
+			version = version + 1
+		WHERE entity_id = :entity_id AND version = :version`
+)
+
+// Cart is the Cart repository interface
+type Cart interface {
+	Startup()
+	Shutdown()
+	ResolveByID(id uuid.UUID) (cart *model.Cart, err error)
+	ResolveIDsWithExpiredHolds(at time.Time, limit int) (ids []uuid.UUID, err error)
+	TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (cart *model.Cart, err error)
+	TxCreate(tx *database.Tx, cart model.Cart) (err error)
+	TxUpdate(tx *database.Tx, cart model.Cart) (err error)
+}
+
+// CartMySQLRepo is the repository for Carts implemented with MySQL backend
+type CartMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *CartMySQLRepo) Startup() {
+	logger.Trace("Cart Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *CartMySQLRepo) Shutdown() {
+	logger.Trace("Cart Repository shutting down...")
+}
+
+// ResolveByID resolves a Cart by its ID, including its lines and holds
+func (r *CartMySQLRepo) ResolveByID(id uuid.UUID) (cart *model.Cart, err error) {
+	cart = &model.Cart{}
+	err = r.DB.Get(cart, querySelectCart+" WHERE carts.entity_id = ?", id)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Cart")
+		}
+		return nil, err
+	}
+
+	lines := make([]model.CartLine, 0)
+	err = r.DB.Select(&lines, querySelectCartLine+" WHERE cart_lines.cart_entity_id = ?", cart.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	holds := make([]model.CartHold, 0)
+	err = r.DB.Select(&holds, querySelectCartHold+" WHERE cart_holds.cart_entity_id = ?", cart.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	cart.AttachLines(lines)
+	cart.AttachHolds(holds)
+
+	return
+}
+
+// ResolveIDsWithExpiredHolds resolves the IDs of Carts holding inventory with holds that have expired at the
+// specified time, those that expired first coming first
+func (r *CartMySQLRepo) ResolveIDsWithExpiredHolds(at time.Time, limit int) (ids []uuid.UUID, err error) {
+	err = r.DB.Select(
+		&ids,
+		"SELECT cart_holds.cart_entity_id FROM cart_holds WHERE cart_holds.expires_at <= ? GROUP BY cart_holds.cart_entity_id ORDER BY MIN(cart_holds.expires_at) LIMIT ?",
+		at,
+		limit)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxResolveByIDForUpdate resolves and locks a Cart by its ID within the supplied transaction, including its lines
+// and holds
+func (r *CartMySQLRepo) TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (cart *model.Cart, err error) {
+	cart = &model.Cart{}
+	err = tx.Get(cart, querySelectCart+" WHERE carts.entity_id = ? FOR UPDATE", id)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Cart")
+		}
+		return nil, err
+	}
+
+	lines := make([]model.CartLine, 0)
+	err = tx.Select(&lines, querySelectCartLine+" WHERE cart_lines.cart_entity_id = ?", cart.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	holds := make([]model.CartHold, 0)
+	err = tx.Select(&holds, querySelectCartHold+" WHERE cart_holds.cart_entity_id = ?", cart.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	cart.AttachLines(lines)
+	cart.AttachHolds(holds)
+
+	return
+}
+
+// TxCreate creates a Cart with its lines and holds within the supplied transaction
+func (r *CartMySQLRepo) TxCreate(tx *database.Tx, cart model.Cart) (err error) {
+	stmt, err := tx.PrepareNamed(queryInsertCart)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	_, err = stmt.Exec(cart)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	return r.txInsertContents(tx, cart)
+}
+
+// TxUpdate updates a Cart within the supplied transaction, replacing its lines and holds with those supplied. It
+// fails if the Cart has changed since it was resolved.
+func (r *CartMySQLRepo) TxUpdate(tx *database.Tx, cart model.Cart) (err error) {
+	stmt, err := tx.PrepareNamed(queryUpdateCart)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	result, err := stmt.Exec(cart)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	if affected == 0 {
+		return failure.VersionConflict("Cart")
+	}
+
+	for _, query := range []string{
+		"DELETE FROM cart_lines WHERE cart_entity_id = ?",
+		"DELETE FROM cart_holds WHERE cart_entity_id = ?",
+	} {
+		if _, err = tx.Exec(query, cart.ID); err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+	}
+
+	return r.txInsertContents(tx, cart)
+}
+
+// txInsertContents inserts the lines and holds of a Cart within the supplied transaction
+func (r *CartMySQLRepo) txInsertContents(tx *database.Tx, cart model.Cart) (err error) {
+	if len(cart.Lines) > 0 {
+		lineStmt, err := tx.PrepareNamed(queryInsertCartLine)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+
+		for _, line := range cart.Lines {
+			_, err = lineStmt.Exec(line)
+			if err != nil {
+				logger.ErrNoStack("%v", err)
+				return err
+			}
+		}
+	}
+
+	if len(cart.Holds) > 0 {
+		holdStmt, err := tx.PrepareNamed(queryInsertCartHold)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+
+		for _, hold := range cart.Holds {
+			_, err = holdStmt.Exec(hold)
+			if err != nil {
+				logger.ErrNoStack("%v", err)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
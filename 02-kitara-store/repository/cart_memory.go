@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// CartMemoryRepo is the repository for Carts kept in memory, together with their lines and holds. Reads without a
+// lock only see committed Carts.
+type CartMemoryRepo struct {
+	memoryLatency
+	mux       sync.RWMutex
+	carts     map[uuid.UUID]model.Cart
+	committed map[uuid.UUID]*model.Cart
+	locks     *memoryLocks
+}
+
+// Startup performs startup functions
+func (r *CartMemoryRepo) Startup() {
+	logger.Trace("Cart Repository starting up...")
+	r.carts = make(map[uuid.UUID]model.Cart)
+	r.committed = make(map[uuid.UUID]*model.Cart)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *CartMemoryRepo) Shutdown() {
+	logger.Trace("Cart Repository shutting down...")
+}
+
+// ResolveByID resolves a Cart by its ID, including its lines and holds
+func (r *CartMemoryRepo) ResolveByID(id uuid.UUID) (cart *model.Cart, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	stored, ok := r.carts[id]
+	if ok {
+		stored, ok = r.committedImage(stored)
+	}
+	if !ok {
+		return nil, failure.EntityNotFound("Cart")
+	}
+
+	return copyCart(stored), nil
+}
+
+// ResolveIDsWithExpiredHolds resolves the IDs of Carts holding inventory with holds that have expired at the
+// specified time, those that expired first coming first
+func (r *CartMemoryRepo) ResolveIDsWithExpiredHolds(at time.Time, limit int) (ids []uuid.UUID, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	expiredAt := make(map[uuid.UUID]time.Time)
+	for _, stored := range r.carts {
+		stored, ok := r.committedImage(stored)
+		if !ok {
+			continue
+		}
+
+		for _, hold := range stored.HoldsExpiredAt(at) {
+			if first, seen := expiredAt[stored.ID]; !seen || hold.ExpiresAt.Before(first) {
+				expiredAt[stored.ID] = hold.ExpiresAt
+			}
+		}
+	}
+
+	ids = make([]uuid.UUID, 0)
+	for id := range expiredAt {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return expiredAt[ids[i]].Before(expiredAt[ids[j]])
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return
+}
+
+// TxResolveByIDForUpdate resolves and locks a Cart by its ID within the supplied transaction, including its lines
+// and holds
+func (r *CartMemoryRepo) TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (cart *model.Cart, err error) {
+	r.roundTrip()
+	r.locks.lock(tx, id)
+
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	stored, ok := r.carts[id]
+	if !ok {
+		return nil, failure.EntityNotFound("Cart")
+	}
+
+	return copyCart(stored), nil
+}
+
+// TxCreate creates a Cart with its lines and holds within the supplied transaction
+func (r *CartMemoryRepo) TxCreate(tx *database.Tx, cart model.Cart) (err error) {
+	r.roundTrip()
+	r.locks.lock(tx, cart.ID)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, exists := r.carts[cart.ID]; exists {
+		return failure.DuplicateEntity("Cart", "already exists")
+	}
+
+	r.keepCommitted(tx, cart.ID, nil)
+	r.carts[cart.ID] = *copyCart(cart)
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.carts, cart.ID)
+	})
+
+	return nil
+}
+
+// TxUpdate updates a Cart within the supplied transaction, replacing its lines and holds with those supplied. It
+// fails if the Cart has changed since it was resolved.
+func (r *CartMemoryRepo) TxUpdate(tx *database.Tx, cart model.Cart) (err error) {
+	r.roundTrip()
+	r.locks.lock(tx, cart.ID)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	stored, ok := r.carts[cart.ID]
+	if !ok || stored.Version != cart.Version {
+		return failure.VersionConflict("Cart")
+	}
+
+	r.keepCommitted(tx, stored.ID, &stored)
+	updated := *copyCart(cart)
+	updated.CustomerRef = stored.CustomerRef
+	updated.CreatedAt = stored.CreatedAt
+	updated.Version++
+	r.carts[cart.ID] = updated
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.carts[stored.ID] = stored
+	})
+
+	return nil
+}
+
+// keepCommitted keeps the committed image of a Cart, or nil if it did not exist, for reads without a lock until
+// the transaction changing it ends. It must be called with the row locked and the repository mutex held.
+func (r *CartMemoryRepo) keepCommitted(tx *database.Tx, id uuid.UUID, image *model.Cart) {
+	if _, changed := r.committed[id]; changed {
+		return
+	}
+
+	r.committed[id] = image
+	tx.OnEnd(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.committed, id)
+	})
+}
+
+// committedImage returns the committed image of a stored Cart, or false if the Cart has not been committed yet. It
+// must be called with the repository mutex held.
+func (r *CartMemoryRepo) committedImage(cart model.Cart) (model.Cart, bool) {
+	image, changed := r.committed[cart.ID]
+	if !changed {
+		return cart, true
+	}
+	if image == nil {
+		return model.Cart{}, false
+	}
+	return *image, true
+}
+
+func copyCart(cart model.Cart) *model.Cart {
+	cart.Lines = append(make([]model.CartLine, 0), cart.Lines...)
+	cart.Holds = append(make([]model.CartHold, 0), cart.Holds...)
+	return &cart
+}
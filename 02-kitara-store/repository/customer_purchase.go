@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryAddCustomerPurchase = `
+		INSERT INTO customer_purchases (
+			customer_ref,
+			product_entity_id,
+			qty
+		) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE qty = qty + VALUES(qty)`
+
+	querySelectCustomerPurchaseQty = `
+		SELECT customer_purchases.qty
+		FROM customer_purchases
+		WHERE customer_purchases.customer_ref = ? AND customer_purchases.product_entity_id = ?`
+)
+
+// CustomerPurchase is the repository interface for the quantities of each Product that customers have purchased
+type CustomerPurchase interface {
+	Startup()
+	Shutdown()
+	TxAddQty(tx *database.Tx, customerRef string, productID uuid.UUID, delta int) (qty int, err error)
+}
+
+// CustomerPurchaseMySQLRepo is the repository for customer purchases implemented with MySQL backend
+type CustomerPurchaseMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *CustomerPurchaseMySQLRepo) Startup() {
+	logger.Trace("Customer Purchase Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *CustomerPurchaseMySQLRepo) Shutdown() {
+	logger.Trace("Customer Purchase Repository shutting down...")
+}
+
+// TxAddQty changes the quantity of a Product purchased by a customer by delta within the supplied transaction and
+// returns the new quantity. The first purchase of a Product inserts its row and later ones update it, either of which
+// locks the row until the transaction ends, so the returned quantity cannot change under the caller.
+func (r *CustomerPurchaseMySQLRepo) TxAddQty(tx *database.Tx, customerRef string, productID uuid.UUID, delta int) (qty int, err error) {
+	_, err = tx.Exec(queryAddCustomerPurchase, customerRef, productID, delta)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	err = tx.Get(&qty, querySelectCustomerPurchaseQty, customerRef, productID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
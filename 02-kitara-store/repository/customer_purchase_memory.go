@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// customerPurchaseKey identifies the purchases of one Product by one customer
+type customerPurchaseKey struct {
+	customerRef string
+	productID   uuid.UUID
+}
+
+// CustomerPurchaseMemoryRepo is the repository for customer purchases kept in memory.
+// Quantities are changed under a row lock held until the transaction ends. Setting Latency delays every call by a
+// simulated round trip to the database.
+type CustomerPurchaseMemoryRepo struct {
+	memoryLatency
+	mux       sync.Mutex
+	purchases map[customerPurchaseKey]int
+	locks     *memoryLocks
+}
+
+// Startup performs startup functions
+func (r *CustomerPurchaseMemoryRepo) Startup() {
+	logger.Trace("Customer Purchase Repository starting up...")
+	r.purchases = make(map[customerPurchaseKey]int)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *CustomerPurchaseMemoryRepo) Shutdown() {
+	logger.Trace("Customer Purchase Repository shutting down...")
+}
+
+// TxAddQty changes the quantity of a Product purchased by a customer by delta within the supplied transaction and
+// returns the new quantity. The purchases stay locked until the transaction ends.
+func (r *CustomerPurchaseMemoryRepo) TxAddQty(tx *database.Tx, customerRef string, productID uuid.UUID, delta int) (qty int, err error) {
+	r.roundTrip()
+	key := customerPurchaseKey{customerRef: customerRef, productID: productID}
+	r.locks.lock(tx, key)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.purchases[key] += delta
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.purchases[key] -= delta
+	})
+
+	return r.purchases[key], nil
+}
+
+// ResolveQty resolves the quantity of a Product purchased by a customer
+func (r *CustomerPurchaseMemoryRepo) ResolveQty(customerRef string, productID uuid.UUID) int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.purchases[customerPurchaseKey{customerRef: customerRef, productID: productID}]
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryInsertIdempotencyKey = `
+		INSERT INTO idempotency_keys (
+			idempotency_key,
+			request_hash,
+			status,
+			response_code,
+			response_content_type,
+			response_body,
+			created_at,
+			expires_at
+		) VALUES (
+			:idempotency_key,
+			:request_hash,
+			:status,
+			:response_code,
+			:response_content_type,
+			:response_body,
+			:created_at,
+			:expires_at)`
+
+	querySelectIdempotencyKey = `
+		SELECT
+			idempotency_keys.idempotency_key,
+			idempotency_keys.request_hash,
+			idempotency_keys.status,
+			idempotency_keys.response_code,
+			idempotency_keys.response_content_type,
+			idempotency_keys.response_body,
+			idempotency_keys.created_at,
+			idempotency_keys.expires_at
+		FROM idempotency_keys`
+
+	queryUpdateIdempotencyKey = `
+		UPDATE idempotency_keys
+		SET
+			status = :status,
+			response_code = :response_code,
+			response_content_type = :response_content_type,
+			response_body = :response_body
+		WHERE idempotency_key = :idempotency_key AND created_at = :created_at AND status = 'in_progress'`
+)
+
+// IdempotencyKey is the Idempotency Key repository interface
+type IdempotencyKey interface {
+	Startup()
+	Shutdown()
+	Create(key model.IdempotencyKey) (err error)
+	ResolveByKey(key string) (idempotencyKey *model.IdempotencyKey, err error)
+	Update(key model.IdempotencyKey) (err error)
+	Delete(key model.IdempotencyKey) (err error)
+	DeleteExpired(before time.Time) (deleted int64, err error)
+}
+
+// IdempotencyKeyMySQLRepo is the repository for Idempotency Keys implemented with MySQL backend
+type IdempotencyKeyMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *IdempotencyKeyMySQLRepo) Startup() {
+	logger.Trace("Idempotency Key Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *IdempotencyKeyMySQLRepo) Shutdown() {
+	logger.Trace("Idempotency Key Repository shutting down...")
+}
+
+// Create creates a new Idempotency Key, failing with a duplicate entity failure if the key is already in use
+func (r *IdempotencyKeyMySQLRepo) Create(key model.IdempotencyKey) (err error) {
+	stmt, err := r.DB.Prepare(queryInsertIdempotencyKey)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(key)
+	if err != nil {
+		if isDuplicateEntryError(err) {
+			return failure.DuplicateEntity("Idempotency Key", "already in use")
+		}
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ResolveByKey resolves an Idempotency Key by its key
+func (r *IdempotencyKeyMySQLRepo) ResolveByKey(key string) (idempotencyKey *model.IdempotencyKey, err error) {
+	idempotencyKey = &model.IdempotencyKey{}
+	err = r.DB.Get(idempotencyKey, querySelectIdempotencyKey+" WHERE idempotency_keys.idempotency_key = ?", key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, failure.EntityNotFound("Idempotency Key")
+		}
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	return
+}
+
+// Update updates the status and stored response of an in-progress Idempotency Key. It fails with a version conflict
+// if the key has been completed, replaced or deleted since it was claimed.
+func (r *IdempotencyKeyMySQLRepo) Update(key model.IdempotencyKey) (err error) {
+	stmt, err := r.DB.Prepare(queryUpdateIdempotencyKey)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(key)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	if affected == 0 {
+		return failure.VersionConflict("Idempotency Key")
+	}
+
+	return nil
+}
+
+// Delete deletes an Idempotency Key, as long as it has not been replaced since it was resolved
+func (r *IdempotencyKeyMySQLRepo) Delete(key model.IdempotencyKey) (err error) {
+	_, err = r.DB.Exec(
+		"DELETE FROM idempotency_keys WHERE idempotency_keys.idempotency_key = ? AND idempotency_keys.created_at = ?",
+		key.Key,
+		key.CreatedAt)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// DeleteExpired deletes all Idempotency Keys that expired before the specified time
+func (r *IdempotencyKeyMySQLRepo) DeleteExpired(before time.Time) (deleted int64, err error) {
+	result, err := r.DB.Exec("DELETE FROM idempotency_keys WHERE idempotency_keys.expires_at < ?", before)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// IdempotencyKeyMemoryRepo is the repository for Idempotency Keys kept in memory
+type IdempotencyKeyMemoryRepo struct {
+	mux  sync.Mutex
+	keys map[string]model.IdempotencyKey
+}
+
+// Startup performs startup functions
+func (r *IdempotencyKeyMemoryRepo) Startup() {
+	logger.Trace("Idempotency Key Repository starting up...")
+	r.keys = make(map[string]model.IdempotencyKey)
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *IdempotencyKeyMemoryRepo) Shutdown() {
+	logger.Trace("Idempotency Key Repository shutting down...")
+}
+
+// Create creates a new Idempotency Key, failing with a duplicate entity failure if the key is already in use
+func (r *IdempotencyKeyMemoryRepo) Create(key model.IdempotencyKey) (err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, exists := r.keys[key.Key]; exists {
+		return failure.DuplicateEntity("Idempotency Key", "already in use")
+	}
+
+	r.keys[key.Key] = key
+	return nil
+}
+
+// ResolveByKey resolves an Idempotency Key by its key
+func (r *IdempotencyKeyMemoryRepo) ResolveByKey(key string) (idempotencyKey *model.IdempotencyKey, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	stored, ok := r.keys[key]
+	if !ok {
+		return nil, failure.EntityNotFound("Idempotency Key")
+	}
+
+	return &stored, nil
+}
+
+// Update updates the status and stored response of an in-progress Idempotency Key. It fails with a version conflict
+// if the key has been completed, replaced or deleted since it was claimed.
+func (r *IdempotencyKeyMemoryRepo) Update(key model.IdempotencyKey) (err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	stored, ok := r.keys[key.Key]
+	if !ok || !stored.CreatedAt.Equal(key.CreatedAt) || stored.Status != model.IdempotencyStatusInProgress {
+		return failure.VersionConflict("Idempotency Key")
+	}
+
+	stored.Status = key.Status
+	stored.ResponseCode = key.ResponseCode
+	stored.ResponseContentType = key.ResponseContentType
+	stored.ResponseBody = key.ResponseBody
+	r.keys[key.Key] = stored
+	return nil
+}
+
+// Delete deletes an Idempotency Key, as long as it has not been replaced since it was resolved
+func (r *IdempotencyKeyMemoryRepo) Delete(key model.IdempotencyKey) (err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if stored, ok := r.keys[key.Key]; ok && stored.CreatedAt.Equal(key.CreatedAt) {
+		delete(r.keys, key.Key)
+	}
+	return nil
+}
+
+// DeleteExpired deletes all Idempotency Keys that expired before the specified time
+func (r *IdempotencyKeyMemoryRepo) DeleteExpired(before time.Time) (deleted int64, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for key, stored := range r.keys {
+		if stored.ExpiresAt.Before(before) {
+			delete(r.keys, key)
+			deleted++
+		}
+	}
+	return
+}
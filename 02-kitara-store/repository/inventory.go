@@ -1,10 +1,12 @@
 package repository
 
 import (
+	"database/sql"
+
 	"github.com/gofrs/uuid"
-	"github.com/jmoiron/sqlx"
 	"github.com/kerti/evm/02-kitara-store/database"
 	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
 	"github.com/kerti/evm/02-kitara-store/util/logger"
 )
 
@@ -13,19 +15,60 @@ const (
 		SELECT
 			inventory.entity_id,
 			inventory.product_entity_id,
+			inventory.warehouse_entity_id,
 			inventory.qty_in_store,
 			inventory.qty_reserved,
-			inventory.qty_available
+			inventory.qty_held,
+			inventory.qty_available,
+			inventory.version
 		FROM inventory`
 
+	queryInsertInventory = `
+		INSERT INTO inventory (
+			entity_id,
+			product_entity_id,
+			warehouse_entity_id,
+			qty_in_store,
+			qty_reserved,
+			qty_held,
+			qty_available
+		) VALUES (
+			:entity_id,
+			:product_entity_id,
+			:warehouse_entity_id,
+			:qty_in_store,
+			:qty_reserved,
+			:qty_held,
+			:qty_available)`
+
+	querySelectLowStock = `
+		SELECT
+			products.entity_id AS product_entity_id,
+			products.sku,
+			products.name,
+			products.reorder_point,
+			COALESCE(SUM(inventory.qty_in_store), 0) AS qty_in_store,
+			COALESCE(SUM(inventory.qty_reserved), 0) AS qty_reserved,
+			COALESCE(SUM(inventory.qty_held), 0) AS qty_held,
+			COALESCE(SUM(inventory.qty_available), 0) AS qty_available
+		FROM products
+		LEFT JOIN inventory ON inventory.product_entity_id = products.entity_id
+		WHERE NOT EXISTS (SELECT bundle_entity_id FROM bundle_components WHERE bundle_components.bundle_entity_id = products.entity_id)
+		GROUP BY products.entity_id, products.sku, products.name, products.reorder_point
+		HAVING qty_available <= products.reorder_point
+		ORDER BY products.sku`
+
 	queryUpdateInventory = `
 		UPDATE inventory
 		SET
 			product_entity_id = :product_entity_id,
+			warehouse_entity_id = :warehouse_entity_id,
 			qty_in_store = :qty_in_store,
 			qty_reserved = :qty_reserved,
-			qty_available = :qty_available
-		WHERE entity_id = :entity_id`
+			qty_held = :qty_held,
+			qty_available = :qty_available,
+			version = version + 1
+		WHERE entity_id = :entity_id AND version = :version`
 )
 
 // Inventory is the Inventory repository interface
@@ -33,12 +76,16 @@ type Inventory interface {
 	Startup()
 	Shutdown()
 	ResolveByProductIDs(ids []uuid.UUID) (inventories []model.Inventory, err error)
-	TxUpdate(tx *sqlx.Tx, inventory model.Inventory) (err error)
+	ResolveLowStock() (items []model.LowStockItem, err error)
+	TxResolveByProductIDsForUpdate(tx *database.Tx, ids []uuid.UUID) (inventories []model.Inventory, err error)
+	TxResolveByProductAndWarehouseForUpdate(tx *database.Tx, productID uuid.UUID, warehouseID uuid.UUID) (inventory *model.Inventory, err error)
+	TxCreate(tx *database.Tx, inventory model.Inventory) (err error)
+	TxUpdate(tx *database.Tx, inventory model.Inventory) (err error)
 }
 
 // InventoryMySQLRepo is the repository for Inventory implemented with MySQL backend
 type InventoryMySQLRepo struct {
-	DB *database.MySQL `inject:"mysql"`
+	DB *database.MySQL `inject:"db"`
 }
 
 // Startup performs startup functions
@@ -51,13 +98,15 @@ func (r *InventoryMySQLRepo) Shutdown() {
 	logger.Trace("Inventory Repository shutting down...")
 }
 
-// ResolveByProductIDs resolves Inventories by their Product IDs
+// ResolveByProductIDs resolves Inventories by their Product IDs, across all Warehouses
 func (r *InventoryMySQLRepo) ResolveByProductIDs(ids []uuid.UUID) (inventories []model.Inventory, err error) {
 	if len(ids) == 0 {
 		return
 	}
 
-	query, args, err := r.DB.In(querySelectInventory+" WHERE inventory.product_entity_id IN (?)", ids)
+	query, args, err := r.DB.In(
+		querySelectInventory+" WHERE inventory.product_entity_id IN (?) ORDER BY inventory.product_entity_id, inventory.warehouse_entity_id",
+		ids)
 	if err != nil {
 		logger.ErrNoStack("%v", err)
 		return
@@ -71,9 +120,64 @@ func (r *InventoryMySQLRepo) ResolveByProductIDs(ids []uuid.UUID) (inventories [
 	return
 }
 
-// TxUpdate performs an update transactionally with transaction object supplied from elsewhere
-func (r *InventoryMySQLRepo) TxUpdate(tx *sqlx.Tx, inventory model.Inventory) (err error) {
-	stmt, err := tx.PrepareNamed(queryUpdateInventory)
+// ResolveLowStock resolves every Product whose available quantity across all Warehouses is at or below its reorder point.
+// Bundles have no stock of their own and are left out.
+func (r *InventoryMySQLRepo) ResolveLowStock() (items []model.LowStockItem, err error) {
+	items = make([]model.LowStockItem, 0)
+	err = r.DB.Select(&items, querySelectLowStock)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxResolveByProductIDsForUpdate resolves and locks Inventories by their Product IDs, across all Warehouses, within the
+// supplied transaction. Rows are locked in ascending Product and Warehouse ID order so that concurrent transactions
+// cannot deadlock on each other.
+func (r *InventoryMySQLRepo) TxResolveByProductIDsForUpdate(tx *database.Tx, ids []uuid.UUID) (inventories []model.Inventory, err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	query, args, err := r.DB.In(
+		querySelectInventory+" WHERE inventory.product_entity_id IN (?) ORDER BY inventory.product_entity_id, inventory.warehouse_entity_id FOR UPDATE",
+		ids)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	err = tx.Select(&inventories, query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+
+	return
+}
+
+// TxResolveByProductAndWarehouseForUpdate resolves and locks the Inventory of a Product in a Warehouse within the
+// supplied transaction
+func (r *InventoryMySQLRepo) TxResolveByProductAndWarehouseForUpdate(tx *database.Tx, productID uuid.UUID, warehouseID uuid.UUID) (inventory *model.Inventory, err error) {
+	inventory = &model.Inventory{}
+	err = tx.Get(
+		inventory,
+		querySelectInventory+" WHERE inventory.product_entity_id = ? AND inventory.warehouse_entity_id = ? FOR UPDATE",
+		productID,
+		warehouseID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Inventory")
+		}
+		return nil, err
+	}
+
+	return
+}
+
+// TxCreate creates an Inventory transactionally with the transaction object supplied from elsewhere
+func (r *InventoryMySQLRepo) TxCreate(tx *database.Tx, inventory model.Inventory) (err error) {
+	stmt, err := tx.PrepareNamed(queryInsertInventory)
 	if err != nil {
 		logger.ErrNoStack("%v", err)
 		return err
@@ -82,8 +186,42 @@ func (r *InventoryMySQLRepo) TxUpdate(tx *sqlx.Tx, inventory model.Inventory) (e
 	_, err = stmt.Exec(inventory)
 	if err != nil {
 		logger.ErrNoStack("%v", err)
+		if isDuplicateEntryError(err) {
+			return failure.DuplicateEntity("Inventory", "the product already has inventory in this warehouse")
+		}
+		if isDeadlockError(err) {
+			return failure.VersionConflict("Inventory")
+		}
 		return err
 	}
 
 	return nil
 }
+
+// TxUpdate performs an update transactionally with transaction object supplied from elsewhere.
+// The update only succeeds if the stored version still matches the supplied one, otherwise a version conflict is returned.
+func (r *InventoryMySQLRepo) TxUpdate(tx *database.Tx, inventory model.Inventory) (err error) {
+	stmt, err := tx.PrepareNamed(queryUpdateInventory)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	result, err := stmt.Exec(inventory)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	if affected == 0 {
+		return failure.VersionConflict("Inventory")
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// InventoryMemoryRepo is the repository for Inventory kept in memory.
+// Row locks are taken per Product, covering its Inventory in every Warehouse, which also keeps other transactions
+// from adding Inventory for a locked Product the way MySQL's gap locks do. Reads without a lock only see committed
+// Inventory. Setting Latency delays every call by a simulated round trip to the database.
+type InventoryMemoryRepo struct {
+	memoryLatency
+	ProductRepository *ProductMemoryRepo `inject:"productRepository"`
+	mux               sync.RWMutex
+	inventories       map[uuid.UUID]model.Inventory
+	committed         map[uuid.UUID]*model.Inventory
+	locks             *memoryLocks
+}
+
+// Startup performs startup functions
+func (r *InventoryMemoryRepo) Startup() {
+	logger.Trace("Inventory Repository starting up...")
+	r.inventories = make(map[uuid.UUID]model.Inventory)
+	r.committed = make(map[uuid.UUID]*model.Inventory)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *InventoryMemoryRepo) Shutdown() {
+	logger.Trace("Inventory Repository shutting down...")
+}
+
+// ResolveByProductIDs resolves Inventories by their Product IDs, across all Warehouses
+func (r *InventoryMemoryRepo) ResolveByProductIDs(ids []uuid.UUID) (inventories []model.Inventory, err error) {
+	return r.resolveByProductIDs(ids, false)
+}
+
+// resolveByProductIDs resolves Inventories by their Product IDs, either as last committed or including the changes
+// of transactions that have not ended yet
+func (r *InventoryMemoryRepo) resolveByProductIDs(ids []uuid.UUID, uncommitted bool) (inventories []model.Inventory, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	productIDs := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		productIDs[id] = true
+	}
+
+	for _, inventory := range r.inventories {
+		visible := true
+		if !uncommitted {
+			inventory, visible = r.committedImage(inventory)
+		}
+		if visible && productIDs[inventory.ProductID] {
+			inventories = append(inventories, inventory)
+		}
+	}
+	sort.Slice(inventories, func(i, j int) bool {
+		if inventories[i].ProductID != inventories[j].ProductID {
+			return inventories[i].ProductID.String() < inventories[j].ProductID.String()
+		}
+		return inventories[i].WarehouseID.String() < inventories[j].WarehouseID.String()
+	})
+	return
+}
+
+// ResolveLowStock resolves every Product whose available quantity across all Warehouses is at or below its reorder point.
+// Bundles have no stock of their own and are left out.
+func (r *InventoryMemoryRepo) ResolveLowStock() (items []model.LowStockItem, err error) {
+	items = make([]model.LowStockItem, 0)
+	for _, product := range r.ProductRepository.resolveAll() {
+		if product.IsBundle() {
+			continue
+		}
+
+		inventories, err := r.ResolveByProductIDs([]uuid.UUID{product.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		item := model.LowStockItem{
+			ProductID:    product.ID,
+			SKU:          product.SKU,
+			Name:         product.Name,
+			ReorderPoint: product.ReorderPoint,
+		}
+		for _, inventory := range inventories {
+			item.QtyInStore += inventory.QtyInStore
+			item.QtyReserved += inventory.QtyReserved
+			item.QtyHeld += inventory.QtyHeld
+			item.QtyAvailable += inventory.QtyAvailable
+		}
+
+		if item.QtyAvailable <= item.ReorderPoint {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// TxResolveByProductIDsForUpdate resolves and locks Inventories by their Product IDs, across all Warehouses, within the
+// supplied transaction. Products are locked in ascending ID order so that concurrent transactions cannot deadlock on
+// each other.
+func (r *InventoryMemoryRepo) TxResolveByProductIDsForUpdate(tx *database.Tx, ids []uuid.UUID) (inventories []model.Inventory, err error) {
+	r.locks.lockIDs(tx, ids)
+	return r.resolveByProductIDs(ids, true)
+}
+
+// TxResolveByProductAndWarehouseForUpdate resolves and locks the Inventory of a Product in a Warehouse within the
+// supplied transaction
+func (r *InventoryMemoryRepo) TxResolveByProductAndWarehouseForUpdate(tx *database.Tx, productID uuid.UUID, warehouseID uuid.UUID) (inventory *model.Inventory, err error) {
+	inventories, err := r.TxResolveByProductIDsForUpdate(tx, []uuid.UUID{productID})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inventory := range inventories {
+		if inventory.WarehouseID == warehouseID {
+			return &inventory, nil
+		}
+	}
+
+	return nil, failure.EntityNotFound("Inventory")
+}
+
+// TxCreate creates an Inventory within the supplied transaction
+func (r *InventoryMemoryRepo) TxCreate(tx *database.Tx, inventory model.Inventory) (err error) {
+	r.roundTrip()
+	r.locks.lock(tx, inventory.ProductID)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, existing := range r.inventories {
+		if existing.ProductID == inventory.ProductID && existing.WarehouseID == inventory.WarehouseID {
+			return failure.DuplicateEntity("Inventory", "the product already has inventory in this warehouse")
+		}
+	}
+
+	r.keepCommitted(tx, inventory.ID, nil)
+	r.inventories[inventory.ID] = inventory
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.inventories, inventory.ID)
+	})
+
+	return nil
+}
+
+// TxUpdate performs an update within the supplied transaction.
+// The update only succeeds if the stored version still matches the supplied one, otherwise a version conflict is returned.
+func (r *InventoryMemoryRepo) TxUpdate(tx *database.Tx, inventory model.Inventory) (err error) {
+	r.roundTrip()
+	r.locks.lock(tx, inventory.ProductID)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	stored, ok := r.inventories[inventory.ID]
+	if !ok || stored.Version != inventory.Version {
+		return failure.VersionConflict("Inventory")
+	}
+
+	r.keepCommitted(tx, stored.ID, &stored)
+	inventory.Version++
+	r.inventories[inventory.ID] = inventory
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.inventories[stored.ID] = stored
+	})
+
+	return nil
+}
+
+// keepCommitted keeps the committed image of an Inventory, or nil if it did not exist, for reads without a lock until
+// the transaction changing it ends. It must be called with the row locked and the repository mutex held.
+func (r *InventoryMemoryRepo) keepCommitted(tx *database.Tx, id uuid.UUID, image *model.Inventory) {
+	if _, changed := r.committed[id]; changed {
+		return
+	}
+
+	r.committed[id] = image
+	tx.OnEnd(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.committed, id)
+	})
+}
+
+// committedImage returns the committed image of a stored Inventory, or false if the Inventory has not been committed
+// yet. It must be called with the repository mutex held.
+func (r *InventoryMemoryRepo) committedImage(inventory model.Inventory) (model.Inventory, bool) {
+	image, changed := r.committed[inventory.ID]
+	if !changed {
+		return inventory, true
+	}
+	if image == nil {
+		return model.Inventory{}, false
+	}
+	return *image, true
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryInsertJob = `
+		INSERT INTO jobs (
+			entity_id,
+			type,
+			order_entity_id,
+			shard_key,
+			status,
+			attempts,
+			created_at
+		) VALUES (
+			:entity_id,
+			:type,
+			:order_entity_id,
+			:shard_key,
+			:status,
+			:attempts,
+			:created_at)`
+
+	querySelectJob = `
+		SELECT
+			jobs.entity_id,
+			jobs.type,
+			jobs.order_entity_id,
+			jobs.shard_key,
+			jobs.status,
+			jobs.attempts,
+			COALESCE(jobs.result, '') AS result,
+			COALESCE(jobs.failure, '') AS failure,
+			jobs.created_at,
+			jobs.started_at,
+			jobs.lease_expires_at,
+			jobs.finished_at
+		FROM jobs`
+
+	queryClaimJob = `
+		UPDATE jobs
+		SET
+			status = :status,
+			attempts = :attempts,
+			started_at = :started_at,
+			lease_expires_at = :lease_expires_at
+		WHERE entity_id = :entity_id`
+
+	queryAcknowledgeJob = `
+		UPDATE jobs
+		SET
+			status = :status,
+			result = NULLIF(:result, ''),
+			failure = NULLIF(:failure, ''),
+			lease_expires_at = :lease_expires_at,
+			finished_at = :finished_at
+		WHERE entity_id = :entity_id AND status = 'running' AND attempts = :attempts`
+)
+
+// Job is the Job repository interface
+type Job interface {
+	Startup()
+	Shutdown()
+	Create(job model.Job) (err error)
+	ResolveByID(id uuid.UUID) (job *model.Job, err error)
+	TxResolveClaimable(tx *database.Tx, at time.Time, limit int) (jobs []model.Job, err error)
+	TxClaim(tx *database.Tx, jobs []model.Job) (err error)
+	TxAcknowledge(tx *database.Tx, job model.Job) (err error)
+	Acknowledge(job model.Job) (err error)
+}
+
+// JobMySQLRepo is the repository for Jobs implemented with MySQL backend
+type JobMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *JobMySQLRepo) Startup() {
+	logger.Trace("Job Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *JobMySQLRepo) Shutdown() {
+	logger.Trace("Job Repository shutting down...")
+}
+
+// Create queues a new Job
+func (r *JobMySQLRepo) Create(job model.Job) (err error) {
+	stmt, err := r.DB.Prepare(queryInsertJob)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(job)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// ResolveByID resolves a Job by its ID
+func (r *JobMySQLRepo) ResolveByID(id uuid.UUID) (job *model.Job, err error) {
+	job = &model.Job{}
+	err = r.DB.Get(job, querySelectJob+" WHERE jobs.entity_id = ?", id)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Job")
+		}
+		return nil, err
+	}
+
+	return
+}
+
+// TxResolveClaimable resolves and locks the oldest Jobs that may be claimed at the specified time within the
+// supplied transaction: queued Jobs and running Jobs whose lease has expired. Pollers on several replicas wait for
+// each other here, so a Job is only ever claimed by one of them at a time.
+func (r *JobMySQLRepo) TxResolveClaimable(tx *database.Tx, at time.Time, limit int) (jobs []model.Job, err error) {
+	err = tx.Select(
+		&jobs,
+		querySelectJob+" WHERE jobs.status = ? OR (jobs.status = ? AND jobs.lease_expires_at < ?) ORDER BY jobs.created_at LIMIT ? FOR UPDATE",
+		model.JobStatusQueued,
+		model.JobStatusRunning,
+		at,
+		limit)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxClaim writes claimed Jobs within the supplied transaction
+func (r *JobMySQLRepo) TxClaim(tx *database.Tx, jobs []model.Job) (err error) {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareNamed(queryClaimJob)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	for _, job := range jobs {
+		_, err = stmt.Exec(job)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TxAcknowledge writes the outcome of a claimed Job within the supplied transaction. It fails if the Job has been
+// claimed again since, so only the latest claim can acknowledge it.
+func (r *JobMySQLRepo) TxAcknowledge(tx *database.Tx, job model.Job) (err error) {
+	stmt, err := tx.PrepareNamed(queryAcknowledgeJob)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	result, err := stmt.Exec(job)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	return checkJobAcknowledged(result)
+}
+
+// Acknowledge writes the outcome of a claimed Job. It fails if the Job has been claimed again since, so only the
+// latest claim can acknowledge it.
+func (r *JobMySQLRepo) Acknowledge(job model.Job) (err error) {
+	stmt, err := r.DB.Prepare(queryAcknowledgeJob)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(job)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	return checkJobAcknowledged(result)
+}
+
+func checkJobAcknowledged(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	if affected == 0 {
+		return failure.OperationNotPermitted("acknowledge", "Job", "the job has been claimed again")
+	}
+
+	return nil
+}
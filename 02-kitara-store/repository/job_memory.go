@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// jobClaimLock is the key of the lock pollers take before claiming Jobs
+const jobClaimLock = "claim"
+
+// JobMemoryRepo is the repository for Jobs kept in memory. Reads without a lock only see committed Jobs.
+type JobMemoryRepo struct {
+	mux       sync.RWMutex
+	jobs      map[uuid.UUID]model.Job
+	committed map[uuid.UUID]*model.Job
+	locks     *memoryLocks
+}
+
+// Startup performs startup functions
+func (r *JobMemoryRepo) Startup() {
+	logger.Trace("Job Repository starting up...")
+	r.jobs = make(map[uuid.UUID]model.Job)
+	r.committed = make(map[uuid.UUID]*model.Job)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *JobMemoryRepo) Shutdown() {
+	logger.Trace("Job Repository shutting down...")
+}
+
+// Create queues a new Job
+func (r *JobMemoryRepo) Create(job model.Job) (err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, exists := r.jobs[job.ID]; exists {
+		return failure.DuplicateEntity("Job", "already exists")
+	}
+
+	r.jobs[job.ID] = job
+	return nil
+}
+
+// ResolveByID resolves a Job by its ID
+func (r *JobMemoryRepo) ResolveByID(id uuid.UUID) (job *model.Job, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	stored, ok := r.jobs[id]
+	if ok {
+		stored, ok = r.committedImage(stored)
+	}
+	if !ok {
+		return nil, failure.EntityNotFound("Job")
+	}
+
+	return &stored, nil
+}
+
+// TxResolveClaimable resolves the oldest Jobs that may be claimed at the specified time within the supplied
+// transaction: queued Jobs and running Jobs whose lease has expired. Pollers take turns through a lock held until
+// the transaction ends.
+func (r *JobMemoryRepo) TxResolveClaimable(tx *database.Tx, at time.Time, limit int) (jobs []model.Job, err error) {
+	r.locks.lock(tx, jobClaimLock)
+
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	for _, job := range r.jobs {
+		if job.IsClaimable(at) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return
+}
+
+// TxClaim writes claimed Jobs within the supplied transaction
+func (r *JobMemoryRepo) TxClaim(tx *database.Tx, jobs []model.Job) (err error) {
+	ids := make([]uuid.UUID, 0)
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	r.locks.lockIDs(tx, ids)
+
+	for _, job := range jobs {
+		r.write(tx, job)
+	}
+	return nil
+}
+
+// TxAcknowledge writes the outcome of a claimed Job within the supplied transaction. It fails if the Job has been
+// claimed again since, so only the latest claim can acknowledge it.
+func (r *JobMemoryRepo) TxAcknowledge(tx *database.Tx, job model.Job) (err error) {
+	r.locks.lock(tx, job.ID)
+
+	r.mux.RLock()
+	stored, ok := r.jobs[job.ID]
+	r.mux.RUnlock()
+	if !ok || stored.Status != model.JobStatusRunning || stored.Attempts != job.Attempts {
+		return failure.OperationNotPermitted("acknowledge", "Job", "the job has been claimed again")
+	}
+
+	r.write(tx, job)
+	return nil
+}
+
+// Acknowledge writes the outcome of a claimed Job. It fails if the Job has been claimed again since, so only the
+// latest claim can acknowledge it.
+func (r *JobMemoryRepo) Acknowledge(job model.Job) (err error) {
+	return (&database.Memory{}).WithTransaction(func(tx *database.Tx, e chan error) {
+		e <- r.TxAcknowledge(tx, job)
+	})
+}
+
+// write stores a locked Job, restoring the previous version if the transaction is rolled back
+func (r *JobMemoryRepo) write(tx *database.Tx, job model.Job) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	previous := r.jobs[job.ID]
+	r.keepCommitted(tx, job.ID, &previous)
+	r.jobs[job.ID] = job
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.jobs[job.ID] = previous
+	})
+}
+
+// keepCommitted keeps the committed image of a Job for reads without a lock until the transaction changing it ends.
+// It must be called with the row locked and the repository mutex held.
+func (r *JobMemoryRepo) keepCommitted(tx *database.Tx, id uuid.UUID, image *model.Job) {
+	if _, changed := r.committed[id]; changed {
+		return
+	}
+
+	r.committed[id] = image
+	tx.OnEnd(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.committed, id)
+	})
+}
+
+// committedImage returns the committed image of a stored Job, or false if the Job has not been committed yet. It
+// must be called with the repository mutex held.
+func (r *JobMemoryRepo) committedImage(job model.Job) (model.Job, bool) {
+	image, changed := r.committed[job.ID]
+	if !changed {
+		return job, true
+	}
+	if image == nil {
+		return model.Job{}, false
+	}
+	return *image, true
+}
+
+// Add adds a Job as it is, as if it had been stored before the repository started
+func (r *JobMemoryRepo) Add(job model.Job) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.jobs[job.ID] = job
+}
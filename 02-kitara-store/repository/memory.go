@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+)
+
+// memoryLocks hands out the row locks of an in-memory repository. Like the locks MySQL takes for SELECT ... FOR UPDATE
+// and UPDATE, a lock is held by the transaction that took it until that transaction ends, and taking it again within
+// the same transaction does not block. In-memory repositories change their data as soon as they are asked to, so
+// every change must be made under a row lock: this keeps other transactions from changing the row again until it is
+// certain whether the first change is committed or undone.
+type memoryLocks struct {
+	mux    sync.Mutex
+	cond   *sync.Cond
+	owners map[interface{}]*database.Tx
+}
+
+func newMemoryLocks() *memoryLocks {
+	locks := &memoryLocks{owners: make(map[interface{}]*database.Tx)}
+	locks.cond = sync.NewCond(&locks.mux)
+	return locks
+}
+
+// lock takes the lock on a row for a transaction, waiting while another transaction holds it
+func (l *memoryLocks) lock(tx *database.Tx, key interface{}) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	for {
+		owner, locked := l.owners[key]
+		if owner == tx {
+			return
+		}
+		if !locked {
+			break
+		}
+		l.cond.Wait()
+	}
+
+	l.owners[key] = tx
+	tx.OnEnd(func() {
+		l.mux.Lock()
+		delete(l.owners, key)
+		l.mux.Unlock()
+		l.cond.Broadcast()
+	})
+}
+
+// lockIDs takes the locks on several rows in ascending ID order, so that concurrent transactions cannot deadlock
+// on each other
+func (l *memoryLocks) lockIDs(tx *database.Tx, ids []uuid.UUID) {
+	sorted := make([]uuid.UUID, len(ids))
+	copy(sorted, ids)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+
+	for _, id := range sorted {
+		l.lock(tx, id)
+	}
+}
+
+// memoryLatency simulates the round trip to a database server. Without it, requests against in-memory repositories
+// hardly ever interleave between reading and writing a row, hiding the races a real database would expose.
+type memoryLatency struct {
+	Latency time.Duration
+}
+
+func (l *memoryLatency) roundTrip() {
+	if l.Latency > 0 {
+		time.Sleep(l.Latency)
+	}
+}
+
+// pageBounds returns the bounds of a page within a list of the specified length
+func pageBounds(length int, pageNum int, pageSize int) (start int, end int) {
+	start = (pageNum - 1) * pageSize
+	if start < 0 {
+		start = 0
+	}
+	if start > length {
+		start = length
+	}
+	end = start + pageSize
+	if end > length {
+		end = length
+	}
+	return
+}
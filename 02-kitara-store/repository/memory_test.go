@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func TestMemoryTransactions(t *testing.T) {
+
+	db := new(database.Memory)
+	orders := new(OrderMemoryRepo)
+	inventories := new(InventoryMemoryRepo)
+	orders.Startup()
+	inventories.Startup()
+
+	order := model.Order{ID: uuid.Must(uuid.NewV4()), Code: "MEMORY-1", Status: model.OrderStatusNew}
+	inventory := model.NewInventory(uuid.Must(uuid.NewV4()), defaultWarehouse.ID)
+	inventory.QtyInStore, inventory.QtyAvailable = 10, 10
+	err := db.WithTransaction(func(tx *database.Tx, e chan error) {
+		if err := orders.TxCreate(tx, order); err != nil {
+			e <- err
+			return
+		}
+		e <- inventories.TxCreate(tx, inventory)
+	})
+	if err != nil {
+		t.Fatalf("failed to seed: %v", err)
+	}
+
+	// reserve changes the order and its inventory in one transaction, checks what other readers see before it ends,
+	// and ends it with the supplied error
+	reserve := func(t *testing.T, result error) error {
+		return db.WithTransaction(func(tx *database.Tx, e chan error) {
+			lockedOrder, err := orders.TxResolveByIDForUpdate(tx, order.ID)
+			if err != nil {
+				e <- err
+				return
+			}
+			locked, err := inventories.TxResolveByProductIDsForUpdate(tx, []uuid.UUID{inventory.ProductID})
+			if err != nil {
+				e <- err
+				return
+			}
+
+			lockedOrder.Status = model.OrderStatusProcessing
+			if err := orders.TxUpdate(tx, *lockedOrder); err != nil {
+				e <- err
+				return
+			}
+			if err := locked[0].Reserve(4); err != nil {
+				e <- err
+				return
+			}
+			if err := inventories.TxUpdate(tx, locked[0]); err != nil {
+				e <- err
+				return
+			}
+
+			if seen, _ := orders.ResolveByID(order.ID); seen.Status != model.OrderStatusNew {
+				t.Errorf("uncommitted order is visible: %s", seen.Status)
+			}
+			if seen, _ := inventories.ResolveByProductIDs([]uuid.UUID{inventory.ProductID}); seen[0].QtyReserved != 0 {
+				t.Errorf("uncommitted inventory is visible: %+v", seen[0])
+			}
+
+			e <- result
+		})
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		if err := reserve(t, errors.New("rolled back")); err == nil {
+			t.Fatalf("transaction was not rolled back")
+		}
+
+		stored, _ := orders.ResolveByID(order.ID)
+		if stored.Status != model.OrderStatusNew || stored.Version != order.Version {
+			t.Errorf("order was not rolled back: %+v", stored)
+		}
+		storedInventories, _ := inventories.ResolveByProductIDs([]uuid.UUID{inventory.ProductID})
+		if storedInventories[0] != inventory {
+			t.Errorf("inventory was not rolled back: %+v", storedInventories[0])
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		if err := reserve(t, nil); err != nil {
+			t.Fatalf("transaction failed: %v", err)
+		}
+
+		stored, _ := orders.ResolveByID(order.ID)
+		if stored.Status != model.OrderStatusProcessing || stored.Version != order.Version+1 {
+			t.Errorf("order was not committed: %+v", stored)
+		}
+		storedInventories, _ := inventories.ResolveByProductIDs([]uuid.UUID{inventory.ProductID})
+		if storedInventories[0].QtyReserved != 4 || storedInventories[0].Version != inventory.Version+1 {
+			t.Errorf("inventory was not committed: %+v", storedInventories[0])
+		}
+	})
+
+	t.Run("staleVersion", func(t *testing.T) {
+		err := db.WithTransaction(func(tx *database.Tx, e chan error) {
+			e <- inventories.TxUpdate(tx, inventory)
+		})
+		if failure.GetCode(err) != failure.CodeVersionConflict {
+			t.Errorf("stale update returned %v", err)
+		}
+	})
+
+	t.Run("locksAreHeldUntilTheTransactionEnds", func(t *testing.T) {
+		locked := make(chan struct{})
+		release := make(chan struct{})
+		first := make(chan error)
+		go func() {
+			first <- db.WithTransaction(func(tx *database.Tx, e chan error) {
+				if _, err := orders.TxResolveByIDForUpdate(tx, order.ID); err != nil {
+					e <- err
+					return
+				}
+				close(locked)
+				<-release
+				e <- nil
+			})
+		}()
+		<-locked
+
+		second := make(chan error)
+		go func() {
+			second <- db.WithTransaction(func(tx *database.Tx, e chan error) {
+				_, err := orders.TxResolveByIDForUpdate(tx, order.ID)
+				e <- err
+			})
+		}()
+
+		select {
+		case <-second:
+			t.Fatalf("second transaction took a lock held by the first one")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		close(release)
+		if err := <-first; err != nil {
+			t.Errorf("first transaction failed: %v", err)
+		}
+		if err := <-second; err != nil {
+			t.Errorf("second transaction failed: %v", err)
+		}
+	})
+
+}
+
+func TestMemoryIdempotencyKeyUpdate(t *testing.T) {
+
+	keys := new(IdempotencyKeyMemoryRepo)
+	keys.Startup()
+
+	claimed := model.NewIdempotencyKey("update-1", "hash", time.Hour)
+	if err := keys.Create(claimed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	completed := claimed
+	completed.Status = model.IdempotencyStatusCompleted
+	completed.ResponseCode = 201
+	completed.ResponseContentType = "application/json"
+	if err := keys.Update(completed); err != nil {
+		t.Fatalf("completing a claimed key failed: %v", err)
+	}
+
+	stored, err := keys.ResolveByKey(claimed.Key)
+	if err != nil || stored.ResponseCode != 201 || stored.ResponseContentType != "application/json" {
+		t.Errorf("wrong completed key: %+v %v", stored, err)
+	}
+
+	if err := keys.Update(completed); failure.GetCode(err) != failure.CodeVersionConflict {
+		t.Errorf("completing a key twice returned wrong error: got %v want %v", err, failure.CodeVersionConflict)
+	}
+
+	if err := keys.Delete(claimed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := keys.Update(completed); failure.GetCode(err) != failure.CodeVersionConflict {
+		t.Errorf("completing a deleted key returned wrong error: got %v want %v", err, failure.CodeVersionConflict)
+	}
+
+}
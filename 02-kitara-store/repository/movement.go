@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryInsertInventoryMovement = `
+		INSERT INTO inventory_movements (
+			entity_id,
+			inventory_entity_id,
+			product_entity_id,
+			warehouse_entity_id,
+			reason,
+			reference_id,
+			note,
+			qty_in_store_delta,
+			qty_reserved_delta,
+			qty_held_delta,
+			created_at
+		) VALUES (
+			:entity_id,
+			:inventory_entity_id,
+			:product_entity_id,
+			:warehouse_entity_id,
+			:reason,
+			:reference_id,
+			:note,
+			:qty_in_store_delta,
+			:qty_reserved_delta,
+			:qty_held_delta,
+			:created_at)`
+
+	querySelectInventoryMovement = `
+		SELECT
+			inventory_movements.sequence,
+			inventory_movements.entity_id,
+			inventory_movements.inventory_entity_id,
+			inventory_movements.product_entity_id,
+			inventory_movements.warehouse_entity_id,
+			inventory_movements.reason,
+			inventory_movements.reference_id,
+			inventory_movements.note,
+			inventory_movements.qty_in_store_delta,
+			inventory_movements.qty_reserved_delta,
+			inventory_movements.qty_held_delta,
+			inventory_movements.created_at
+		FROM inventory_movements`
+
+	querySelectStockLevel = `
+		SELECT
+			inventory_movements.inventory_entity_id,
+			inventory_movements.warehouse_entity_id,
+			SUM(inventory_movements.qty_in_store_delta) AS qty_in_store,
+			SUM(inventory_movements.qty_reserved_delta) AS qty_reserved,
+			SUM(inventory_movements.qty_held_delta) AS qty_held
+		FROM inventory_movements
+		WHERE inventory_movements.product_entity_id = ? AND inventory_movements.created_at <= ?
+		GROUP BY inventory_movements.inventory_entity_id, inventory_movements.warehouse_entity_id
+		ORDER BY inventory_movements.warehouse_entity_id`
+
+	querySelectReservedQty = `
+		SELECT
+			inventory_movements.product_entity_id,
+			SUM(inventory_movements.qty_reserved_delta) AS qty
+		FROM inventory_movements
+		WHERE inventory_movements.reason = ? AND inventory_movements.created_at >= ? AND inventory_movements.product_entity_id IN (?)
+		GROUP BY inventory_movements.product_entity_id`
+)
+
+// InventoryMovement is the Inventory Movement repository interface
+type InventoryMovement interface {
+	Startup()
+	Shutdown()
+	ResolvePage(filter model.InventoryMovementFilter) (page *model.Page, err error)
+	ResolveStockLevels(productID uuid.UUID, asOf time.Time) (levels []model.StockLevel, err error)
+	ResolveReservedQtyByProductIDs(ids []uuid.UUID, since time.Time) (qtyMap map[uuid.UUID]int, err error)
+	TxCreate(tx *database.Tx, movements []model.InventoryMovement) (err error)
+}
+
+// InventoryMovementMySQLRepo is the repository for Inventory Movements implemented with MySQL backend
+type InventoryMovementMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *InventoryMovementMySQLRepo) Startup() {
+	logger.Trace("Inventory Movement Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *InventoryMovementMySQLRepo) Shutdown() {
+	logger.Trace("Inventory Movement Repository shutting down...")
+}
+
+// ResolvePage resolves a Page of Inventory Movements matching a filter, in the order they were recorded
+func (r *InventoryMovementMySQLRepo) ResolvePage(filter model.InventoryMovementFilter) (page *model.Page, err error) {
+	clauses := []string{"inventory_movements.product_entity_id = ?"}
+	params := []interface{}{filter.ProductID}
+	if filter.WarehouseID != uuid.Nil {
+		clauses = append(clauses, "inventory_movements.warehouse_entity_id = ?")
+		params = append(params, filter.WarehouseID)
+	}
+	if filter.From != nil {
+		clauses = append(clauses, "inventory_movements.created_at >= ?")
+		params = append(params, *filter.From)
+	}
+	if filter.To != nil {
+		clauses = append(clauses, "inventory_movements.created_at <= ?")
+		params = append(params, *filter.To)
+	}
+	where := " WHERE " + strings.Join(clauses, " AND ")
+
+	var count int
+	err = r.DB.Get(&count, "SELECT COUNT(inventory_movements.sequence) FROM inventory_movements"+where, params...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	movements := make([]model.InventoryMovement, 0)
+	offset := (filter.Page - 1) * filter.PageSize
+	err = r.DB.Select(
+		&movements,
+		querySelectInventoryMovement+where+" ORDER BY inventory_movements.sequence LIMIT ? OFFSET ?",
+		append(params, filter.PageSize, offset)...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	page = &model.Page{
+		Items:      movements,
+		Page:       filter.Page,
+		PageSize:   filter.PageSize,
+		TotalCount: count,
+	}
+	page.CalculateTotalPages()
+	return page, nil
+}
+
+// ResolveStockLevels rebuilds the stock levels of every Inventory of a Product as of the specified time
+// by adding up the movements recorded until then
+func (r *InventoryMovementMySQLRepo) ResolveStockLevels(productID uuid.UUID, asOf time.Time) (levels []model.StockLevel, err error) {
+	err = r.DB.Select(&levels, querySelectStockLevel, productID, asOf)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// ResolveReservedQtyByProductIDs resolves the total quantity reserved for each of the specified Products since the
+// specified time. Products without any reservation are left out.
+func (r *InventoryMovementMySQLRepo) ResolveReservedQtyByProductIDs(ids []uuid.UUID, since time.Time) (qtyMap map[uuid.UUID]int, err error) {
+	qtyMap = make(map[uuid.UUID]int)
+	if len(ids) == 0 {
+		return
+	}
+
+	query, args, err := r.DB.In(querySelectReservedQty, model.MovementReasonReserve, since, ids)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	rows := make([]struct {
+		ProductID uuid.UUID `db:"product_entity_id"`
+		Qty       int       `db:"qty"`
+	}, 0)
+	err = r.DB.Select(&rows, query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	for _, row := range rows {
+		qtyMap[row.ProductID] = row.Qty
+	}
+
+	return
+}
+
+// TxCreate records Inventory Movements transactionally with the transaction object supplied from elsewhere
+func (r *InventoryMovementMySQLRepo) TxCreate(tx *database.Tx, movements []model.InventoryMovement) (err error) {
+	if len(movements) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareNamed(queryInsertInventoryMovement)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	for _, movement := range movements {
+		_, err = stmt.Exec(movement)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+	}
+
+	return nil
+}
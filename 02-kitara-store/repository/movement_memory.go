@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// InventoryMovementMemoryRepo is the repository for Inventory Movements kept in memory, in the order they were recorded
+type InventoryMovementMemoryRepo struct {
+	mux       sync.RWMutex
+	movements []model.InventoryMovement
+	sequence  int64
+}
+
+// Startup performs startup functions
+func (r *InventoryMovementMemoryRepo) Startup() {
+	logger.Trace("Inventory Movement Repository starting up...")
+	r.movements = make([]model.InventoryMovement, 0)
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *InventoryMovementMemoryRepo) Shutdown() {
+	logger.Trace("Inventory Movement Repository shutting down...")
+}
+
+// ResolvePage resolves a Page of Inventory Movements matching a filter, in the order they were recorded
+func (r *InventoryMovementMemoryRepo) ResolvePage(filter model.InventoryMovementFilter) (page *model.Page, err error) {
+	r.mux.RLock()
+	movements := make([]model.InventoryMovement, 0)
+	for _, movement := range r.movements {
+		if movement.ProductID != filter.ProductID {
+			continue
+		}
+		if filter.WarehouseID != uuid.Nil && movement.WarehouseID != filter.WarehouseID {
+			continue
+		}
+		if filter.From != nil && movement.CreatedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && movement.CreatedAt.After(*filter.To) {
+			continue
+		}
+		movements = append(movements, movement)
+	}
+	r.mux.RUnlock()
+
+	start, end := pageBounds(len(movements), filter.Page, filter.PageSize)
+	page = &model.Page{
+		Items:      movements[start:end],
+		Page:       filter.Page,
+		PageSize:   filter.PageSize,
+		TotalCount: len(movements),
+	}
+	page.CalculateTotalPages()
+	return page, nil
+}
+
+// ResolveStockLevels rebuilds the stock levels of every Inventory of a Product as of the specified time
+// by adding up the movements recorded until then
+func (r *InventoryMovementMemoryRepo) ResolveStockLevels(productID uuid.UUID, asOf time.Time) (levels []model.StockLevel, err error) {
+	r.mux.RLock()
+	levelMap := make(map[uuid.UUID]*model.StockLevel)
+	for _, movement := range r.movements {
+		if movement.ProductID != productID || movement.CreatedAt.After(asOf) {
+			continue
+		}
+
+		level, ok := levelMap[movement.InventoryID]
+		if !ok {
+			level = &model.StockLevel{InventoryID: movement.InventoryID, WarehouseID: movement.WarehouseID}
+			levelMap[movement.InventoryID] = level
+		}
+		level.QtyInStore += movement.QtyInStoreDelta
+		level.QtyReserved += movement.QtyReservedDelta
+		level.QtyHeld += movement.QtyHeldDelta
+	}
+	r.mux.RUnlock()
+
+	for _, level := range levelMap {
+		levels = append(levels, *level)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].WarehouseID.String() < levels[j].WarehouseID.String()
+	})
+	return
+}
+
+// ResolveReservedQtyByProductIDs resolves the total quantity reserved for each of the specified Products since the
+// specified time. Products without any reservation are left out.
+func (r *InventoryMovementMemoryRepo) ResolveReservedQtyByProductIDs(ids []uuid.UUID, since time.Time) (qtyMap map[uuid.UUID]int, err error) {
+	productIDs := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		productIDs[id] = true
+	}
+
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	qtyMap = make(map[uuid.UUID]int)
+	for _, movement := range r.movements {
+		if movement.Reason == model.MovementReasonReserve && !movement.CreatedAt.Before(since) && productIDs[movement.ProductID] {
+			qtyMap[movement.ProductID] += movement.QtyReservedDelta
+		}
+	}
+	return
+}
+
+// TxCreate records Inventory Movements within the supplied transaction
+func (r *InventoryMovementMemoryRepo) TxCreate(tx *database.Tx, movements []model.InventoryMovement) (err error) {
+	if len(movements) == 0 {
+		return nil
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	sequences := make(map[int64]bool)
+	for _, movement := range movements {
+		r.sequence++
+		movement.Sequence = r.sequence
+		sequences[movement.Sequence] = true
+		r.movements = append(r.movements, movement)
+	}
+
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		kept := make([]model.InventoryMovement, 0, len(r.movements))
+		for _, movement := range r.movements {
+			if !sequences[movement.Sequence] {
+				kept = append(kept, movement)
+			}
+		}
+		r.movements = kept
+	})
+
+	return nil
+}
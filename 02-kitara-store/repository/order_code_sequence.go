@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryNextOrderCodeSequence = `
+		INSERT INTO order_code_sequences (
+			name,
+			value
+		) VALUES (?, LAST_INSERT_ID(1))
+		ON DUPLICATE KEY UPDATE value = LAST_INSERT_ID(value + 1)`
+)
+
+// OrderCodeSequence is the repository interface for the named sequences that number Order codes
+type OrderCodeSequence interface {
+	Startup()
+	Shutdown()
+	Next(name string) (value int64, err error)
+}
+
+// OrderCodeSequenceMySQLRepo is the repository for Order code sequences implemented with MySQL backend
+type OrderCodeSequenceMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *OrderCodeSequenceMySQLRepo) Startup() {
+	logger.Trace("Order Code Sequence Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *OrderCodeSequenceMySQLRepo) Shutdown() {
+	logger.Trace("Order Code Sequence Repository shutting down...")
+}
+
+// Next takes the next value of a sequence, starting a new sequence at 1. The value is taken and returned by a single
+// statement outside of any transaction, so every replica gets a value of its own without holding the sequence locked
+// while creating its Order. Values taken for Orders that fail to be created are not given back.
+func (r *OrderCodeSequenceMySQLRepo) Next(name string) (value int64, err error) {
+	result, err := r.DB.Exec(queryNextOrderCodeSequence, name)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	value, err = result.LastInsertId()
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
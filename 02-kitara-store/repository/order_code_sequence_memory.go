@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// OrderCodeSequenceMemoryRepo is the repository for Order code sequences kept in memory
+type OrderCodeSequenceMemoryRepo struct {
+	mux       sync.Mutex
+	sequences map[string]int64
+}
+
+// Startup performs startup functions
+func (r *OrderCodeSequenceMemoryRepo) Startup() {
+	logger.Trace("Order Code Sequence Repository starting up...")
+	r.sequences = make(map[string]int64)
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *OrderCodeSequenceMemoryRepo) Shutdown() {
+	logger.Trace("Order Code Sequence Repository shutting down...")
+}
+
+// Next takes the next value of a sequence, starting a new sequence at 1
+func (r *OrderCodeSequenceMemoryRepo) Next(name string) (value int64, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.sequences[name]++
+	return r.sequences[name], nil
+}
@@ -1,20 +1,96 @@
 package repository
 
 import (
+	"database/sql"
+	"strings"
+	"time"
+
 	"github.com/gofrs/uuid"
-	"github.com/jmoiron/sqlx"
 	"github.com/kerti/evm/02-kitara-store/database"
 	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
 	"github.com/kerti/evm/02-kitara-store/util/logger"
 )
 
 const (
+	queryInsertOrder = `
+		INSERT INTO ` + "`orders`" + ` (
+			entity_id,
+			order_code,
+			customer_ref,
+			total_price,
+			currency,
+			status
+		) VALUES (
+			:entity_id,
+			:order_code,
+			:customer_ref,
+			:total_price.amount,
+			:total_price.currency,
+			:status)`
+
+	queryInsertOrderItem = `
+		INSERT INTO order_items (
+			entity_id,
+			order_entity_id,
+			product_entity_id,
+			qty,
+			price,
+			currency
+		) VALUES (
+			:entity_id,
+			:order_entity_id,
+			:product_entity_id,
+			:qty,
+			:price.amount,
+			:price.currency)`
+
+	queryInsertOrderDiscount = `
+		INSERT INTO order_discounts (
+			entity_id,
+			order_entity_id,
+			promotion_entity_id,
+			code,
+			name,
+			amount,
+			currency
+		) VALUES (
+			:entity_id,
+			:order_entity_id,
+			:promotion_entity_id,
+			:code,
+			:name,
+			:amount.amount,
+			:amount.currency)`
+
+	queryInsertAllocation = `
+		INSERT INTO order_item_allocations (
+			entity_id,
+			order_entity_id,
+			order_item_entity_id,
+			product_entity_id,
+			warehouse_entity_id,
+			inventory_entity_id,
+			qty
+		) VALUES (
+			:entity_id,
+			:order_entity_id,
+			:order_item_entity_id,
+			:product_entity_id,
+			:warehouse_entity_id,
+			:inventory_entity_id,
+			:qty)`
+
 	querySelectOrder = `
 		SELECT
 			orders.entity_id,
 			orders.order_code,
-			orders.total_price,
-			orders.status
+			orders.customer_ref,
+			orders.total_price AS "total_price.amount",
+			orders.currency AS "total_price.currency",
+			orders.status,
+			orders.processed_at,
+			orders.version
 		FROM ` + "`orders`"
 
 	querySelectOrderItem = `
@@ -23,16 +99,42 @@ const (
 			order_items.order_entity_id,
 			order_items.product_entity_id,
 			order_items.qty,
-			order_items.price
+			order_items.price AS "price.amount",
+			order_items.currency AS "price.currency"
 		FROM order_items`
 
+	querySelectOrderDiscount = `
+		SELECT
+			order_discounts.entity_id,
+			order_discounts.order_entity_id,
+			order_discounts.promotion_entity_id,
+			order_discounts.code,
+			order_discounts.name,
+			order_discounts.amount AS "amount.amount",
+			order_discounts.currency AS "amount.currency"
+		FROM order_discounts`
+
+	querySelectAllocation = `
+		SELECT
+			order_item_allocations.entity_id,
+			order_item_allocations.order_entity_id,
+			order_item_allocations.order_item_entity_id,
+			order_item_allocations.product_entity_id,
+			order_item_allocations.warehouse_entity_id,
+			order_item_allocations.inventory_entity_id,
+			order_item_allocations.qty
+		FROM order_item_allocations`
+
 	queryUpdateOrder = `
 		UPDATE orders
 		SET
 			order_code = :order_code,
-			total_price = :total_price,
-			status = :status
-		WHERE entity_id = :entity_id`
+			total_price = :total_price.amount,
+			currency = :total_price.currency,
+			status = :status,
+			processed_at = :processed_at,
+			version = version + 1
+		WHERE entity_id = :entity_id AND version = :version`
 )
 
 // Order is the Order repository interface
@@ -40,12 +142,18 @@ type Order interface {
 	Startup()
 	Shutdown()
 	ResolveByID(id uuid.UUID) (order *model.Order, err error)
-	TxUpdate(tx *sqlx.Tx, order model.Order) (err error)
+	ResolveByCode(code string) (order *model.Order, err error)
+	ResolvePage(filter model.OrderFilter) (page *model.Page, err error)
+	ResolveExpiredIDs(processedBefore time.Time, limit int) (ids []uuid.UUID, err error)
+	TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (order *model.Order, err error)
+	TxCreate(tx *database.Tx, order model.Order) (err error)
+	TxCreateAllocations(tx *database.Tx, allocations []model.Allocation) (err error)
+	TxUpdate(tx *database.Tx, order model.Order) (err error)
 }
 
 // OrderMySQLRepo is the repository for Orders implemented with MySQL backend
 type OrderMySQLRepo struct {
-	DB *database.MySQL `inject:"mysql"`
+	DB *database.MySQL `inject:"db"`
 }
 
 // Startup performs startup functions
@@ -58,13 +166,16 @@ func (r *OrderMySQLRepo) Shutdown() {
 	logger.Trace("Order Repository shutting down...")
 }
 
-// ResolveByID resolves an Order by its ID, including its items
+// ResolveByID resolves an Order by its ID, including its items, discounts and allocations
 func (r *OrderMySQLRepo) ResolveByID(id uuid.UUID) (order *model.Order, err error) {
 	order = &model.Order{}
 	err = r.DB.Get(order, querySelectOrder+" WHERE `orders`.entity_id = ?", id)
 	if err != nil {
 		logger.ErrNoStack("%v", err)
-		return
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Order")
+		}
+		return nil, err
 	}
 
 	query, args, err := r.DB.In(querySelectOrderItem+" WHERE order_items.order_entity_id = ?", order.ID)
@@ -77,16 +188,205 @@ func (r *OrderMySQLRepo) ResolveByID(id uuid.UUID) (order *model.Order, err erro
 	err = r.DB.Select(&orderItems, query, args...)
 	if err != nil {
 		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	discounts := make([]model.OrderDiscount, 0)
+	err = r.DB.Select(&discounts, querySelectOrderDiscount+" WHERE order_discounts.order_entity_id = ?", order.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	allocations := make([]model.Allocation, 0)
+	err = r.DB.Select(&allocations, querySelectAllocation+" WHERE order_item_allocations.order_entity_id = ?", order.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
 	}
 
 	order.AttachItems(orderItems)
+	order.AttachDiscounts(discounts)
+	order.AttachAllocations(allocations)
 
 	return
 }
 
-// TxUpdate performs an update transactionally with the transaction object supplied from elsewhere
-func (r *OrderMySQLRepo) TxUpdate(tx *sqlx.Tx, order model.Order) (err error) {
-	stmt, err := tx.PrepareNamed(queryUpdateOrder)
+// ResolveByCode resolves an Order by its code, including its items, discounts and allocations
+func (r *OrderMySQLRepo) ResolveByCode(code string) (order *model.Order, err error) {
+	var id uuid.UUID
+	err = r.DB.Get(&id, "SELECT `orders`.entity_id FROM `orders` WHERE `orders`.order_code = ?", code)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Order")
+		}
+		return nil, err
+	}
+
+	return r.ResolveByID(id)
+}
+
+// ResolvePage resolves a Page of Orders matching a filter, including their items, discounts and allocations
+func (r *OrderMySQLRepo) ResolvePage(filter model.OrderFilter) (page *model.Page, err error) {
+	clauses := make([]string, 0)
+	params := make([]interface{}, 0)
+	if filter.Status != "" {
+		clauses = append(clauses, "`orders`.status = ?")
+		params = append(params, filter.Status)
+	}
+	if filter.Code != "" {
+		clauses = append(clauses, "`orders`.order_code = ?")
+		params = append(params, filter.Code)
+	}
+	if filter.ProductID != uuid.Nil {
+		clauses = append(clauses, "`orders`.entity_id IN (SELECT order_items.order_entity_id FROM order_items WHERE order_items.product_entity_id = ?)")
+		params = append(params, filter.ProductID)
+	}
+
+	where := ""
+	if len(clauses) > 0 {
+		where = " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	var count int
+	err = r.DB.Get(&count, "SELECT COUNT(`orders`.entity_id) FROM `orders`"+where, params...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0)
+	offset := (filter.Page - 1) * filter.PageSize
+	err = r.DB.Select(
+		&orders,
+		querySelectOrder+where+" ORDER BY "+filter.SortClause()+" LIMIT ? OFFSET ?",
+		append(params, filter.PageSize, offset)...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	if len(orders) > 0 {
+		orderIDs := make([]uuid.UUID, 0)
+		for _, order := range orders {
+			orderIDs = append(orderIDs, order.ID)
+		}
+
+		query, args, err := r.DB.In(querySelectOrderItem+" WHERE order_items.order_entity_id IN (?)", orderIDs)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return nil, err
+		}
+
+		orderItems := make([]model.OrderItem, 0)
+		err = r.DB.Select(&orderItems, query, args...)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return nil, err
+		}
+
+		query, args, err = r.DB.In(querySelectOrderDiscount+" WHERE order_discounts.order_entity_id IN (?)", orderIDs)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return nil, err
+		}
+
+		discounts := make([]model.OrderDiscount, 0)
+		err = r.DB.Select(&discounts, query, args...)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return nil, err
+		}
+
+		query, args, err = r.DB.In(querySelectAllocation+" WHERE order_item_allocations.order_entity_id IN (?)", orderIDs)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return nil, err
+		}
+
+		allocations := make([]model.Allocation, 0)
+		err = r.DB.Select(&allocations, query, args...)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return nil, err
+		}
+
+		for idx := range orders {
+			orders[idx].AttachItems(orderItems)
+			orders[idx].AttachDiscounts(discounts)
+			orders[idx].AttachAllocations(allocations)
+		}
+	}
+
+	page = &model.Page{
+		Items:      orders,
+		Page:       filter.Page,
+		PageSize:   filter.PageSize,
+		TotalCount: count,
+	}
+	page.CalculateTotalPages()
+	return page, nil
+}
+
+// ResolveExpiredIDs resolves the IDs of processing Orders that were processed before the specified time, oldest first
+func (r *OrderMySQLRepo) ResolveExpiredIDs(processedBefore time.Time, limit int) (ids []uuid.UUID, err error) {
+	err = r.DB.Select(
+		&ids,
+		"SELECT `orders`.entity_id FROM `orders` WHERE `orders`.status = ? AND `orders`.processed_at < ? ORDER BY `orders`.processed_at LIMIT ?",
+		model.OrderStatusProcessing,
+		processedBefore,
+		limit)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxResolveByIDForUpdate resolves and locks an Order by its ID within the supplied transaction, including its items,
+// discounts and allocations
+func (r *OrderMySQLRepo) TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (order *model.Order, err error) {
+	order = &model.Order{}
+	err = tx.Get(order, querySelectOrder+" WHERE `orders`.entity_id = ? FOR UPDATE", id)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Order")
+		}
+		return nil, err
+	}
+
+	orderItems := make([]model.OrderItem, 0)
+	err = tx.Select(&orderItems, querySelectOrderItem+" WHERE order_items.order_entity_id = ?", order.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	discounts := make([]model.OrderDiscount, 0)
+	err = tx.Select(&discounts, querySelectOrderDiscount+" WHERE order_discounts.order_entity_id = ?", order.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	allocations := make([]model.Allocation, 0)
+	err = tx.Select(&allocations, querySelectAllocation+" WHERE order_item_allocations.order_entity_id = ?", order.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return nil, err
+	}
+
+	order.AttachItems(orderItems)
+	order.AttachDiscounts(discounts)
+	order.AttachAllocations(allocations)
+
+	return
+}
+
+// TxCreate creates an Order with its items and discounts transactionally with the transaction object supplied from elsewhere
+func (r *OrderMySQLRepo) TxCreate(tx *database.Tx, order model.Order) (err error) {
+	stmt, err := tx.PrepareNamed(queryInsertOrder)
 	if err != nil {
 		logger.ErrNoStack("%v", err)
 		return err
@@ -95,8 +395,90 @@ func (r *OrderMySQLRepo) TxUpdate(tx *sqlx.Tx, order model.Order) (err error) {
 	_, err = stmt.Exec(order)
 	if err != nil {
 		logger.ErrNoStack("%v", err)
+		if isDuplicateEntryError(err) {
+			return failure.DuplicateEntity("Order", "code is already in use")
+		}
 		return err
 	}
 
+	itemStmt, err := tx.PrepareNamed(queryInsertOrderItem)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	for _, item := range order.Items {
+		_, err = itemStmt.Exec(item)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+	}
+
+	if len(order.Discounts) == 0 {
+		return nil
+	}
+
+	discountStmt, err := tx.PrepareNamed(queryInsertOrderDiscount)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	for _, discount := range order.Discounts {
+		_, err = discountStmt.Exec(discount)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TxCreateAllocations creates Allocations transactionally with the transaction object supplied from elsewhere
+func (r *OrderMySQLRepo) TxCreateAllocations(tx *database.Tx, allocations []model.Allocation) (err error) {
+	stmt, err := tx.PrepareNamed(queryInsertAllocation)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	for _, allocation := range allocations {
+		_, err = stmt.Exec(allocation)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TxUpdate performs an update transactionally with the transaction object supplied from elsewhere.
+// The update only succeeds if the stored version still matches the supplied one, otherwise a version conflict is returned.
+func (r *OrderMySQLRepo) TxUpdate(tx *database.Tx, order model.Order) (err error) {
+	stmt, err := tx.PrepareNamed(queryUpdateOrder)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	result, err := stmt.Exec(order)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	if affected == 0 {
+		return failure.VersionConflict("Order")
+	}
+
 	return nil
 }
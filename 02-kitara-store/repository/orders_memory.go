@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// OrderMemoryRepo is the repository for Orders kept in memory, together with their items, discounts and allocations.
+// Reads without a lock only see committed Orders. Setting Latency delays every call by a simulated round trip to
+// the database.
+type OrderMemoryRepo struct {
+	memoryLatency
+	mux       sync.RWMutex
+	orders    map[uuid.UUID]model.Order
+	committed map[uuid.UUID]*model.Order
+	locks     *memoryLocks
+}
+
+// orderCodeLock is the key of the lock on an Order code, kept apart from the locks on Order IDs
+type orderCodeLock string
+
+// orderLessFuncs compares Orders by each of their sortable fields
+var orderLessFuncs = map[string]func(a model.Order, b model.Order) bool{
+	"code": func(a model.Order, b model.Order) bool {
+		return a.Code < b.Code
+	},
+	"totalPrice": func(a model.Order, b model.Order) bool {
+		return a.TotalPrice.Amount < b.TotalPrice.Amount
+	},
+	"status": func(a model.Order, b model.Order) bool {
+		return a.Status < b.Status
+	},
+	"processedAt": func(a model.Order, b model.Order) bool {
+		if a.ProcessedAt == nil || b.ProcessedAt == nil {
+			return a.ProcessedAt == nil && b.ProcessedAt != nil
+		}
+		return a.ProcessedAt.Before(*b.ProcessedAt)
+	},
+}
+
+// Startup performs startup functions
+func (r *OrderMemoryRepo) Startup() {
+	logger.Trace("Order Repository starting up...")
+	r.orders = make(map[uuid.UUID]model.Order)
+	r.committed = make(map[uuid.UUID]*model.Order)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *OrderMemoryRepo) Shutdown() {
+	logger.Trace("Order Repository shutting down...")
+}
+
+// ResolveByID resolves an Order by its ID, including its items, discounts and allocations
+func (r *OrderMemoryRepo) ResolveByID(id uuid.UUID) (order *model.Order, err error) {
+	return r.resolveByID(id, false)
+}
+
+// resolveByID resolves an Order by its ID, either as last committed or including the changes of the transaction
+// that has it locked
+func (r *OrderMemoryRepo) resolveByID(id uuid.UUID, uncommitted bool) (order *model.Order, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	stored, ok := r.orders[id]
+	if ok && !uncommitted {
+		stored, ok = r.committedImage(stored)
+	}
+	if !ok {
+		return nil, failure.EntityNotFound("Order")
+	}
+
+	order = copyOrder(stored)
+	return
+}
+
+// ResolveByCode resolves an Order by its code, including its items, discounts and allocations
+func (r *OrderMemoryRepo) ResolveByCode(code string) (order *model.Order, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	for _, stored := range r.orders {
+		if stored, ok := r.committedImage(stored); ok && stored.Code == code {
+			return copyOrder(stored), nil
+		}
+	}
+
+	return nil, failure.EntityNotFound("Order")
+}
+
+// ResolvePage resolves a Page of Orders matching a filter, including their items, discounts and allocations
+func (r *OrderMemoryRepo) ResolvePage(filter model.OrderFilter) (page *model.Page, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	orders := make([]model.Order, 0)
+	for _, order := range r.orders {
+		order, ok := r.committedImage(order)
+		if !ok {
+			continue
+		}
+		if filter.Status != "" && order.Status != filter.Status {
+			continue
+		}
+		if filter.Code != "" && order.Code != filter.Code {
+			continue
+		}
+		if filter.ProductID != uuid.Nil && !orderHasProduct(order, filter.ProductID) {
+			continue
+		}
+		orders = append(orders, *copyOrder(order))
+	}
+	r.mux.RUnlock()
+
+	less := orderLessFuncs[filter.SortBy]
+	sort.Slice(orders, func(i, j int) bool {
+		a, b := orders[i], orders[j]
+		if filter.SortOrder == "desc" {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.ID.String() < b.ID.String()
+	})
+
+	start, end := pageBounds(len(orders), filter.Page, filter.PageSize)
+	page = &model.Page{
+		Items:      orders[start:end],
+		Page:       filter.Page,
+		PageSize:   filter.PageSize,
+		TotalCount: len(orders),
+	}
+	page.CalculateTotalPages()
+	return page, nil
+}
+
+// ResolveExpiredIDs resolves the IDs of processing Orders that were processed before the specified time, oldest first
+func (r *OrderMemoryRepo) ResolveExpiredIDs(processedBefore time.Time, limit int) (ids []uuid.UUID, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	expired := make([]model.Order, 0)
+	for _, order := range r.orders {
+		order, ok := r.committedImage(order)
+		if ok && order.Status == model.OrderStatusProcessing && order.ProcessedAt != nil && order.ProcessedAt.Before(processedBefore) {
+			expired = append(expired, order)
+		}
+	}
+	r.mux.RUnlock()
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].ProcessedAt.Before(*expired[j].ProcessedAt)
+	})
+
+	for idx, order := range expired {
+		if idx >= limit {
+			break
+		}
+		ids = append(ids, order.ID)
+	}
+	return
+}
+
+// TxResolveByIDForUpdate resolves and locks an Order by its ID within the supplied transaction, including its items,
+// discounts and allocations
+func (r *OrderMemoryRepo) TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (order *model.Order, err error) {
+	r.locks.lock(tx, id)
+	return r.resolveByID(id, true)
+}
+
+// TxCreate creates an Order with its items and discounts within the supplied transaction. Like a unique index,
+// the code stays locked until the transaction ends, so another transaction creating an Order with the same code
+// waits to see whether this one is committed.
+func (r *OrderMemoryRepo) TxCreate(tx *database.Tx, order model.Order) (err error) {
+	r.roundTrip()
+	r.locks.lock(tx, order.ID)
+	r.locks.lock(tx, orderCodeLock(order.Code))
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, exists := r.orders[order.ID]; exists {
+		return failure.DuplicateEntity("Order", "already exists")
+	}
+
+	for _, stored := range r.orders {
+		if stored.Code == order.Code {
+			return failure.DuplicateEntity("Order", "code is already in use")
+		}
+	}
+
+	stored := copyOrder(order)
+	stored.Allocations = nil
+	r.keepCommitted(tx, order.ID, nil)
+	r.orders[order.ID] = *stored
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.orders, order.ID)
+	})
+
+	return nil
+}
+
+// TxCreateAllocations creates Allocations within the supplied transaction
+func (r *OrderMemoryRepo) TxCreateAllocations(tx *database.Tx, allocations []model.Allocation) (err error) {
+	r.roundTrip()
+	for _, allocation := range allocations {
+		r.locks.lock(tx, allocation.OrderID)
+
+		r.mux.Lock()
+		stored, ok := r.orders[allocation.OrderID]
+		if !ok {
+			r.mux.Unlock()
+			return failure.EntityNotFound("Order")
+		}
+
+		r.keepCommitted(tx, stored.ID, &stored)
+		previous := stored.Allocations
+		stored.Allocations = append(append(make([]model.Allocation, 0), previous...), allocation)
+		r.orders[stored.ID] = stored
+		r.mux.Unlock()
+
+		tx.OnRollback(func() {
+			r.mux.Lock()
+			defer r.mux.Unlock()
+			if order, ok := r.orders[allocation.OrderID]; ok {
+				order.Allocations = previous
+				r.orders[order.ID] = order
+			}
+		})
+	}
+
+	return nil
+}
+
+// TxUpdate performs an update within the supplied transaction, leaving the items and allocations as they are.
+// The update only succeeds if the stored version still matches the supplied one, otherwise a version conflict is returned.
+func (r *OrderMemoryRepo) TxUpdate(tx *database.Tx, order model.Order) (err error) {
+	r.roundTrip()
+	r.locks.lock(tx, order.ID)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	stored, ok := r.orders[order.ID]
+	if !ok || stored.Version != order.Version {
+		return failure.VersionConflict("Order")
+	}
+
+	r.keepCommitted(tx, stored.ID, &stored)
+	updated := stored
+	updated.Code = order.Code
+	updated.TotalPrice = order.TotalPrice
+	updated.Status = order.Status
+	updated.ProcessedAt = order.ProcessedAt
+	updated.Version++
+	r.orders[order.ID] = updated
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.orders[stored.ID] = stored
+	})
+
+	return nil
+}
+
+// keepCommitted keeps the committed image of an Order, or nil if it did not exist, for reads without a lock until
+// the transaction changing it ends. It must be called with the row locked and the repository mutex held.
+func (r *OrderMemoryRepo) keepCommitted(tx *database.Tx, id uuid.UUID, image *model.Order) {
+	if _, changed := r.committed[id]; changed {
+		return
+	}
+
+	if image != nil {
+		image = copyOrder(*image)
+	}
+	r.committed[id] = image
+	tx.OnEnd(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.committed, id)
+	})
+}
+
+// committedImage returns the committed image of a stored Order, or false if the Order has not been committed yet.
+// It must be called with the repository mutex held.
+func (r *OrderMemoryRepo) committedImage(order model.Order) (model.Order, bool) {
+	image, changed := r.committed[order.ID]
+	if !changed {
+		return order, true
+	}
+	if image == nil {
+		return model.Order{}, false
+	}
+	return *image, true
+}
+
+// referencesProduct checks whether any Order has an item for a Product
+func (r *OrderMemoryRepo) referencesProduct(productID uuid.UUID) bool {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	for _, order := range r.orders {
+		if orderHasProduct(order, productID) {
+			return true
+		}
+	}
+	return false
+}
+
+func orderHasProduct(order model.Order, productID uuid.UUID) bool {
+	for _, item := range order.Items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// copyOrder copies an Order so that its items and allocations can be changed without touching the stored ones
+func copyOrder(order model.Order) *model.Order {
+	order.Items = append(make([]model.OrderItem, 0), order.Items...)
+	if order.Discounts != nil {
+		order.Discounts = append(make([]model.OrderDiscount, 0), order.Discounts...)
+	}
+	if order.Allocations != nil {
+		order.Allocations = append(make([]model.Allocation, 0), order.Allocations...)
+	}
+	return &order
+}
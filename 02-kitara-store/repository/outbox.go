@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryInsertOutboxEvent = `
+		INSERT INTO outbox (
+			entity_id,
+			aggregate_type,
+			aggregate_id,
+			event_type,
+			payload,
+			created_at
+		) VALUES (
+			:entity_id,
+			:aggregate_type,
+			:aggregate_id,
+			:event_type,
+			:payload,
+			:created_at)`
+
+	querySelectOutboxEvent = `
+		SELECT
+			outbox.sequence,
+			outbox.entity_id,
+			outbox.aggregate_type,
+			outbox.aggregate_id,
+			outbox.event_type,
+			outbox.payload,
+			outbox.created_at,
+			outbox.published_at,
+			outbox.attempts
+		FROM outbox`
+)
+
+// Outbox is the Outbox repository interface
+type Outbox interface {
+	Startup()
+	Shutdown()
+	TxCreate(tx *database.Tx, events []model.OutboxEvent) (err error)
+	TxLockDispatch(tx *database.Tx) (err error)
+	TxResolveUnpublished(tx *database.Tx, limit int) (events []model.OutboxEvent, err error)
+	TxMarkPublished(tx *database.Tx, sequences []int64, publishedAt time.Time) (err error)
+	TxIncrementAttempts(tx *database.Tx, sequences []int64) (err error)
+}
+
+// OutboxMySQLRepo is the repository for Outbox Events implemented with MySQL backend
+type OutboxMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *OutboxMySQLRepo) Startup() {
+	logger.Trace("Outbox Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *OutboxMySQLRepo) Shutdown() {
+	logger.Trace("Outbox Repository shutting down...")
+}
+
+// TxCreate records events transactionally with the transaction object supplied from elsewhere
+func (r *OutboxMySQLRepo) TxCreate(tx *database.Tx, events []model.OutboxEvent) (err error) {
+	if len(events) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareNamed(queryInsertOutboxEvent)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	for _, event := range events {
+		_, err = stmt.Exec(event)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TxLockDispatch takes the dispatch lock within the supplied transaction, waiting while another dispatcher holds it.
+// The lock is released when the transaction ends.
+func (r *OutboxMySQLRepo) TxLockDispatch(tx *database.Tx) (err error) {
+	var name string
+	err = tx.Get(&name, "SELECT outbox_dispatch_lock.name FROM outbox_dispatch_lock WHERE outbox_dispatch_lock.name = 'dispatcher' FOR UPDATE")
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxResolveUnpublished resolves the oldest unpublished events within the supplied transaction, in Sequence order
+func (r *OutboxMySQLRepo) TxResolveUnpublished(tx *database.Tx, limit int) (events []model.OutboxEvent, err error) {
+	err = tx.Select(&events, querySelectOutboxEvent+" WHERE outbox.published_at IS NULL ORDER BY outbox.sequence LIMIT ?", limit)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxMarkPublished marks events as published transactionally with the transaction object supplied from elsewhere
+func (r *OutboxMySQLRepo) TxMarkPublished(tx *database.Tx, sequences []int64, publishedAt time.Time) (err error) {
+	if len(sequences) == 0 {
+		return nil
+	}
+
+	query, args, err := r.DB.In("UPDATE outbox SET published_at = ?, attempts = attempts + 1 WHERE sequence IN (?)", publishedAt, sequences)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxIncrementAttempts records a failed publishing attempt of events transactionally with the transaction object
+// supplied from elsewhere
+func (r *OutboxMySQLRepo) TxIncrementAttempts(tx *database.Tx, sequences []int64) (err error) {
+	if len(sequences) == 0 {
+		return nil
+	}
+
+	query, args, err := r.DB.In("UPDATE outbox SET attempts = attempts + 1 WHERE sequence IN (?)", sequences)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// outboxDispatchLock is the key of the lock dispatchers take before publishing
+const outboxDispatchLock = "dispatcher"
+
+// OutboxMemoryRepo is the repository for outbox events kept in memory, in Sequence order
+type OutboxMemoryRepo struct {
+	mux      sync.RWMutex
+	events   []model.OutboxEvent
+	sequence int64
+	locks    *memoryLocks
+}
+
+// Startup performs startup functions
+func (r *OutboxMemoryRepo) Startup() {
+	logger.Trace("Outbox Repository starting up...")
+	r.events = make([]model.OutboxEvent, 0)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *OutboxMemoryRepo) Shutdown() {
+	logger.Trace("Outbox Repository shutting down...")
+}
+
+// TxCreate records events within the supplied transaction
+func (r *OutboxMemoryRepo) TxCreate(tx *database.Tx, events []model.OutboxEvent) (err error) {
+	if len(events) == 0 {
+		return nil
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	sequences := make(map[int64]bool)
+	for _, event := range events {
+		r.sequence++
+		event.Sequence = r.sequence
+		sequences[event.Sequence] = true
+		r.events = append(r.events, event)
+	}
+
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		kept := make([]model.OutboxEvent, 0, len(r.events))
+		for _, event := range r.events {
+			if !sequences[event.Sequence] {
+				kept = append(kept, event)
+			}
+		}
+		r.events = kept
+	})
+
+	return nil
+}
+
+// TxLockDispatch takes the dispatch lock within the supplied transaction, waiting while another dispatcher holds it.
+// The lock is released when the transaction ends.
+func (r *OutboxMemoryRepo) TxLockDispatch(tx *database.Tx) (err error) {
+	r.locks.lock(tx, outboxDispatchLock)
+	return nil
+}
+
+// TxResolveUnpublished resolves the oldest unpublished events within the supplied transaction, in Sequence order
+func (r *OutboxMemoryRepo) TxResolveUnpublished(tx *database.Tx, limit int) (events []model.OutboxEvent, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	for _, event := range r.events {
+		if len(events) >= limit {
+			break
+		}
+		if event.PublishedAt == nil {
+			events = append(events, event)
+		}
+	}
+	return
+}
+
+// TxMarkPublished marks events as published within the supplied transaction
+func (r *OutboxMemoryRepo) TxMarkPublished(tx *database.Tx, sequences []int64, publishedAt time.Time) (err error) {
+	r.update(tx, sequences, func(event *model.OutboxEvent) {
+		event.PublishedAt = &publishedAt
+		event.Attempts++
+	})
+	return nil
+}
+
+// TxIncrementAttempts records a failed publishing attempt of events within the supplied transaction
+func (r *OutboxMemoryRepo) TxIncrementAttempts(tx *database.Tx, sequences []int64) (err error) {
+	r.update(tx, sequences, func(event *model.OutboxEvent) {
+		event.Attempts++
+	})
+	return nil
+}
+
+// update changes the events with the specified Sequences, restoring them if the transaction is rolled back
+func (r *OutboxMemoryRepo) update(tx *database.Tx, sequences []int64, change func(event *model.OutboxEvent)) {
+	selected := make(map[int64]bool)
+	for _, sequence := range sequences {
+		selected[sequence] = true
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	previous := make(map[int64]model.OutboxEvent)
+	for idx := range r.events {
+		if selected[r.events[idx].Sequence] {
+			previous[r.events[idx].Sequence] = r.events[idx]
+			change(&r.events[idx])
+		}
+	}
+
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		for idx := range r.events {
+			if event, ok := previous[r.events[idx].Sequence]; ok {
+				r.events[idx] = event
+			}
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryInsertPayment = `
+		INSERT INTO payments (
+			entity_id,
+			order_entity_id,
+			amount,
+			currency,
+			status,
+			charge_id,
+			failure_reason,
+			created_at,
+			settled_at,
+			refund_id,
+			refunded_at,
+			version
+		) VALUES (
+			:entity_id,
+			:order_entity_id,
+			:amount.amount,
+			:amount.currency,
+			:status,
+			:charge_id,
+			:failure_reason,
+			:created_at,
+			:settled_at,
+			:refund_id,
+			:refunded_at,
+			:version)`
+
+	querySelectPayment = `
+		SELECT
+			payments.entity_id,
+			payments.order_entity_id,
+			payments.amount AS "amount.amount",
+			payments.currency AS "amount.currency",
+			payments.status,
+			payments.charge_id,
+			payments.failure_reason,
+			payments.created_at,
+			payments.settled_at,
+			payments.refund_id,
+			payments.refunded_at,
+			payments.version
+		FROM payments`
+
+	queryUpdatePayment = `
+		UPDATE payments
+		SET
+			status = :status,
+			charge_id = :charge_id,
+			failure_reason = :failure_reason,
+			settled_at = :settled_at,
+			refund_id = :refund_id,
+			refunded_at = :refunded_at,
+			version = version + 1
+		WHERE entity_id = :entity_id AND version = :version`
+)
+
+// Payment is the Payment repository interface
+type Payment interface {
+	Startup()
+	Shutdown()
+	ResolveByID(id uuid.UUID) (payment *model.Payment, err error)
+	ResolveByOrderID(orderID uuid.UUID) (payments []model.Payment, err error)
+	ResolveUnsettledIDs(createdBefore time.Time, limit int) (ids []uuid.UUID, err error)
+	TxResolveByOrderID(tx *database.Tx, orderID uuid.UUID) (payments []model.Payment, err error)
+	TxCreate(tx *database.Tx, payment model.Payment) (err error)
+	TxUpdate(tx *database.Tx, payment model.Payment) (err error)
+}
+
+// PaymentMySQLRepo is the repository for Payments implemented with MySQL backend
+type PaymentMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *PaymentMySQLRepo) Startup() {
+	logger.Trace("Payment Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *PaymentMySQLRepo) Shutdown() {
+	logger.Trace("Payment Repository shutting down...")
+}
+
+// ResolveByID resolves a Payment by its ID
+func (r *PaymentMySQLRepo) ResolveByID(id uuid.UUID) (payment *model.Payment, err error) {
+	payment = &model.Payment{}
+	err = r.DB.Get(payment, querySelectPayment+" WHERE payments.entity_id = ?", id)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Payment")
+		}
+		return nil, err
+	}
+	return
+}
+
+// ResolveByOrderID resolves the Payments of an Order, oldest first
+func (r *PaymentMySQLRepo) ResolveByOrderID(orderID uuid.UUID) (payments []model.Payment, err error) {
+	payments = make([]model.Payment, 0)
+	err = r.DB.Select(&payments, querySelectPayment+" WHERE payments.order_entity_id = ? ORDER BY payments.created_at", orderID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// ResolveUnsettledIDs resolves the IDs of Payments created before the specified time that are still pending or
+// awaiting their refund, oldest first
+func (r *PaymentMySQLRepo) ResolveUnsettledIDs(createdBefore time.Time, limit int) (ids []uuid.UUID, err error) {
+	query, args, err := r.DB.In(
+		"SELECT payments.entity_id FROM payments WHERE payments.status IN (?) AND payments.created_at < ? ORDER BY payments.created_at LIMIT ?",
+		[]string{model.PaymentStatusPending, model.PaymentStatusRefundPending},
+		createdBefore,
+		limit)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	err = r.DB.Select(&ids, query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxResolveByOrderID resolves the Payments of an Order, oldest first, within the supplied transaction
+func (r *PaymentMySQLRepo) TxResolveByOrderID(tx *database.Tx, orderID uuid.UUID) (payments []model.Payment, err error) {
+	payments = make([]model.Payment, 0)
+	err = tx.Select(&payments, querySelectPayment+" WHERE payments.order_entity_id = ? ORDER BY payments.created_at", orderID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxCreate creates a Payment within the supplied transaction
+func (r *PaymentMySQLRepo) TxCreate(tx *database.Tx, payment model.Payment) (err error) {
+	stmt, err := tx.PrepareNamed(queryInsertPayment)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	_, err = stmt.Exec(payment)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// TxUpdate updates a Payment within the supplied transaction. It fails if the Payment has changed since it was
+// resolved.
+func (r *PaymentMySQLRepo) TxUpdate(tx *database.Tx, payment model.Payment) (err error) {
+	stmt, err := tx.PrepareNamed(queryUpdatePayment)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	result, err := stmt.Exec(payment)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	if affected == 0 {
+		return failure.VersionConflict("Payment")
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// PaymentMemoryRepo is the repository for Payments kept in memory. Reads without a transaction only see committed
+// Payments.
+type PaymentMemoryRepo struct {
+	memoryLatency
+	mux       sync.RWMutex
+	payments  map[uuid.UUID]model.Payment
+	committed map[uuid.UUID]*model.Payment
+	locks     *memoryLocks
+}
+
+// Startup performs startup functions
+func (r *PaymentMemoryRepo) Startup() {
+	logger.Trace("Payment Repository starting up...")
+	r.payments = make(map[uuid.UUID]model.Payment)
+	r.committed = make(map[uuid.UUID]*model.Payment)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *PaymentMemoryRepo) Shutdown() {
+	logger.Trace("Payment Repository shutting down...")
+}
+
+// ResolveByID resolves a Payment by its ID
+func (r *PaymentMemoryRepo) ResolveByID(id uuid.UUID) (payment *model.Payment, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	stored, ok := r.payments[id]
+	if ok {
+		stored, ok = r.committedImage(stored)
+	}
+	if !ok {
+		return nil, failure.EntityNotFound("Payment")
+	}
+
+	return &stored, nil
+}
+
+// ResolveByOrderID resolves the Payments of an Order, oldest first
+func (r *PaymentMemoryRepo) ResolveByOrderID(orderID uuid.UUID) (payments []model.Payment, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	payments = make([]model.Payment, 0)
+	for _, stored := range r.payments {
+		stored, ok := r.committedImage(stored)
+		if ok && stored.OrderID == orderID {
+			payments = append(payments, stored)
+		}
+	}
+
+	sortPayments(payments)
+	return
+}
+
+// ResolveUnsettledIDs resolves the IDs of Payments created before the specified time that are still pending or
+// awaiting their refund, oldest first
+func (r *PaymentMemoryRepo) ResolveUnsettledIDs(createdBefore time.Time, limit int) (ids []uuid.UUID, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	unsettled := make([]model.Payment, 0)
+	for _, stored := range r.payments {
+		stored, ok := r.committedImage(stored)
+		unsettledStatus := stored.Status == model.PaymentStatusPending || stored.Status == model.PaymentStatusRefundPending
+		if ok && unsettledStatus && stored.CreatedAt.Before(createdBefore) {
+			unsettled = append(unsettled, stored)
+		}
+	}
+	r.mux.RUnlock()
+
+	sortPayments(unsettled)
+	for idx, payment := range unsettled {
+		if idx >= limit {
+			break
+		}
+		ids = append(ids, payment.ID)
+	}
+	return
+}
+
+// TxResolveByOrderID resolves the Payments of an Order, oldest first, within the supplied transaction
+func (r *PaymentMemoryRepo) TxResolveByOrderID(tx *database.Tx, orderID uuid.UUID) (payments []model.Payment, err error) {
+	r.roundTrip()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	payments = make([]model.Payment, 0)
+	for _, stored := range r.payments {
+		if stored.OrderID == orderID {
+			payments = append(payments, stored)
+		}
+	}
+
+	sortPayments(payments)
+	return
+}
+
+// TxCreate creates a Payment within the supplied transaction
+func (r *PaymentMemoryRepo) TxCreate(tx *database.Tx, payment model.Payment) (err error) {
+	r.roundTrip()
+	r.locks.lock(tx, payment.ID)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, exists := r.payments[payment.ID]; exists {
+		return failure.DuplicateEntity("Payment", "already exists")
+	}
+
+	r.keepCommitted(tx, payment.ID, nil)
+	r.payments[payment.ID] = payment
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.payments, payment.ID)
+	})
+
+	return nil
+}
+
+// TxUpdate updates a Payment within the supplied transaction. It fails if the Payment has changed since it was
+// resolved.
+func (r *PaymentMemoryRepo) TxUpdate(tx *database.Tx, payment model.Payment) (err error) {
+	r.roundTrip()
+	r.locks.lock(tx, payment.ID)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	stored, ok := r.payments[payment.ID]
+	if !ok || stored.Version != payment.Version {
+		return failure.VersionConflict("Payment")
+	}
+
+	r.keepCommitted(tx, stored.ID, &stored)
+	updated := payment
+	updated.OrderID = stored.OrderID
+	updated.Amount = stored.Amount
+	updated.CreatedAt = stored.CreatedAt
+	updated.Version++
+	r.payments[payment.ID] = updated
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.payments[stored.ID] = stored
+	})
+
+	return nil
+}
+
+// keepCommitted keeps the committed image of a Payment, or nil if it did not exist, for reads without a
+// transaction until the transaction changing it ends. It must be called with the row locked and the repository
+// mutex held.
+func (r *PaymentMemoryRepo) keepCommitted(tx *database.Tx, id uuid.UUID, image *model.Payment) {
+	if _, changed := r.committed[id]; changed {
+		return
+	}
+
+	r.committed[id] = image
+	tx.OnEnd(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		delete(r.committed, id)
+	})
+}
+
+// committedImage returns the committed image of a stored Payment, or false if the Payment has not been committed
+// yet. It must be called with the repository mutex held.
+func (r *PaymentMemoryRepo) committedImage(payment model.Payment) (model.Payment, bool) {
+	image, changed := r.committed[payment.ID]
+	if !changed {
+		return payment, true
+	}
+	if image == nil {
+		return model.Payment{}, false
+	}
+	return *image, true
+}
+
+func sortPayments(payments []model.Payment) {
+	sort.Slice(payments, func(i, j int) bool {
+		if payments[i].CreatedAt.Equal(payments[j].CreatedAt) {
+			return payments[i].ID.String() < payments[j].ID.String()
+		}
+		return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+	})
+}
@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryInsertProduct = `
+		INSERT INTO products (
+			products.entity_id,
+			products.sku,
+			products.name,
+			products.price,
+			products.currency,
+			products.reorder_point,
+			products.purchase_limit
+		) VALUES (
+			:entity_id,
+			:sku,
+			:name,
+			:price.amount,
+			:price.currency,
+			:reorder_point,
+			:purchase_limit)`
+
+	querySelectProduct = `
+		SELECT
+			products.entity_id,
+			products.sku,
+			products.name,
+			products.price AS "price.amount",
+			products.currency AS "price.currency",
+			products.reorder_point,
+			products.purchase_limit
+		FROM products`
+
+	queryUpdateProduct = `
+		UPDATE products
+		SET
+			sku = :sku,
+			name = :name,
+			price = :price.amount,
+			currency = :price.currency,
+			reorder_point = :reorder_point,
+			purchase_limit = :purchase_limit
+		WHERE entity_id = :entity_id`
+
+	queryDeleteProduct = `
+		DELETE FROM products
+		WHERE entity_id = ?`
+
+	queryInsertBundleComponent = `
+		INSERT INTO bundle_components (
+			bundle_entity_id,
+			product_entity_id,
+			qty
+		) VALUES (
+			:bundle_entity_id,
+			:product_entity_id,
+			:qty)`
+
+	querySelectBundleComponent = `
+		SELECT
+			bundle_components.bundle_entity_id,
+			bundle_components.product_entity_id,
+			bundle_components.qty
+		FROM bundle_components`
+)
+
+// Product is the Product repository interface
+type Product interface {
+	Startup()
+	Shutdown()
+	ExistsByID(id uuid.UUID) (exists bool, err error)
+	ExistsBySKU(sku string, excludedID uuid.UUID) (exists bool, err error)
+	IsComponent(id uuid.UUID) (component bool, err error)
+	Create(product model.Product) (err error)
+	ResolveByIDs(ids []uuid.UUID) (products []model.Product, err error)
+	ResolvePage(pageNum int, pageSize int) (page *model.Page, err error)
+	Update(product model.Product) (err error)
+	TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (product *model.Product, err error)
+	TxIsReferenced(tx *database.Tx, id uuid.UUID) (referenced bool, err error)
+	TxDelete(tx *database.Tx, id uuid.UUID) (err error)
+}
+
+// ProductMySQLRepo is the repository for Products implemented with MySQL backend
+type ProductMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *ProductMySQLRepo) Startup() {
+	logger.Trace("Product Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *ProductMySQLRepo) Shutdown() {
+	logger.Trace("Product Repository shutting down...")
+}
+
+// ExistsByID checks whether a Product exists by its ID
+func (r *ProductMySQLRepo) ExistsByID(id uuid.UUID) (exists bool, err error) {
+	err = r.DB.Get(
+		&exists,
+		"SELECT COUNT(entity_id) > 0 FROM products WHERE products.entity_id = ?",
+		id.String())
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// ExistsBySKU checks whether a Product other than the excluded one already uses a SKU
+func (r *ProductMySQLRepo) ExistsBySKU(sku string, excludedID uuid.UUID) (exists bool, err error) {
+	err = r.DB.Get(
+		&exists,
+		"SELECT COUNT(entity_id) > 0 FROM products WHERE products.sku = ? AND products.entity_id <> ?",
+		sku,
+		excludedID.String())
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// IsComponent checks whether a Product is a component of any bundle
+func (r *ProductMySQLRepo) IsComponent(id uuid.UUID) (component bool, err error) {
+	err = r.DB.Get(
+		&component,
+		"SELECT COUNT(bundle_entity_id) > 0 FROM bundle_components WHERE bundle_components.product_entity_id = ?",
+		id.String())
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// Create creates a new Product along with its bundle components
+func (r *ProductMySQLRepo) Create(product model.Product) (err error) {
+	exists, err := r.ExistsByID(product.ID)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	if exists {
+		err = failure.OperationNotPermitted("create", "Product", "already exists")
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	return r.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		stmt, err := tx.PrepareNamed(queryInsertProduct)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			e <- err
+			return
+		}
+
+		_, err = stmt.Exec(product)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			if isDuplicateEntryError(err) {
+				err = failure.DuplicateEntity("Product", "SKU is already in use")
+			}
+			e <- err
+			return
+		}
+
+		e <- r.txInsertComponents(tx, product)
+	})
+}
+
+// ResolveByIDs resolves Products by their IDs, including their bundle components
+func (r *ProductMySQLRepo) ResolveByIDs(ids []uuid.UUID) (products []model.Product, err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	query, args, err := r.DB.In(querySelectProduct+" WHERE products.entity_id IN (?)", ids)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	err = r.DB.Select(&products, query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	err = r.attachComponents(products)
+	return
+}
+
+// ResolvePage resolves a Page of Products based on page and page size parameters, including their bundle components
+func (r *ProductMySQLRepo) ResolvePage(pageNum int, pageSize int) (page *model.Page, err error) {
+	offset := (pageNum - 1) * pageSize
+	query, args, err := r.DB.In(
+		querySelectProduct+" ORDER BY products.sku LIMIT ? OFFSET ?",
+		pageSize,
+		offset,
+	)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	products := make([]model.Product, 0)
+	err = r.DB.Select(&products, query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	err = r.attachComponents(products)
+	if err != nil {
+		return
+	}
+
+	var count int
+	err = r.DB.Get(&count, "SELECT COUNT(entity_id) FROM products")
+	if err != nil {
+		return nil, err
+	}
+
+	page = &model.Page{
+		Items:      products,
+		Page:       pageNum,
+		PageSize:   pageSize,
+		TotalCount: count,
+	}
+	page.CalculateTotalPages()
+	return page, nil
+}
+
+// Update updates an existing Product, replacing its bundle components with those supplied
+func (r *ProductMySQLRepo) Update(product model.Product) (err error) {
+	return r.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		stmt, err := tx.PrepareNamed(queryUpdateProduct)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			e <- err
+			return
+		}
+
+		_, err = stmt.Exec(product)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			if isDuplicateEntryError(err) {
+				err = failure.DuplicateEntity("Product", "SKU is already in use")
+			}
+			e <- err
+			return
+		}
+
+		if _, err = tx.Exec("DELETE FROM bundle_components WHERE bundle_entity_id = ?", product.ID.String()); err != nil {
+			logger.ErrNoStack("%v", err)
+			e <- err
+			return
+		}
+
+		e <- r.txInsertComponents(tx, product)
+	})
+}
+
+// TxResolveByIDForUpdate resolves and locks a Product by its ID within the supplied transaction, without its bundle
+// components
+func (r *ProductMySQLRepo) TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (product *model.Product, err error) {
+	product = &model.Product{}
+	err = tx.Get(product, querySelectProduct+" WHERE products.entity_id = ? FOR UPDATE", id.String())
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if err == sql.ErrNoRows {
+			err = failure.EntityNotFound("Product")
+		}
+		return nil, err
+	}
+	return
+}
+
+// TxIsReferenced checks whether a Product is referenced by any inventory, order item or bundle within the supplied
+// transaction. The references are read with shared locks, so that none can be added until the transaction ends.
+func (r *ProductMySQLRepo) TxIsReferenced(tx *database.Tx, id uuid.UUID) (referenced bool, err error) {
+	for _, query := range []string{
+		"SELECT COUNT(entity_id) > 0 FROM inventory WHERE inventory.product_entity_id = ? LOCK IN SHARE MODE",
+		"SELECT COUNT(entity_id) > 0 FROM order_items WHERE order_items.product_entity_id = ? LOCK IN SHARE MODE",
+		"SELECT COUNT(bundle_entity_id) > 0 FROM bundle_components WHERE bundle_components.product_entity_id = ? LOCK IN SHARE MODE",
+	} {
+		err = tx.Get(&referenced, query, id.String())
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return
+		}
+
+		if referenced {
+			return
+		}
+	}
+	return
+}
+
+// TxDelete deletes a Product by its ID, along with its bundle components, within the supplied transaction
+func (r *ProductMySQLRepo) TxDelete(tx *database.Tx, id uuid.UUID) (err error) {
+	for _, query := range []string{
+		"DELETE FROM bundle_components WHERE bundle_entity_id = ?",
+		queryDeleteProduct,
+	} {
+		if _, err = tx.Exec(query, id.String()); err != nil {
+			logger.ErrNoStack("%v", err)
+			return
+		}
+	}
+	return
+}
+
+// attachComponents resolves the bundle components of Products and attaches them
+func (r *ProductMySQLRepo) attachComponents(products []model.Product) (err error) {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0)
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+
+	query, args, err := r.DB.In(querySelectBundleComponent+" WHERE bundle_components.bundle_entity_id IN (?) ORDER BY bundle_components.product_entity_id", ids)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	components := make([]model.BundleComponent, 0)
+	err = r.DB.Select(&components, query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	for idx := range products {
+		products[idx].AttachComponents(components)
+	}
+	return nil
+}
+
+// txInsertComponents inserts the bundle components of a Product within the supplied transaction
+func (r *ProductMySQLRepo) txInsertComponents(tx *database.Tx, product model.Product) (err error) {
+	if len(product.Components) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareNamed(queryInsertBundleComponent)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	for _, component := range product.Components {
+		_, err = stmt.Exec(component)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return err
+		}
+	}
+
+	return nil
+}
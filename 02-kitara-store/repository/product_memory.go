@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// ProductMemoryRepo is the repository for Products kept in memory
+type ProductMemoryRepo struct {
+	InventoryRepository *InventoryMemoryRepo `inject:"inventoryRepository"`
+	OrderRepository     *OrderMemoryRepo     `inject:"orderRepository"`
+	mux                 sync.RWMutex
+	products            map[uuid.UUID]model.Product
+	locks               *memoryLocks
+}
+
+// Startup performs startup functions
+func (r *ProductMemoryRepo) Startup() {
+	logger.Trace("Product Repository starting up...")
+	r.products = make(map[uuid.UUID]model.Product)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *ProductMemoryRepo) Shutdown() {
+	logger.Trace("Product Repository shutting down...")
+}
+
+// ExistsByID checks whether a Product exists by its ID
+func (r *ProductMemoryRepo) ExistsByID(id uuid.UUID) (exists bool, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	_, exists = r.products[id]
+	return
+}
+
+// ExistsBySKU checks whether a Product other than the excluded one already uses a SKU
+func (r *ProductMemoryRepo) ExistsBySKU(sku string, excludedID uuid.UUID) (exists bool, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.skuInUse(sku, excludedID), nil
+}
+
+// IsComponent checks whether a Product is a component of any bundle
+func (r *ProductMemoryRepo) IsComponent(id uuid.UUID) (component bool, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	for _, product := range r.products {
+		for _, bundleComponent := range product.Components {
+			if bundleComponent.ProductID == id {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Create creates a new Product
+func (r *ProductMemoryRepo) Create(product model.Product) (err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, exists := r.products[product.ID]; exists {
+		return failure.OperationNotPermitted("create", "Product", "already exists")
+	}
+
+	if r.skuInUse(product.SKU, product.ID) {
+		return failure.DuplicateEntity("Product", "SKU is already in use")
+	}
+
+	r.products[product.ID] = copyProduct(product)
+	return nil
+}
+
+// ResolveByIDs resolves Products by their IDs
+func (r *ProductMemoryRepo) ResolveByIDs(ids []uuid.UUID) (products []model.Product, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	for _, id := range ids {
+		if product, ok := r.products[id]; ok {
+			products = append(products, copyProduct(product))
+		}
+	}
+	return
+}
+
+// ResolvePage resolves a Page of Products based on page and page size parameters
+func (r *ProductMemoryRepo) ResolvePage(pageNum int, pageSize int) (page *model.Page, err error) {
+	products := r.resolveAll()
+	start, end := pageBounds(len(products), pageNum, pageSize)
+
+	page = &model.Page{
+		Items:      products[start:end],
+		Page:       pageNum,
+		PageSize:   pageSize,
+		TotalCount: len(products),
+	}
+	page.CalculateTotalPages()
+	return page, nil
+}
+
+// Update updates an existing Product
+func (r *ProductMemoryRepo) Update(product model.Product) (err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, exists := r.products[product.ID]; !exists {
+		return nil
+	}
+
+	if r.skuInUse(product.SKU, product.ID) {
+		return failure.DuplicateEntity("Product", "SKU is already in use")
+	}
+
+	r.products[product.ID] = copyProduct(product)
+	return nil
+}
+
+// TxResolveByIDForUpdate resolves and locks a Product by its ID within the supplied transaction
+func (r *ProductMemoryRepo) TxResolveByIDForUpdate(tx *database.Tx, id uuid.UUID) (product *model.Product, err error) {
+	r.locks.lock(tx, id)
+	products, _ := r.ResolveByIDs([]uuid.UUID{id})
+	if len(products) == 0 {
+		return nil, failure.EntityNotFound("Product")
+	}
+	return &products[0], nil
+}
+
+// TxIsReferenced checks whether a Product is referenced by any inventory, order item or bundle within the supplied
+// transaction. Like the shared locks MySQL takes, the Product's inventory stays locked until the transaction ends, so
+// that none can be created for it in the meantime.
+func (r *ProductMemoryRepo) TxIsReferenced(tx *database.Tx, id uuid.UUID) (referenced bool, err error) {
+	inventories, err := r.InventoryRepository.TxResolveByProductIDsForUpdate(tx, []uuid.UUID{id})
+	if err != nil {
+		return false, err
+	}
+
+	component, _ := r.IsComponent(id)
+	return len(inventories) > 0 || r.OrderRepository.referencesProduct(id) || component, nil
+}
+
+// TxDelete deletes a Product by its ID within the supplied transaction
+func (r *ProductMemoryRepo) TxDelete(tx *database.Tx, id uuid.UUID) (err error) {
+	r.locks.lock(tx, id)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	stored, ok := r.products[id]
+	if !ok {
+		return nil
+	}
+
+	delete(r.products, id)
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.products[id] = stored
+	})
+	return nil
+}
+
+// resolveAll resolves all Products, ordered by SKU
+func (r *ProductMemoryRepo) resolveAll() []model.Product {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	products := make([]model.Product, 0)
+	for _, product := range r.products {
+		products = append(products, copyProduct(product))
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].SKU < products[j].SKU
+	})
+	return products
+}
+
+func (r *ProductMemoryRepo) skuInUse(sku string, excludedID uuid.UUID) bool {
+	for _, product := range r.products {
+		if product.SKU == sku && product.ID != excludedID {
+			return true
+		}
+	}
+	return false
+}
+
+// copyProduct copies a Product along with its bundle components, so that the copy kept in memory is not shared
+func copyProduct(product model.Product) model.Product {
+	if product.Components != nil {
+		product.Components = append([]model.BundleComponent(nil), product.Components...)
+	}
+	return product
+}
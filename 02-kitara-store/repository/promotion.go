@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	queryInsertPromotion = `
+		INSERT INTO promotions (
+			entity_id,
+			code,
+			name,
+			type,
+			percent_off,
+			amount_off,
+			amount_off_currency,
+			buy_qty,
+			get_qty,
+			min_spend,
+			min_spend_currency,
+			target_product_entity_id,
+			target_sku,
+			valid_from,
+			valid_until,
+			usage_cap,
+			usage_count
+		) VALUES (
+			:entity_id,
+			NULLIF(:code, ''),
+			:name,
+			:type,
+			:percent_off,
+			:amount_off.amount,
+			:amount_off.currency,
+			:buy_qty,
+			:get_qty,
+			:min_spend.amount,
+			:min_spend.currency,
+			NULLIF(:target_product_entity_id, '00000000-0000-0000-0000-000000000000'),
+			:target_sku,
+			:valid_from,
+			:valid_until,
+			:usage_cap,
+			:usage_count)`
+
+	querySelectPromotion = `
+		SELECT
+			promotions.entity_id,
+			COALESCE(promotions.code, '') AS code,
+			promotions.name,
+			promotions.type,
+			promotions.percent_off,
+			promotions.amount_off AS "amount_off.amount",
+			promotions.amount_off_currency AS "amount_off.currency",
+			promotions.buy_qty,
+			promotions.get_qty,
+			promotions.min_spend AS "min_spend.amount",
+			promotions.min_spend_currency AS "min_spend.currency",
+			COALESCE(promotions.target_product_entity_id, '00000000-0000-0000-0000-000000000000') AS target_product_entity_id,
+			promotions.target_sku,
+			promotions.valid_from,
+			promotions.valid_until,
+			promotions.usage_cap,
+			promotions.usage_count
+		FROM promotions`
+
+	queryUpdatePromotion = `
+		UPDATE promotions
+		SET
+			code = NULLIF(:code, ''),
+			name = :name,
+			type = :type,
+			percent_off = :percent_off,
+			amount_off = :amount_off.amount,
+			amount_off_currency = :amount_off.currency,
+			buy_qty = :buy_qty,
+			get_qty = :get_qty,
+			min_spend = :min_spend.amount,
+			min_spend_currency = :min_spend.currency,
+			target_product_entity_id = NULLIF(:target_product_entity_id, '00000000-0000-0000-0000-000000000000'),
+			target_sku = :target_sku,
+			valid_from = :valid_from,
+			valid_until = :valid_until,
+			usage_cap = :usage_cap
+		WHERE entity_id = :entity_id`
+
+	queryAddPromotionUsage = `
+		UPDATE promotions
+		SET usage_count = usage_count + ?
+		WHERE entity_id = ? AND usage_count + ? >= 0 AND (usage_cap IS NULL OR usage_count + ? <= usage_cap)`
+)
+
+// Promotion is the Promotion repository interface
+type Promotion interface {
+	Startup()
+	Shutdown()
+	ExistsByCode(code string, excludedID uuid.UUID) (exists bool, err error)
+	Create(promotion model.Promotion) (err error)
+	ResolveByIDs(ids []uuid.UUID) (promotions []model.Promotion, err error)
+	ResolvePage(pageNum int, pageSize int) (page *model.Page, err error)
+	ResolveApplicable(codes []string) (promotions []model.Promotion, err error)
+	Update(promotion model.Promotion) (err error)
+	TxAddUsage(tx *database.Tx, id uuid.UUID, delta int) (err error)
+}
+
+// PromotionMySQLRepo is the repository for Promotions implemented with MySQL backend
+type PromotionMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *PromotionMySQLRepo) Startup() {
+	logger.Trace("Promotion Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *PromotionMySQLRepo) Shutdown() {
+	logger.Trace("Promotion Repository shutting down...")
+}
+
+// ExistsByCode checks whether a Promotion other than the excluded one already uses a voucher code
+func (r *PromotionMySQLRepo) ExistsByCode(code string, excludedID uuid.UUID) (exists bool, err error) {
+	err = r.DB.Get(
+		&exists,
+		"SELECT COUNT(entity_id) > 0 FROM promotions WHERE promotions.code = ? AND promotions.entity_id <> ?",
+		code,
+		excludedID.String())
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
+
+// Create creates a new Promotion
+func (r *PromotionMySQLRepo) Create(promotion model.Promotion) (err error) {
+	stmt, err := r.DB.Prepare(queryInsertPromotion)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(promotion)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if isDuplicateEntryError(err) {
+			return failure.DuplicateEntity("Promotion", "code is already in use")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ResolveByIDs resolves Promotions by their IDs
+func (r *PromotionMySQLRepo) ResolveByIDs(ids []uuid.UUID) (promotions []model.Promotion, err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	query, args, err := r.DB.In(querySelectPromotion+" WHERE promotions.entity_id IN (?)", ids)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	err = r.DB.Select(&promotions, query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+
+	return
+}
+
+// ResolvePage resolves a Page of Promotions based on page and page size parameters, automatic Promotions first
+func (r *PromotionMySQLRepo) ResolvePage(pageNum int, pageSize int) (page *model.Page, err error) {
+	offset := (pageNum - 1) * pageSize
+	promotions := make([]model.Promotion, 0)
+	err = r.DB.Select(
+		&promotions,
+		querySelectPromotion+" ORDER BY promotions.code, promotions.entity_id LIMIT ? OFFSET ?",
+		pageSize,
+		offset)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	var count int
+	err = r.DB.Get(&count, "SELECT COUNT(entity_id) FROM promotions")
+	if err != nil {
+		return nil, err
+	}
+
+	page = &model.Page{
+		Items:      promotions,
+		Page:       pageNum,
+		PageSize:   pageSize,
+		TotalCount: count,
+	}
+	page.CalculateTotalPages()
+	return page, nil
+}
+
+// ResolveApplicable resolves the Promotions that may apply to an Order created with the specified voucher codes:
+// every automatic Promotion and the vouchers with those codes
+func (r *PromotionMySQLRepo) ResolveApplicable(codes []string) (promotions []model.Promotion, err error) {
+	query := querySelectPromotion + " WHERE promotions.code IS NULL"
+	args := make([]interface{}, 0)
+	if len(codes) > 0 {
+		query, args, err = r.DB.In(query+" OR promotions.code IN (?)", codes)
+		if err != nil {
+			logger.ErrNoStack("%v", err)
+			return
+		}
+	}
+
+	err = r.DB.Select(&promotions, query, args...)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+
+	return
+}
+
+// Update updates an existing Promotion, leaving its usage count as it is
+func (r *PromotionMySQLRepo) Update(promotion model.Promotion) (err error) {
+	stmt, err := r.DB.Prepare(queryUpdatePromotion)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(promotion)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		if isDuplicateEntryError(err) {
+			return failure.DuplicateEntity("Promotion", "code is already in use")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// TxAddUsage changes the usage count of a Promotion by delta within the supplied transaction. The check against the
+// usage cap and the change happen in one statement that locks the row until the transaction ends, so concurrent
+// transactions can never take the count past the cap. It fails if the count would go past the cap or below zero.
+func (r *PromotionMySQLRepo) TxAddUsage(tx *database.Tx, id uuid.UUID, delta int) (err error) {
+	result, err := tx.Exec(queryAddPromotionUsage, delta, id, delta, delta)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return err
+	}
+
+	if affected == 0 {
+		return failure.PromotionExhausted("the promotion has been fully redeemed")
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// PromotionMemoryRepo is the repository for Promotions kept in memory.
+// Usage counts are changed under a row lock held until the transaction ends, and reads only see committed usage.
+type PromotionMemoryRepo struct {
+	mux         sync.RWMutex
+	promotions  map[uuid.UUID]model.Promotion
+	uncommitted map[uuid.UUID]int
+	locks       *memoryLocks
+}
+
+// Startup performs startup functions
+func (r *PromotionMemoryRepo) Startup() {
+	logger.Trace("Promotion Repository starting up...")
+	r.promotions = make(map[uuid.UUID]model.Promotion)
+	r.uncommitted = make(map[uuid.UUID]int)
+	r.locks = newMemoryLocks()
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *PromotionMemoryRepo) Shutdown() {
+	logger.Trace("Promotion Repository shutting down...")
+}
+
+// ExistsByCode checks whether a Promotion other than the excluded one already uses a voucher code
+func (r *PromotionMemoryRepo) ExistsByCode(code string, excludedID uuid.UUID) (exists bool, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.codeInUse(code, excludedID), nil
+}
+
+// Create creates a new Promotion
+func (r *PromotionMemoryRepo) Create(promotion model.Promotion) (err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.codeInUse(promotion.Code, promotion.ID) {
+		return failure.DuplicateEntity("Promotion", "code is already in use")
+	}
+
+	r.promotions[promotion.ID] = promotion
+	return nil
+}
+
+// ResolveByIDs resolves Promotions by their IDs
+func (r *PromotionMemoryRepo) ResolveByIDs(ids []uuid.UUID) (promotions []model.Promotion, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	for _, id := range ids {
+		if promotion, ok := r.promotions[id]; ok {
+			promotions = append(promotions, r.committedImage(promotion))
+		}
+	}
+	return
+}
+
+// ResolvePage resolves a Page of Promotions based on page and page size parameters, automatic Promotions first
+func (r *PromotionMemoryRepo) ResolvePage(pageNum int, pageSize int) (page *model.Page, err error) {
+	promotions := r.resolveAll(func(model.Promotion) bool { return true })
+	start, end := pageBounds(len(promotions), pageNum, pageSize)
+
+	page = &model.Page{
+		Items:      promotions[start:end],
+		Page:       pageNum,
+		PageSize:   pageSize,
+		TotalCount: len(promotions),
+	}
+	page.CalculateTotalPages()
+	return page, nil
+}
+
+// ResolveApplicable resolves the Promotions that may apply to an Order created with the specified voucher codes:
+// every automatic Promotion and the vouchers with those codes
+func (r *PromotionMemoryRepo) ResolveApplicable(codes []string) (promotions []model.Promotion, err error) {
+	requested := make(map[string]bool)
+	for _, code := range codes {
+		requested[code] = true
+	}
+
+	return r.resolveAll(func(promotion model.Promotion) bool {
+		return !promotion.IsVoucher() || requested[promotion.Code]
+	}), nil
+}
+
+// Update updates an existing Promotion, leaving its usage count as it is
+func (r *PromotionMemoryRepo) Update(promotion model.Promotion) (err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	stored, exists := r.promotions[promotion.ID]
+	if !exists {
+		return nil
+	}
+
+	if r.codeInUse(promotion.Code, promotion.ID) {
+		return failure.DuplicateEntity("Promotion", "code is already in use")
+	}
+
+	promotion.UsageCount = stored.UsageCount
+	r.promotions[promotion.ID] = promotion
+	return nil
+}
+
+// TxAddUsage changes the usage count of a Promotion by delta within the supplied transaction. The Promotion stays
+// locked until the transaction ends. It fails if the count would go past the usage cap or below zero.
+func (r *PromotionMemoryRepo) TxAddUsage(tx *database.Tx, id uuid.UUID, delta int) (err error) {
+	r.locks.lock(tx, id)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	promotion, ok := r.promotions[id]
+	if !ok {
+		return failure.EntityNotFound("Promotion")
+	}
+
+	count := promotion.UsageCount + delta
+	if count < 0 || (promotion.UsageCap != nil && count > *promotion.UsageCap) {
+		return failure.PromotionExhausted("the promotion has been fully redeemed")
+	}
+
+	promotion.UsageCount = count
+	r.promotions[id] = promotion
+	r.uncommitted[id] += delta
+	tx.OnRollback(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		promotion := r.promotions[id]
+		promotion.UsageCount -= delta
+		r.promotions[id] = promotion
+	})
+	tx.OnEnd(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.uncommitted[id] -= delta
+		if r.uncommitted[id] == 0 {
+			delete(r.uncommitted, id)
+		}
+	})
+
+	return nil
+}
+
+// resolveAll resolves all Promotions matching a predicate, automatic Promotions first and vouchers ordered by code
+func (r *PromotionMemoryRepo) resolveAll(matches func(model.Promotion) bool) []model.Promotion {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	promotions := make([]model.Promotion, 0)
+	for _, promotion := range r.promotions {
+		if matches(promotion) {
+			promotions = append(promotions, r.committedImage(promotion))
+		}
+	}
+	sort.Slice(promotions, func(i, j int) bool {
+		if promotions[i].Code != promotions[j].Code {
+			return promotions[i].Code < promotions[j].Code
+		}
+		return promotions[i].ID.String() < promotions[j].ID.String()
+	})
+	return promotions
+}
+
+// committedImage returns a stored Promotion with the usage its transactions have not committed yet taken out.
+// It must be called with the repository mutex held.
+func (r *PromotionMemoryRepo) committedImage(promotion model.Promotion) model.Promotion {
+	promotion.UsageCount -= r.uncommitted[promotion.ID]
+	return promotion
+}
+
+func (r *PromotionMemoryRepo) codeInUse(code string, excludedID uuid.UUID) bool {
+	if code == "" {
+		return false
+	}
+
+	for _, promotion := range r.promotions {
+		if promotion.Code == code && promotion.ID != excludedID {
+			return true
+		}
+	}
+	return false
+}
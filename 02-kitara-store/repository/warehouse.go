@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	querySelectWarehouse = `
+		SELECT
+			warehouses.entity_id,
+			warehouses.code,
+			warehouses.name,
+			warehouses.priority
+		FROM warehouses`
+)
+
+// Warehouse is the Warehouse repository interface
+type Warehouse interface {
+	Startup()
+	Shutdown()
+	ResolveAll() (warehouses []model.Warehouse, err error)
+}
+
+// WarehouseMySQLRepo is the repository for Warehouses implemented with MySQL backend
+type WarehouseMySQLRepo struct {
+	DB *database.MySQL `inject:"db"`
+}
+
+// Startup performs startup functions
+func (r *WarehouseMySQLRepo) Startup() {
+	logger.Trace("Warehouse Repository starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *WarehouseMySQLRepo) Shutdown() {
+	logger.Trace("Warehouse Repository shutting down...")
+}
+
+// ResolveAll resolves all Warehouses, highest priority first
+func (r *WarehouseMySQLRepo) ResolveAll() (warehouses []model.Warehouse, err error) {
+	err = r.DB.Select(&warehouses, querySelectWarehouse+" ORDER BY warehouses.priority, warehouses.code")
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+	return
+}
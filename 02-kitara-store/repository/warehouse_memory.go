@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// defaultWarehouse is the Warehouse the migrations create for existing inventory
+var defaultWarehouse = model.Warehouse{
+	ID:       uuid.FromStringOrNil("3eb2e602-1f5b-42b7-943a-eb03d46484b6"),
+	Code:     "DEFAULT",
+	Name:     "Default Warehouse",
+	Priority: 0,
+}
+
+// WarehouseMemoryRepo is the repository for Warehouses kept in memory.
+// It starts out with the same default Warehouse the migrations create.
+type WarehouseMemoryRepo struct {
+	mux        sync.RWMutex
+	warehouses []model.Warehouse
+}
+
+// Startup performs startup functions
+func (r *WarehouseMemoryRepo) Startup() {
+	logger.Trace("Warehouse Repository starting up...")
+	r.warehouses = []model.Warehouse{defaultWarehouse}
+}
+
+// Shutdown cleans up everything and shuts down
+func (r *WarehouseMemoryRepo) Shutdown() {
+	logger.Trace("Warehouse Repository shutting down...")
+}
+
+// ResolveAll resolves all Warehouses, highest priority first
+func (r *WarehouseMemoryRepo) ResolveAll() (warehouses []model.Warehouse, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	warehouses = make([]model.Warehouse, len(r.warehouses))
+	copy(warehouses, r.warehouses)
+	sort.Slice(warehouses, func(i, j int) bool {
+		if warehouses[i].Priority != warehouses[j].Priority {
+			return warehouses[i].Priority < warehouses[j].Priority
+		}
+		return warehouses[i].Code < warehouses[j].Code
+	})
+	return
+}
+
+// Add adds Warehouses besides the default one, for setting up tests
+func (r *WarehouseMemoryRepo) Add(warehouses ...model.Warehouse) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.warehouses = append(r.warehouses, warehouses...)
+}
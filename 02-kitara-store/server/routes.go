@@ -21,8 +21,48 @@ func (s *Server) InitRoutes() {
 	// Health
 	s.router.HandleFunc("/health", s.HealthHandler.HandleHealthCheck).Methods("GET")
 
+	// Carts
+	s.router.HandleFunc("/carts", s.CartHandler.HandleCreate).Methods("POST")
+	s.router.HandleFunc("/carts/{id}", s.CartHandler.HandleResolveByID).Methods("GET")
+	s.router.HandleFunc("/carts/{id}/lines", s.CartHandler.HandleAddLine).Methods("POST")
+	s.router.HandleFunc("/carts/{id}/lines/{lineId}", s.CartHandler.HandleRemoveLine).Methods("DELETE")
+	s.router.HandleFunc("/carts/{id}/checkout", s.IdempotencyHandler.Wrap(s.CartHandler.HandleCheckout)).Methods("POST")
+
 	// Orders
-	s.router.HandleFunc("/orders/process", s.OrderHandler.HandleProcessOrder).Methods("POST")
+	s.router.HandleFunc("/orders", s.OrderHandler.HandleCreateOrder).Methods("POST")
+	s.router.HandleFunc("/orders", s.OrderHandler.HandleResolvePage).Methods("GET")
+	s.router.HandleFunc("/orders/by-code/{code}", s.OrderHandler.HandleResolveByCode).Methods("GET")
+	s.router.HandleFunc("/orders/{id}", s.OrderHandler.HandleResolveByID).Methods("GET")
+	s.router.HandleFunc("/orders/process", s.IdempotencyHandler.Wrap(s.OrderHandler.HandleProcessOrder)).Methods("POST")
+	s.router.HandleFunc("/orders/process/batch", s.IdempotencyHandler.Wrap(s.OrderHandler.HandleProcessOrderBatch)).Methods("POST")
+	s.router.HandleFunc("/orders/{id}/complete", s.OrderHandler.HandleCompleteOrder).Methods("POST")
+	s.router.HandleFunc("/orders/{id}/cancel", s.OrderHandler.HandleCancelOrder).Methods("POST")
+	s.router.HandleFunc("/orders/{id}/pay", s.IdempotencyHandler.Wrap(s.PaymentHandler.HandlePay)).Methods("POST")
+
+	// Payments
+	s.router.HandleFunc("/payments/webhook", s.PaymentHandler.HandleWebhook).Methods("POST")
+	s.router.HandleFunc("/payments/{id}", s.PaymentHandler.HandleResolveByID).Methods("GET")
+
+	// Inventory
+	s.router.HandleFunc("/inventory/low-stock", s.InventoryHandler.HandleResolveLowStock).Methods("GET")
+	s.router.HandleFunc("/inventory/{id}/restock", s.InventoryHandler.HandleRestock).Methods("POST")
+	s.router.HandleFunc("/inventory/{id}/adjust", s.InventoryHandler.HandleAdjust).Methods("POST")
+
+	// Products
+	s.router.HandleFunc("/products", s.ProductHandler.HandleCreate).Methods("POST")
+	s.router.HandleFunc("/products", s.ProductHandler.HandleResolvePage).Methods("GET")
+	s.router.HandleFunc("/products/{id}", s.ProductHandler.HandleResolveByID).Methods("GET")
+	s.router.HandleFunc("/products/{id}", s.ProductHandler.HandleUpdate).Methods("PUT")
+	s.router.HandleFunc("/products/{id}", s.ProductHandler.HandleDelete).Methods("DELETE")
+	s.router.HandleFunc("/products/{id}/movements", s.InventoryHandler.HandleResolveMovementPage).Methods("GET")
+	s.router.HandleFunc("/products/{id}/stock", s.InventoryHandler.HandleResolveStock).Methods("GET")
+
+	// Promotions
+	s.router.HandleFunc("/promotions", s.PromotionHandler.HandleCreate).Methods("POST")
+	s.router.HandleFunc("/promotions", s.PromotionHandler.HandleResolvePage).Methods("GET")
+	s.router.HandleFunc("/promotions/{id}", s.PromotionHandler.HandleResolveByID).Methods("GET")
+	s.router.HandleFunc("/promotions/{id}", s.PromotionHandler.HandleUpdate).Methods("PUT")
 
-	http.Handle("/", s.router)
+	// Jobs
+	s.router.HandleFunc("/jobs/{id}", s.JobHandler.HandleResolveByID).Methods("GET")
 }
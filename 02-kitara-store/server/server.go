@@ -17,10 +17,17 @@ var isShuttingDown bool
 
 // Server is the server instance
 type Server struct {
-	config        *config.Config
-	HealthHandler handler.Health `inject:"healthHandler"`
-	OrderHandler  handler.Order  `inject:"orderHandler"`
-	router        *mux.Router
+	config             *config.Config
+	CartHandler        handler.Cart        `inject:"cartHandler"`
+	HealthHandler      handler.Health      `inject:"healthHandler"`
+	IdempotencyHandler handler.Idempotency `inject:"idempotencyHandler"`
+	InventoryHandler   handler.Inventory   `inject:"inventoryHandler"`
+	JobHandler         handler.Job         `inject:"jobHandler"`
+	OrderHandler       handler.Order       `inject:"orderHandler"`
+	PaymentHandler     handler.Payment     `inject:"paymentHandler"`
+	ProductHandler     handler.Product     `inject:"productHandler"`
+	PromotionHandler   handler.Promotion   `inject:"promotionHandler"`
+	router             *mux.Router
 }
 
 // Startup perform startup functions
@@ -49,10 +56,15 @@ func (s *Server) Serve() {
 		logger.Info("- http://%s:%d", ip.String(), s.config.Server.Port)
 	}
 
-	logger.Fatal("%s", http.ListenAndServe(fmt.Sprintf(":%d", s.config.Server.Port), nil))
+	logger.Fatal("%s", http.ListenAndServe(fmt.Sprintf(":%d", s.config.Server.Port), s.router))
 
 }
 
+// Handler returns the HTTP handler serving all routes, for running the server in-process
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		headerList := make([]string, 0)
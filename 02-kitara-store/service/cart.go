@@ -0,0 +1,341 @@
+package service
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Cart is the service provider interface
+type Cart interface {
+	Startup()
+	Shutdown()
+	Create(input model.CartInput) (*model.Cart, error)
+	ResolveByID(id uuid.UUID) (*model.Cart, error)
+	AddLine(id uuid.UUID, input model.CartLineInput) (*model.Cart, error)
+	RemoveLine(id uuid.UUID, lineID uuid.UUID) (*model.Cart, error)
+	Checkout(id uuid.UUID, input model.CartCheckoutInput) (*model.Order, error)
+	ExpireHolds(id uuid.UUID) (released int, err error)
+}
+
+// CartImpl is the service provider implementation.
+// A Cart is always locked before the inventories it holds, and the inventories are always read with row locks,
+// whatever the configured process strategy.
+type CartImpl struct {
+	CartRepository      repository.Cart              `inject:"cartRepository"`
+	InventoryRepository repository.Inventory         `inject:"inventoryRepository"`
+	MovementRepository  repository.InventoryMovement `inject:"inventoryMovementRepository"`
+	ProductRepository   repository.Product           `inject:"productRepository"`
+	WarehouseRepository repository.Warehouse         `inject:"warehouseRepository"`
+	OrderService        Order                        `inject:"orderService"`
+	DB                  database.Transactor          `inject:"db"`
+	config              *config.Config
+}
+
+// Startup performs startup functions
+func (s *CartImpl) Startup() {
+	logger.Trace("Cart service starting up...")
+	s.config = config.Get()
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *CartImpl) Shutdown() {
+	logger.Trace("Cart service shutting down...")
+}
+
+// Create creates a new, empty Cart
+func (s *CartImpl) Create(input model.CartInput) (*model.Cart, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	cart := model.NewCartFromInput(input, time.Now())
+	err := s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("creating cart")
+		e <- s.CartRepository.TxCreate(tx, cart)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cart, nil
+}
+
+// ResolveByID resolves a Cart by its ID, showing the current price and availability of every line
+func (s *CartImpl) ResolveByID(id uuid.UUID) (*model.Cart, error) {
+	cart, err := s.CartRepository.ResolveByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.showAvailability(cart)
+}
+
+// AddLine adds a quantity of a Product to a Cart. When the input asks for a hold, the whole quantity of the Product
+// in the Cart is held for the configured TTL, replacing whatever the Cart held of it before. If the Product lacks
+// available inventory, nothing is added and the failure details describe the shortage. Bundles cannot be held.
+func (s *CartImpl) AddLine(id uuid.UUID, input model.CartLineInput) (*model.Cart, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	products, err := s.ProductRepository.ResolveByIDs([]uuid.UUID{input.ProductID})
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, failure.EntityNotFound("Product")
+	}
+	if input.Hold && products[0].IsBundle() {
+		return nil, failure.OperationNotPermitted("hold", "Product", "a bundle cannot be held, it is reserved from its components at checkout")
+	}
+
+	var warehouses []model.Warehouse
+	if input.Hold {
+		warehouses, err = s.WarehouseRepository.ResolveAll()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.change(id, "add lines to", func(tx *database.Tx, cart *model.Cart, now time.Time) error {
+		line := cart.AddLine(input.ProductID, input.Qty, now)
+		if !input.Hold {
+			return nil
+		}
+
+		return s.txChangeHolds(tx, cart.ID, []uuid.UUID{input.ProductID}, func(inventories []model.Inventory) ([]model.Inventory, error) {
+			released, err := cart.ReleaseHolds(func(hold model.CartHold) bool {
+				return hold.ProductID == input.ProductID
+			}, inventories)
+			if err != nil {
+				return nil, err
+			}
+
+			held, err := cart.HoldStock(line, inventories, warehouses, now.Add(s.config.Cart.HoldTTL))
+			return append(released, held...), err
+		})
+	})
+}
+
+// RemoveLine removes a line from a Cart, releasing whatever the Cart held of its Product
+func (s *CartImpl) RemoveLine(id uuid.UUID, lineID uuid.UUID) (*model.Cart, error) {
+	return s.change(id, "remove lines from", func(tx *database.Tx, cart *model.Cart, now time.Time) error {
+		line, err := cart.RemoveLine(lineID, now)
+		if err != nil {
+			return err
+		}
+
+		return s.txChangeHolds(tx, cart.ID, []uuid.UUID{line.ProductID}, func(inventories []model.Inventory) ([]model.Inventory, error) {
+			return cart.ReleaseHolds(func(hold model.CartHold) bool {
+				return hold.ProductID == line.ProductID
+			}, inventories)
+		})
+	})
+}
+
+// Checkout turns the lines of a Cart into a new order, priced and discounted exactly as if it had been created
+// directly. What the Cart holds becomes reserved for the order in the same transaction, processing it right away.
+// Checkout fails with a version conflict if the Cart changes while the order is being prepared.
+func (s *CartImpl) Checkout(id uuid.UUID, input model.CartCheckoutInput) (*model.Order, error) {
+	cart, err := s.CartRepository.ResolveByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cart.EnsureOpen("check out"); err != nil {
+		return nil, err
+	}
+
+	if len(cart.Lines) == 0 {
+		return nil, failure.OperationNotPermitted("check out", "Cart", "the cart is empty")
+	}
+
+	order, err := s.OrderService.Prepare(cart.OrderInput(input.VoucherCodes))
+	if err != nil {
+		return nil, err
+	}
+
+	var checkedOut *model.Order
+	err = s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("locking cart")
+		locked, err := s.CartRepository.TxResolveByIDForUpdate(tx, id)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		if locked.Version != cart.Version {
+			e <- failure.VersionConflict("Cart")
+			return
+		}
+
+		checkedOut, err = s.OrderService.TxCheckout(tx, *order, locked)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		locked.CheckOut(order.ID, time.Now())
+		logger.Trace("updating cart")
+		e <- s.CartRepository.TxUpdate(tx, *locked)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return checkedOut, nil
+}
+
+// ExpireHolds releases the holds of a Cart that have expired and returns how many were released
+func (s *CartImpl) ExpireHolds(id uuid.UUID) (released int, err error) {
+	err = s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("locking cart")
+		cart, err := s.CartRepository.TxResolveByIDForUpdate(tx, id)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		now := time.Now()
+		expired := cart.HoldsExpiredAt(now)
+		if len(expired) == 0 {
+			e <- nil
+			return
+		}
+
+		productIDs := make([]uuid.UUID, 0)
+		for _, hold := range expired {
+			productIDs = append(productIDs, hold.ProductID)
+		}
+
+		err = s.txChangeHolds(tx, cart.ID, productIDs, func(inventories []model.Inventory) ([]model.Inventory, error) {
+			return cart.ReleaseHolds(func(hold model.CartHold) bool {
+				return !hold.ExpiresAt.After(now)
+			}, inventories)
+		})
+		if err != nil {
+			e <- err
+			return
+		}
+
+		logger.Trace("updating cart")
+		if err := s.CartRepository.TxUpdate(tx, *cart); err != nil {
+			e <- err
+			return
+		}
+
+		released = len(expired)
+		e <- nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return released, nil
+}
+
+// change applies a change to an open Cart within a transaction, with the Cart locked, and returns the changed Cart
+// along with its availability
+func (s *CartImpl) change(id uuid.UUID, operation string, apply func(tx *database.Tx, cart *model.Cart, now time.Time) error) (*model.Cart, error) {
+	var changed *model.Cart
+	err := s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("locking cart")
+		cart, err := s.CartRepository.TxResolveByIDForUpdate(tx, id)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		if err := cart.EnsureOpen(operation); err != nil {
+			e <- err
+			return
+		}
+
+		if err := apply(tx, cart, time.Now()); err != nil {
+			e <- err
+			return
+		}
+
+		logger.Trace("updating cart")
+		if err := s.CartRepository.TxUpdate(tx, *cart); err != nil {
+			e <- err
+			return
+		}
+
+		cart.Version++
+		changed = cart
+		e <- nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.showAvailability(changed)
+}
+
+// txChangeHolds locks the inventories of the specified Products within the supplied transaction, lets hold change
+// them and writes back those it returns, along with a hold or release_hold movement for each of them referencing
+// the Cart
+func (s *CartImpl) txChangeHolds(tx *database.Tx, cartID uuid.UUID, productIDs []uuid.UUID, hold func(inventories []model.Inventory) ([]model.Inventory, error)) error {
+	logger.Trace("locking inventories")
+	inventories, err := s.InventoryRepository.TxResolveByProductIDsForUpdate(tx, productIDs)
+	if err != nil {
+		return err
+	}
+
+	before := append(make([]model.Inventory, 0), inventories...)
+	changed, err := hold(inventories)
+	if err != nil {
+		return err
+	}
+
+	for _, inventory := range inventories {
+		if !containsInventory(changed, inventory.ID) {
+			continue
+		}
+
+		logger.Trace("updating inventory")
+		if err := s.InventoryRepository.TxUpdate(tx, inventory); err != nil {
+			return err
+		}
+	}
+
+	logger.Trace("recording inventory movements")
+	return s.MovementRepository.TxCreate(tx, model.NewHoldMovements(before, changed, cartID))
+}
+
+// showAvailability fills in the current price and availability of every line of a Cart
+func (s *CartImpl) showAvailability(cart *model.Cart) (*model.Cart, error) {
+	productIDs := make([]uuid.UUID, 0)
+	for _, line := range cart.Lines {
+		productIDs = append(productIDs, line.ProductID)
+	}
+
+	if len(productIDs) == 0 {
+		return cart, nil
+	}
+
+	products, err := s.ProductRepository.ResolveByIDs(productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, product := range products {
+		productIDs = append(productIDs, product.ComponentIDs()...)
+	}
+
+	inventories, err := s.InventoryRepository.ResolveByProductIDs(productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	cart.ShowAvailability(products, inventories)
+	return cart, nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const idempotencyPollInterval = 100 * time.Millisecond
+
+// Idempotency is the service provider interface for Idempotency Keys
+type Idempotency interface {
+	Startup()
+	Shutdown()
+	Begin(key string, requestHash string) (*model.IdempotencyKey, error)
+	Complete(key model.IdempotencyKey, responseCode int, contentType string, responseBody []byte) error
+	Abandon(key model.IdempotencyKey) error
+	Cleanup() (deleted int64)
+}
+
+// IdempotencyImpl is the service provider implementation
+type IdempotencyImpl struct {
+	IdempotencyKeyRepository repository.IdempotencyKey `inject:"idempotencyKeyRepository"`
+	config                   *config.Config
+	stop                     chan struct{}
+	done                     sync.WaitGroup
+}
+
+// Startup performs startup functions
+func (s *IdempotencyImpl) Startup() {
+	logger.Trace("Idempotency service starting up...")
+	s.config = config.Get()
+	s.stop = make(chan struct{})
+	s.done.Add(1)
+	go s.run()
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *IdempotencyImpl) Shutdown() {
+	logger.Trace("Idempotency service shutting down...")
+	if s.stop != nil {
+		close(s.stop)
+		s.done.Wait()
+		s.stop = nil
+	}
+}
+
+// Begin claims an Idempotency Key for a request. If the key is new, an in-progress key is returned and the caller
+// must eventually Complete or Abandon it. If the key was already used for the same request and its response is
+// stored, the completed key is returned for replay. While the original request is still in progress, Begin waits
+// for it to complete up to the configured timeout. A key reused for a different request is rejected.
+func (s *IdempotencyImpl) Begin(key string, requestHash string) (*model.IdempotencyKey, error) {
+	deadline := time.Now().Add(s.config.Idempotency.WaitTimeout)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && time.Now().After(deadline) {
+			return nil, failure.OperationNotPermitted("replay", "Idempotency Key", "the original request is still in progress")
+		}
+
+		claimed := model.NewIdempotencyKey(key, requestHash, s.config.Idempotency.TTL)
+		err := s.IdempotencyKeyRepository.Create(claimed)
+		if err == nil {
+			return &claimed, nil
+		}
+
+		if failure.GetCode(err) != failure.CodeDuplicateEntity {
+			return nil, err
+		}
+
+		existing, err := s.IdempotencyKeyRepository.ResolveByKey(key)
+		if failure.GetCode(err) == failure.CodeEntityNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if existing.IsExpired() || existing.IsStale(s.config.Idempotency.LockTimeout) {
+			logger.Debug("discarding expired or abandoned idempotency key %s", key)
+			if err := s.IdempotencyKeyRepository.Delete(*existing); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if existing.RequestHash != requestHash {
+			return nil, failure.BadRequestFromString("Idempotency-Key has already been used for a different request")
+		}
+
+		if existing.Status == model.IdempotencyStatusCompleted {
+			return existing, nil
+		}
+
+		time.Sleep(idempotencyPollInterval)
+	}
+}
+
+// Complete stores the response produced for a claimed Idempotency Key so it can be replayed. It fails with a version
+// conflict if the key is no longer claimed by the request completing it.
+func (s *IdempotencyImpl) Complete(key model.IdempotencyKey, responseCode int, contentType string, responseBody []byte) error {
+	key.Status = model.IdempotencyStatusCompleted
+	key.ResponseCode = responseCode
+	key.ResponseContentType = contentType
+	key.ResponseBody = responseBody
+	return s.IdempotencyKeyRepository.Update(key)
+}
+
+// Abandon releases a claimed Idempotency Key without storing a response, allowing the request to be retried
+func (s *IdempotencyImpl) Abandon(key model.IdempotencyKey) error {
+	return s.IdempotencyKeyRepository.Delete(key)
+}
+
+// Cleanup deletes expired Idempotency Keys and returns how many were deleted
+func (s *IdempotencyImpl) Cleanup() (deleted int64) {
+	deleted, err := s.IdempotencyKeyRepository.DeleteExpired(time.Now())
+	if err != nil {
+		logger.ErrNoStack("failed cleaning up idempotency keys: %v", err)
+		return 0
+	}
+
+	if deleted > 0 {
+		logger.Debug("cleaned up %d expired idempotency keys", deleted)
+	}
+
+	return
+}
+
+func (s *IdempotencyImpl) run() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.config.Idempotency.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Cleanup()
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Inventory is the service provider interface
+type Inventory interface {
+	Startup()
+	Shutdown()
+	ResolveMovementPage(filter model.InventoryMovementFilter) (*model.Page, error)
+	ResolveStockAsOf(productID uuid.UUID, asOf time.Time) (*model.StockSnapshot, error)
+	ResolveLowStock() ([]model.LowStockItem, error)
+	Restock(productID uuid.UUID, input model.InventoryRestockInput) (*model.Inventory, error)
+	Adjust(productID uuid.UUID, input model.InventoryAdjustInput) (*model.Inventory, error)
+}
+
+// InventoryImpl is the service provider implementation
+type InventoryImpl struct {
+	InventoryRepository repository.Inventory         `inject:"inventoryRepository"`
+	MovementRepository  repository.InventoryMovement `inject:"inventoryMovementRepository"`
+	ProductRepository   repository.Product           `inject:"productRepository"`
+	WarehouseRepository repository.Warehouse         `inject:"warehouseRepository"`
+	DB                  database.Transactor          `inject:"db"`
+	config              *config.Config
+}
+
+// Startup performs startup functions
+func (s *InventoryImpl) Startup() {
+	logger.Trace("Inventory service starting up...")
+	s.config = config.Get()
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *InventoryImpl) Shutdown() {
+	logger.Trace("Inventory service shutting down...")
+}
+
+// ResolveMovementPage resolves a Page of a Product's Inventory Movements matching a filter
+func (s *InventoryImpl) ResolveMovementPage(filter model.InventoryMovementFilter) (*model.Page, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateProductExists(filter.ProductID); err != nil {
+		return nil, err
+	}
+
+	return s.MovementRepository.ResolvePage(filter)
+}
+
+// ResolveStockAsOf rebuilds the stock of a Product across all Warehouses as of the specified time
+func (s *InventoryImpl) ResolveStockAsOf(productID uuid.UUID, asOf time.Time) (*model.StockSnapshot, error) {
+	if err := s.validateProductExists(productID); err != nil {
+		return nil, err
+	}
+
+	levels, err := s.MovementRepository.ResolveStockLevels(productID, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := model.NewStockSnapshot(productID, asOf, levels)
+	return &snapshot, nil
+}
+
+// ResolveLowStock resolves every Product whose available quantity is at or below its reorder point, along with
+// a suggested reorder quantity based on how fast it was reserved during the configured velocity window
+func (s *InventoryImpl) ResolveLowStock() ([]model.LowStockItem, error) {
+	items, err := s.InventoryRepository.ResolveLowStock()
+	if err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]uuid.UUID, 0)
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	window := s.config.Inventory.VelocityWindow
+	reservedMap, err := s.MovementRepository.ResolveReservedQtyByProductIDs(productIDs, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range items {
+		items[idx].SuggestReorder(reservedMap[items[idx].ProductID], window, s.config.Inventory.ReorderCoverage)
+	}
+
+	return items, nil
+}
+
+// Restock adds stock of a Product to a Warehouse, creating the Product's Inventory there if it has none yet
+func (s *InventoryImpl) Restock(productID uuid.UUID, input model.InventoryRestockInput) (*model.Inventory, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s.changeStock(productID, input.WarehouseID, true, func(inventory *model.Inventory) (*model.InventoryMovement, error) {
+		before := *inventory
+		if err := inventory.Restock(input.Qty); err != nil {
+			return nil, err
+		}
+
+		movement := model.NewInventoryMovement(before, *inventory, model.MovementReasonRestock, input.ReferenceID.UUID)
+		movement.Note = input.Note
+		return &movement, nil
+	})
+}
+
+// Adjust corrects the in-store stock of a Product in a Warehouse, either by a signed amount or to a counted quantity.
+// An adjustment that leaves the stock unchanged is not recorded.
+func (s *InventoryImpl) Adjust(productID uuid.UUID, input model.InventoryAdjustInput) (*model.Inventory, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s.changeStock(productID, input.WarehouseID, false, func(inventory *model.Inventory) (*model.InventoryMovement, error) {
+		delta := input.DeltaFor(*inventory)
+		if delta == 0 {
+			return nil, nil
+		}
+
+		before := *inventory
+		if err := inventory.Adjust(delta); err != nil {
+			return nil, err
+		}
+
+		movement := model.NewInventoryMovement(before, *inventory, model.MovementReasonAdjust, uuid.Nil)
+		movement.Note = input.Note
+		return &movement, nil
+	})
+}
+
+// stockChange applies a change to an Inventory and returns the movement it produced, or nothing if it changed nothing
+type stockChange func(inventory *model.Inventory) (*model.InventoryMovement, error)
+
+// changeStock locks the Inventory of a Product in a Warehouse, applies a change to it and writes it back along with
+// the movement the change produced. When no Warehouse is specified, the highest priority one is used. A missing
+// Inventory is created when createMissing is set, otherwise it is reported as not found. Bundles have no Inventory of
+// their own, so their stock cannot be changed.
+func (s *InventoryImpl) changeStock(productID uuid.UUID, warehouseID uuid.UUID, createMissing bool, change stockChange) (*model.Inventory, error) {
+	products, err := s.ProductRepository.ResolveByIDs([]uuid.UUID{productID})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(products) == 0 {
+		return nil, failure.EntityNotFound("Product")
+	}
+
+	if products[0].IsBundle() {
+		return nil, failure.OperationNotPermitted("change stock", "Product", "a bundle has no stock of its own, change the stock of its components instead")
+	}
+
+	warehouseID, err = s.resolveWarehouseID(warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory, err := s.changeStockOnce(productID, warehouseID, createMissing, change)
+
+	// Two requests creating the same missing Inventory at once both find nothing to lock, and only one of them gets
+	// to insert it. The other one is retried once, finding and locking the Inventory the first one created.
+	code := failure.GetCode(err)
+	if createMissing && (code == failure.CodeDuplicateEntity || code == failure.CodeVersionConflict) {
+		logger.Debug("inventory of product %s was created concurrently, retrying: %v", productID, err)
+		return s.changeStockOnce(productID, warehouseID, createMissing, change)
+	}
+
+	return inventory, err
+}
+
+// changeStockOnce applies a stock change to the Inventory of a Product in a Warehouse within a single transaction
+func (s *InventoryImpl) changeStockOnce(productID uuid.UUID, warehouseID uuid.UUID, createMissing bool, change stockChange) (*model.Inventory, error) {
+	var changedInventory *model.Inventory
+	err := s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("locking inventory")
+		inventory, err := s.InventoryRepository.TxResolveByProductAndWarehouseForUpdate(tx, productID, warehouseID)
+		isNew := false
+		if failure.GetCode(err) == failure.CodeEntityNotFound && createMissing {
+			created := model.NewInventory(productID, warehouseID)
+			inventory, isNew, err = &created, true, nil
+		}
+		if err != nil {
+			e <- err
+			return
+		}
+
+		movement, err := change(inventory)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		if movement == nil {
+			changedInventory = inventory
+			e <- nil
+			return
+		}
+
+		if isNew {
+			logger.Trace("creating inventory")
+			err = s.InventoryRepository.TxCreate(tx, *inventory)
+		} else {
+			logger.Trace("updating inventory")
+			err = s.InventoryRepository.TxUpdate(tx, *inventory)
+			inventory.Version++
+		}
+		if err != nil {
+			e <- err
+			return
+		}
+
+		logger.Trace("recording inventory movement")
+		if err := s.MovementRepository.TxCreate(tx, []model.InventoryMovement{*movement}); err != nil {
+			e <- err
+			return
+		}
+
+		changedInventory = inventory
+		e <- nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changedInventory, nil
+}
+
+// resolveWarehouseID checks that the specified Warehouse exists, or picks the highest priority one if none is specified
+func (s *InventoryImpl) resolveWarehouseID(warehouseID uuid.UUID) (uuid.UUID, error) {
+	warehouses, err := s.WarehouseRepository.ResolveAll()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	for _, warehouse := range warehouses {
+		if warehouseID == uuid.Nil || warehouse.ID == warehouseID {
+			return warehouse.ID, nil
+		}
+	}
+
+	return uuid.Nil, failure.EntityNotFound("Warehouse")
+}
+
+func (s *InventoryImpl) validateProductExists(productID uuid.UUID) error {
+	exists, err := s.ProductRepository.ExistsByID(productID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return failure.EntityNotFound("Product")
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+// racingInventoryRepo lets another restock create the Inventory the first lock asks for, the way two MySQL
+// transactions both find no row to lock before either of them inserts it
+type racingInventoryRepo struct {
+	*repository.InventoryMemoryRepo
+	db         database.Transactor
+	competing  int
+	raceBefore bool
+}
+
+func (r *racingInventoryRepo) TxResolveByProductAndWarehouseForUpdate(tx *database.Tx, productID uuid.UUID, warehouseID uuid.UUID) (*model.Inventory, error) {
+	if !r.raceBefore {
+		return r.InventoryMemoryRepo.TxResolveByProductAndWarehouseForUpdate(tx, productID, warehouseID)
+	}
+
+	r.raceBefore = false
+	err := r.db.WithTransaction(func(competingTx *database.Tx, e chan error) {
+		inventory := model.NewInventory(productID, warehouseID)
+		inventory.Restock(r.competing)
+		e <- r.InventoryMemoryRepo.TxCreate(competingTx, inventory)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, failure.EntityNotFound("Inventory")
+}
+
+func TestRestockCreatedConcurrently(t *testing.T) {
+
+	db := new(database.Memory)
+	products := new(repository.ProductMemoryRepo)
+	products.Startup()
+	warehouses := new(repository.WarehouseMemoryRepo)
+	warehouses.Startup()
+	movements := new(repository.InventoryMovementMemoryRepo)
+	movements.Startup()
+	inventories := &racingInventoryRepo{InventoryMemoryRepo: new(repository.InventoryMemoryRepo), db: db, competing: 5, raceBefore: true}
+	inventories.Startup()
+
+	product := model.NewProductFromInput(model.ProductInput{SKU: "RACE-1", Name: "Raced Product", Price: model.NewMoney(1000, "IDR")})
+	if err := products.Create(product); err != nil {
+		t.Fatalf("failed to create the product: %v", err)
+	}
+
+	s := &InventoryImpl{
+		InventoryRepository: inventories,
+		MovementRepository:  movements,
+		ProductRepository:   products,
+		WarehouseRepository: warehouses,
+		DB:                  db,
+	}
+
+	inventory, err := s.Restock(product.ID, model.InventoryRestockInput{Qty: 3})
+	if err != nil {
+		t.Fatalf("restock racing another one failed: %v", err)
+	}
+	if inventory.QtyInStore != 8 {
+		t.Errorf("restock was not applied on top of the concurrent one: %+v", inventory)
+	}
+
+	stored, err := inventories.ResolveByProductIDs([]uuid.UUID{product.ID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stored) != 1 || stored[0].QtyInStore != 8 {
+		t.Errorf("wrong inventories after racing restocks: %+v", stored)
+	}
+
+}
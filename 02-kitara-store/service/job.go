@@ -0,0 +1,216 @@
+package service
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Job is the service provider interface for Jobs carried out in the background
+type Job interface {
+	Startup()
+	Shutdown()
+	Enabled() bool
+	EnqueueProcess(input model.OrderProcessInput) (*model.Job, error)
+	ResolveByID(id uuid.UUID) (*model.Job, error)
+	Poll() (claimed int)
+}
+
+// JobImpl is the service provider implementation.
+// When asynchronous order processing is enabled, it periodically claims queued Jobs and hands them to a pool of
+// workers. Each Job goes to the worker picked by its ShardKey, so Jobs for the same Product are carried out one after
+// the other while Jobs for unrelated Products proceed in parallel.
+type JobImpl struct {
+	JobRepository   repository.Job      `inject:"jobRepository"`
+	OrderRepository repository.Order    `inject:"orderRepository"`
+	OrderService    Order               `inject:"orderService"`
+	DB              database.Transactor `inject:"db"`
+	config          *config.Config
+	shards          []chan model.Job
+	pending         int32
+	wake            chan struct{}
+	stop            chan struct{}
+	done            sync.WaitGroup
+	workers         sync.WaitGroup
+}
+
+// Startup performs startup functions
+func (s *JobImpl) Startup() {
+	logger.Trace("Job service starting up...")
+	s.config = config.Get()
+
+	if !s.Enabled() {
+		logger.Info("Asynchronous order processing is disabled.")
+		return
+	}
+
+	s.shards = make([]chan model.Job, s.config.Job.Workers)
+	for idx := range s.shards {
+		s.shards[idx] = make(chan model.Job, s.config.Job.BatchSize)
+		s.workers.Add(1)
+		go s.work(s.shards[idx])
+	}
+
+	s.wake = make(chan struct{}, 1)
+	s.stop = make(chan struct{})
+	s.done.Add(1)
+	go s.run()
+}
+
+// Shutdown cleans up everything and shuts down. Jobs already handed to the workers are carried out first.
+func (s *JobImpl) Shutdown() {
+	logger.Trace("Job service shutting down...")
+	if s.stop != nil {
+		close(s.stop)
+		s.done.Wait()
+		s.stop = nil
+
+		for _, shard := range s.shards {
+			close(shard)
+		}
+		s.workers.Wait()
+		s.shards = nil
+	}
+}
+
+// Enabled checks whether orders are processed asynchronously
+func (s *JobImpl) Enabled() bool {
+	return s.config.Order.ProcessAsync
+}
+
+// EnqueueProcess queues a Job that processes an order and wakes the poller up. The order must exist, but whether it
+// can be processed is only found out once the Job is carried out.
+func (s *JobImpl) EnqueueProcess(input model.OrderProcessInput) (*model.Job, error) {
+	order, err := s.OrderRepository.ResolveByID(input.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	job := model.NewProcessOrderJob(*order)
+	if err := s.JobRepository.Create(job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return &job, nil
+}
+
+// ResolveByID resolves a Job by its ID
+func (s *JobImpl) ResolveByID(id uuid.UUID) (*model.Job, error) {
+	return s.JobRepository.ResolveByID(id)
+}
+
+// Poll claims a single batch of Jobs, oldest first, hands them to the workers and returns how many were claimed. No
+// more Jobs are claimed than the batch size minus the Jobs the workers have not finished yet. Pollers on several
+// replicas take turns through the locks taken while claiming.
+func (s *JobImpl) Poll() (claimed int) {
+	if s.shards == nil {
+		return 0
+	}
+
+	limit := s.config.Job.BatchSize - int(atomic.LoadInt32(&s.pending))
+	if limit <= 0 {
+		return 0
+	}
+
+	var jobs []model.Job
+	err := s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		now := time.Now()
+		claimable, err := s.JobRepository.TxResolveClaimable(tx, now, limit)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		for idx := range claimable {
+			claimable[idx].Claim(now, now.Add(s.config.Job.LeaseTimeout))
+		}
+
+		if err := s.JobRepository.TxClaim(tx, claimable); err != nil {
+			e <- err
+			return
+		}
+
+		jobs = claimable
+		e <- nil
+	})
+	if err != nil {
+		logger.ErrNoStack("failed claiming jobs: %v", err)
+		return 0
+	}
+
+	atomic.AddInt32(&s.pending, int32(len(jobs)))
+	for _, job := range jobs {
+		s.shards[s.shardOf(job)] <- job
+	}
+
+	return len(jobs)
+}
+
+// shardOf picks the worker that carries out a Job
+func (s *JobImpl) shardOf(job model.Job) int {
+	hash := fnv.New32a()
+	hash.Write(job.ShardKey.Bytes())
+	return int(hash.Sum32() % uint32(len(s.shards)))
+}
+
+func (s *JobImpl) run() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.config.Job.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		s.Poll()
+	}
+}
+
+func (s *JobImpl) work(jobs chan model.Job) {
+	defer s.workers.Done()
+	for job := range jobs {
+		s.carryOut(job)
+		atomic.AddInt32(&s.pending, -1)
+	}
+}
+
+// carryOut carries out a claimed Job. A Job that succeeds is acknowledged along with the processed order. A Job
+// that fails on an internal error or a version conflict is given back to the queue until it runs out of attempts;
+// any other failure is final.
+func (s *JobImpl) carryOut(job model.Job) {
+	_, err := s.OrderService.ProcessJob(job)
+	if err == nil {
+		return
+	}
+
+	code := failure.GetCode(err)
+	if (code == failure.CodeInternalError || code == failure.CodeVersionConflict) &&
+		job.Attempts < s.config.Job.MaxAttempts {
+		logger.ErrNoStack("job %s failed on attempt %d, queueing it again: %v", job.ID, job.Attempts, err)
+		job.Release()
+	} else if err := job.Fail(err, time.Now()); err != nil {
+		logger.ErrNoStack("failed recording the failure of job %s: %v", job.ID, err)
+		return
+	}
+
+	if err := s.JobRepository.Acknowledge(job); err != nil {
+		logger.ErrNoStack("failed acknowledging job %s: %v", job.ID, err)
+	}
+}
@@ -1,13 +1,19 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/gofrs/uuid"
-	"github.com/jmoiron/sqlx"
+	"github.com/kerti/evm/02-kitara-store/config"
 	"github.com/kerti/evm/02-kitara-store/database"
 	"github.com/kerti/evm/02-kitara-store/model"
 	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
 	"github.com/kerti/evm/02-kitara-store/util/logger"
 )
 
@@ -15,20 +21,61 @@ import (
 type Order interface {
 	Startup()
 	Shutdown()
+	ResolveByID(id uuid.UUID) (*model.Order, error)
+	ResolveByCode(code string) (*model.Order, error)
+	ResolvePage(filter model.OrderFilter) (*model.Page, error)
+	Prepare(input model.OrderInput) (*model.Order, error)
+	Create(input model.OrderInput) (*model.Order, error)
+	TxCheckout(tx *database.Tx, order model.Order, cart *model.Cart) (*model.Order, error)
 	Process(input model.OrderProcessInput) (*model.Order, error)
+	ProcessJob(job model.Job) (*model.Order, error)
+	ProcessBatch(input model.OrderBatchProcessInput) (*model.OrderBatchResponse, error)
+	Complete(id uuid.UUID) (*model.Order, error)
+	Cancel(id uuid.UUID) (*model.Order, error)
+	Expire(id uuid.UUID) (*model.Order, error)
+	SettlePayment(payment model.Payment) (*model.Order, error)
 }
 
 // OrderImpl is the service provider implementation
 type OrderImpl struct {
-	InventoryRepository repository.Inventory `inject:"inventoryRepository"`
-	OrderRepository     repository.Order     `inject:"orderRepository"`
-	DB                  *database.MySQL      `inject:"mysql"`
-	mux                 sync.Mutex
+	CustomerPurchaseRepository  repository.CustomerPurchase  `inject:"customerPurchaseRepository"`
+	InventoryRepository         repository.Inventory         `inject:"inventoryRepository"`
+	JobRepository               repository.Job               `inject:"jobRepository"`
+	MovementRepository          repository.InventoryMovement `inject:"inventoryMovementRepository"`
+	OrderRepository             repository.Order             `inject:"orderRepository"`
+	OrderCodeSequenceRepository repository.OrderCodeSequence `inject:"orderCodeSequenceRepository"`
+	OutboxRepository            repository.Outbox            `inject:"outboxRepository"`
+	PaymentRepository           repository.Payment           `inject:"paymentRepository"`
+	ProductRepository           repository.Product           `inject:"productRepository"`
+	PromotionRepository         repository.Promotion         `inject:"promotionRepository"`
+	WarehouseRepository         repository.Warehouse         `inject:"warehouseRepository"`
+	StockGate                   StockGate                    `inject:"stockGate"`
+	DB                          database.Transactor          `inject:"db"`
+	config                      *config.Config
+	codeFormat                  model.OrderCodeFormat
+	mux                         sync.Mutex
+}
+
+// allocationStrategies maps the configurable allocation strategies to their implementations
+var allocationStrategies = map[string]model.AllocationStrategy{
+	config.AllocationStrategySingle:   model.AllocateFromSingleWarehouse,
+	config.AllocationStrategyPriority: model.AllocateByPriority,
+	config.AllocationStrategySplit:    model.AllocateSplit,
 }
 
 // Startup performs startup functions
 func (s *OrderImpl) Startup() {
 	logger.Trace("Order service starting up...")
+	s.config = config.Get()
+
+	var err error
+	s.codeFormat, err = model.NewOrderCodeFormat(
+		s.config.Order.CodePrefix,
+		s.config.Order.CodeSequenceWidth,
+		s.config.Order.CodeUnambiguous)
+	if err != nil {
+		logger.Fatal("Invalid order code format: %v", err)
+	}
 }
 
 // Shutdown cleans up everything and shuts down
@@ -36,60 +83,882 @@ func (s *OrderImpl) Shutdown() {
 	logger.Trace("Order service shutting down...")
 }
 
-// Process processes an order
+// ResolveByID resolves an order by its ID, including its items
+func (s *OrderImpl) ResolveByID(id uuid.UUID) (*model.Order, error) {
+	return s.OrderRepository.ResolveByID(id)
+}
+
+// ResolveByCode resolves an order by its code, including its items. The code is cleaned up the way a customer might
+// have misread it, and a generated code whose check character does not match is rejected without looking it up.
+func (s *OrderImpl) ResolveByCode(code string) (*model.Order, error) {
+	code = s.codeFormat.Normalize(code)
+	if err := s.codeFormat.Verify(code); err != nil {
+		return nil, err
+	}
+
+	return s.OrderRepository.ResolveByCode(code)
+}
+
+// ResolvePage resolves a Page of orders matching a filter, including their items
+func (s *OrderImpl) ResolvePage(filter model.OrderFilter) (*model.Page, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s.OrderRepository.ResolvePage(filter)
+}
+
+// Prepare prepares a new order without storing it, pricing its items from the current Product catalog and applying
+// every automatic promotion that applies along with the vouchers in the input. The order gets a code numbered from
+// the sequence of the day it is prepared.
+func (s *OrderImpl) Prepare(input model.OrderInput) (*model.Order, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	products, err := s.ProductRepository.ResolveByIDs(input.ProductIDs())
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := model.NewOrderFromInput(input, products)
+	if err != nil {
+		return nil, err
+	}
+	order.AttachBundles(products)
+
+	voucherCodes := make([]string, 0)
+	for _, code := range input.VoucherCodes {
+		voucherCodes = append(voucherCodes, model.NormalizeVoucherCode(code))
+	}
+
+	promotions, err := s.PromotionRepository.ResolveApplicable(voucherCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := order.ApplyPromotions(promotions, voucherCodes, products, now); err != nil {
+		return nil, err
+	}
+
+	sequence, err := s.OrderCodeSequenceRepository.Next(s.codeFormat.SequenceName(now))
+	if err != nil {
+		return nil, err
+	}
+	order.Code = s.codeFormat.Format(now, sequence)
+
+	return &order, nil
+}
+
+// Create creates a new order as prepared by Prepare. The discounts are stored with the order, while the usage of the
+// promotions is only counted once the order is processed.
+func (s *OrderImpl) Create(input model.OrderInput) (*model.Order, error) {
+	order, err := s.Prepare(input)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("creating order")
+		if err := s.OrderRepository.TxCreate(tx, *order); err != nil {
+			e <- err
+			return
+		}
+
+		e <- nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// TxCheckout creates a prepared order for the lines of a Cart within the supplied transaction. If the Cart holds
+// inventory, its holds are released and the order is processed right away, so the held quantities become reserved
+// for the order without ever being available to others in between. Every released hold is recorded as a
+// release_hold movement before the reservations. Processing fails as Process would, including when
+// lines that hold nothing lack inventory. A Cart holding nothing leaves the order new. The inventories are always
+// read with row locks, whatever the configured process strategy. An order that is processed takes its quantities off
+// the stock gate first, if it is enabled, and gives them back if the transaction is rolled back.
+func (s *OrderImpl) TxCheckout(tx *database.Tx, order model.Order, cart *model.Cart) (*model.Order, error) {
+	logger.Trace("creating order")
+	if err := s.OrderRepository.TxCreate(tx, order); err != nil {
+		return nil, err
+	}
+
+	if len(cart.Holds) == 0 {
+		return &order, nil
+	}
+
+	if s.StockGate.Enabled() {
+		stock := order.StockOrder()
+		release, err := s.StockGate.Acquire(stock.QtyByProduct())
+		if err != nil {
+			return nil, err
+		}
+		tx.OnRollback(release)
+	}
+
+	warehouses, err := s.WarehouseRepository.ResolveAll()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Trace("locking inventories")
+	productIDs := append(order.StockProductIDs(), cart.HeldProductIDs()...)
+	inventories, err := s.InventoryRepository.TxResolveByProductIDsForUpdate(tx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	held := append(make([]model.Inventory, 0), inventories...)
+	released, err := cart.ReleaseHolds(func(model.CartHold) bool { return true }, inventories)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.processTransition(warehouses)(&order, inventories)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inventory := range released {
+		if !containsInventory(result.inventories, inventory.ID) {
+			result.inventories = append(result.inventories, inventory)
+		}
+	}
+	result.movements = append(model.NewHoldMovements(held, released, cart.ID), result.movements...)
+
+	if err := s.txWriteTransition(tx, &order, 0, result); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// transitionResult holds what a transition changed besides the order itself: the inventories that need to be
+// written back, the movements explaining their new quantities, the events describing the change, whether the
+// order starts (1) or stops (-1) counting towards the usage of its promotions and the purchases of its customer,
+// and what else must be written along with the order, if anything
+type transitionResult struct {
+	inventories []model.Inventory
+	movements   []model.InventoryMovement
+	events      []model.OutboxEvent
+	counted     int
+	acknowledge func(tx *database.Tx, order model.Order) error
+}
+
+// orderTransition moves an Order to another status and applies the matching changes to the inventories
+// of its items
+type orderTransition func(order *model.Order, inventories []model.Inventory) (transitionResult, error)
+
+// Process processes an order. When any of its products is in flash-sale mode, the order must first get past the
+// in-memory stock gate, which turns requests for sold out products away before they reach the database.
 func (s *OrderImpl) Process(input model.OrderProcessInput) (*model.Order, error) {
-	s.mux.Lock()
-	defer s.mux.Unlock()
+	return s.processGated(input.OrderID, nil)
+}
+
+// ProcessJob processes the order of a claimed Job exactly as Process would. The Job is acknowledged as succeeded, with
+// the processed order as its result, in the same transaction that processes the order, so the order is never
+// processed without the Job being acknowledged or the other way around. If the Job has been claimed again in the
+// meantime, processing fails and nothing is written.
+func (s *OrderImpl) ProcessJob(job model.Job) (*model.Order, error) {
+	return s.processGated(job.OrderID, func(tx *database.Tx, order model.Order) error {
+		if err := job.Succeed(order, time.Now()); err != nil {
+			return err
+		}
+
+		logger.Trace("acknowledging job")
+		return s.JobRepository.TxAcknowledge(tx, job)
+	})
+}
+
+// processGated processes an order after getting it past the stock gate, if it is enabled
+func (s *OrderImpl) processGated(orderID uuid.UUID, acknowledge func(tx *database.Tx, order model.Order) error) (*model.Order, error) {
+	if !s.StockGate.Enabled() {
+		return s.process(orderID, acknowledge)
+	}
 
-	order, err := s.OrderRepository.ResolveByID(input.OrderID)
+	order, err := s.OrderRepository.ResolveByID(orderID)
 	if err != nil {
 		return nil, err
 	}
 
-	productIDs := make([]uuid.UUID, 0)
-	qtyMap := make(map[uuid.UUID]int)
-	for _, orderItem := range order.Items {
-		productIDs = append(productIDs, orderItem.ProductID)
-		qtyMap[orderItem.ProductID] = orderItem.Qty
+	if err := s.attachBundles(order); err != nil {
+		return nil, err
 	}
 
-	inventories, err := s.InventoryRepository.ResolveByProductIDs(productIDs)
+	stock := order.StockOrder()
+	release, err := s.StockGate.Acquire(stock.QtyByProduct())
 	if err != nil {
 		return nil, err
 	}
 
-	processedInventories := make([]model.Inventory, 0)
-	for _, inventory := range inventories {
-		err := inventory.Reserve(qtyMap[inventory.ProductID])
+	processed, err := s.process(orderID, acknowledge)
+	if err != nil {
+		release()
+	}
+
+	return processed, err
+}
+
+// process processes an order, allocating its items to warehouses with the configured allocation strategy and
+// reserving the allocated inventory. Quantities of several items for the same product are added up. If any product
+// lacks inventory across all warehouses, nothing is reserved and the failure details list every affected item along
+// with how much is missing. Every promotion applied to the order counts a use, which fails the order if a promotion
+// has been fully redeemed in the meantime. The quantities ordered count towards the purchases of the order's
+// customer, which fails the order if it goes past the purchase limit of any product. OrderProcessed and
+// InventoryReserved events are recorded in the outbox in the same transaction, and so is whatever acknowledge
+// writes, if it is set.
+func (s *OrderImpl) process(orderID uuid.UUID, acknowledge func(tx *database.Tx, order model.Order) error) (*model.Order, error) {
+	warehouses, err := s.WarehouseRepository.ResolveAll()
+	if err != nil {
+		return nil, err
+	}
+
+	apply := s.processTransition(warehouses)
+	return s.transition(orderID, func(order *model.Order, inventories []model.Inventory) (transitionResult, error) {
+		result, err := apply(order, inventories)
+		result.acknowledge = acknowledge
+		return result, err
+	})
+}
+
+// processTransition returns the transition that processes an order, allocating its items from the specified
+// warehouses with the configured allocation strategy. Items of bundles are allocated from the inventories of their
+// components, so a bundle is only reserved if all of its components can be, along with the rest of the order.
+func (s *OrderImpl) processTransition(warehouses []model.Warehouse) orderTransition {
+	allocate := allocationStrategies[s.config.Order.AllocationStrategy]
+	return func(order *model.Order, inventories []model.Inventory) (transitionResult, error) {
+		if err := order.VerifyTotal(); err != nil {
+			return transitionResult{}, err
+		}
+
+		if err := order.Process(); err != nil {
+			return transitionResult{}, err
+		}
+
+		stock := order.StockOrder()
+		if shortages := model.FindStockShortages(stock, inventories); len(shortages) > 0 {
+			return transitionResult{}, failure.InsufficientStock("insufficient stock to process the order", shortages)
+		}
+
+		allocations, err := allocate(stock, inventories, warehouses)
+		if err != nil {
+			return transitionResult{}, err
+		}
+		order.Allocations = allocations
+
+		result, err := changeInventories(order, inventories, (*model.Inventory).Reserve, model.MovementReasonReserve)
+		if err != nil {
+			return transitionResult{}, err
+		}
+
+		result.events, err = model.NewOrderProcessedEvents(*order, result.inventories)
+		result.counted = 1
+		return result, err
+	}
+}
+
+// ProcessBatch processes several orders and reports the outcome of each of them instead of failing the whole batch.
+// In best-effort mode every order is processed on its own, a limited number at a time, exactly as Process would.
+// In all-or-nothing mode the orders are processed in a single transaction that is rolled back if any of them fails.
+func (s *OrderImpl) ProcessBatch(input model.OrderBatchProcessInput) (*model.OrderBatchResponse, error) {
+	if err := input.Validate(s.config.Order.BatchMaxSize); err != nil {
+		return nil, err
+	}
+
+	var results []model.OrderBatchResult
+	if input.Mode == model.OrderBatchModeAllOrNothing {
+		var err error
+		results, err = s.processAll(input.OrderIDs)
 		if err != nil {
 			return nil, err
 		}
-		processedInventories = append(processedInventories, inventory)
+	} else {
+		results = s.processEach(input.OrderIDs)
+	}
+
+	response := model.NewOrderBatchResponse(input.Mode, results)
+	return &response, nil
+}
+
+// processEach processes every order on its own, running at most the configured number of them at once
+func (s *OrderImpl) processEach(orderIDs []uuid.UUID) []model.OrderBatchResult {
+	results := make([]model.OrderBatchResult, len(orderIDs))
+	slots := make(chan struct{}, s.config.Order.BatchConcurrency)
+	var wg sync.WaitGroup
+	for idx, orderID := range orderIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(idx int, orderID uuid.UUID) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[idx] = s.processBatchOrder(orderID)
+		}(idx, orderID)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// processBatchOrder processes an order of a best-effort batch exactly as Process would, unless it does not exist or
+// is not new anymore
+func (s *OrderImpl) processBatchOrder(orderID uuid.UUID) model.OrderBatchResult {
+	order, err := s.OrderRepository.ResolveByID(orderID)
+	skipped, err := skippedBatchResult(orderID, order, err)
+	if err != nil {
+		return model.NewOrderBatchResult(orderID, nil, err)
+	}
+	if skipped != nil {
+		return *skipped
+	}
+
+	order, err = s.Process(model.OrderProcessInput{OrderID: orderID})
+	return model.NewOrderBatchResult(orderID, order, err)
+}
+
+// skippedBatchResult decides from an order that was just resolved whether it is skipped by a batch, because it does
+// not exist or is not new anymore. Other failures to resolve it are returned as they are.
+func skippedBatchResult(orderID uuid.UUID, order *model.Order, err error) (*model.OrderBatchResult, error) {
+	if failure.GetCode(err) == failure.CodeEntityNotFound {
+		return model.NewSkippedOrderBatchResult(orderID, nil), nil
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	return model.NewSkippedOrderBatchResult(orderID, order), nil
+}
 
-	err = order.Process()
+// processAll processes all orders in a single transaction, each reserving from what the orders before it left.
+// The orders are locked in ascending ID order before the inventories of all their products are locked at once,
+// so the batch takes its locks in the same order as single orders do. The first order that cannot be processed
+// rolls the whole batch back and the other orders are reported as rolled back. Failures that are not caused by
+// an order, such as database errors, are returned as they are.
+func (s *OrderImpl) processAll(orderIDs []uuid.UUID) ([]model.OrderBatchResult, error) {
+	warehouses, err := s.WarehouseRepository.ResolveAll()
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.DB.WithTransaction(s.DB, func(tx *sqlx.Tx, e chan error) {
-		for _, inventory := range processedInventories {
-			logger.Trace("updating inventory")
-			if err := s.InventoryRepository.TxUpdate(tx, inventory); err != nil {
+	var failed *model.OrderBatchResult
+	processed := make(map[uuid.UUID]*model.Order)
+	fail := func(orderID uuid.UUID, err error) error {
+		if failure.GetCode(err) != failure.CodeInternalError {
+			result := model.NewOrderBatchResult(orderID, nil, err)
+			failed = &result
+		}
+		return err
+	}
+	skip := func(result *model.OrderBatchResult) error {
+		failed = result
+		return errors.New(result.Error)
+	}
+
+	releaseGate, err := s.acquireBatch(orderIDs, fail, skip)
+	if err != nil {
+		return rolledBackBatchResults(orderIDs, failed, err)
+	}
+
+	if s.config.Order.ProcessStrategy == config.ProcessStrategyMutex {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+	}
+
+	lockOrder := make([]uuid.UUID, len(orderIDs))
+	copy(lockOrder, orderIDs)
+	sort.Slice(lockOrder, func(i, j int) bool {
+		return lockOrder[i].String() < lockOrder[j].String()
+	})
+
+	apply := s.processTransition(warehouses)
+	err = s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		orders := make(map[uuid.UUID]*model.Order)
+		productIDs := make([]uuid.UUID, 0)
+		logger.Trace("locking orders")
+		for _, orderID := range lockOrder {
+			order, err := s.OrderRepository.TxResolveByIDForUpdate(tx, orderID)
+			skipped, err := skippedBatchResult(orderID, order, err)
+			if err != nil {
 				e <- err
 				return
 			}
+			if skipped != nil {
+				e <- skip(skipped)
+				return
+			}
+
+			if err := s.attachBundles(order); err != nil {
+				e <- err
+				return
+			}
+			orders[orderID] = order
+			productIDs = append(productIDs, order.StockProductIDs()...)
 		}
 
-		logger.Trace("updating order")
-		if err := s.OrderRepository.TxUpdate(tx, *order); err != nil {
+		logger.Trace("locking inventories")
+		inventories, err := s.InventoryRepository.TxResolveByProductIDsForUpdate(tx, productIDs)
+		if err != nil {
 			e <- err
 			return
 		}
 
+		for _, orderID := range orderIDs {
+			order := orders[orderID]
+			allocated := len(order.Allocations)
+			result, err := apply(order, inventories)
+			if err != nil {
+				e <- fail(orderID, err)
+				return
+			}
+
+			if err := s.txWriteTransition(tx, order, allocated, result); err != nil {
+				e <- err
+				return
+			}
+
+			replaceWrittenInventories(inventories, result.inventories)
+			processed[orderID] = order
+		}
+
+		e <- nil
+	})
+	if err != nil {
+		releaseGate()
+		return rolledBackBatchResults(orderIDs, failed, err)
+	}
+
+	results := make([]model.OrderBatchResult, 0)
+	for _, orderID := range orderIDs {
+		results = append(results, model.NewOrderBatchResult(orderID, processed[orderID], nil))
+	}
+
+	return results, nil
+}
+
+// acquireBatch takes the quantities of every order of an all-or-nothing batch off the flash-sale stock gate, if
+// it is enabled. When an order is turned away, everything taken so far is given back and the order is reported
+// through fail, or through skip if it does not exist or is not new. The returned function gives everything back.
+func (s *OrderImpl) acquireBatch(orderIDs []uuid.UUID, fail func(uuid.UUID, error) error, skip func(*model.OrderBatchResult) error) (release func(), err error) {
+	releases := make([]func(), 0)
+	release = func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+
+	if !s.StockGate.Enabled() {
+		return release, nil
+	}
+
+	for _, orderID := range orderIDs {
+		order, err := s.OrderRepository.ResolveByID(orderID)
+		skipped, err := skippedBatchResult(orderID, order, err)
+		if err == nil && skipped != nil {
+			err = skip(skipped)
+		}
+		if err == nil {
+			err = s.attachBundles(order)
+		}
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		stock := order.StockOrder()
+		orderRelease, err := s.StockGate.Acquire(stock.QtyByProduct())
+		if err != nil {
+			release()
+			return nil, fail(orderID, err)
+		}
+		releases = append(releases, orderRelease)
+	}
+
+	return release, nil
+}
+
+// rolledBackBatchResults reports the outcome of an all-or-nothing batch that was rolled back: the order that
+// failed gets its failure and every other order is reported as rolled back. If no order failed, the error that
+// rolled the batch back is returned instead.
+func rolledBackBatchResults(orderIDs []uuid.UUID, failed *model.OrderBatchResult, err error) ([]model.OrderBatchResult, error) {
+	if failed == nil {
+		return nil, err
+	}
+
+	results := make([]model.OrderBatchResult, 0)
+	for _, orderID := range orderIDs {
+		if orderID == failed.OrderID {
+			results = append(results, *failed)
+			continue
+		}
+		results = append(results, model.OrderBatchResult{OrderID: orderID, Status: model.OrderBatchStatusRolledBack})
+	}
+
+	return results, nil
+}
+
+// Complete completes a processing or paid order, taking its reserved inventory out of the warehouses it was allocated from
+func (s *OrderImpl) Complete(id uuid.UUID) (*model.Order, error) {
+	return s.transition(id, func(order *model.Order, inventories []model.Inventory) (transitionResult, error) {
+		if err := order.Complete(); err != nil {
+			return transitionResult{}, err
+		}
+
+		return changeInventories(order, inventories, (*model.Inventory).Ship, model.MovementReasonShip)
+	})
+}
+
+// Cancel cancels a new or processing order. Inventory reserved for a processing order is released, and the usage
+// of its promotions and the purchases of its customer are given back.
+func (s *OrderImpl) Cancel(id uuid.UUID) (*model.Order, error) {
+	return s.transition(id, func(order *model.Order, inventories []model.Inventory) (transitionResult, error) {
+		wasProcessing := order.Status == model.OrderStatusProcessing
+		if err := order.Cancel(); err != nil {
+			return transitionResult{}, err
+		}
+
+		if !wasProcessing {
+			return transitionResult{}, nil
+		}
+
+		result, err := changeInventories(order, inventories, (*model.Inventory).Release, model.MovementReasonRelease)
+		result.counted = -1
+		return result, err
+	})
+}
+
+// Expire expires a processing order whose reservation has lapsed, releasing its reserved inventory and giving
+// back the usage of its promotions and the purchases of its customer
+func (s *OrderImpl) Expire(id uuid.UUID) (*model.Order, error) {
+	return s.transition(id, func(order *model.Order, inventories []model.Inventory) (transitionResult, error) {
+		if err := order.Expire(); err != nil {
+			return transitionResult{}, err
+		}
+
+		result, err := changeInventories(order, inventories, (*model.Inventory).Release, model.MovementReasonRelease)
+		result.counted = -1
+		return result, err
+	})
+}
+
+// SettlePayment settles an order with the outcome of its payment, writing the settled payment in the same
+// transaction. A processing order whose payment succeeded is paid. One whose payment failed is compensated for: its
+// reserved inventory is released, the usage of its promotions and the purchases of its customer are given back, and
+// it becomes payment_failed. An order that was cancelled, expired or completed while its payment was pending, or one
+// already settled by another delivery of the same outcome, is left as it is, and only the payment is recorded. A
+// payment that succeeded for an order cancelled, expired or failed in the meantime is recorded as awaiting its
+// refund.
+func (s *OrderImpl) SettlePayment(payment model.Payment) (*model.Order, error) {
+	return s.transition(payment.OrderID, func(order *model.Order, inventories []model.Inventory) (transitionResult, error) {
+		settled := payment
+		acknowledge := func(tx *database.Tx, order model.Order) error {
+			logger.Trace("updating payment")
+			return s.PaymentRepository.TxUpdate(tx, settled)
+		}
+
+		if order.Status != model.OrderStatusProcessing {
+			if settled.RequiresRefund(*order) {
+				logger.Warn("payment %s succeeded for order %s that is %s, marking it for refund", payment.ID, order.ID, order.Status)
+				err := settled.MarkForRefund()
+				return transitionResult{acknowledge: acknowledge}, err
+			}
+			return transitionResult{acknowledge: acknowledge}, nil
+		}
+
+		if payment.Status == model.PaymentStatusSucceeded {
+			err := order.MarkPaid()
+			return transitionResult{acknowledge: acknowledge}, err
+		}
+
+		if err := order.FailPayment(); err != nil {
+			return transitionResult{}, err
+		}
+
+		result, err := changeInventories(order, inventories, (*model.Inventory).Release, model.MovementReasonRelease)
+		result.counted = -1
+		result.acknowledge = acknowledge
+		return result, err
+	})
+}
+
+// transition applies a transition to an order atomically.
+// How concurrent requests are kept from overselling depends on the configured process strategy:
+// a mutex local to this instance, database row locks, or optimistic versioned updates retried on conflict.
+func (s *OrderImpl) transition(orderID uuid.UUID, apply orderTransition) (*model.Order, error) {
+	switch s.config.Order.ProcessStrategy {
+	case config.ProcessStrategyMutex:
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		return s.transitionOnce(orderID, apply, false)
+	case config.ProcessStrategyOptimistic:
+		return s.transitionWithRetry(orderID, apply)
+	default:
+		return s.transitionOnce(orderID, apply, true)
+	}
+}
+
+// transitionWithRetry repeats the whole read-apply-write cycle while it fails on version conflicts,
+// backing off exponentially with jitter between attempts
+func (s *OrderImpl) transitionWithRetry(orderID uuid.UUID, apply orderTransition) (*model.Order, error) {
+	backoff := s.config.Order.ProcessRetryBackoff
+	for attempt := 0; ; attempt++ {
+		order, err := s.transitionOnce(orderID, apply, false)
+		if failure.GetCode(err) != failure.CodeVersionConflict || attempt >= s.config.Order.ProcessMaxRetries {
+			return order, err
+		}
+
+		jittered := backoff/2 + time.Duration(rand.Int63n(int64(backoff)+1))
+		logger.Debug("version conflict on order %s, retrying in %v", orderID, jittered)
+		time.Sleep(jittered)
+		backoff = nextRetryBackoff(backoff, s.config.Order.ProcessRetryMaxBackoff)
+	}
+}
+
+// nextRetryBackoff doubles a retry backoff without letting it grow past maxBackoff
+func nextRetryBackoff(backoff time.Duration, maxBackoff time.Duration) time.Duration {
+	if backoff >= maxBackoff/2 {
+		return maxBackoff
+	}
+	return backoff * 2
+}
+
+// transitionOnce performs a single read-apply-write cycle in a transaction. When lockRows is set, the order
+// and inventory rows are read with row locks held until the transaction ends. Otherwise they are read
+// without locks and the versioned updates reject the write if another request modified them in the meantime.
+// Allocations added to the order by the transition, the inventory movements and the events it produced are
+// written along with it.
+func (s *OrderImpl) transitionOnce(orderID uuid.UUID, apply orderTransition, lockRows bool) (*model.Order, error) {
+	var transitionedOrder *model.Order
+	err := s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		var order *model.Order
+		var err error
+		if lockRows {
+			logger.Trace("locking order")
+			order, err = s.OrderRepository.TxResolveByIDForUpdate(tx, orderID)
+		} else {
+			order, err = s.OrderRepository.ResolveByID(orderID)
+		}
+		if err != nil {
+			e <- err
+			return
+		}
+
+		if err := s.attachBundles(order); err != nil {
+			e <- err
+			return
+		}
+
+		productIDs := order.StockProductIDs()
+
+		var inventories []model.Inventory
+		if lockRows {
+			logger.Trace("locking inventories")
+			inventories, err = s.InventoryRepository.TxResolveByProductIDsForUpdate(tx, productIDs)
+		} else {
+			inventories, err = s.InventoryRepository.ResolveByProductIDs(productIDs)
+		}
+		if err != nil {
+			e <- err
+			return
+		}
+
+		allocated := len(order.Allocations)
+		result, err := apply(order, inventories)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		if err := s.txWriteTransition(tx, order, allocated, result); err != nil {
+			e <- err
+			return
+		}
+
+		transitionedOrder = order
 		e <- nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transitionedOrder, nil
+}
+
+// txWriteTransition writes what a transition changed within the supplied transaction: the inventories, the usage
+// of the promotions, the purchases of the customer, the order, the allocations added after the first allocated
+// ones, the inventory movements, the events and finally whatever the transition acknowledges
+func (s *OrderImpl) txWriteTransition(tx *database.Tx, order *model.Order, allocated int, result transitionResult) error {
+	for _, inventory := range result.inventories {
+		logger.Trace("updating inventory")
+		if err := s.InventoryRepository.TxUpdate(tx, inventory); err != nil {
+			return err
+		}
+	}
+
+	if result.counted != 0 {
+		logger.Trace("counting promotion usage")
+		if err := s.txAddPromotionUsage(tx, order, result.counted); err != nil {
+			return err
+		}
+
+		logger.Trace("counting customer purchases")
+		if err := s.txAddCustomerPurchases(tx, order, result.counted); err != nil {
+			return err
+		}
+	}
+
+	logger.Trace("updating order")
+	if err := s.OrderRepository.TxUpdate(tx, *order); err != nil {
+		return err
+	}
+
+	if len(order.Allocations) > allocated {
+		logger.Trace("creating allocations")
+		if err := s.OrderRepository.TxCreateAllocations(tx, order.Allocations[allocated:]); err != nil {
+			return err
+		}
+	}
+
+	logger.Trace("recording inventory movements")
+	if err := s.MovementRepository.TxCreate(tx, result.movements); err != nil {
+		return err
+	}
+
+	logger.Trace("recording events")
+	if err := s.OutboxRepository.TxCreate(tx, result.events); err != nil {
+		return err
+	}
+
+	if result.acknowledge != nil {
+		return result.acknowledge(tx, *order)
+	}
+
+	return nil
+}
+
+// txAddPromotionUsage changes the usage count of every promotion applied to an order within the supplied
+// transaction, in ascending ID order. A promotion that has been fully redeemed fails the transition.
+func (s *OrderImpl) txAddPromotionUsage(tx *database.Tx, order *model.Order, delta int) error {
+	for _, promotionID := range order.PromotionIDs() {
+		err := s.PromotionRepository.TxAddUsage(tx, promotionID, delta)
+		if failure.GetCode(err) == failure.CodePromotionExhausted {
+			for _, discount := range order.Discounts {
+				if discount.PromotionID == promotionID {
+					return failure.PromotionExhausted(fmt.Sprintf("promotion %s has been fully redeemed", discount.Name))
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// txAddCustomerPurchases adds the quantity of every product of an order to the purchases of its customer, or takes
+// it off when sign is negative, within the supplied transaction. The purchases are changed in ascending product ID
+// order and stay locked until the transaction ends, so concurrent orders of the same customer are counted one after
+// the other. When adding, every item whose product would go past its purchase limit is reported at once.
+func (s *OrderImpl) txAddCustomerPurchases(tx *database.Tx, order *model.Order, sign int) error {
+	purchased := make(map[uuid.UUID]int)
+	if order.CustomerRef != "" {
+		productIDs := order.ProductIDs()
+		sort.Slice(productIDs, func(i, j int) bool {
+			return productIDs[i].String() < productIDs[j].String()
+		})
+
+		qtyMap := order.QtyByProduct()
+		for _, productID := range productIDs {
+			qty, err := s.CustomerPurchaseRepository.TxAddQty(tx, order.CustomerRef, productID, sign*qtyMap[productID])
+			if err != nil {
+				return err
+			}
+			purchased[productID] = qty - qtyMap[productID]
+		}
+	}
+
+	if sign < 0 {
+		return nil
+	}
+
+	products, err := s.ProductRepository.ResolveByIDs(order.ProductIDs())
+	if err != nil {
+		return err
+	}
+
+	if violations := model.FindPurchaseLimitViolations(*order, products, purchased); len(violations) > 0 {
+		return failure.PurchaseLimitExceeded("the order goes past the purchase limits of its customer", violations)
+	}
+
+	return nil
+}
+
+// attachBundles attaches the components of the bundles an order contains to its items, so that the order draws on
+// the inventories of the components
+func (s *OrderImpl) attachBundles(order *model.Order) error {
+	products, err := s.ProductRepository.ResolveByIDs(order.ProductIDs())
+	if err != nil {
+		return err
+	}
+
+	order.AttachBundles(products)
+	return nil
+}
+
+// replaceWrittenInventories replaces inventories with the versions that were just written over them, so that later
+// transitions within the same transaction start from the written quantities and versions
+func replaceWrittenInventories(inventories []model.Inventory, written []model.Inventory) {
+	for _, inventory := range written {
+		for idx := range inventories {
+			if inventories[idx].ID == inventory.ID {
+				inventories[idx] = inventory
+				inventories[idx].Version++
+			}
+		}
+	}
+}
+
+// containsInventory checks whether an inventory is among the specified ones
+func containsInventory(inventories []model.Inventory, id uuid.UUID) bool {
+	for _, inventory := range inventories {
+		if inventory.ID == id {
+			return true
+		}
+	}
+	return false
+}
 
-	return order, err
+// changeInventories applies a quantity change to every inventory an order is allocated from, using the total
+// quantity allocated from each inventory, and records a movement with the specified reason for each of them.
+// It fails if any allocated inventory no longer exists.
+func changeInventories(order *model.Order, inventories []model.Inventory, change func(*model.Inventory, int) error, reason string) (transitionResult, error) {
+	qtyMap := order.QtyByInventory()
+	result := transitionResult{
+		inventories: make([]model.Inventory, 0),
+		movements:   make([]model.InventoryMovement, 0),
+	}
+	for _, inventory := range inventories {
+		qty, ok := qtyMap[inventory.ID]
+		if !ok {
+			continue
+		}
+
+		before := inventory
+		if err := change(&inventory, qty); err != nil {
+			return transitionResult{}, err
+		}
+		result.inventories = append(result.inventories, inventory)
+		result.movements = append(result.movements, model.NewInventoryMovement(before, inventory, reason, order.ID))
+		delete(qtyMap, inventory.ID)
+	}
+
+	for inventoryID := range qtyMap {
+		return transitionResult{}, failure.EntityNotFound(fmt.Sprintf("Inventory %s", inventoryID))
+	}
 
+	return result, nil
 }
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRetryBackoff(t *testing.T) {
+
+	backoffs := []struct {
+		name     string
+		backoff  time.Duration
+		expected time.Duration
+	}{
+		{"doubles", 10 * time.Millisecond, 20 * time.Millisecond},
+		{"reachesMax", 50 * time.Millisecond, 100 * time.Millisecond},
+		{"clampedToMax", 80 * time.Millisecond, 100 * time.Millisecond},
+		{"staysAtMax", 100 * time.Millisecond, 100 * time.Millisecond},
+	}
+
+	for _, tc := range backoffs {
+		t.Run(tc.name, func(t *testing.T) {
+			if next := nextRetryBackoff(tc.backoff, 100*time.Millisecond); next != tc.expected {
+				t.Errorf("wrong backoff after %v: got %v want %v", tc.backoff, next, tc.expected)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// OutboxDispatcher is the service provider interface for publishing outbox events
+type OutboxDispatcher interface {
+	Startup()
+	Shutdown()
+	Dispatch() (published int)
+}
+
+// OutboxDispatcherImpl is the service provider implementation.
+// It periodically publishes unpublished outbox events to the configured sink. When Sink is left empty,
+// the sink selected in the configuration is used.
+type OutboxDispatcherImpl struct {
+	OutboxRepository repository.Outbox   `inject:"outboxRepository"`
+	DB               database.Transactor `inject:"db"`
+	Sink             EventSink
+	config           *config.Config
+	stop             chan struct{}
+	done             sync.WaitGroup
+}
+
+// Startup performs startup functions
+func (s *OutboxDispatcherImpl) Startup() {
+	logger.Trace("Outbox dispatcher starting up...")
+	s.config = config.Get()
+	if s.Sink == nil {
+		s.Sink = NewEventSink(s.config)
+	}
+
+	if !s.config.Outbox.DispatchEnabled {
+		logger.Info("Outbox dispatcher is disabled.")
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done.Add(1)
+	go s.run()
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *OutboxDispatcherImpl) Shutdown() {
+	logger.Trace("Outbox dispatcher shutting down...")
+	if s.stop != nil {
+		close(s.stop)
+		s.done.Wait()
+		s.stop = nil
+	}
+}
+
+// Dispatch publishes a single batch of unpublished events in Sequence order and returns how many were published.
+// An event is only marked as published after the sink accepted it, so an event may be published again if marking
+// it fails, but never lost. When an event fails to publish, the remaining events of the same aggregate are held
+// back until it succeeds so that each aggregate's events arrive in order. Dispatchers on several replicas take
+// turns through a lock held for the whole batch.
+func (s *OutboxDispatcherImpl) Dispatch() (published int) {
+	err := s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		if err := s.OutboxRepository.TxLockDispatch(tx); err != nil {
+			e <- err
+			return
+		}
+
+		events, err := s.OutboxRepository.TxResolveUnpublished(tx, s.config.Outbox.BatchSize)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		blocked := make(map[uuid.UUID]bool)
+		publishedSequences := make([]int64, 0)
+		failedSequences := make([]int64, 0)
+		for _, event := range events {
+			if blocked[event.AggregateID] {
+				continue
+			}
+
+			if err := s.Sink.Publish(event); err != nil {
+				logger.ErrNoStack("failed publishing event %s: %v", event.ID, err)
+				blocked[event.AggregateID] = true
+				failedSequences = append(failedSequences, event.Sequence)
+				continue
+			}
+
+			publishedSequences = append(publishedSequences, event.Sequence)
+		}
+
+		if err := s.OutboxRepository.TxMarkPublished(tx, publishedSequences, time.Now()); err != nil {
+			e <- err
+			return
+		}
+
+		if err := s.OutboxRepository.TxIncrementAttempts(tx, failedSequences); err != nil {
+			e <- err
+			return
+		}
+
+		published = len(publishedSequences)
+		e <- nil
+	})
+	if err != nil {
+		logger.ErrNoStack("failed dispatching outbox events: %v", err)
+		return 0
+	}
+
+	return
+}
+
+func (s *OutboxDispatcherImpl) run() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.config.Outbox.DispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Dispatch()
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Payment is the service provider interface
+type Payment interface {
+	Startup()
+	Shutdown()
+	ResolveByID(id uuid.UUID) (*model.Payment, error)
+	Pay(orderID uuid.UUID) (*model.Payment, error)
+	HandleCharge(charge model.PaymentCharge) (*model.Payment, error)
+	Reconcile(id uuid.UUID) (*model.Payment, error)
+}
+
+// PaymentImpl is the service provider implementation. Payments are charged through Gateway, which defaults to the
+// HTTP payment gateway at the configured URL.
+type PaymentImpl struct {
+	OrderRepository   repository.Order    `inject:"orderRepository"`
+	PaymentRepository repository.Payment  `inject:"paymentRepository"`
+	OrderService      Order               `inject:"orderService"`
+	DB                database.Transactor `inject:"db"`
+	Gateway           PaymentGateway
+	config            *config.Config
+}
+
+// Startup performs startup functions
+func (s *PaymentImpl) Startup() {
+	logger.Trace("Payment service starting up...")
+	s.config = config.Get()
+	if s.Gateway == nil {
+		s.Gateway = NewHTTPPaymentGateway(s.config.Payment.GatewayURL, s.config.Payment.GatewayTimeout)
+	}
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *PaymentImpl) Shutdown() {
+	logger.Trace("Payment service shutting down...")
+}
+
+// ResolveByID resolves a Payment by its ID
+func (s *PaymentImpl) ResolveByID(id uuid.UUID) (*model.Payment, error) {
+	return s.PaymentRepository.ResolveByID(id)
+}
+
+// Pay charges the total price of a processing order through the payment gateway. A pending payment is recorded
+// first, so that whatever the gateway reports can always be matched to it, and an order never has more than one
+// payment pending or succeeded. The outcome of the charge is then settled along with the order. If the gateway does
+// not answer in time, the payment is left pending for the gateway's webhook, or the payment sweeper, to settle.
+func (s *PaymentImpl) Pay(orderID uuid.UUID) (*model.Payment, error) {
+	payment, err := s.createPending(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	charge, err := s.Gateway.Charge(*payment)
+	if err != nil {
+		logger.ErrNoStack("charging payment %s failed, leaving it pending: %v", payment.ID, err)
+		return payment, nil
+	}
+
+	return s.settle(*charge)
+}
+
+// HandleCharge settles a payment with the outcome of its charge reported by the gateway's webhook. Webhooks are not
+// authenticated, so the charge is fetched from the gateway again and only the gateway's answer is settled. A charge
+// the gateway does not know of, or one that differs from its answer, is rejected. Gateways deliver webhooks at least
+// once, so reporting the outcome of a settled payment again changes nothing and returns the payment as it is.
+func (s *PaymentImpl) HandleCharge(charge model.PaymentCharge) (*model.Payment, error) {
+	if err := charge.Validate(); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.PaymentRepository.ResolveByID(charge.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := s.Gateway.ResolveCharge(*payment)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolved == nil {
+		return nil, failure.EntityNotFound("Payment Charge")
+	}
+
+	if *resolved != charge {
+		logger.Warn("webhook for payment %s reported charge %+v but the gateway reports %+v", payment.ID, charge, *resolved)
+		return nil, failure.OperationNotPermitted("settle", "Payment", "the charge does not match the one the gateway reports")
+	}
+
+	return s.settle(*resolved)
+}
+
+// Reconcile settles a payment the store has not heard the outcome of by asking the gateway for its charge. A charge
+// the gateway never received fails the payment, compensating its order, so a payment must only be reconciled once
+// the charge request can no longer be in flight. A payment awaiting its refund is asked to be refunded again. Any
+// other payment is returned as it is.
+func (s *PaymentImpl) Reconcile(id uuid.UUID) (*model.Payment, error) {
+	payment, err := s.PaymentRepository.ResolveByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch payment.Status {
+	case model.PaymentStatusPending:
+	case model.PaymentStatusRefundPending:
+		return s.refund(*payment)
+	default:
+		return payment, nil
+	}
+
+	charge, err := s.Gateway.ResolveCharge(*payment)
+	if err != nil {
+		return nil, err
+	}
+
+	if charge != nil {
+		return s.settle(*charge)
+	}
+
+	if err := payment.Fail("the payment gateway never received the charge", time.Now()); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.OrderService.SettlePayment(*payment); err != nil {
+		return nil, err
+	}
+
+	payment.Version++
+	return payment, nil
+}
+
+// createPending records a pending payment of a processing order, with the order locked
+func (s *PaymentImpl) createPending(orderID uuid.UUID) (*model.Payment, error) {
+	var payment model.Payment
+	err := s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("locking order")
+		order, err := s.OrderRepository.TxResolveByIDForUpdate(tx, orderID)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		if !order.CanTransitionTo(model.OrderStatusPaid) {
+			e <- failure.OperationNotPermitted("pay", "Order", fmt.Sprintf("cannot pay an order that is %s", order.Status))
+			return
+		}
+
+		payments, err := s.PaymentRepository.TxResolveByOrderID(tx, orderID)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		for _, existing := range payments {
+			if existing.Status != model.PaymentStatusFailed {
+				e <- failure.OperationNotPermitted("pay", "Order", fmt.Sprintf("the order already has a %s payment", existing.Status))
+				return
+			}
+		}
+
+		payment = model.NewPayment(*order, time.Now())
+		logger.Trace("creating payment")
+		e <- s.PaymentRepository.TxCreate(tx, payment)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// settle settles a payment with the outcome of its charge, along with its order. If the payment gets settled in the
+// meantime, by the response to the charge request or another delivery of the webhook, it is returned as it is
+// provided it records the same outcome. A charge that went through for an order that can no longer be paid is
+// refunded right away.
+func (s *PaymentImpl) settle(charge model.PaymentCharge) (*model.Payment, error) {
+	payment, err := s.PaymentRepository.ResolveByID(charge.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Records(charge) {
+		return payment, nil
+	}
+
+	if err := payment.Settle(charge, time.Now()); err != nil {
+		return nil, err
+	}
+
+	order, err := s.OrderService.SettlePayment(*payment)
+	if err != nil {
+		settled, resolveErr := s.PaymentRepository.ResolveByID(payment.ID)
+		if resolveErr == nil && settled.Records(charge) {
+			return settled, nil
+		}
+		return nil, err
+	}
+
+	payment.Version++
+	if payment.RequiresRefund(*order) {
+		if err := payment.MarkForRefund(); err != nil {
+			return nil, err
+		}
+		return s.refund(*payment)
+	}
+
+	return payment, nil
+}
+
+// refund asks the gateway to refund a payment awaiting its refund and records the refund. If the gateway fails, the
+// payment is left awaiting its refund.
+func (s *PaymentImpl) refund(payment model.Payment) (*model.Payment, error) {
+	refund, err := s.Gateway.Refund(payment)
+	if err != nil {
+		logger.ErrNoStack("refunding payment %s failed, leaving it awaiting its refund: %v", payment.ID, err)
+		return &payment, nil
+	}
+
+	if err := payment.Refund(*refund, time.Now()); err != nil {
+		return nil, err
+	}
+
+	err = s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("updating payment")
+		e <- s.PaymentRepository.TxUpdate(tx, payment)
+	})
+	if err != nil {
+		refunded, resolveErr := s.PaymentRepository.ResolveByID(payment.ID)
+		if resolveErr == nil && refunded.Status == model.PaymentStatusRefunded && refunded.RefundID == refund.ID {
+			return refunded, nil
+		}
+		return nil, err
+	}
+
+	payment.Version++
+	return &payment, nil
+}
@@ -0,0 +1,379 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+const (
+	// MockGatewayApprove makes the mock payment gateway approve every charge
+	MockGatewayApprove = "approve"
+	// MockGatewayDecline makes the mock payment gateway decline every charge
+	MockGatewayDecline = "decline"
+	// MockGatewayTimeout makes the mock payment gateway answer charges only after its delay, approving them
+	MockGatewayTimeout = "timeout"
+)
+
+// PaymentGateway is the interface of the payment gateway Payments are charged and refunded through.
+// A gateway asked to charge or refund the same Payment more than once must only do so once.
+type PaymentGateway interface {
+	Charge(payment model.Payment) (*model.PaymentCharge, error)
+	ResolveCharge(payment model.Payment) (*model.PaymentCharge, error)
+	Refund(payment model.Payment) (*model.PaymentRefund, error)
+}
+
+// HTTPPaymentGateway charges and refunds Payments through the HTTP API of a payment gateway, such as the one served
+// by MockPaymentGateway. The ID of the Payment is both the reference of the charge or refund and its idempotency key.
+type HTTPPaymentGateway struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPPaymentGateway creates an HTTP payment gateway with the specified base URL
+func NewHTTPPaymentGateway(url string, timeout time.Duration) *HTTPPaymentGateway {
+	return &HTTPPaymentGateway{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Charge asks the gateway to charge a Payment and returns the charge it reports. Any response other than 2xx is
+// treated as a failure.
+func (g *HTTPPaymentGateway) Charge(payment model.Payment) (*model.PaymentCharge, error) {
+	var charge model.PaymentCharge
+	input := model.PaymentChargeInput{Reference: payment.ID, Amount: payment.Amount}
+	if err := g.post("/charges", payment.ID, input, &charge); err != nil {
+		return nil, err
+	}
+
+	if err := charge.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &charge, nil
+}
+
+// ResolveCharge asks the gateway for the charge of a Payment, returning nil if the gateway never received it. Any
+// other response than 2xx or 404 is treated as a failure.
+func (g *HTTPPaymentGateway) ResolveCharge(payment model.Payment) (*model.PaymentCharge, error) {
+	resp, err := g.Client.Get(g.URL + "/charges/" + payment.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("payment gateway responded with %s", resp.Status)
+	}
+
+	var charge model.PaymentCharge
+	if err := json.NewDecoder(resp.Body).Decode(&charge); err != nil {
+		return nil, err
+	}
+
+	if err := charge.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &charge, nil
+}
+
+// Refund asks the gateway to refund the charge of a Payment and returns the refund it reports. Any response other
+// than 2xx is treated as a failure.
+func (g *HTTPPaymentGateway) Refund(payment model.Payment) (*model.PaymentRefund, error) {
+	var refund model.PaymentRefund
+	input := model.PaymentRefundInput{Reference: payment.ID, ChargeID: payment.ChargeID, Amount: payment.Amount}
+	if err := g.post("/refunds", payment.ID, input, &refund); err != nil {
+		return nil, err
+	}
+
+	if err := refund.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// post posts a request to the gateway with an idempotency key and decodes its response into result
+func (g *HTTPPaymentGateway) post(path string, key uuid.UUID, input interface{}, result interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key.String())
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("payment gateway responded with %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// MockPaymentGateway is a local stand-in for a payment gateway, serving the API HTTPPaymentGateway talks to.
+// Depending on its behaviour it approves or declines every charge, or answers only after Delay, by which time the
+// store should have given up waiting, and approves the charge then. Succeeded charges can be refunded. Charges and
+// refunds are idempotent by reference. The
+// outcome of every charge is also posted to the callback URL, if set, Duplicates + 1 times, the way real gateways
+// deliver their webhooks at least once.
+type MockPaymentGateway struct {
+	Delay      time.Duration
+	Duplicates int
+	Client     *http.Client
+
+	mux         sync.Mutex
+	behaviour   string
+	callbackURL string
+	charges     map[uuid.UUID]model.PaymentCharge
+	refunds     map[uuid.UUID]model.PaymentRefund
+	pending     int
+	delivered   *sync.Cond
+}
+
+// NewMockPaymentGateway creates a mock payment gateway with the specified behaviour
+func NewMockPaymentGateway(behaviour string, delay time.Duration, duplicates int) *MockPaymentGateway {
+	g := &MockPaymentGateway{
+		Delay:      delay,
+		Duplicates: duplicates,
+		Client:     &http.Client{Timeout: 5 * time.Second},
+		behaviour:  behaviour,
+		charges:    make(map[uuid.UUID]model.PaymentCharge),
+		refunds:    make(map[uuid.UUID]model.PaymentRefund),
+	}
+	g.delivered = sync.NewCond(&g.mux)
+	return g
+}
+
+// SetBehaviour changes how the mock payment gateway answers new charges
+func (g *MockPaymentGateway) SetBehaviour(behaviour string) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.behaviour = behaviour
+}
+
+// SetCallbackURL changes where the mock payment gateway posts the outcome of charges
+func (g *MockPaymentGateway) SetCallbackURL(url string) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.callbackURL = url
+}
+
+// Wait waits until the outcome of every charge answered so far has been posted to the callback URL
+func (g *MockPaymentGateway) Wait() {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	for g.pending > 0 {
+		g.delivered.Wait()
+	}
+}
+
+// Refunds returns the refunds made so far, by reference
+func (g *MockPaymentGateway) Refunds() map[uuid.UUID]model.PaymentRefund {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	refunds := make(map[uuid.UUID]model.PaymentRefund)
+	for reference, refund := range g.refunds {
+		refunds[reference] = refund
+	}
+	return refunds
+}
+
+// ServeHTTP serves POST /charges, GET /charges/{reference} and POST /refunds
+func (g *MockPaymentGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/charges/") {
+		g.serveCharge(w, r)
+		return
+	}
+
+	if r.URL.Path != "/charges" && r.URL.Path != "/refunds" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path == "/refunds" {
+		g.serveRefund(w, r)
+		return
+	}
+
+	var input model.PaymentChargeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	g.mux.Lock()
+	charge, exists := g.charges[input.Reference]
+	behaviour := g.behaviour
+	if !exists {
+		id, _ := uuid.NewV4()
+		charge = model.PaymentCharge{
+			ID:        "ch_" + id.String(),
+			Reference: input.Reference,
+			Amount:    input.Amount,
+			Status:    model.ChargeStatusSucceeded,
+		}
+		if behaviour == MockGatewayDecline {
+			charge.Status = model.ChargeStatusDeclined
+			charge.Reason = "card declined"
+		}
+		g.charges[input.Reference] = charge
+	}
+	g.mux.Unlock()
+
+	if exists {
+		logger.Debug("duplicate charge %s for %s", charge.ID, charge.Reference)
+		g.respond(w, http.StatusOK, charge)
+		return
+	}
+
+	if behaviour == MockGatewayTimeout {
+		time.Sleep(g.Delay)
+	}
+
+	logger.Info("charge %s for %s of %s %s", charge.ID, charge.Reference, charge.Amount, charge.Status)
+	g.notify(charge)
+	g.respond(w, http.StatusCreated, charge)
+}
+
+// serveCharge serves the charge of a reference, whether or not its outcome has been answered yet
+func (g *MockPaymentGateway) serveCharge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	reference, err := uuid.FromString(strings.TrimPrefix(r.URL.Path, "/charges/"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	g.mux.Lock()
+	charge, exists := g.charges[reference]
+	g.mux.Unlock()
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	g.respond(w, http.StatusOK, charge)
+}
+
+// serveRefund refunds a succeeded charge, in full
+func (g *MockPaymentGateway) serveRefund(w http.ResponseWriter, r *http.Request) {
+	var input model.PaymentRefundInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	g.mux.Lock()
+	charge, charged := g.charges[input.Reference]
+	refund, exists := g.refunds[input.Reference]
+	if charged && !exists && charge.ID == input.ChargeID && charge.Status == model.ChargeStatusSucceeded && charge.Amount == input.Amount {
+		id, _ := uuid.NewV4()
+		refund = model.PaymentRefund{
+			ID:        "re_" + id.String(),
+			Reference: input.Reference,
+			ChargeID:  charge.ID,
+			Amount:    charge.Amount,
+		}
+		g.refunds[input.Reference] = refund
+	}
+	g.mux.Unlock()
+
+	switch {
+	case exists:
+		logger.Debug("duplicate refund %s for %s", refund.ID, refund.Reference)
+		g.respond(w, http.StatusOK, refund)
+	case refund.ID == "":
+		w.WriteHeader(http.StatusConflict)
+	default:
+		logger.Info("refund %s for %s of %s", refund.ID, refund.Reference, refund.Amount)
+		g.respond(w, http.StatusCreated, refund)
+	}
+}
+
+func (g *MockPaymentGateway) respond(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.ErrNoStack("%v", err)
+	}
+}
+
+// notify posts the outcome of a charge to the callback URL in the background
+func (g *MockPaymentGateway) notify(charge model.PaymentCharge) {
+	body, err := json.Marshal(charge)
+	if err != nil {
+		logger.ErrNoStack("%v", err)
+		return
+	}
+
+	g.mux.Lock()
+	url := g.callbackURL
+	if url != "" {
+		g.pending++
+	}
+	g.mux.Unlock()
+	if url == "" {
+		return
+	}
+
+	go func() {
+		defer func() {
+			g.mux.Lock()
+			defer g.mux.Unlock()
+			g.pending--
+			g.delivered.Broadcast()
+		}()
+		for delivery := 0; delivery <= g.Duplicates; delivery++ {
+			resp, err := g.Client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				logger.Warn("delivering the outcome of charge %s failed: %v", charge.ID, err)
+				continue
+			}
+			resp.Body.Close()
+			logger.Debug("delivered the outcome of charge %s: %s", charge.ID, resp.Status)
+		}
+	}()
+}
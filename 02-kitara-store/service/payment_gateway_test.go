@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/model"
+)
+
+func TestMockPaymentGateway(t *testing.T) {
+
+	payment := func() model.Payment {
+		order := model.Order{ID: uuid.Must(uuid.NewV4()), TotalPrice: model.NewMoney(2500, "IDR")}
+		return model.NewPayment(order, time.Now())
+	}
+
+	t.Run("approves", func(t *testing.T) {
+		server := httptest.NewServer(NewMockPaymentGateway(MockGatewayApprove, 0, 0))
+		defer server.Close()
+
+		charged := payment()
+		charge, err := NewHTTPPaymentGateway(server.URL, time.Second).Charge(charged)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if charge.Reference != charged.ID || charge.Amount != charged.Amount || charge.Status != model.ChargeStatusSucceeded {
+			t.Errorf("wrong charge: %+v", charge)
+		}
+	})
+
+	t.Run("declinesOnce", func(t *testing.T) {
+		mock := NewMockPaymentGateway(MockGatewayDecline, 0, 0)
+		server := httptest.NewServer(mock)
+		defer server.Close()
+
+		gateway := NewHTTPPaymentGateway(server.URL, time.Second)
+		charged := payment()
+		first, err := gateway.Charge(charged)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if first.Status != model.ChargeStatusDeclined || first.Reason == "" {
+			t.Errorf("wrong charge: %+v", first)
+		}
+
+		// Charging the same payment again returns the same charge, whatever the behaviour is by then
+		mock.SetBehaviour(MockGatewayApprove)
+		second, err := gateway.Charge(charged)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if *second != *first {
+			t.Errorf("charging twice returned %+v, then %+v", first, second)
+		}
+	})
+
+	t.Run("refundsOnce", func(t *testing.T) {
+		mock := NewMockPaymentGateway(MockGatewayApprove, 0, 0)
+		server := httptest.NewServer(mock)
+		defer server.Close()
+
+		gateway := NewHTTPPaymentGateway(server.URL, time.Second)
+		charged := payment()
+		if _, err := gateway.Refund(charged); err == nil {
+			t.Error("expected an error refunding a payment that was never charged")
+		}
+
+		charge, err := gateway.Charge(charged)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		charged.ChargeID = charge.ID
+
+		first, err := gateway.Refund(charged)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if first.Reference != charged.ID || first.ChargeID != charge.ID || first.Amount != charged.Amount {
+			t.Errorf("wrong refund: %+v", first)
+		}
+
+		second, err := gateway.Refund(charged)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if *second != *first || len(mock.Refunds()) != 1 {
+			t.Errorf("refunding twice returned %+v, then %+v", first, second)
+		}
+	})
+
+	t.Run("timesOutAndCallsBack", func(t *testing.T) {
+		var mux sync.Mutex
+		received := make([]model.PaymentCharge, 0)
+		callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var charge model.PaymentCharge
+			json.NewDecoder(r.Body).Decode(&charge)
+			mux.Lock()
+			received = append(received, charge)
+			mux.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer callback.Close()
+
+		mock := NewMockPaymentGateway(MockGatewayTimeout, 100*time.Millisecond, 1)
+		mock.SetCallbackURL(callback.URL)
+		server := httptest.NewServer(mock)
+		defer server.Close()
+
+		charged := payment()
+		if _, err := NewHTTPPaymentGateway(server.URL, 20*time.Millisecond).Charge(charged); err == nil {
+			t.Error("expected an error for a charge answered too late")
+		}
+
+		time.Sleep(200 * time.Millisecond)
+		mock.Wait()
+		mux.Lock()
+		defer mux.Unlock()
+		if len(received) != 2 {
+			t.Fatalf("wrong number of callbacks: got %d want 2", len(received))
+		}
+		for _, charge := range received {
+			if charge.Reference != charged.ID || charge.Status != model.ChargeStatusSucceeded {
+				t.Errorf("wrong charge called back: %+v", charge)
+			}
+		}
+	})
+
+}
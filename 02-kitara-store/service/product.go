@@ -0,0 +1,224 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Product is the service provider interface
+type Product interface {
+	Startup()
+	Shutdown()
+	ResolveByID(id uuid.UUID) (*model.Product, error)
+	ResolvePage(pageNum int, pageSize int) (*model.Page, error)
+	Create(input model.ProductInput) (*model.Product, error)
+	Update(id uuid.UUID, input model.ProductInput) (*model.Product, error)
+	Delete(id uuid.UUID) error
+}
+
+// ProductImpl is the service provider implementation
+type ProductImpl struct {
+	InventoryRepository repository.Inventory `inject:"inventoryRepository"`
+	ProductRepository   repository.Product   `inject:"productRepository"`
+	DB                  database.Transactor  `inject:"db"`
+}
+
+// Startup performs startup functions
+func (s *ProductImpl) Startup() {
+	logger.Trace("Product service starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *ProductImpl) Shutdown() {
+	logger.Trace("Product service shutting down...")
+}
+
+// ResolveByID resolves a Product by its ID. The available quantity of a bundle is derived from the inventory of its
+// components.
+func (s *ProductImpl) ResolveByID(id uuid.UUID) (*model.Product, error) {
+	product, err := s.resolveByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !product.IsBundle() {
+		return product, nil
+	}
+
+	inventories, err := s.InventoryRepository.ResolveByProductIDs(product.ComponentIDs())
+	if err != nil {
+		return nil, err
+	}
+
+	product.ShowAvailability(inventories)
+	return product, nil
+}
+
+// ResolvePage resolves a Page of Products based on page and page size parameters
+func (s *ProductImpl) ResolvePage(pageNum int, pageSize int) (*model.Page, error) {
+	return s.ProductRepository.ResolvePage(pageNum, pageSize)
+}
+
+// Create creates a new Product
+func (s *ProductImpl) Create(input model.ProductInput) (*model.Product, error) {
+	product := model.NewProductFromInput(input)
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateUniqueSKU(product); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateComponents(product); err != nil {
+		return nil, err
+	}
+
+	err := s.ProductRepository.Create(product)
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// Update updates an existing Product. A Product may only become a bundle if it has no inventory of its own and is
+// not a component of another bundle.
+func (s *ProductImpl) Update(id uuid.UUID, input model.ProductInput) (*model.Product, error) {
+	product, err := s.resolveByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	wasBundle := product.IsBundle()
+	product.Update(input)
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateUniqueSKU(*product); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateComponents(*product); err != nil {
+		return nil, err
+	}
+
+	if product.IsBundle() && !wasBundle {
+		if err := s.validateCanBecomeBundle(*product); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.ProductRepository.Update(*product)
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// Delete deletes a Product that is not referenced by any inventory, order or bundle. The Product is locked while its
+// references are checked and it is deleted, and the check keeps new references from being added in the meantime.
+func (s *ProductImpl) Delete(id uuid.UUID) error {
+	return s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		logger.Trace("locking product")
+		if _, err := s.ProductRepository.TxResolveByIDForUpdate(tx, id); err != nil {
+			e <- err
+			return
+		}
+
+		referenced, err := s.ProductRepository.TxIsReferenced(tx, id)
+		if err != nil {
+			e <- err
+			return
+		}
+
+		if referenced {
+			e <- failure.OperationNotPermitted("delete", "Product", "the product is referenced by inventory, orders or bundles")
+			return
+		}
+
+		logger.Trace("deleting product")
+		e <- s.ProductRepository.TxDelete(tx, id)
+	})
+}
+
+func (s *ProductImpl) resolveByID(id uuid.UUID) (*model.Product, error) {
+	products, err := s.ProductRepository.ResolveByIDs([]uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(products) == 0 {
+		return nil, failure.EntityNotFound("Product")
+	}
+
+	return &products[0], nil
+}
+
+// validateComponents checks that the components of a bundle exist and are not bundles themselves
+func (s *ProductImpl) validateComponents(product model.Product) error {
+	if !product.IsBundle() {
+		return nil
+	}
+
+	components, err := s.ProductRepository.ResolveByIDs(product.ComponentIDs())
+	if err != nil {
+		return err
+	}
+
+	if len(components) != len(product.Components) {
+		return failure.BadRequestFromString("bundle components must be existing products")
+	}
+
+	for _, component := range components {
+		if component.IsBundle() {
+			return failure.BadRequestFromString(fmt.Sprintf("bundle component %s must not be a bundle itself", component.SKU))
+		}
+	}
+
+	return nil
+}
+
+// validateCanBecomeBundle checks that a Product has no inventory of its own and is not a component of another bundle
+func (s *ProductImpl) validateCanBecomeBundle(product model.Product) error {
+	inventories, err := s.InventoryRepository.ResolveByProductIDs([]uuid.UUID{product.ID})
+	if err != nil {
+		return err
+	}
+
+	if len(inventories) > 0 {
+		return failure.OperationNotPermitted("update", "Product", "a product with inventory cannot become a bundle")
+	}
+
+	component, err := s.ProductRepository.IsComponent(product.ID)
+	if err != nil {
+		return err
+	}
+
+	if component {
+		return failure.OperationNotPermitted("update", "Product", "a bundle component cannot become a bundle")
+	}
+
+	return nil
+}
+
+func (s *ProductImpl) validateUniqueSKU(product model.Product) error {
+	exists, err := s.ProductRepository.ExistsBySKU(product.SKU, product.ID)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return failure.DuplicateEntity("Product", "SKU is already in use")
+	}
+
+	return nil
+}
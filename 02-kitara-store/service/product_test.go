@@ -0,0 +1,113 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/database"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func newMemoryProductImpl() (*ProductImpl, *repository.InventoryMemoryRepo) {
+	inventories := new(repository.InventoryMemoryRepo)
+	inventories.Startup()
+	orders := new(repository.OrderMemoryRepo)
+	orders.Startup()
+	products := &repository.ProductMemoryRepo{InventoryRepository: inventories, OrderRepository: orders}
+	products.Startup()
+
+	return &ProductImpl{
+		InventoryRepository: inventories,
+		ProductRepository:   products,
+		DB:                  new(database.Memory),
+	}, inventories
+}
+
+func TestProductUniqueSKU(t *testing.T) {
+
+	s, _ := newMemoryProductImpl()
+	first, err := s.Create(model.ProductInput{SKU: "SKU-1", Name: "First", Price: model.NewMoney(1000, "IDR")})
+	if err != nil {
+		t.Fatalf("failed to create the product: %v", err)
+	}
+	second, err := s.Create(model.ProductInput{SKU: "SKU-2", Name: "Second", Price: model.NewMoney(1000, "IDR")})
+	if err != nil {
+		t.Fatalf("failed to create the product: %v", err)
+	}
+
+	t.Run("create", func(t *testing.T) {
+		_, err := s.Create(model.ProductInput{SKU: "SKU-1", Name: "Duplicate", Price: model.NewMoney(1000, "IDR")})
+		if err == nil || failure.GetCode(err) != failure.CodeDuplicateEntity {
+			t.Errorf("creating a product with a used SKU returned %v", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		_, err := s.Update(second.ID, model.ProductInput{SKU: "SKU-1", Name: "Second", Price: model.NewMoney(1000, "IDR")})
+		if err == nil || failure.GetCode(err) != failure.CodeDuplicateEntity {
+			t.Errorf("updating a product to a used SKU returned %v", err)
+		}
+	})
+
+	t.Run("updateKeepingOwnSKU", func(t *testing.T) {
+		if _, err := s.Update(first.ID, model.ProductInput{SKU: "SKU-1", Name: "Renamed", Price: model.NewMoney(2000, "IDR")}); err != nil {
+			t.Errorf("updating a product without changing its SKU failed: %v", err)
+		}
+	})
+
+}
+
+func TestProductDelete(t *testing.T) {
+
+	s, inventories := newMemoryProductImpl()
+	create := func(sku string, components ...model.BundleComponentInput) *model.Product {
+		product, err := s.Create(model.ProductInput{SKU: sku, Name: sku, Price: model.NewMoney(1000, "IDR"), Components: components})
+		if err != nil {
+			t.Fatalf("failed to create product %s: %v", sku, err)
+		}
+		return product
+	}
+
+	stocked := create("STOCKED")
+	err := s.DB.WithTransaction(func(tx *database.Tx, e chan error) {
+		e <- inventories.TxCreate(tx, model.NewInventory(stocked.ID, uuid.Nil))
+	})
+	if err != nil {
+		t.Fatalf("failed to create the inventory: %v", err)
+	}
+	component := create("COMPONENT")
+	create("BUNDLE", model.BundleComponentInput{ProductID: component.ID, Qty: 2})
+	unused := create("UNUSED")
+	missing, _ := uuid.NewV4()
+
+	cases := []struct {
+		name string
+		id   uuid.UUID
+		code failure.Code
+	}{
+		{"withInventory", stocked.ID, failure.CodeOperationNotPermitted},
+		{"bundleComponent", component.ID, failure.CodeOperationNotPermitted},
+		{"missing", missing, failure.CodeEntityNotFound},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := s.Delete(c.id)
+			if err == nil || failure.GetCode(err) != c.code {
+				t.Errorf("delete returned %v, want code %v", err, c.code)
+			}
+		})
+	}
+
+	t.Run("unreferenced", func(t *testing.T) {
+		if err := s.Delete(unused.ID); err != nil {
+			t.Fatalf("deleting an unreferenced product failed: %v", err)
+		}
+		if _, err := s.ResolveByID(unused.ID); err == nil || failure.GetCode(err) != failure.CodeEntityNotFound {
+			t.Errorf("deleted product still resolves: %v", err)
+		}
+	})
+
+}
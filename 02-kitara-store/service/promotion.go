@@ -0,0 +1,114 @@
+package service
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// Promotion is the service provider interface
+type Promotion interface {
+	Startup()
+	Shutdown()
+	ResolveByID(id uuid.UUID) (*model.Promotion, error)
+	ResolvePage(pageNum int, pageSize int) (*model.Page, error)
+	Create(input model.PromotionInput) (*model.Promotion, error)
+	Update(id uuid.UUID, input model.PromotionInput) (*model.Promotion, error)
+}
+
+// PromotionImpl is the service provider implementation
+type PromotionImpl struct {
+	PromotionRepository repository.Promotion `inject:"promotionRepository"`
+}
+
+// Startup performs startup functions
+func (s *PromotionImpl) Startup() {
+	logger.Trace("Promotion service starting up...")
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *PromotionImpl) Shutdown() {
+	logger.Trace("Promotion service shutting down...")
+}
+
+// ResolveByID resolves a Promotion by its ID
+func (s *PromotionImpl) ResolveByID(id uuid.UUID) (*model.Promotion, error) {
+	promotions, err := s.PromotionRepository.ResolveByIDs([]uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(promotions) == 0 {
+		return nil, failure.EntityNotFound("Promotion")
+	}
+
+	return &promotions[0], nil
+}
+
+// ResolvePage resolves a Page of Promotions based on page and page size parameters
+func (s *PromotionImpl) ResolvePage(pageNum int, pageSize int) (*model.Page, error) {
+	return s.PromotionRepository.ResolvePage(pageNum, pageSize)
+}
+
+// Create creates a new Promotion
+func (s *PromotionImpl) Create(input model.PromotionInput) (*model.Promotion, error) {
+	promotion := model.NewPromotionFromInput(input)
+	if err := promotion.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateUniqueCode(promotion); err != nil {
+		return nil, err
+	}
+
+	err := s.PromotionRepository.Create(promotion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &promotion, nil
+}
+
+// Update updates an existing Promotion. Its usage count is kept, and Orders already created with the Promotion
+// keep the discounts they were given.
+func (s *PromotionImpl) Update(id uuid.UUID, input model.PromotionInput) (*model.Promotion, error) {
+	promotion, err := s.ResolveByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	promotion.Update(input)
+	if err := promotion.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateUniqueCode(*promotion); err != nil {
+		return nil, err
+	}
+
+	err = s.PromotionRepository.Update(*promotion)
+	if err != nil {
+		return nil, err
+	}
+
+	return promotion, nil
+}
+
+func (s *PromotionImpl) validateUniqueCode(promotion model.Promotion) error {
+	if !promotion.IsVoucher() {
+		return nil
+	}
+
+	exists, err := s.PromotionRepository.ExistsByCode(promotion.Code, promotion.ID)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return failure.DuplicateEntity("Promotion", "code is already in use")
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// EventSink is the interface of a destination outbox events are published to.
+// Delivery is at-least-once, so a sink may receive the same event more than once and should deduplicate by its ID.
+type EventSink interface {
+	Publish(event model.OutboxEvent) error
+}
+
+// NewEventSink creates the event sink selected in the configuration
+func NewEventSink(conf *config.Config) EventSink {
+	switch conf.Outbox.Sink {
+	case config.OutboxSinkHTTP:
+		return NewHTTPSink(conf.Outbox.HTTPURL, conf.Outbox.HTTPTimeout)
+	case config.OutboxSinkMemory:
+		return new(MemorySink)
+	default:
+		return new(LogSink)
+	}
+}
+
+// LogSink publishes events to the application log
+type LogSink struct{}
+
+// Publish writes an event to the application log
+func (s *LogSink) Publish(event model.OutboxEvent) error {
+	logger.Info("event %s %s on %s %s: %s", event.ID, event.EventType, event.AggregateType, event.AggregateID, event.Payload)
+	return nil
+}
+
+// HTTPSink publishes events by posting them as JSON to an HTTP endpoint
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPSink creates an HTTP sink that posts to the specified URL
+func NewHTTPSink(url string, timeout time.Duration) *HTTPSink {
+	return &HTTPSink{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Publish posts an event to the endpoint. Any response other than 2xx is treated as a failure.
+func (s *HTTPSink) Publish(event model.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", event.ID.String())
+	req.Header.Set("X-Event-Type", event.EventType)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("event sink responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// MemorySink keeps published events in memory so tests can inspect them
+type MemorySink struct {
+	mux    sync.Mutex
+	events []model.OutboxEvent
+}
+
+// Publish stores an event in memory
+func (s *MemorySink) Publish(event model.OutboxEvent) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns the events published so far, in the order they were published
+func (s *MemorySink) Events() []model.OutboxEvent {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	events := make([]model.OutboxEvent, len(s.events))
+	copy(events, s.events)
+	return events
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/model"
+)
+
+func TestHTTPSink(t *testing.T) {
+
+	event, err := model.NewOutboxEvent(model.AggregateTypeOrder, uuid.Must(uuid.NewV4()), model.EventTypeOrderProcessed, map[string]string{"code": "EVM-TEST-ORDER-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("delivers", func(t *testing.T) {
+		var received model.OutboxEvent
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Event-ID") != event.ID.String() {
+				t.Errorf("wrong event ID header: got %v want %v", r.Header.Get("X-Event-ID"), event.ID)
+			}
+			json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		if err := NewHTTPSink(server.URL, time.Second).Publish(event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if received.ID != event.ID || string(received.Payload) != string(event.Payload) {
+			t.Errorf("wrong event received: got %+v want %+v", received, event)
+		}
+	})
+
+	t.Run("failsOnErrorResponse", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		if err := NewHTTPSink(server.URL, time.Second).Publish(event); err == nil {
+			t.Error("expected an error for a 503 response")
+		}
+	})
+
+}
+
+func TestMemorySink(t *testing.T) {
+
+	sink := new(MemorySink)
+	for i := 0; i < 3; i++ {
+		event, _ := model.NewOutboxEvent(model.AggregateTypeInventory, uuid.Must(uuid.NewV4()), model.EventTypeInventoryReserved, i)
+		sink.Publish(event)
+	}
+
+	events := sink.Events()
+	if len(events) != 3 {
+		t.Fatalf("wrong number of events: got %v want 3", len(events))
+	}
+
+	for i, event := range events {
+		if string(event.Payload) != strconv.Itoa(i) {
+			t.Errorf("events out of order: got payload %s at position %v", event.Payload, i)
+		}
+	}
+
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// StockGate is the service provider interface for the flash-sale stock gate
+type StockGate interface {
+	Startup()
+	Shutdown()
+	Enabled() bool
+	Acquire(qtyMap map[uuid.UUID]int) (release func(), err error)
+	Resync()
+}
+
+// StockGateImpl is the service provider implementation.
+// It keeps an in-memory counter of the available quantity of every flash-sale Product so that requests for a
+// Product that has sold out are rejected without touching the database. The counters only filter requests:
+// the database transaction still decides whether stock is reserved, so a counter that runs ahead of the database
+// never oversells. Counters are reloaded from the database periodically, picking up restocks, released
+// reservations and anything a crashed request left behind.
+type StockGateImpl struct {
+	InventoryRepository repository.Inventory `inject:"inventoryRepository"`
+	config              *config.Config
+	counters            map[uuid.UUID]*int64
+	stop                chan struct{}
+	done                sync.WaitGroup
+}
+
+// Startup performs startup functions
+func (g *StockGateImpl) Startup() {
+	logger.Trace("Stock gate starting up...")
+	g.config = config.Get()
+	g.counters = make(map[uuid.UUID]*int64)
+	for _, productID := range g.config.FlashSale.ProductIDs {
+		id, err := uuid.FromString(productID)
+		if err != nil {
+			logger.Fatal("Invalid flash sale product ID %s: %v", productID, err)
+		}
+		g.counters[id] = new(int64)
+	}
+
+	if len(g.counters) == 0 {
+		logger.Info("Flash sale mode is disabled.")
+		return
+	}
+
+	g.Resync()
+	g.stop = make(chan struct{})
+	g.done.Add(1)
+	go g.run()
+}
+
+// Shutdown cleans up everything and shuts down
+func (g *StockGateImpl) Shutdown() {
+	logger.Trace("Stock gate shutting down...")
+	if g.stop != nil {
+		close(g.stop)
+		g.done.Wait()
+		g.stop = nil
+	}
+}
+
+// Enabled checks whether any Product is in flash-sale mode
+func (g *StockGateImpl) Enabled() bool {
+	return len(g.counters) > 0
+}
+
+// Acquire takes the specified quantities of flash-sale Products off their counters, ignoring other Products.
+// If any of them does not have enough left, nothing is taken and a sold out failure is returned. Otherwise the
+// caller must call release if the quantities end up not being reserved in the database.
+func (g *StockGateImpl) Acquire(qtyMap map[uuid.UUID]int) (release func(), err error) {
+	acquired := make(map[uuid.UUID]int64)
+	release = func() {
+		for productID, qty := range acquired {
+			atomic.AddInt64(g.counters[productID], qty)
+		}
+	}
+
+	for productID, qty := range qtyMap {
+		counter, ok := g.counters[productID]
+		if !ok {
+			continue
+		}
+
+		if !takeFromCounter(counter, int64(qty)) {
+			release()
+			return nil, failure.SoldOut(fmt.Sprintf("Product %s is sold out", productID))
+		}
+		acquired[productID] = int64(qty)
+	}
+
+	return release, nil
+}
+
+// Resync reloads the counters of all flash-sale Products from their available quantity in the database
+func (g *StockGateImpl) Resync() {
+	if len(g.counters) == 0 {
+		return
+	}
+
+	productIDs := make([]uuid.UUID, 0)
+	for productID := range g.counters {
+		productIDs = append(productIDs, productID)
+	}
+
+	inventories, err := g.InventoryRepository.ResolveByProductIDs(productIDs)
+	if err != nil {
+		logger.ErrNoStack("failed resyncing stock gate: %v", err)
+		return
+	}
+
+	availableMap := make(map[uuid.UUID]int64)
+	for _, inventory := range inventories {
+		availableMap[inventory.ProductID] += int64(inventory.QtyAvailable)
+	}
+
+	for productID, counter := range g.counters {
+		atomic.StoreInt64(counter, availableMap[productID])
+	}
+}
+
+func (g *StockGateImpl) run() {
+	defer g.done.Done()
+	ticker := time.NewTicker(g.config.FlashSale.ResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			g.Resync()
+		}
+	}
+}
+
+// takeFromCounter atomically decreases a counter by qty unless that would take it below zero
+func takeFromCounter(counter *int64, qty int64) bool {
+	for {
+		current := atomic.LoadInt64(counter)
+		if current < qty {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(counter, current, current-qty) {
+			return true
+		}
+	}
+}
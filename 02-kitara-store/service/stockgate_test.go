@@ -0,0 +1,77 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+func newTestStockGate(stock map[uuid.UUID]int64) *StockGateImpl {
+	gate := &StockGateImpl{counters: make(map[uuid.UUID]*int64)}
+	for productID, qty := range stock {
+		counter := qty
+		gate.counters[productID] = &counter
+	}
+	return gate
+}
+
+func TestStockGate(t *testing.T) {
+
+	flashProduct, _ := uuid.NewV4()
+	otherProduct, _ := uuid.NewV4()
+
+	t.Run("acquireAndRelease", func(t *testing.T) {
+		gate := newTestStockGate(map[uuid.UUID]int64{flashProduct: 3})
+
+		release, err := gate.Acquire(map[uuid.UUID]int{flashProduct: 2, otherProduct: 10})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if left := atomic.LoadInt64(gate.counters[flashProduct]); left != 1 {
+			t.Errorf("wrong counter after acquire: got %v want %v", left, 1)
+		}
+
+		release()
+		if left := atomic.LoadInt64(gate.counters[flashProduct]); left != 3 {
+			t.Errorf("wrong counter after release: got %v want %v", left, 3)
+		}
+	})
+
+	t.Run("soldOut", func(t *testing.T) {
+		secondFlashProduct, _ := uuid.NewV4()
+		gate := newTestStockGate(map[uuid.UUID]int64{flashProduct: 5, secondFlashProduct: 1})
+
+		_, err := gate.Acquire(map[uuid.UUID]int{flashProduct: 2, secondFlashProduct: 2})
+		if failure.GetCode(err) != failure.CodeSoldOut {
+			t.Fatalf("wrong error: got %v want %v", err, failure.CodeSoldOut)
+		}
+		if left := atomic.LoadInt64(gate.counters[flashProduct]); left != 5 {
+			t.Errorf("counter was not restored after sold out: got %v want %v", left, 5)
+		}
+	})
+
+	t.Run("concurrentNeverOverAdmits", func(t *testing.T) {
+		gate := newTestStockGate(map[uuid.UUID]int64{flashProduct: 100})
+
+		var admitted int64
+		var wg sync.WaitGroup
+		for i := 0; i < 1000; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := gate.Acquire(map[uuid.UUID]int{flashProduct: 1}); err == nil {
+					atomic.AddInt64(&admitted, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if admitted != 100 {
+			t.Errorf("wrong number of admitted requests: got %v want %v", admitted, 100)
+		}
+	})
+
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/repository"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+	"github.com/kerti/evm/02-kitara-store/util/logger"
+)
+
+// ReservationSweeper is the service provider interface for expiring lapsed reservations
+type ReservationSweeper interface {
+	Startup()
+	Shutdown()
+	Sweep() (expired int)
+}
+
+// ReservationSweeperImpl is the service provider implementation.
+// It periodically expires orders that have been processing for longer than the configured TTL,
+// returning their reserved inventory to the available pool.
+type ReservationSweeperImpl struct {
+	OrderRepository repository.Order `inject:"orderRepository"`
+	OrderService    Order            `inject:"orderService"`
+	config          *config.Config
+	stop            chan struct{}
+	done            sync.WaitGroup
+}
+
+// Startup performs startup functions
+func (s *ReservationSweeperImpl) Startup() {
+	logger.Trace("Reservation sweeper starting up...")
+	s.config = config.Get()
+	if !s.config.Reservation.SweepEnabled {
+		logger.Info("Reservation sweeper is disabled.")
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done.Add(1)
+	go s.run()
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *ReservationSweeperImpl) Shutdown() {
+	logger.Trace("Reservation sweeper shutting down...")
+	if s.stop != nil {
+		close(s.stop)
+		s.done.Wait()
+		s.stop = nil
+	}
+}
+
+// Sweep expires a single batch of lapsed reservations and returns how many orders were expired.
+// It is safe to run on several replicas at once: each order is expired through the same transition as
+// any other status change, so an order already expired, completed or cancelled elsewhere is simply skipped.
+func (s *ReservationSweeperImpl) Sweep() (expired int) {
+	cutoff := time.Now().Add(-s.config.Reservation.TTL)
+	ids, err := s.OrderRepository.ResolveExpiredIDs(cutoff, s.config.Reservation.SweepBatchSize)
+	if err != nil {
+		logger.ErrNoStack("failed resolving expired reservations: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		_, err := s.OrderService.Expire(id)
+		switch failure.GetCode(err) {
+		case failure.CodeOperationNotPermitted, failure.CodeVersionConflict, failure.CodeEntityNotFound:
+			logger.Debug("order %s was transitioned elsewhere, skipping: %v", id, err)
+		default:
+			if err != nil {
+				logger.ErrNoStack("failed expiring order %s: %v", id, err)
+				continue
+			}
+			logger.Info("expired reservation of order %s", id)
+			expired++
+		}
+	}
+
+	return
+}
+
+func (s *ReservationSweeperImpl) run() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.config.Reservation.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
+
+// HoldSweeper is the service provider interface for releasing expired Cart holds
+type HoldSweeper interface {
+	Startup()
+	Shutdown()
+	Sweep() (released int)
+}
+
+// HoldSweeperImpl is the service provider implementation.
+// It periodically releases the holds of Carts that have expired, returning the held inventory to the available pool.
+type HoldSweeperImpl struct {
+	CartRepository repository.Cart `inject:"cartRepository"`
+	CartService    Cart            `inject:"cartService"`
+	config         *config.Config
+	stop           chan struct{}
+	done           sync.WaitGroup
+}
+
+// Startup performs startup functions
+func (s *HoldSweeperImpl) Startup() {
+	logger.Trace("Hold sweeper starting up...")
+	s.config = config.Get()
+	if !s.config.Cart.HoldSweepEnabled {
+		logger.Info("Hold sweeper is disabled.")
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done.Add(1)
+	go s.run()
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *HoldSweeperImpl) Shutdown() {
+	logger.Trace("Hold sweeper shutting down...")
+	if s.stop != nil {
+		close(s.stop)
+		s.done.Wait()
+		s.stop = nil
+	}
+}
+
+// Sweep releases the expired holds of a single batch of Carts and returns how many holds were released.
+// It is safe to run on several replicas at once: each Cart is locked while its holds are released, and holds
+// released elsewhere in the meantime are simply no longer there.
+func (s *HoldSweeperImpl) Sweep() (released int) {
+	ids, err := s.CartRepository.ResolveIDsWithExpiredHolds(time.Now(), s.config.Cart.HoldSweepBatchSize)
+	if err != nil {
+		logger.ErrNoStack("failed resolving carts with expired holds: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		count, err := s.CartService.ExpireHolds(id)
+		if err != nil {
+			logger.ErrNoStack("failed releasing expired holds of cart %s: %v", id, err)
+			continue
+		}
+
+		if count > 0 {
+			logger.Info("released %d expired holds of cart %s", count, id)
+			released += count
+		}
+	}
+
+	return
+}
+
+func (s *HoldSweeperImpl) run() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.config.Cart.HoldSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
+
+// PaymentSweeper is the service provider interface for reconciling Payments left unsettled
+type PaymentSweeper interface {
+	Startup()
+	Shutdown()
+	Sweep() (reconciled int)
+}
+
+// PaymentSweeperImpl is the service provider implementation.
+// It periodically reconciles Payments that have been pending for longer than the configured timeout with the
+// gateway, settling them with their charge or failing them if the gateway never received it, and retries the
+// refunds the gateway failed to make.
+type PaymentSweeperImpl struct {
+	PaymentRepository repository.Payment `inject:"paymentRepository"`
+	PaymentService    Payment            `inject:"paymentService"`
+	config            *config.Config
+	stop              chan struct{}
+	done              sync.WaitGroup
+}
+
+// Startup performs startup functions
+func (s *PaymentSweeperImpl) Startup() {
+	logger.Trace("Payment sweeper starting up...")
+	s.config = config.Get()
+	if !s.config.Payment.SweepEnabled {
+		logger.Info("Payment sweeper is disabled.")
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done.Add(1)
+	go s.run()
+}
+
+// Shutdown cleans up everything and shuts down
+func (s *PaymentSweeperImpl) Shutdown() {
+	logger.Trace("Payment sweeper shutting down...")
+	if s.stop != nil {
+		close(s.stop)
+		s.done.Wait()
+		s.stop = nil
+	}
+}
+
+// Sweep reconciles a single batch of unsettled Payments and returns how many were settled or refunded.
+// It is safe to run on several replicas at once: each Payment is settled along with its order the same way as by
+// the gateway's webhook, so a Payment settled elsewhere in the meantime is simply skipped.
+func (s *PaymentSweeperImpl) Sweep() (reconciled int) {
+	cutoff := time.Now().Add(-s.config.Payment.PendingTimeout)
+	ids, err := s.PaymentRepository.ResolveUnsettledIDs(cutoff, s.config.Payment.SweepBatchSize)
+	if err != nil {
+		logger.ErrNoStack("failed resolving unsettled payments: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		payment, err := s.PaymentService.Reconcile(id)
+		switch failure.GetCode(err) {
+		case failure.CodeOperationNotPermitted, failure.CodeVersionConflict:
+			logger.Debug("payment %s was settled elsewhere, skipping: %v", id, err)
+		default:
+			if err != nil {
+				logger.ErrNoStack("failed reconciling payment %s: %v", id, err)
+				continue
+			}
+			if payment.Status == model.PaymentStatusPending || payment.Status == model.PaymentStatusRefundPending {
+				continue
+			}
+			logger.Info("reconciled payment %s, which is now %s", id, payment.Status)
+			reconciled++
+		}
+	}
+
+	return
+}
+
+func (s *PaymentSweeperImpl) run() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.config.Payment.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package concurrency
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/model"
+)
+
+const (
+	componentAStock  = 10
+	componentBStock  = 12
+	componentAPerKit = 2
+	componentBPerKit = 3
+	kitOrders        = 6
+	looseOrders      = 4
+)
+
+func TestConcurrentBundleOrders(t *testing.T) {
+
+	forEachStrategy(t, testConcurrentBundleOrders)
+
+}
+
+func testConcurrentBundleOrders(t *testing.T) {
+	s := startStore(t)
+
+	var componentA, componentB, kit model.Product
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-PART-A", Name: "Harness Part A", Price: model.NewMoney(1000, "IDR")}, &componentA)
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-PART-B", Name: "Harness Part B", Price: model.NewMoney(1000, "IDR")}, &componentB)
+	s.mustPost(t, restockPath(componentA.ID), model.InventoryRestockInput{Qty: componentAStock}, nil)
+	s.mustPost(t, restockPath(componentB.ID), model.InventoryRestockInput{Qty: componentBStock}, nil)
+	s.mustPost(t, "/products", model.ProductInput{
+		SKU:   "HARNESS-KIT",
+		Name:  "Harness Kit",
+		Price: model.NewMoney(4000, "IDR"),
+		Components: []model.BundleComponentInput{
+			{ProductID: componentA.ID, Qty: componentAPerKit},
+			{ProductID: componentB.ID, Qty: componentBPerKit},
+		},
+	}, &kit)
+
+	s.expectKitAvailability(t, kit.ID)
+	if status := s.post(t, restockPath(kit.ID), model.InventoryRestockInput{Qty: 1}, nil); status != http.StatusConflict {
+		t.Errorf("restocking a bundle returned status %d", status)
+	}
+
+	// Orders for the kit compete with orders for one of its components, asking for more than there is in total
+	kitOrderIDs := make(map[uuid.UUID]bool)
+	orderIDs := make([]uuid.UUID, 0)
+	for idx := 0; idx < kitOrders+looseOrders; idx++ {
+		productID := componentA.ID
+		if idx < kitOrders {
+			productID = kit.ID
+		}
+
+		var order model.Order
+		s.mustPost(t, "/orders", model.OrderInput{Items: []model.OrderItemInput{{ProductID: productID, Qty: 1}}}, &order)
+		orderIDs = append(orderIDs, order.ID)
+		kitOrderIDs[order.ID] = productID == kit.ID
+	}
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, orderID := range orderIDs {
+		wg.Add(1)
+		go func(orderID uuid.UUID) {
+			defer wg.Done()
+			<-start
+			status := s.post(t, "/orders/process", model.OrderProcessInput{OrderID: orderID}, nil)
+			if status != http.StatusOK && status != http.StatusConflict {
+				t.Errorf("processing order %s returned status %d", orderID, status)
+			}
+		}(orderID)
+	}
+	close(start)
+	wg.Wait()
+
+	// A kit order reserves every component in full or nothing at all
+	reserved := make(map[uuid.UUID]int)
+	for _, orderID := range orderIDs {
+		order, err := s.Orders.ResolveByID(orderID)
+		if err != nil {
+			t.Fatalf("failed to resolve order %s: %v", orderID, err)
+		}
+
+		allocated := make(map[uuid.UUID]int)
+		for _, allocation := range order.Allocations {
+			allocated[allocation.ProductID] += allocation.Qty
+			reserved[allocation.ProductID] += allocation.Qty
+		}
+
+		expected := map[uuid.UUID]int{componentA.ID: 1}
+		if kitOrderIDs[orderID] {
+			expected = map[uuid.UUID]int{componentA.ID: componentAPerKit, componentB.ID: componentBPerKit}
+		}
+		if order.Status != model.OrderStatusProcessing {
+			expected = map[uuid.UUID]int{}
+		}
+		if fmt.Sprint(allocated) != fmt.Sprint(expected) {
+			t.Errorf("order %s is %s with %v allocated instead of %v", orderID, order.Status, allocated, expected)
+		}
+	}
+
+	for _, productID := range []uuid.UUID{componentA.ID, componentB.ID} {
+		if inventory := s.inventoryOf(t, productID); inventory.QtyReserved != reserved[productID] || inventory.QtyAvailable < 0 {
+			t.Errorf("inventory %+v does not match the %d reserved by orders", inventory, reserved[productID])
+		}
+	}
+	s.expectKitAvailability(t, kit.ID)
+
+	var cart model.Cart
+	s.mustPost(t, "/carts", model.CartInput{}, &cart)
+	if status := s.post(t, fmt.Sprintf("/carts/%s/lines", cart.ID), model.CartLineInput{ProductID: kit.ID, Qty: 1, Hold: true}, nil); status != http.StatusConflict {
+		t.Errorf("holding a bundle returned status %d", status)
+	}
+}
+
+// expectKitAvailability checks that a kit shows how many of it its components can still make
+func (s *store) expectKitAvailability(t *testing.T, kitID uuid.UUID) {
+	var kit model.Product
+	s.get(t, fmt.Sprintf("/products/%s", kitID), &kit)
+	if kit.QtyAvailable == nil || len(kit.Components) != 2 {
+		t.Fatalf("bundle %s does not show its availability: %+v", kitID, kit)
+	}
+
+	expected := -1
+	for _, component := range kit.Components {
+		if qty := s.inventoryOf(t, component.ProductID).QtyAvailable / component.Qty; expected < 0 || qty < expected {
+			expected = qty
+		}
+	}
+	if *kit.QtyAvailable != expected {
+		t.Errorf("bundle %s shows %d available instead of %d", kitID, *kit.QtyAvailable, expected)
+	}
+}
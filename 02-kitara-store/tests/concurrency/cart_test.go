@@ -0,0 +1,308 @@
+package concurrency
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const (
+	heldStock      = 10
+	holdingCarts   = 20
+	competingOrder = 10
+	holdWaitTime   = 5 * time.Second
+)
+
+func TestConcurrentCartHolds(t *testing.T) {
+
+	forEachStrategy(t, testConcurrentCartHolds)
+
+}
+
+func testConcurrentCartHolds(t *testing.T) {
+	s := startStore(t)
+
+	var product model.Product
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-CART", Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &product)
+	s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: heldStock}, nil)
+
+	carts := make([]model.Cart, holdingCarts)
+	for idx := range carts {
+		s.mustPost(t, "/carts", model.CartInput{}, &carts[idx])
+	}
+
+	orderIDs := make([]uuid.UUID, competingOrder)
+	for idx := range orderIDs {
+		var order model.Order
+		s.mustPost(t, "/orders", model.OrderInput{Items: []model.OrderItemInput{{ProductID: product.ID, Qty: 1}}}, &order)
+		orderIDs[idx] = order.ID
+	}
+
+	// Every cart tries to hold one unit while orders are processed for the same product, asking for more than
+	// there is in total
+	held := make([]bool, len(carts))
+	var processed int
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	for idx := range carts {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			var cart model.Cart
+			status := s.post(t, fmt.Sprintf("/carts/%s/lines", carts[idx].ID), model.CartLineInput{ProductID: product.ID, Qty: 1, Hold: true}, &cart)
+			switch status {
+			case http.StatusOK:
+				held[idx] = true
+				if len(cart.Lines) != 1 || cart.Lines[0].QtyHeld != 1 || cart.Lines[0].HoldExpiresAt == nil {
+					t.Errorf("cart %s held nothing: %+v", cart.ID, cart.Lines)
+				}
+			case http.StatusConflict:
+			default:
+				t.Errorf("holding for cart %s returned status %d", carts[idx].ID, status)
+			}
+		}(idx)
+	}
+	for _, orderID := range orderIDs {
+		wg.Add(1)
+		go func(orderID uuid.UUID) {
+			defer wg.Done()
+			status := s.post(t, "/orders/process", model.OrderProcessInput{OrderID: orderID}, nil)
+			switch status {
+			case http.StatusOK:
+				mux.Lock()
+				processed++
+				mux.Unlock()
+			case http.StatusConflict:
+			default:
+				t.Errorf("processing order %s returned status %d", orderID, status)
+			}
+		}(orderID)
+	}
+	wg.Wait()
+
+	heldCount := 0
+	for _, isHeld := range held {
+		if isHeld {
+			heldCount++
+		}
+	}
+	t.Logf("%d carts held stock and %d orders were processed", heldCount, processed)
+
+	// The stock went to holds and orders exactly once
+	inventory := s.inventoryOf(t, product.ID)
+	if heldCount+processed != heldStock || inventory.QtyHeld != heldCount || inventory.QtyReserved != processed ||
+		inventory.QtyAvailable != 0 {
+		t.Errorf("%d holds and %d processed orders do not match the inventory: %+v", heldCount, processed, inventory)
+	}
+	s.expectLedgerMatches(t, inventory)
+
+	// Checking out turns every hold into a reservation of a processed order
+	for idx, cart := range carts {
+		if !held[idx] {
+			continue
+		}
+
+		wg.Add(1)
+		go func(cart model.Cart) {
+			defer wg.Done()
+			var order model.Order
+			if status := s.post(t, fmt.Sprintf("/carts/%s/checkout", cart.ID), model.CartCheckoutInput{}, &order); status != http.StatusCreated {
+				t.Errorf("checking out cart %s returned status %d", cart.ID, status)
+				return
+			}
+			if order.Status != model.OrderStatusProcessing || len(order.Allocations) != 1 {
+				t.Errorf("checking out cart %s left order %+v", cart.ID, order)
+			}
+		}(cart)
+	}
+	wg.Wait()
+
+	inventory = s.inventoryOf(t, product.ID)
+	if inventory.QtyHeld != 0 || inventory.QtyReserved != heldStock || inventory.QtyAvailable != 0 {
+		t.Errorf("holds were not turned into reservations: %+v", inventory)
+	}
+	s.expectLedgerMatches(t, inventory)
+
+	for idx, cart := range carts {
+		if held[idx] {
+			if status := s.post(t, fmt.Sprintf("/carts/%s/lines", cart.ID), model.CartLineInput{ProductID: product.ID, Qty: 1}, nil); status != http.StatusConflict {
+				t.Errorf("adding to a checked out cart returned status %d", status)
+			}
+			break
+		}
+	}
+}
+
+func TestCartHoldExpiry(t *testing.T) {
+	conf := config.Get()
+	holdTTL, sweepEnabled, sweepInterval := conf.Cart.HoldTTL, conf.Cart.HoldSweepEnabled, conf.Cart.HoldSweepInterval
+	conf.Cart.HoldTTL, conf.Cart.HoldSweepEnabled, conf.Cart.HoldSweepInterval = 50*time.Millisecond, true, 5*time.Millisecond
+	t.Cleanup(func() {
+		conf.Cart.HoldTTL, conf.Cart.HoldSweepEnabled, conf.Cart.HoldSweepInterval = holdTTL, sweepEnabled, sweepInterval
+	})
+	s := startStore(t)
+
+	var product model.Product
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-EXPIRY", Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &product)
+	s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: 3}, nil)
+
+	var first, second model.Cart
+	s.mustPost(t, "/carts", model.CartInput{}, &first)
+	s.mustPost(t, "/carts", model.CartInput{}, &second)
+
+	// Removing a line releases its hold right away
+	s.mustPost(t, fmt.Sprintf("/carts/%s/lines", first.ID), model.CartLineInput{ProductID: product.ID, Qty: 3, Hold: true}, &first)
+	if status := s.post(t, fmt.Sprintf("/carts/%s/lines", second.ID), model.CartLineInput{ProductID: product.ID, Qty: 1, Hold: true}, nil); status != http.StatusConflict {
+		t.Errorf("holding stock held by another cart returned status %d", status)
+	}
+	if status := s.delete(t, fmt.Sprintf("/carts/%s/lines/%s", first.ID, first.Lines[0].ID), &first); status != http.StatusOK || len(first.Lines) != 0 {
+		t.Errorf("removing the line returned status %d with %+v", status, first.Lines)
+	}
+	if inventory := s.inventoryOf(t, product.ID); inventory.QtyHeld != 0 || inventory.QtyAvailable != 3 {
+		t.Errorf("removing the line did not release its hold: %+v", inventory)
+	}
+
+	// A hold left alone expires and is released by the sweeper
+	s.mustPost(t, fmt.Sprintf("/carts/%s/lines", second.ID), model.CartLineInput{ProductID: product.ID, Qty: 2, Hold: true}, nil)
+	deadline := time.Now().Add(holdWaitTime)
+	for s.inventoryOf(t, product.ID).QtyHeld != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("hold was not released after %v", holdWaitTime)
+		}
+		time.Sleep(conf.Cart.HoldSweepInterval)
+	}
+
+	var resolved model.Cart
+	s.get(t, fmt.Sprintf("/carts/%s", second.ID), &resolved)
+	if len(resolved.Lines) != 1 || resolved.Lines[0].QtyHeld != 0 || resolved.Lines[0].QtyAvailable != 3 {
+		t.Errorf("expired cart shows %+v", resolved.Lines)
+	}
+
+	// Without holds, checking out leaves the order new
+	var order model.Order
+	if status := s.post(t, fmt.Sprintf("/carts/%s/checkout", second.ID), nil, &order); status != http.StatusCreated {
+		t.Fatalf("checking out returned status %d", status)
+	}
+	if order.Status != model.OrderStatusNew || len(order.Items) != 1 || order.Items[0].Qty != 2 {
+		t.Errorf("checking out created %+v", order)
+	}
+	if status := s.post(t, fmt.Sprintf("/carts/%s/checkout", second.ID), nil, nil); status != http.StatusConflict {
+		t.Errorf("checking out twice returned status %d", status)
+	}
+}
+
+func TestGatedCartCheckouts(t *testing.T) {
+
+	forEachStrategy(t, testGatedCartCheckouts)
+
+}
+
+func testGatedCartCheckouts(t *testing.T) {
+	// The gate is only resynced on demand, so its counters must follow every reservation on their own
+	productID, _ := uuid.NewV4()
+	conf := config.Get()
+	productIDs, resyncInterval := conf.FlashSale.ProductIDs, conf.FlashSale.ResyncInterval
+	conf.FlashSale.ProductIDs, conf.FlashSale.ResyncInterval = []string{productID.String()}, time.Hour
+	t.Cleanup(func() {
+		conf.FlashSale.ProductIDs, conf.FlashSale.ResyncInterval = productIDs, resyncInterval
+	})
+
+	s := startStore(t)
+	orders := s.service("orderService").(service.Order)
+
+	s.mustPost(t, "/products", model.ProductInput{ID: productID, SKU: "HARNESS-GATED-CART", Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, nil)
+	s.mustPost(t, restockPath(productID), model.InventoryRestockInput{Qty: heldStock}, nil)
+	s.service("stockGate").(service.StockGate).Resync()
+
+	carts := make([]model.Cart, heldStock/2)
+	for idx := range carts {
+		s.mustPost(t, "/carts", model.CartInput{}, &carts[idx])
+		s.mustPost(t, fmt.Sprintf("/carts/%s/lines", carts[idx].ID), model.CartLineInput{ProductID: productID, Qty: 1, Hold: true}, nil)
+	}
+
+	orderIDs := make([]uuid.UUID, heldStock-len(carts)+1)
+	for idx := range orderIDs {
+		var order model.Order
+		s.mustPost(t, "/orders", model.OrderInput{Items: []model.OrderItemInput{{ProductID: productID, Qty: 1}}}, &order)
+		orderIDs[idx] = order.ID
+	}
+
+	// Every cart is checked out while gated orders ask for the rest of the stock
+	processed := make([]bool, len(orderIDs))
+	var wg sync.WaitGroup
+	for _, cart := range carts {
+		wg.Add(1)
+		go func(cart model.Cart) {
+			defer wg.Done()
+			if status := s.post(t, fmt.Sprintf("/carts/%s/checkout", cart.ID), model.CartCheckoutInput{}, nil); status != http.StatusCreated {
+				t.Errorf("checking out cart %s returned status %d", cart.ID, status)
+			}
+		}(cart)
+	}
+	for idx := range orderIDs[1:] {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			status := s.post(t, "/orders/process", model.OrderProcessInput{OrderID: orderIDs[idx]}, nil)
+			switch status {
+			case http.StatusOK:
+				processed[idx] = true
+			case http.StatusConflict:
+			default:
+				t.Errorf("processing order %s returned status %d", orderIDs[idx], status)
+			}
+		}(idx + 1)
+	}
+	wg.Wait()
+
+	// The remaining orders take what is left one at a time, until the gate itself turns them away without letting
+	// them reach the database
+	soldOut := 0
+	for idx, orderID := range orderIDs {
+		if processed[idx] {
+			continue
+		}
+
+		_, err := orders.Process(model.OrderProcessInput{OrderID: orderID})
+		if err == nil {
+			continue
+		}
+		if failure.GetCode(err) != failure.CodeSoldOut {
+			t.Errorf("processing order %s past the gate failed: %v", orderID, err)
+		}
+		soldOut++
+	}
+
+	inventory := s.inventoryOf(t, productID)
+	if soldOut != 1 || inventory.QtyHeld != 0 || inventory.QtyReserved != heldStock || inventory.QtyAvailable != 0 {
+		t.Errorf("%d orders were sold out with the inventory at %+v", soldOut, inventory)
+	}
+	s.expectLedgerMatches(t, inventory)
+}
+
+// expectLedgerMatches checks that the stock rebuilt from the movements of an inventory's product matches it
+func (s *store) expectLedgerMatches(t *testing.T, inventory model.Inventory) {
+	var snapshot model.StockSnapshot
+	s.get(t, fmt.Sprintf("/products/%s/stock", inventory.ProductID), &snapshot)
+	if snapshot.QtyInStore != inventory.QtyInStore || snapshot.QtyReserved != inventory.QtyReserved ||
+		snapshot.QtyHeld != inventory.QtyHeld || snapshot.QtyAvailable != inventory.QtyAvailable {
+		t.Errorf("stock rebuilt from movements %+v does not match the inventory %+v", snapshot, inventory)
+	}
+}
+
+// inventoryOf resolves the only inventory of a product
+func (s *store) inventoryOf(t testing.TB, productID uuid.UUID) model.Inventory {
+	inventories, err := s.Inventory.ResolveByProductIDs([]uuid.UUID{productID})
+	if err != nil || len(inventories) != 1 {
+		t.Fatalf("failed to resolve the inventory of %s: %v", productID, err)
+	}
+	return inventories[0]
+}
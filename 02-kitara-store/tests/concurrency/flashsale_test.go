@@ -0,0 +1,86 @@
+package concurrency
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const flashSaleStock = 100
+
+// BenchmarkFlashSale compares a sale of flashSaleStock units hit by b.N orders processed through OrderImpl.Process,
+// once with every order reaching the reservation transaction and once with the product behind the stock gate,
+// which turns orders away in memory once it has sold out
+func BenchmarkFlashSale(b *testing.B) {
+
+	b.Run("withoutGate", func(b *testing.B) {
+		benchmarkFlashSale(b, false)
+	})
+
+	b.Run("withGate", func(b *testing.B) {
+		benchmarkFlashSale(b, true)
+	})
+
+}
+
+func benchmarkFlashSale(b *testing.B, gated bool) {
+	productID, _ := uuid.NewV4()
+	conf := config.Get()
+	productIDs, strategy := conf.FlashSale.ProductIDs, conf.Order.ProcessStrategy
+	conf.FlashSale.ProductIDs, conf.Order.ProcessStrategy = nil, config.ProcessStrategyRowLock
+	if gated {
+		conf.FlashSale.ProductIDs = []string{productID.String()}
+	}
+	b.Cleanup(func() {
+		conf.FlashSale.ProductIDs, conf.Order.ProcessStrategy = productIDs, strategy
+	})
+
+	s := startStore(b)
+	products := s.service("productService").(service.Product)
+	inventory := s.service("inventoryService").(service.Inventory)
+	orders := s.service("orderService").(service.Order)
+
+	if _, err := products.Create(model.ProductInput{ID: productID, SKU: "BENCH-FLASH", Name: "Flash Sale Product", Price: model.NewMoney(1000, "IDR")}); err != nil {
+		b.Fatalf("failed to create the product: %v", err)
+	}
+	if _, err := inventory.Restock(productID, model.InventoryRestockInput{Qty: flashSaleStock}); err != nil {
+		b.Fatalf("failed to restock the product: %v", err)
+	}
+	s.service("stockGate").(service.StockGate).Resync()
+
+	orderIDs := make([]uuid.UUID, b.N)
+	for idx := range orderIDs {
+		order, err := orders.Create(model.OrderInput{Items: []model.OrderItemInput{{ProductID: productID, Qty: 1}}})
+		if err != nil {
+			b.Fatalf("failed to create an order: %v", err)
+		}
+		orderIDs[idx] = order.ID
+	}
+
+	var next, processed int64 = -1, 0
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			orderID := orderIDs[atomic.AddInt64(&next, 1)]
+			_, err := orders.Process(model.OrderProcessInput{OrderID: orderID})
+			if err == nil {
+				atomic.AddInt64(&processed, 1)
+				continue
+			}
+			if code := failure.GetCode(err); code != failure.CodeSoldOut && code != failure.CodeInsufficientStock {
+				b.Errorf("processing order %s failed: %v", orderID, err)
+			}
+		}
+	})
+	b.StopTimer()
+
+	reserved := s.inventoryOf(b, productID).QtyReserved
+	if int64(reserved) != processed || reserved > flashSaleStock {
+		b.Errorf("%d orders were processed but %d units are reserved out of %d", processed, reserved, flashSaleStock)
+	}
+}
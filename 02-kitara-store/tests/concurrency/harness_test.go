@@ -0,0 +1,166 @@
+package concurrency
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/inject"
+	"github.com/kerti/evm/02-kitara-store/registry"
+)
+
+// databaseLatency is the simulated round trip of every Order and Inventory repository call, which gives concurrent
+// requests the chance to interleave between reading and writing the same rows
+const databaseLatency = 200 * time.Microsecond
+
+func TestMain(m *testing.M) {
+	os.Setenv("OUTBOX_SINK", "memory")
+	os.Setenv("RESERVATION_SWEEP_ENABLED", "false")
+	os.Setenv("CART_HOLD_SWEEP_ENABLED", "false")
+	os.Setenv("PAYMENT_SWEEP_ENABLED", "false")
+	os.Exit(m.Run())
+}
+
+// forEachStrategy runs test once with every order processing strategy, as a subtest named after it. The strategy in
+// the configuration is restored when the test ends.
+func forEachStrategy(t *testing.T, test func(t *testing.T)) {
+	conf := config.Get()
+	strategy := conf.Order.ProcessStrategy
+	t.Cleanup(func() {
+		conf.Order.ProcessStrategy = strategy
+	})
+
+	strategies := []string{config.ProcessStrategyMutex, config.ProcessStrategyRowLock, config.ProcessStrategyOptimistic}
+	for _, strategy := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			conf.Order.ProcessStrategy = strategy
+			test(t)
+		})
+	}
+}
+
+// store is a complete Kitara Store running in-process on in-memory repositories
+type store struct {
+	*registry.MemoryRepositories
+	URL        string
+	container  inject.ServiceContainer
+	httpServer *httptest.Server
+	httpClient *http.Client
+}
+
+// startStore registers the same services as main, on in-memory repositories, and serves the real router with
+// httptest. Everything is shut down when the test ends.
+func startStore(t testing.TB) *store {
+	s := &store{
+		MemoryRepositories: registry.NewMemoryRepositories(),
+		container:          inject.NewContainer(),
+		httpClient:         &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 100}},
+	}
+
+	s.Carts.Latency = databaseLatency
+	s.Inventory.Latency = databaseLatency
+	s.Orders.Latency = databaseLatency
+	s.Purchases.Latency = databaseLatency
+
+	s.MemoryRepositories.Register(s.container)
+	srv := registry.RegisterApplication(s.container)
+
+	if err := s.container.Ready(); err != nil {
+		t.Fatalf("failed to populate services: %v", err)
+	}
+
+	s.httpServer = httptest.NewServer(srv.Handler())
+	s.URL = s.httpServer.URL
+	t.Cleanup(func() {
+		s.httpServer.Close()
+		s.container.Shutdown()
+	})
+
+	return s
+}
+
+// service resolves a service registered with the store, for tests that drive it without going through HTTP
+func (s *store) service(id string) interface{} {
+	svc, _ := s.container.GetService(id)
+	return svc
+}
+
+// post sends a JSON request to the store and decodes the data of the response into result, if it is not nil.
+// It returns the status code of the response.
+func (s *store) post(t *testing.T, path string, payload interface{}, result interface{}) int {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal request to %s: %v", path, err)
+	}
+
+	resp, err := s.httpClient.Post(s.URL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Errorf("request to %s failed: %v", path, err)
+		return 0
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(t, path, resp, result)
+}
+
+// get sends a GET request to the store and decodes the data of the response into result, if it is not nil.
+// It returns the status code of the response.
+func (s *store) get(t *testing.T, path string, result interface{}) int {
+	resp, err := s.httpClient.Get(s.URL + path)
+	if err != nil {
+		t.Errorf("request to %s failed: %v", path, err)
+		return 0
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(t, path, resp, result)
+}
+
+// delete sends a DELETE request to the store and decodes the data of the response into result, if it is not nil.
+// It returns the status code of the response.
+func (s *store) delete(t *testing.T, path string, result interface{}) int {
+	req, err := http.NewRequest(http.MethodDelete, s.URL+path, nil)
+	if err != nil {
+		t.Fatalf("failed to build request to %s: %v", path, err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		t.Errorf("request to %s failed: %v", path, err)
+		return 0
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(t, path, resp, result)
+}
+
+// decodeResponse decodes the data of a response into result, if it is not nil, and returns its status code
+func decodeResponse(t *testing.T, path string, resp *http.Response, result interface{}) int {
+	if result != nil {
+		envelope := struct {
+			Data interface{} `json:"data"`
+		}{Data: result}
+		if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+			t.Errorf("failed to decode response from %s: %v", path, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// mustPost is post for requests that seed the store and must succeed
+func (s *store) mustPost(t *testing.T, path string, payload interface{}, result interface{}) {
+	if code := s.post(t, path, payload, result); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("seeding request to %s failed with status %d", path, code)
+	}
+}
+
+func restockPath(productID fmt.Stringer) string {
+	return fmt.Sprintf("/inventory/%s/restock", productID)
+}
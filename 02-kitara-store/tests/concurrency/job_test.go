@@ -0,0 +1,218 @@
+package concurrency
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/util/failure"
+)
+
+const (
+	asyncProductCount = 6
+	asyncOrderCount   = 60
+	jobPollInterval   = 5 * time.Millisecond
+	jobWaitTimeout    = 10 * time.Second
+)
+
+func TestAsyncOrderProcessing(t *testing.T) {
+
+	forEachStrategy(t, func(t *testing.T) {
+		enableAsyncProcessing(t)
+		testAsyncOrderProcessing(t)
+	})
+
+}
+
+func testAsyncOrderProcessing(t *testing.T) {
+	s := startStore(t)
+
+	// Stock every product well below what the orders ask for in total
+	productIDs := make([]uuid.UUID, 0)
+	for idx := 0; idx < asyncProductCount; idx++ {
+		var product model.Product
+		s.mustPost(t, "/products", model.ProductInput{SKU: fmt.Sprintf("HARNESS-%03d", idx), Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &product)
+		s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: 10}, nil)
+		productIDs = append(productIDs, product.ID)
+	}
+
+	orderIDs := make([]uuid.UUID, 0)
+	for idx := 0; idx < asyncOrderCount; idx++ {
+		input := model.OrderInput{Items: []model.OrderItemInput{{ProductID: productIDs[idx%asyncProductCount], Qty: 1 + idx%2}}}
+		var order model.Order
+		s.mustPost(t, "/orders", input, &order)
+		orderIDs = append(orderIDs, order.ID)
+	}
+
+	// Queue every order twice, all at once
+	jobIDs := make([]uuid.UUID, 2*len(orderIDs))
+	var wg sync.WaitGroup
+	for idx := range jobIDs {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			var job model.Job
+			if status := s.post(t, "/orders/process", model.OrderProcessInput{OrderID: orderIDs[idx/2]}, &job); status != http.StatusAccepted {
+				t.Errorf("queueing order %s returned status %d", orderIDs[idx/2], status)
+			}
+			jobIDs[idx] = job.ID
+		}(idx)
+	}
+	wg.Wait()
+
+	if status := s.post(t, "/orders/process", model.OrderProcessInput{OrderID: uuid.Must(uuid.NewV4())}, nil); status != http.StatusNotFound {
+		t.Errorf("queueing an unknown order returned status %d", status)
+	}
+	if status := s.get(t, fmt.Sprintf("/jobs/%s", uuid.Must(uuid.NewV4())), nil); status != http.StatusNotFound {
+		t.Errorf("resolving an unknown job returned status %d", status)
+	}
+
+	// Every job ends up succeeded or failed, and each order is processed by exactly one of its jobs at most
+	succeeded := make(map[uuid.UUID]int)
+	for idx, jobID := range jobIDs {
+		job := s.waitForJob(t, jobID)
+		if job.OrderID != orderIDs[idx/2] {
+			t.Errorf("job %s is for order %s instead of %s", jobID, job.OrderID, orderIDs[idx/2])
+		}
+
+		switch job.Status {
+		case model.JobStatusSucceeded:
+			succeeded[job.OrderID]++
+			var order model.Order
+			if err := json.Unmarshal(job.Result, &order); err != nil || order.Status != model.OrderStatusProcessing {
+				t.Errorf("job %s succeeded with result %s", jobID, job.Result)
+			}
+		case model.JobStatusFailed:
+			var f failure.Failure
+			if err := json.Unmarshal(job.Failure, &f); err != nil || f.Code == failure.CodeInternalError {
+				t.Errorf("job %s failed with %s", jobID, job.Failure)
+			}
+		}
+	}
+
+	reservedByOrders := make(map[uuid.UUID]int)
+	processed := 0
+	for _, orderID := range orderIDs {
+		order, err := s.Orders.ResolveByID(orderID)
+		if err != nil {
+			t.Fatalf("failed to resolve order %s: %v", orderID, err)
+		}
+
+		isProcessing := order.Status == model.OrderStatusProcessing
+		if succeeded[orderID] > 1 || isProcessing != (succeeded[orderID] == 1) {
+			t.Errorf("order %s is %s after %d succeeded jobs", orderID, order.Status, succeeded[orderID])
+		}
+
+		if isProcessing {
+			processed++
+			for productID, qty := range order.QtyByProduct() {
+				reservedByOrders[productID] += qty
+			}
+		}
+	}
+	t.Logf("%d of %d orders processed from %d jobs", processed, asyncOrderCount, len(jobIDs))
+	if processed == 0 {
+		t.Errorf("no order was processed")
+	}
+
+	// What is reserved is exactly what the processing orders hold
+	inventories, err := s.Inventory.ResolveByProductIDs(productIDs)
+	if err != nil {
+		t.Fatalf("failed to resolve inventories: %v", err)
+	}
+
+	reservedInStock := make(map[uuid.UUID]int)
+	for _, inventory := range inventories {
+		if inventory.QtyAvailable < 0 {
+			t.Errorf("inventory %s went negative: %+v", inventory.ID, inventory)
+		}
+		reservedInStock[inventory.ProductID] += inventory.QtyReserved
+	}
+
+	for _, productID := range productIDs {
+		if reservedInStock[productID] != reservedByOrders[productID] {
+			t.Errorf("product %s has %d reserved but processing orders hold %d", productID, reservedInStock[productID], reservedByOrders[productID])
+		}
+	}
+}
+
+func TestAsyncJobRecovery(t *testing.T) {
+	enableAsyncProcessing(t)
+	s := startStore(t)
+
+	var product model.Product
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-RECOVERY", Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &product)
+	s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: 10}, nil)
+
+	orders := make([]model.Order, 3)
+	for idx := range orders {
+		s.mustPost(t, "/orders", model.OrderInput{Items: []model.OrderItemInput{{ProductID: product.ID, Qty: 1}}}, &orders[idx])
+	}
+
+	// Jobs left behind as if by an earlier run of the store: one claimed by a worker that stopped before
+	// acknowledging it, one never claimed, and one still leased to a worker elsewhere
+	now := time.Now()
+	abandoned := model.NewProcessOrderJob(orders[0])
+	abandoned.Claim(now.Add(-2*time.Minute), now.Add(-time.Minute))
+	queued := model.NewProcessOrderJob(orders[1])
+	leased := model.NewProcessOrderJob(orders[2])
+	leased.Claim(now, now.Add(time.Hour))
+	for _, job := range []model.Job{abandoned, queued, leased} {
+		s.Jobs.Add(job)
+	}
+
+	for _, job := range []model.Job{abandoned, queued} {
+		resolved := s.waitForJob(t, job.ID)
+		if resolved.Status != model.JobStatusSucceeded {
+			t.Errorf("job %s is %s with failure %s", job.ID, resolved.Status, resolved.Failure)
+		}
+		if resolved.Attempts != job.Attempts+1 {
+			t.Errorf("job %s took %d attempts, expected %d", job.ID, resolved.Attempts, job.Attempts+1)
+		}
+	}
+
+	time.Sleep(10 * jobPollInterval)
+	var resolved model.Job
+	s.get(t, fmt.Sprintf("/jobs/%s", leased.ID), &resolved)
+	if resolved.Status != model.JobStatusRunning || resolved.Attempts != 1 {
+		t.Errorf("leased job was claimed again: %+v", resolved)
+	}
+}
+
+// enableAsyncProcessing processes orders asynchronously, polling for jobs often, until the test ends
+func enableAsyncProcessing(t *testing.T) {
+	conf := config.Get()
+	conf.Order.ProcessAsync = true
+	pollInterval := conf.Job.PollInterval
+	conf.Job.PollInterval = jobPollInterval
+	t.Cleanup(func() {
+		conf.Order.ProcessAsync = false
+		conf.Job.PollInterval = pollInterval
+	})
+}
+
+// waitForJob polls a job until it has succeeded or failed
+func (s *store) waitForJob(t *testing.T, id uuid.UUID) model.Job {
+	deadline := time.Now().Add(jobWaitTimeout)
+	for {
+		var job model.Job
+		if status := s.get(t, fmt.Sprintf("/jobs/%s", id), &job); status != http.StatusOK {
+			t.Fatalf("resolving job %s returned status %d", id, status)
+		}
+
+		if job.Status == model.JobStatusSucceeded || job.Status == model.JobStatusFailed {
+			return job
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still %s after %v", id, job.Status, jobWaitTimeout)
+		}
+		time.Sleep(jobPollInterval)
+	}
+}
@@ -0,0 +1,223 @@
+package concurrency
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/model"
+)
+
+const (
+	productCount     = 8
+	orderCount       = 120
+	attemptsPerOrder = 3
+)
+
+func TestConcurrentOrderProcessing(t *testing.T) {
+
+	forEachStrategy(t, testConcurrentOrderProcessing)
+
+}
+
+func testConcurrentOrderProcessing(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("random seed %d", seed)
+	random := rand.New(rand.NewSource(seed))
+
+	s := startStore(t)
+	secondary := model.Warehouse{ID: uuid.Must(uuid.NewV4()), Code: "SECONDARY", Name: "Secondary Warehouse", Priority: 1}
+	s.Warehouses.Add(secondary)
+
+	// Stock every product in both warehouses, well below what the orders ask for in total
+	productIDs := make([]uuid.UUID, 0)
+	for idx := 0; idx < productCount; idx++ {
+		var product model.Product
+		s.mustPost(t, "/products", model.ProductInput{SKU: fmt.Sprintf("HARNESS-%03d", idx), Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &product)
+		s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: 1 + random.Intn(20)}, nil)
+		s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{WarehouseID: secondary.ID, Qty: 1 + random.Intn(10)}, nil)
+		productIDs = append(productIDs, product.ID)
+	}
+
+	orderIDs := make([]uuid.UUID, 0)
+	for idx := 0; idx < orderCount; idx++ {
+		input := model.OrderInput{}
+		for _, productIdx := range random.Perm(productCount)[:1+random.Intn(3)] {
+			input.Items = append(input.Items, model.OrderItemInput{ProductID: productIDs[productIdx], Qty: 1 + random.Intn(3)})
+		}
+
+		var order model.Order
+		s.mustPost(t, "/orders", input, &order)
+		orderIDs = append(orderIDs, order.ID)
+	}
+
+	// Process every order several times, all at once and in random order
+	requests := make([]uuid.UUID, 0)
+	for _, orderID := range orderIDs {
+		for attempt := 0; attempt < attemptsPerOrder; attempt++ {
+			requests = append(requests, orderID)
+		}
+	}
+	random.Shuffle(len(requests), func(i, j int) {
+		requests[i], requests[j] = requests[j], requests[i]
+	})
+
+	start := make(chan struct{})
+	statuses := make([]int, len(requests))
+	var wg sync.WaitGroup
+	for idx, orderID := range requests {
+		wg.Add(1)
+		go func(idx int, orderID uuid.UUID) {
+			defer wg.Done()
+			<-start
+			statuses[idx] = s.post(t, "/orders/process", model.OrderProcessInput{OrderID: orderID}, nil)
+		}(idx, orderID)
+	}
+	close(start)
+	wg.Wait()
+
+	processedCount := make(map[uuid.UUID]int)
+	for idx, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			processedCount[requests[idx]]++
+		case http.StatusConflict:
+			// not enough stock, already processed, or too many version conflicts
+		default:
+			t.Errorf("unexpected status %d processing order %s", status, requests[idx])
+		}
+	}
+
+	// Each order is processed at most once, and exactly when a request said so
+	reservedByOrders := make(map[uuid.UUID]int)
+	processed := 0
+	for _, orderID := range orderIDs {
+		order, err := s.Orders.ResolveByID(orderID)
+		if err != nil {
+			t.Fatalf("failed to resolve order %s: %v", orderID, err)
+		}
+
+		if processedCount[orderID] > 1 {
+			t.Errorf("order %s was processed %d times", orderID, processedCount[orderID])
+		}
+
+		isProcessing := order.Status == model.OrderStatusProcessing
+		if isProcessing != (processedCount[orderID] == 1) {
+			t.Errorf("order %s is %s after %d successful requests", orderID, order.Status, processedCount[orderID])
+		}
+
+		if !isProcessing {
+			if len(order.Allocations) > 0 {
+				t.Errorf("order %s is %s but has allocations", orderID, order.Status)
+			}
+			continue
+		}
+
+		processed++
+		allocatedMap := make(map[uuid.UUID]int)
+		for _, allocation := range order.Allocations {
+			allocatedMap[allocation.ProductID] += allocation.Qty
+		}
+		for productID, qty := range order.QtyByProduct() {
+			if allocatedMap[productID] != qty {
+				t.Errorf("order %s has %d of product %s allocated for %d ordered", orderID, allocatedMap[productID], productID, qty)
+			}
+			reservedByOrders[productID] += qty
+		}
+	}
+	t.Logf("%d of %d orders processed from %d requests", processed, orderCount, len(requests))
+	if processed == 0 {
+		t.Errorf("no order was processed")
+	}
+
+	// No availability goes negative, and what is reserved is exactly what the processing orders hold
+	inventories, err := s.Inventory.ResolveByProductIDs(productIDs)
+	if err != nil {
+		t.Fatalf("failed to resolve inventories: %v", err)
+	}
+
+	reservedInStock := make(map[uuid.UUID]int)
+	inventoryMap := make(map[uuid.UUID]model.Inventory)
+	for _, inventory := range inventories {
+		if inventory.QtyAvailable < 0 || inventory.QtyReserved < 0 {
+			t.Errorf("inventory %s went negative: %+v", inventory.ID, inventory)
+		}
+		if inventory.QtyAvailable != inventory.QtyInStore-inventory.QtyReserved-inventory.QtyHeld {
+			t.Errorf("inventory %s does not add up: %+v", inventory.ID, inventory)
+		}
+		reservedInStock[inventory.ProductID] += inventory.QtyReserved
+		inventoryMap[inventory.ID] = inventory
+	}
+
+	for _, productID := range productIDs {
+		if reservedInStock[productID] != reservedByOrders[productID] {
+			t.Errorf("product %s has %d reserved but processing orders hold %d", productID, reservedInStock[productID], reservedByOrders[productID])
+		}
+
+		// The movement ledger tells the same story as the inventory
+		levels, err := s.Movements.ResolveStockLevels(productID, time.Now())
+		if err != nil {
+			t.Fatalf("failed to resolve stock levels: %v", err)
+		}
+		for _, level := range levels {
+			inventory := inventoryMap[level.InventoryID]
+			if level.QtyInStore != inventory.QtyInStore || level.QtyReserved != inventory.QtyReserved {
+				t.Errorf("movements of inventory %s add up to %+v, not %+v", level.InventoryID, level, inventory)
+			}
+		}
+	}
+}
+
+func TestOrderBatchResults(t *testing.T) {
+	s := startStore(t)
+
+	var stocked, unstocked model.Product
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-BATCH-1", Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &stocked)
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-BATCH-2", Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &unstocked)
+	s.mustPost(t, restockPath(stocked.ID), model.InventoryRestockInput{Qty: 10}, nil)
+
+	newOrder := func(productID uuid.UUID) uuid.UUID {
+		var order model.Order
+		s.mustPost(t, "/orders", model.OrderInput{Items: []model.OrderItemInput{{ProductID: productID, Qty: 1}}}, &order)
+		return order.ID
+	}
+
+	processed := newOrder(stocked.ID)
+	s.mustPost(t, "/orders/process", model.OrderProcessInput{OrderID: processed}, nil)
+	missing := uuid.Must(uuid.NewV4())
+	short := newOrder(unstocked.ID)
+
+	cases := []struct {
+		mode     string
+		orderIDs []uuid.UUID
+		expected []string
+	}{
+		{model.OrderBatchModeBestEffort, []uuid.UUID{missing, processed, short, newOrder(stocked.ID)}, []string{
+			model.OrderBatchStatusNotFound, model.OrderBatchStatusNotNew, model.OrderBatchStatusInsufficientStock, model.OrderBatchStatusProcessed,
+		}},
+		{model.OrderBatchModeAllOrNothing, []uuid.UUID{newOrder(stocked.ID), missing}, []string{
+			model.OrderBatchStatusRolledBack, model.OrderBatchStatusNotFound,
+		}},
+		{model.OrderBatchModeAllOrNothing, []uuid.UUID{processed, newOrder(stocked.ID)}, []string{
+			model.OrderBatchStatusNotNew, model.OrderBatchStatusRolledBack,
+		}},
+	}
+
+	for _, c := range cases {
+		var response model.OrderBatchResponse
+		s.mustPost(t, "/orders/process/batch", model.OrderBatchProcessInput{OrderIDs: c.orderIDs, Mode: c.mode}, &response)
+		if len(response.Results) != len(c.expected) {
+			t.Fatalf("%s batch returned %+v", c.mode, response.Results)
+		}
+
+		for idx, result := range response.Results {
+			if result.Status != c.expected[idx] || (result.Status != model.OrderBatchStatusRolledBack && result.Status != model.OrderBatchStatusProcessed && result.Error == "") {
+				t.Errorf("%s batch reported %+v for order %d instead of %s", c.mode, result, idx, c.expected[idx])
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package concurrency
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+	"github.com/kerti/evm/02-kitara-store/service"
+)
+
+const (
+	paidStock        = 10
+	declinedOrders   = 3
+	approvedOrders   = 2
+	webhookDuplicate = 2
+	gatewayTimeout   = 100 * time.Millisecond
+	gatewayDelay     = 300 * time.Millisecond
+	paymentWaitTime  = 5 * time.Second
+)
+
+func TestConcurrentPayments(t *testing.T) {
+
+	forEachStrategy(t, testConcurrentPayments)
+
+}
+
+func testConcurrentPayments(t *testing.T) {
+	gateway := service.NewMockPaymentGateway(service.MockGatewayDecline, gatewayDelay, webhookDuplicate)
+	gatewayServer := httptest.NewServer(gateway)
+	t.Cleanup(gatewayServer.Close)
+
+	conf := config.Get()
+	gatewayURL, timeout := conf.Payment.GatewayURL, conf.Payment.GatewayTimeout
+	conf.Payment.GatewayURL, conf.Payment.GatewayTimeout = gatewayServer.URL, gatewayTimeout
+	t.Cleanup(func() {
+		conf.Payment.GatewayURL, conf.Payment.GatewayTimeout = gatewayURL, timeout
+	})
+
+	s := startStore(t)
+	gateway.SetCallbackURL(s.URL + "/payments/webhook")
+	t.Cleanup(gateway.Wait)
+
+	var product model.Product
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-PAY", Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &product)
+	s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: paidStock}, nil)
+
+	orderIDs := make([]uuid.UUID, declinedOrders+approvedOrders+2)
+	for idx := range orderIDs {
+		var order model.Order
+		s.mustPost(t, "/orders", model.OrderInput{Items: []model.OrderItemInput{{ProductID: product.ID, Qty: 1}}}, &order)
+		s.mustPost(t, "/orders/process", model.OrderProcessInput{OrderID: order.ID}, nil)
+		orderIDs[idx] = order.ID
+	}
+
+	var unpaid model.Order
+	s.mustPost(t, "/orders", model.OrderInput{Items: []model.OrderItemInput{{ProductID: product.ID, Qty: 1}}}, &unpaid)
+	if status := s.post(t, fmt.Sprintf("/orders/%s/pay", unpaid.ID), nil, nil); status != http.StatusConflict {
+		t.Errorf("paying a new order returned status %d", status)
+	}
+
+	// Every declined order is paid twice at once, and its webhook is delivered several times on top. Only one
+	// payment is charged, and its reservation is released exactly once.
+	declined := s.payConcurrently(t, orderIDs[:declinedOrders], model.PaymentStatusFailed)
+	gateway.Wait()
+	for _, payment := range declined {
+		s.expectOrderStatus(t, payment.OrderID, model.OrderStatusPaymentFailed)
+	}
+	if inventory := s.inventoryOf(t, product.ID); inventory.QtyReserved != len(orderIDs)-declinedOrders {
+		t.Errorf("declined payments did not release their reservations exactly once: %+v", inventory)
+	}
+
+	// Approved orders are paid and may then be completed
+	gateway.SetBehaviour(service.MockGatewayApprove)
+	approved := s.payConcurrently(t, orderIDs[declinedOrders:declinedOrders+approvedOrders], model.PaymentStatusSucceeded)
+	gateway.Wait()
+	for _, payment := range approved {
+		s.expectOrderStatus(t, payment.OrderID, model.OrderStatusPaid)
+	}
+	if status := s.post(t, fmt.Sprintf("/orders/%s/complete", approved[0].OrderID), nil, nil); status != http.StatusOK {
+		t.Errorf("completing a paid order returned status %d", status)
+	}
+
+	// A webhook contradicting a settled payment is rejected
+	contradiction := model.PaymentCharge{ID: approved[1].ChargeID, Reference: approved[1].ID, Amount: approved[1].Amount, Status: model.ChargeStatusDeclined}
+	if status := s.post(t, "/payments/webhook", contradiction, nil); status != http.StatusConflict {
+		t.Errorf("contradicting webhook returned status %d", status)
+	}
+	s.expectOrderStatus(t, approved[1].OrderID, model.OrderStatusPaid)
+
+	// A charge the gateway answers too late is left pending and settled by its webhook
+	gateway.SetBehaviour(service.MockGatewayTimeout)
+	pending := s.payPending(t, orderIDs[len(orderIDs)-2])
+	s.awaitPaymentStatus(t, pending.ID, model.PaymentStatusSucceeded)
+	s.expectOrderStatus(t, pending.OrderID, model.OrderStatusPaid)
+
+	// A charge that goes through after its order was cancelled is refunded, and the order stays cancelled
+	cancelled := s.payPending(t, orderIDs[len(orderIDs)-1])
+	s.mustPost(t, fmt.Sprintf("/orders/%s/cancel", cancelled.OrderID), nil, nil)
+	refunded := s.awaitPaymentStatus(t, cancelled.ID, model.PaymentStatusRefunded)
+	if refund, ok := gateway.Refunds()[cancelled.ID]; !ok || refund.ID != refunded.RefundID || refund.ChargeID != refunded.ChargeID {
+		t.Errorf("payment %+v was not refunded by the gateway: %+v", refunded, refund)
+	}
+	s.expectOrderStatus(t, cancelled.OrderID, model.OrderStatusCancelled)
+
+	inventory := s.inventoryOf(t, product.ID)
+	if inventory.QtyInStore != paidStock-1 || inventory.QtyReserved != len(orderIDs)-declinedOrders-2 {
+		t.Errorf("payments left the inventory at %+v", inventory)
+	}
+}
+
+func TestPaymentSweeper(t *testing.T) {
+
+	forEachStrategy(t, testPaymentSweeper)
+
+}
+
+func testPaymentSweeper(t *testing.T) {
+	// The gateway never calls back, so payments it answers too late are only settled by the sweeper
+	gateway := service.NewMockPaymentGateway(service.MockGatewayTimeout, gatewayDelay, 0)
+	gatewayServer := httptest.NewServer(gateway)
+	t.Cleanup(gatewayServer.Close)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	conf := config.Get()
+	gatewayURL, timeout, pendingTimeout := conf.Payment.GatewayURL, conf.Payment.GatewayTimeout, conf.Payment.PendingTimeout
+	conf.Payment.GatewayURL, conf.Payment.GatewayTimeout, conf.Payment.PendingTimeout = gatewayServer.URL, gatewayTimeout, 0
+	t.Cleanup(func() {
+		conf.Payment.GatewayURL, conf.Payment.GatewayTimeout, conf.Payment.PendingTimeout = gatewayURL, timeout, pendingTimeout
+	})
+
+	s := startStore(t)
+	payments := s.service("paymentService").(*service.PaymentImpl)
+	sweeper := s.service("paymentSweeper").(service.PaymentSweeper)
+
+	var product model.Product
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-SWEEP", Name: "Harness Product", Price: model.NewMoney(1000, "IDR")}, &product)
+	s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: paidStock}, nil)
+
+	orderIDs := make([]uuid.UUID, 2)
+	for idx := range orderIDs {
+		var order model.Order
+		s.mustPost(t, "/orders", model.OrderInput{Items: []model.OrderItemInput{{ProductID: product.ID, Qty: 1}}}, &order)
+		s.mustPost(t, "/orders/process", model.OrderProcessInput{OrderID: order.ID}, nil)
+		orderIDs[idx] = order.ID
+	}
+
+	charged := s.payPending(t, orderIDs[0])
+
+	// A charge that never reaches the gateway leaves its payment pending too
+	payments.Gateway = service.NewHTTPPaymentGateway(unreachable.URL, gatewayTimeout)
+	lost := s.payPending(t, orderIDs[1])
+	payments.Gateway = service.NewHTTPPaymentGateway(gatewayServer.URL, gatewayTimeout)
+
+	// A webhook for a charge the gateway never made is rejected without settling the payment
+	forged := model.PaymentCharge{ID: "ch_forged", Reference: lost.ID, Amount: lost.Amount, Status: model.ChargeStatusSucceeded}
+	if status := s.post(t, "/payments/webhook", forged, nil); status != http.StatusNotFound {
+		t.Errorf("forged webhook returned status %d", status)
+	}
+	s.expectOrderStatus(t, lost.OrderID, model.OrderStatusProcessing)
+
+	if reconciled := sweeper.Sweep(); reconciled != 2 {
+		t.Errorf("sweeper reconciled %d payments instead of 2", reconciled)
+	}
+	s.awaitPaymentStatus(t, charged.ID, model.PaymentStatusSucceeded)
+	s.expectOrderStatus(t, charged.OrderID, model.OrderStatusPaid)
+	s.awaitPaymentStatus(t, lost.ID, model.PaymentStatusFailed)
+	s.expectOrderStatus(t, lost.OrderID, model.OrderStatusPaymentFailed)
+
+	if reconciled := sweeper.Sweep(); reconciled != 0 {
+		t.Errorf("sweeping settled payments reconciled %d of them", reconciled)
+	}
+	if inventory := s.inventoryOf(t, product.ID); inventory.QtyReserved != 1 {
+		t.Errorf("sweeping payments left the inventory at %+v", inventory)
+	}
+}
+
+// payPending pays an order through a gateway that answers too late, leaving its payment pending
+func (s *store) payPending(t *testing.T, orderID uuid.UUID) model.Payment {
+	var pending model.Payment
+	if status := s.post(t, fmt.Sprintf("/orders/%s/pay", orderID), nil, &pending); status != http.StatusAccepted || pending.Status != model.PaymentStatusPending {
+		t.Fatalf("paying through a timed out gateway returned status %d with %+v", status, pending)
+	}
+	return pending
+}
+
+// awaitPaymentStatus waits for a payment to reach the expected status and returns it
+func (s *store) awaitPaymentStatus(t *testing.T, paymentID uuid.UUID, expected string) model.Payment {
+	deadline := time.Now().Add(paymentWaitTime)
+	for {
+		var payment model.Payment
+		s.get(t, fmt.Sprintf("/payments/%s", paymentID), &payment)
+		if payment.Status == expected {
+			return payment
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("payment %s is %s instead of %s after %v", paymentID, payment.Status, expected, paymentWaitTime)
+		}
+		time.Sleep(gatewayTimeout)
+	}
+}
+
+// payConcurrently pays every order twice at once and returns the one payment created for each. The payments must be
+// settled with the expected status.
+func (s *store) payConcurrently(t *testing.T, orderIDs []uuid.UUID, expected string) []model.Payment {
+	payments := make([]model.Payment, 0)
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	for _, orderID := range orderIDs {
+		for attempt := 0; attempt < 2; attempt++ {
+			wg.Add(1)
+			go func(orderID uuid.UUID) {
+				defer wg.Done()
+				var payment model.Payment
+				status := s.post(t, fmt.Sprintf("/orders/%s/pay", orderID), nil, &payment)
+				switch status {
+				case http.StatusCreated:
+					if payment.Status != expected {
+						t.Errorf("paying order %s settled %+v", orderID, payment)
+					}
+					mux.Lock()
+					payments = append(payments, payment)
+					mux.Unlock()
+				case http.StatusConflict:
+				default:
+					t.Errorf("paying order %s returned status %d", orderID, status)
+				}
+			}(orderID)
+		}
+	}
+	wg.Wait()
+
+	if len(payments) != len(orderIDs) {
+		t.Errorf("%d payments were created for %d orders", len(payments), len(orderIDs))
+	}
+	return payments
+}
+
+// expectOrderStatus checks the status of an order
+func (s *store) expectOrderStatus(t *testing.T, orderID uuid.UUID, expected string) {
+	var order model.Order
+	s.get(t, fmt.Sprintf("/orders/%s", orderID), &order)
+	if order.Status != expected {
+		t.Errorf("order %s is %s instead of %s", orderID, order.Status, expected)
+	}
+}
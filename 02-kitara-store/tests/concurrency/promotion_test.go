@@ -0,0 +1,95 @@
+package concurrency
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+)
+
+const (
+	voucherCap        = 5
+	voucherOrderCount = 40
+)
+
+func TestConcurrentVoucherRedemption(t *testing.T) {
+
+	forEachStrategy(t, testConcurrentVoucherRedemption)
+
+}
+
+func testConcurrentVoucherRedemption(t *testing.T) {
+	s := startStore(t)
+
+	// Plenty of stock, so that only the voucher's usage cap can turn orders away
+	var product model.Product
+	s.mustPost(t, "/products", model.ProductInput{SKU: "HARNESS-VOUCHER", Name: "Harness Product", Price: model.NewMoney(10000, "IDR")}, &product)
+	s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: 1000}, nil)
+
+	usageCap := voucherCap
+	var voucher model.Promotion
+	s.mustPost(t, "/promotions", model.PromotionInput{
+		Code:       "HARNESS10",
+		Name:       "Harness Voucher",
+		Type:       model.PromotionTypePercentage,
+		PercentOff: 10,
+		UsageCap:   &usageCap,
+	}, &voucher)
+
+	orderIDs := make([]uuid.UUID, 0)
+	for idx := 0; idx < voucherOrderCount; idx++ {
+		var order model.Order
+		s.mustPost(t, "/orders", model.OrderInput{
+			Items:        []model.OrderItemInput{{ProductID: product.ID, Qty: 1}},
+			VoucherCodes: []string{"harness10"},
+		}, &order)
+		if order.TotalPrice != model.NewMoney(9000, "IDR") {
+			t.Fatalf("order was created with total %s instead of the discounted IDR 90.00", order.TotalPrice)
+		}
+		orderIDs = append(orderIDs, order.ID)
+	}
+
+	start := make(chan struct{})
+	statuses := make([]int, len(orderIDs))
+	var wg sync.WaitGroup
+	for idx, orderID := range orderIDs {
+		wg.Add(1)
+		go func(idx int, orderID uuid.UUID) {
+			defer wg.Done()
+			<-start
+			statuses[idx] = s.post(t, "/orders/process", model.OrderProcessInput{OrderID: orderID}, nil)
+		}(idx, orderID)
+	}
+	close(start)
+	wg.Wait()
+
+	processed := 0
+	for idx, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			processed++
+		case http.StatusConflict:
+			// the voucher has been fully redeemed, or too many version conflicts
+		default:
+			t.Errorf("unexpected status %d processing order %s", status, orderIDs[idx])
+		}
+	}
+
+	promotions, err := s.Promotions.ResolveByIDs([]uuid.UUID{voucher.ID})
+	if err != nil || len(promotions) != 1 {
+		t.Fatalf("failed to resolve voucher: %v", err)
+	}
+
+	if processed > voucherCap {
+		t.Errorf("%d orders were processed with a voucher capped at %d uses", processed, voucherCap)
+	}
+	if promotions[0].UsageCount != processed {
+		t.Errorf("voucher counts %d uses but %d orders were processed", promotions[0].UsageCount, processed)
+	}
+	if config.Get().Order.ProcessStrategy != config.ProcessStrategyOptimistic && processed < voucherCap {
+		t.Errorf("only %d orders were processed with a voucher capped at %d uses", processed, voucherCap)
+	}
+}
@@ -0,0 +1,92 @@
+package concurrency
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/kerti/evm/02-kitara-store/config"
+	"github.com/kerti/evm/02-kitara-store/model"
+)
+
+const (
+	purchaseLimit            = 2
+	limitedCustomerCount     = 3
+	ordersPerLimitedCustomer = 12
+)
+
+func TestConcurrentPurchaseLimits(t *testing.T) {
+
+	forEachStrategy(t, testConcurrentPurchaseLimits)
+
+}
+
+func testConcurrentPurchaseLimits(t *testing.T) {
+	s := startStore(t)
+
+	// Plenty of stock, so that only the purchase limit can turn orders away
+	limit := purchaseLimit
+	var product model.Product
+	s.mustPost(t, "/products", model.ProductInput{
+		SKU:           "HARNESS-LIMITED",
+		Name:          "Harness Product",
+		Price:         model.NewMoney(10000, "IDR"),
+		PurchaseLimit: &limit,
+	}, &product)
+	s.mustPost(t, restockPath(product.ID), model.InventoryRestockInput{Qty: 1000}, nil)
+
+	customerRefs := make([]string, 0)
+	orderIDs := make([]uuid.UUID, 0)
+	for customerIdx := 0; customerIdx < limitedCustomerCount; customerIdx++ {
+		customerRef := fmt.Sprintf("CUSTOMER-%d", customerIdx)
+		customerRefs = append(customerRefs, customerRef)
+		for idx := 0; idx < ordersPerLimitedCustomer; idx++ {
+			var order model.Order
+			s.mustPost(t, "/orders", model.OrderInput{
+				CustomerRef: customerRef,
+				Items:       []model.OrderItemInput{{ProductID: product.ID, Qty: 1}},
+			}, &order)
+			orderIDs = append(orderIDs, order.ID)
+		}
+	}
+
+	start := make(chan struct{})
+	statuses := make([]int, len(orderIDs))
+	var wg sync.WaitGroup
+	for idx, orderID := range orderIDs {
+		wg.Add(1)
+		go func(idx int, orderID uuid.UUID) {
+			defer wg.Done()
+			<-start
+			statuses[idx] = s.post(t, "/orders/process", model.OrderProcessInput{OrderID: orderID}, nil)
+		}(idx, orderID)
+	}
+	close(start)
+	wg.Wait()
+
+	for customerIdx, customerRef := range customerRefs {
+		processed := 0
+		for idx := customerIdx * ordersPerLimitedCustomer; idx < (customerIdx+1)*ordersPerLimitedCustomer; idx++ {
+			switch statuses[idx] {
+			case http.StatusOK:
+				processed++
+			case http.StatusConflict:
+				// the customer has reached the purchase limit, or too many version conflicts
+			default:
+				t.Errorf("unexpected status %d processing order %s", statuses[idx], orderIDs[idx])
+			}
+		}
+
+		if processed > purchaseLimit {
+			t.Errorf("customer %s got %d orders processed with a purchase limit of %d", customerRef, processed, purchaseLimit)
+		}
+		if purchased := s.Purchases.ResolveQty(customerRef, product.ID); purchased != processed {
+			t.Errorf("customer %s has %d purchases counted but %d orders were processed", customerRef, purchased, processed)
+		}
+		if config.Get().Order.ProcessStrategy != config.ProcessStrategyOptimistic && processed < purchaseLimit {
+			t.Errorf("customer %s only got %d orders processed with a purchase limit of %d", customerRef, processed, purchaseLimit)
+		}
+	}
+}
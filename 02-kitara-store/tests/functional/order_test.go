@@ -3,6 +3,7 @@ package functional
 import (
 	"encoding/json"
 	"net/http"
+	"os"
 	"strings"
 	"testing"
 
@@ -12,10 +13,29 @@ import (
 )
 
 const (
-	url = "http://localhost:8080/orders/process"
+	defaultBaseURL = "http://localhost:8080"
+	processPath    = "/orders/process"
 )
 
+// baseURLs returns the server instances to test against. Set KITARA_URLS to a comma-separated list of base URLs,
+// e.g. "http://localhost:8080,http://localhost:8081", to spread the requests across several replicas.
+func baseURLs() []string {
+	urls := make([]string, 0)
+	for _, url := range strings.Split(os.Getenv("KITARA_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, strings.TrimRight(url, "/"))
+		}
+	}
+	if len(urls) == 0 {
+		urls = append(urls, defaultBaseURL)
+	}
+	return urls
+}
+
 func TestOrderConcurrency(t *testing.T) {
+	urls := baseURLs()
+	url1 := urls[0] + processPath
+	url2 := urls[1%len(urls)] + processPath
 
 	payload1, _ := json.Marshal(model.OrderProcessInput{
 		OrderID: uuid.FromStringOrNil("5b27773a-efce-4e21-8474-2694ebdaa084"),
@@ -30,15 +50,15 @@ func TestOrderConcurrency(t *testing.T) {
 	resp1 := make(chan *http.Response)
 	resp2 := make(chan *http.Response)
 
-	// Run both requests concurrently
+	// Run both requests concurrently, each against its own instance if more than one is configured
 	go func(t *testing.T) {
-		r1, err := http.Post(url, "application/json", body1)
+		r1, err := http.Post(url1, "application/json", body1)
 		assert.Nil(t, err)
 		resp1 <- r1
 	}(t)
 
 	go func(t *testing.T) {
-		r2, err := http.Post(url, "application/json", body2)
+		r2, err := http.Post(url2, "application/json", body2)
 		assert.Nil(t, err)
 		resp2 <- r2
 	}(t)
@@ -4,8 +4,9 @@ import "fmt"
 
 // Failure is a wrapper for error messages and codes
 type Failure struct {
-	Code    Code   `json:"code"`
-	Message string `json:"message"`
+	Code    Code        `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 // Error returns the error code and message in a formatted string
@@ -67,6 +68,57 @@ func EntityNotFound(entityName string) error {
 	}
 }
 
+// DuplicateEntity returns a new Failure with code for an entity that conflicts with an existing one
+func DuplicateEntity(entityName string, message string) error {
+	return &Failure{
+		Code:    CodeDuplicateEntity,
+		Message: fmt.Sprintf("%s: %s", entityName, message),
+	}
+}
+
+// VersionConflict returns a new Failure with code for an entity that was modified concurrently
+func VersionConflict(entityName string) error {
+	return &Failure{
+		Code:    CodeVersionConflict,
+		Message: fmt.Sprintf("%s was modified by another request", entityName),
+	}
+}
+
+// InsufficientStock returns a new Failure with code for insufficient stock, with details describing the shortage
+func InsufficientStock(message string, details interface{}) error {
+	return &Failure{
+		Code:    CodeInsufficientStock,
+		Message: message,
+		Details: details,
+	}
+}
+
+// SoldOut returns a new Failure with code for a flash-sale Product whose stock has run out
+func SoldOut(message string) error {
+	return &Failure{
+		Code:    CodeSoldOut,
+		Message: message,
+	}
+}
+
+// PurchaseLimitExceeded returns a new Failure with code for purchase limits exceeded, with details describing the
+// violations
+func PurchaseLimitExceeded(message string, details interface{}) error {
+	return &Failure{
+		Code:    CodePurchaseLimitExceeded,
+		Message: message,
+		Details: details,
+	}
+}
+
+// PromotionExhausted returns a new Failure with code for a Promotion that has reached its usage cap
+func PromotionExhausted(message string) error {
+	return &Failure{
+		Code:    CodePromotionExhausted,
+		Message: message,
+	}
+}
+
 // OperationNotPermitted returns a new Failure with code for operation not permitted
 func OperationNotPermitted(operationName string, entityName string, message string) error {
 	return &Failure{
@@ -75,6 +127,14 @@ func OperationNotPermitted(operationName string, entityName string, message stri
 	}
 }
 
+// GetDetails returns the details of an error interface, if any
+func GetDetails(err error) interface{} {
+	if f, ok := err.(*Failure); ok {
+		return f.Details
+	}
+	return nil
+}
+
 // GetCode returns the error code of an error interface
 func GetCode(err error) Code {
 	if f, ok := err.(*Failure); ok {
@@ -97,6 +157,18 @@ var (
 	CodeUnimplemented Code = "Unimplemented"
 	// CodeEntityNotFound is the string code for indicating an entity is not found
 	CodeEntityNotFound Code = "EntityNotFound"
+	// CodeDuplicateEntity is the string code for indicating an entity conflicts with an existing one
+	CodeDuplicateEntity Code = "DuplicateEntity"
+	// CodeVersionConflict is the string code for indicating that an entity was modified concurrently
+	CodeVersionConflict Code = "VersionConflict"
+	// CodeInsufficientStock is the string code for indicating that there is not enough stock to fulfil a request
+	CodeInsufficientStock Code = "InsufficientStock"
+	// CodeSoldOut is the string code for indicating that a flash-sale Product has no stock left
+	CodeSoldOut Code = "SoldOut"
+	// CodePurchaseLimitExceeded is the string code for indicating that a customer may not buy that much of a Product
+	CodePurchaseLimitExceeded Code = "PurchaseLimitExceeded"
+	// CodePromotionExhausted is the string code for indicating that a Promotion has reached its usage cap
+	CodePromotionExhausted Code = "PromotionExhausted"
 	// CodeOperationNotPermitted is the string code for indicating that an operation is not permitted
 	CodeOperationNotPermitted Code = "OperationNotPermitted"
 )